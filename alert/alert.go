@@ -0,0 +1,162 @@
+// Package alert evaluates alerting rules written as RPN conditions, reporting which rules are
+// firing because their conditions have held for long enough.
+//
+// Each Rule names an Expression whose result is true, in the sense of the EvaluateBool method of
+// gorpn.Expression, while the condition holds. An Evaluator is given the bindings of each step of
+// time in turn, and a rule fires once its condition has held at every step for at least its For
+// duration, just as Prometheus does for alerting rules with a "for" clause. A step at which the
+// condition does not hold, including because it evaluates to UNKN, resets the rule.
+//
+//	func example(g *rrdgraph.Graph, when time.Time, values map[string]interface{}) {
+//		exp, err := gorpn.New("busy,busy,idle,+,/,0.9,GT")
+//		if err != nil {
+//			panic(err)
+//		}
+//		evaluator, err := alert.NewEvaluator(alert.Rule{Name: "overloaded", Expr: exp, For: 5 * time.Minute})
+//		if err != nil {
+//			panic(err)
+//		}
+//		states, err := evaluator.Evaluate(when, g.Bindings(values))
+//	}
+package alert
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/karrick/gorpn"
+)
+
+// Rule is an alerting rule, which fires once its condition has held for the For duration.
+type Rule struct {
+	Name string
+	Expr *gorpn.Expression // condition, which holds while its result is true
+	For  time.Duration     // how long the condition must hold before the rule fires, or 0 to fire at once
+}
+
+// State is the state of a Rule after a step has been evaluated.
+type State struct {
+	Name   string
+	Active bool      // whether the condition held at the step
+	Since  time.Time // time of the first step of the run of steps at which the condition held, or zero
+	Firing bool      // whether the condition has held for the For duration of the rule
+}
+
+// Step is the time of a step along with the bindings for evaluating the rules at that step.
+type Step struct {
+	Time     time.Time
+	Bindings map[string]interface{}
+}
+
+// ErrParse is returned when an Evaluator cannot be created from a set of rules.
+type ErrParse struct {
+	Rule    string // name of the rule
+	Message string
+}
+
+// Error returns the error string representation for ErrParse errors.
+func (e ErrParse) Error() string {
+	return fmt.Sprintf("invalid rule %q: %s", e.Rule, e.Message)
+}
+
+// Evaluator evaluates a set of rules at successive steps of time, remembering how long the
+// condition of each rule has held. An Evaluator is not safe for concurrent use, because neither are
+// the expressions of its rules.
+type Evaluator struct {
+	rules  []Rule
+	active []bool      // whether the condition of each rule held at the most recent step
+	since  []time.Time // when the condition of each active rule started holding
+	last   time.Time   // time of the most recently evaluated step
+}
+
+// NewEvaluator returns an Evaluator for rules, which must have distinct names, an Expression, and a
+// For duration that is not negative.
+func NewEvaluator(rules ...Rule) (*Evaluator, error) {
+	names := make(map[string]struct{}, len(rules))
+	for _, rule := range rules {
+		if _, ok := names[rule.Name]; ok {
+			return nil, ErrParse{Rule: rule.Name, Message: "name already used by another rule"}
+		}
+		names[rule.Name] = struct{}{}
+		if rule.Expr == nil {
+			return nil, ErrParse{Rule: rule.Name, Message: "nil expression"}
+		}
+		if rule.For < 0 {
+			return nil, ErrParse{Rule: rule.Name, Message: fmt.Sprintf("negative for duration: %s", rule.For)}
+		}
+	}
+	return &Evaluator{
+		rules:  append([]Rule(nil), rules...),
+		active: make([]bool, len(rules)),
+		since:  make([]time.Time, len(rules)),
+	}, nil
+}
+
+// Evaluate evaluates the condition of each rule using bindings, which is not modified, at the step
+// whose time is when, and returns the state of each rule, in the order the rules were given. Unless
+// bindings already binds TIME, it is bound to when, so that conditions may use TIME and LTIME.
+//
+// It returns an error, without changing the state of any rule, when when precedes the time of the
+// previous step, or when evaluating a condition returns an error, which is a gorpn.ErrExpression
+// naming the rule.
+func (ev *Evaluator) Evaluate(when time.Time, bindings map[string]interface{}) ([]State, error) {
+	if when.Before(ev.last) {
+		return nil, fmt.Errorf("cannot evaluate step at %s before previous step at %s", when, ev.last)
+	}
+	if _, ok := bindings["TIME"]; !ok {
+		withTime := make(map[string]interface{}, len(bindings)+1)
+		for symbol, value := range bindings {
+			withTime[symbol] = value
+		}
+		withTime["TIME"] = when
+		bindings = withTime
+	}
+
+	states := make([]State, len(ev.rules))
+	for i, rule := range ev.rules {
+		active, err := rule.Expr.EvaluateBool(bindings)
+		if err != nil {
+			return nil, gorpn.ErrExpression{Name: rule.Name, Err: err}
+		}
+		states[i] = State{Name: rule.Name, Active: active}
+		if active {
+			states[i].Since = when
+			if ev.active[i] {
+				states[i].Since = ev.since[i]
+			}
+			states[i].Firing = when.Sub(states[i].Since) >= rule.For
+		}
+	}
+
+	for i, state := range states {
+		ev.active[i], ev.since[i] = state.Active, state.Since
+	}
+	ev.last = when
+	return states, nil
+}
+
+// EvaluateSteps evaluates each of steps in turn, just like Evaluate, and returns the state of each
+// rule after the final step. It stops at the first step that returns an error, leaving the state of
+// each rule as it was after the preceding step.
+func (ev *Evaluator) EvaluateSteps(steps []Step) ([]State, error) {
+	var states []State
+	for _, step := range steps {
+		var err error
+		if states, err = ev.Evaluate(step.Time, step.Bindings); err != nil {
+			return nil, err
+		}
+	}
+	return states, nil
+}
+
+// Firing returns the names of the rules whose conditions have held for their For durations as of
+// the most recently evaluated step, in the order the rules were given.
+func (ev *Evaluator) Firing() []string {
+	var names []string
+	for i, rule := range ev.rules {
+		if ev.active[i] && ev.last.Sub(ev.since[i]) >= rule.For {
+			names = append(names, rule.Name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,172 @@
+package alert
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/karrick/gorpn"
+	"github.com/karrick/gorpn/rrdgraph"
+)
+
+var epoch = time.Unix(1500000000, 0)
+
+func mustRule(t *testing.T, name, input string, duration time.Duration) Rule {
+	t.Helper()
+	exp, err := gorpn.New(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Rule{Name: name, Expr: exp, For: duration}
+}
+
+func TestEvaluator(t *testing.T) {
+	evaluator, err := NewEvaluator(
+		mustRule(t, "high", "qps,100,GT", 2*time.Minute),
+		mustRule(t, "now", "qps,100,GT", 0),
+		mustRule(t, "idle", "qps,0,EQ", time.Minute),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := []struct {
+		qps    float64
+		firing []string
+	}{
+		{50, nil},
+		{150, []string{"now"}},
+		{150, []string{"now"}},
+		{150, []string{"high", "now"}},
+		{math.NaN(), nil}, // unknown resets the rules
+		{150, []string{"now"}},
+		{0, nil},
+		{0, []string{"idle"}},
+	}
+	for i, item := range list {
+		when := epoch.Add(time.Duration(i) * time.Minute)
+		states, err := evaluator.Evaluate(when, map[string]interface{}{"qps": item.qps})
+		if err != nil {
+			t.Fatalf("Case: %d; Actual: %#v; Expected: %#v", i, err, nil)
+		}
+		if actual := evaluator.Firing(); !reflect.DeepEqual(actual, item.firing) {
+			t.Errorf("Case: %d; Actual: %#v; Expected: %#v", i, actual, item.firing)
+		}
+		var firing []string
+		for _, state := range states {
+			if state.Firing {
+				firing = append(firing, state.Name)
+			}
+		}
+		if !reflect.DeepEqual(firing, item.firing) {
+			t.Errorf("Case: %d; Actual: %#v; Expected: %#v", i, firing, item.firing)
+		}
+	}
+}
+
+func TestEvaluatorState(t *testing.T) {
+	evaluator, err := NewEvaluator(mustRule(t, "high", "qps,100,GT", 90*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := []Step{
+		{Time: epoch, Bindings: map[string]interface{}{"qps": 150}},
+		{Time: epoch.Add(time.Minute), Bindings: map[string]interface{}{"qps": 150}},
+	}
+	states, err := evaluator.EvaluateSteps(steps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []State{{Name: "high", Active: true, Since: epoch}}
+	if !reflect.DeepEqual(states, expected) {
+		t.Errorf("Actual: %#v; Expected: %#v", states, expected)
+	}
+
+	states, err = evaluator.Evaluate(epoch.Add(2*time.Minute), map[string]interface{}{"qps": 150})
+	expected = []State{{Name: "high", Active: true, Since: epoch, Firing: true}}
+	if err != nil || !reflect.DeepEqual(states, expected) {
+		t.Errorf("Actual: %#v, %#v; Expected: %#v", states, err, expected)
+	}
+}
+
+func TestEvaluatorTime(t *testing.T) {
+	// fires during the second half of each hour
+	evaluator, err := NewEvaluator(mustRule(t, "late", "TIME,3600,%,1800,GE", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hour := time.Unix(1500000000/3600*3600, 0)
+	list := []struct {
+		offset   time.Duration
+		expected bool
+	}{
+		{0, false},
+		{45 * time.Minute, true},
+		{time.Hour, false},
+	}
+	for _, item := range list {
+		offset, expected := item.offset, item.expected
+		states, err := evaluator.Evaluate(hour.Add(offset), nil)
+		if err != nil || states[0].Firing != expected {
+			t.Errorf("Case: %s; Actual: %#v, %#v; Expected: %#v", offset, states, err, expected)
+		}
+	}
+}
+
+func TestEvaluatorGraph(t *testing.T) {
+	g, err := rrdgraph.Parse(strings.NewReader("DEF:busy=host.rrd:busy:AVERAGE DEF:idle=host.rrd:idle:AVERAGE CDEF:load=busy,busy,idle,+,/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	evaluator, err := NewEvaluator(mustRule(t, "overloaded", "load,0.9,GT", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	states, err := evaluator.Evaluate(epoch, g.Bindings(map[string]interface{}{"busy": 95, "idle": 5}))
+	if err != nil || !states[0].Firing {
+		t.Errorf("Actual: %#v, %#v; Expected: %#v", states, err, true)
+	}
+}
+
+func TestEvaluatorErrors(t *testing.T) {
+	evaluator, err := NewEvaluator(mustRule(t, "high", "qps,100,GT", 0), mustRule(t, "other", "other,1,GT", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = evaluator.Evaluate(epoch, map[string]interface{}{"qps": 150, "other": 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = evaluator.Evaluate(epoch.Add(time.Minute), map[string]interface{}{"qps": 50})
+	var errExpression gorpn.ErrExpression
+	if !errors.As(err, &errExpression) || errExpression.Name != "other" {
+		t.Errorf("Actual: %#v; Expected: %#v", err, "gorpn.ErrExpression")
+	}
+	if actual, expected := evaluator.Firing(), []string{"high", "other"}; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected) // state unchanged
+	}
+
+	if _, err = evaluator.Evaluate(epoch.Add(-time.Minute), map[string]interface{}{"qps": 50, "other": 0}); err == nil {
+		t.Errorf("Actual: %#v; Expected: %#v", err, "step before previous step")
+	}
+}
+
+func TestNewEvaluatorErrors(t *testing.T) {
+	rule := mustRule(t, "high", "qps,100,GT", 0)
+	list := map[string]struct {
+		rules    []Rule
+		expected string
+	}{
+		"duplicate": {[]Rule{rule, rule}, "invalid rule \"high\": name already used by another rule"},
+		"nil":       {[]Rule{{Name: "empty"}}, "invalid rule \"empty\": nil expression"},
+		"negative":  {[]Rule{{Name: "early", Expr: rule.Expr, For: -time.Second}}, "invalid rule \"early\": negative for duration: -1s"},
+	}
+	for name, item := range list {
+		_, err := NewEvaluator(item.rules...)
+		if err == nil || err.Error() != item.expected {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, err, item.expected)
+		}
+	}
+}
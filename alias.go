@@ -0,0 +1,176 @@
+package gorpn
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// aliasTable holds the alternative names of operators accepted by an Expression.
+type aliasTable struct {
+	operators map[string]string // operator or reserved word named by each alias
+	names     map[string]string // alias String writes for each operator that has at least one
+}
+
+// aliasTables interns each aliasTable by its contents, so that expressions configured with the same
+// aliases share a configuration, and NewCached finds the expressions compiled with them.
+var aliasTables sync.Map
+
+// Aliases allows an RPN Expression to accept alternative names for its operators and reserved
+// words, so that organizations may standardize on their preferred names, or accept legacy
+// spellings of operators while migrating to others. Each key of aliases is an alternative name for
+// the operator or reserved word that is its value. Just as with operators, a quoted alias is a
+// symbol rather than an operator.
+//
+// By default, String writes each operator that has an alias using that alias, preferring the alias
+// that sorts first when an operator has several, so that expressions read back just as they were
+// written. Use the CanonicalOperators configurator to have String write the names of the operators
+// instead. It returns an error when an alias is empty, is a number, or is already the name of an
+// operator or reserved word, or when an alias names something other than an operator or reserved
+// word. When Aliases is given more than once, the aliases accumulate.
+//
+//	func example() {
+//		exp, err := gorpn.New("a,b,c,3,AVERAGE", gorpn.Aliases(map[string]string{"AVERAGE": "AVG"}))
+//		if err != nil {
+//			panic(err)
+//		}
+//		s := exp.String() // "a,b,c,3,AVERAGE"
+//	}
+func Aliases(aliases map[string]string) ExpressionConfigurator {
+	return func(e *Expression) error {
+		operators := make(map[string]string, len(aliases))
+		if e.aliases != nil {
+			for alias, operator := range e.aliases.operators {
+				operators[alias] = operator
+			}
+		}
+		for alias, operator := range aliases {
+			if alias == "" {
+				return newErrSyntax("cannot use empty alias for %q", operator)
+			}
+			if _, ok := parseNumber(alias); ok {
+				return newErrSyntax("cannot use number as alias: %q", alias)
+			}
+			if _, ok := arity[alias]; ok || reserved[alias] {
+				return newErrSyntax("cannot use operator as alias: %q", alias)
+			}
+			if _, ok := arity[operator]; !ok && !reserved[operator] {
+				return newErrUnknownOperator("cannot alias %q to %q, which is not an operator", alias, operator)
+			}
+			operators[alias] = operator
+		}
+		e.aliases = internAliasTable(operators)
+		return nil
+	}
+}
+
+// CanonicalOperators allows changing the String method of an RPN Expression configured with Aliases
+// to write the name of each operator rather than its alias, so that expressions written using
+// legacy spellings of operators may be rewritten using their standard names.
+//
+//	func example() {
+//		exp, err := gorpn.New("a,b,c,3,MEAN", gorpn.Aliases(map[string]string{"MEAN": "AVG"}), gorpn.CanonicalOperators())
+//		if err != nil {
+//			panic(err)
+//		}
+//		s := exp.String() // "a,b,c,3,AVG"
+//	}
+func CanonicalOperators() ExpressionConfigurator {
+	return func(e *Expression) error {
+		e.canonicalOperators = true
+		return nil
+	}
+}
+
+// CaseInsensitiveOperators allows the operators and reserved words of an RPN Expression, along with
+// their aliases, to be written in any letter case, which is convenient for expressions entered into
+// user facing forms, such as "a,b,c,3,avg". Symbols are left untouched, but a symbol that differs
+// from an operator or reserved word only by letter case, such as "time", must be quoted to remain a
+// symbol. The String method writes operators in upper case.
+//
+//	func example() {
+//		exp, err := gorpn.New("qps,100,gt,1,0,if", gorpn.CaseInsensitiveOperators())
+//		if err != nil {
+//			panic(err)
+//		}
+//		s := exp.String() // "qps,100,GT,1,0,IF"
+//	}
+func CaseInsensitiveOperators() ExpressionConfigurator {
+	return func(e *Expression) error {
+		e.caseInsensitiveOperators = true
+		return nil
+	}
+}
+
+// operatorName returns the operator or reserved word that token names, taking the aliases and
+// letter case sensitivity of the configuration into account, and true, or false when token is a
+// symbol or a number.
+func (c config) operatorName(token string) (string, bool) {
+	if isOperatorName(c.aliases.operator(token)) {
+		return c.aliases.operator(token), true
+	}
+	if c.caseInsensitiveOperators {
+		upper := strings.ToUpper(token)
+		if isOperatorName(c.aliases.operator(upper)) {
+			return c.aliases.operator(upper), true
+		}
+	}
+	return token, false
+}
+
+// isOperatorName returns true when token is an operator or a reserved word.
+func isOperatorName(token string) bool {
+	_, ok := arity[token]
+	return ok || reserved[token]
+}
+
+// internAliasTable returns the aliasTable for operators, creating it the first time these aliases
+// are seen.
+func internAliasTable(operators map[string]string) *aliasTable {
+	keys := make([]string, 0, len(operators))
+	for alias := range operators {
+		keys = append(keys, alias)
+	}
+	sort.Strings(keys)
+
+	var key strings.Builder
+	for _, alias := range keys {
+		key.WriteString(alias)
+		key.WriteByte(0)
+		key.WriteString(operators[alias])
+		key.WriteByte(0)
+	}
+	if table, ok := aliasTables.Load(key.String()); ok {
+		return table.(*aliasTable)
+	}
+
+	table := &aliasTable{operators: operators, names: make(map[string]string, len(operators))}
+	for _, alias := range keys {
+		if _, ok := table.names[operators[alias]]; !ok {
+			table.names[operators[alias]] = alias // keys are sorted, so the first alias wins
+		}
+	}
+	actual, _ := aliasTables.LoadOrStore(key.String(), table)
+	return actual.(*aliasTable)
+}
+
+// operator returns the operator or reserved word token names, which is token itself unless token is
+// an alias.
+func (t *aliasTable) operator(token string) string {
+	if t != nil {
+		if operator, ok := t.operators[token]; ok {
+			return operator
+		}
+	}
+	return token
+}
+
+// name returns the alias String writes for operator, which is operator itself when it has no alias.
+func (t *aliasTable) name(operator string) string {
+	if t != nil {
+		if alias, ok := t.names[operator]; ok {
+			return alias
+		}
+	}
+	return operator
+}
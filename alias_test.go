@@ -0,0 +1,146 @@
+package gorpn
+
+import "testing"
+
+func TestAliases(t *testing.T) {
+	aliases := Aliases(map[string]string{"AVERAGE": "AVG", "MEAN": "AVG", "UNKNOWN": "UNKN", "SWITCH": "IF"})
+	list := map[string]string{
+		"a,b,c,3,AVERAGE":        "a,b,c,3,AVERAGE",
+		"a,b,c,3,MEAN":           "a,b,c,3,AVERAGE", // first alias in sorted order
+		"a,b,c,3,AVG":            "a,b,c,3,AVERAGE",
+		"1,2,3,3,AVERAGE":        "2",
+		"x,UNKNOWN,+":            "x,UNKN,+", // constants are written as numbers
+		"c,a,b,SWITCH":           "c,a,b,SWITCH",
+		"1,a,b,SWITCH":           "a",
+		"'AVERAGE',2,*":          "'AVERAGE',2,*", // quoted alias is a symbol
+		"average,2,*":            "average,2,*",
+		"a,b,+,c,a,b,+,*,MEAN,+": "a,b,+,c,a,b,+,*,AVERAGE,+",
+	}
+	for input, output := range list {
+		exp, err := New(input, aliases)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if actual := exp.String(); actual != output {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, actual, output)
+		}
+	}
+
+	exp, err := New("a,b,c,3,MEAN,'MEAN',+", aliases, CanonicalOperators())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual, expected := exp.String(), "a,b,c,3,AVG,'MEAN',+"; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+	value, err := exp.Evaluate(map[string]interface{}{"a": 1, "b": 2, "c": 6, "MEAN": 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := 13.0; value != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", value, expected)
+	}
+
+	// without aliases, an alias is merely a symbol
+	exp, err = New("a,b,c,3,AVERAGE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual, expected := exp.OpenBindings(), 4; len(actual) != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+}
+
+func TestAliasesErrors(t *testing.T) {
+	errors := map[string]map[string]string{
+		"syntax error : cannot use empty alias for \"AVG\"":                             {"": "AVG"},
+		"syntax error : cannot use number as alias: \"42\"":                             {"42": "AVG"},
+		"syntax error : cannot use operator as alias: \"MIN\"":                          {"MIN": "MAX"},
+		"syntax error : cannot use operator as alias: \"NOW\"":                          {"NOW": "TIME"},
+		"syntax error : cannot alias \"AVERAGE\" to \"MEAN\", which is not an operator": {"AVERAGE": "MEAN"},
+	}
+	for expected, aliases := range errors {
+		if _, err := New("1", Aliases(aliases)); err == nil || err.Error() != expected {
+			t.Errorf("Case: %v; Actual: %v; Expected: %#v", aliases, err, expected)
+		}
+	}
+}
+
+func TestAliasesAccumulate(t *testing.T) {
+	exp, err := New("a,b,MAXIMUM,c,MINIMUM", Aliases(map[string]string{"MAXIMUM": "MAX"}), Aliases(map[string]string{"MINIMUM": "MIN"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual, expected := exp.String(), "a,b,MAXIMUM,c,MINIMUM"; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+}
+
+func TestAliasesCached(t *testing.T) {
+	defer PurgeCache()
+	first, err := NewCached("a,b,c,3,AVERAGE", Aliases(map[string]string{"AVERAGE": "AVG"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewCached("a,b,c,3,AVERAGE", Aliases(map[string]string{"AVERAGE": "AVG"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.String() != second.String() {
+		t.Errorf("Actual: %#v; Expected: %#v", second.String(), first.String())
+	}
+	if actual, expected := expressionCache.len(), 1; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+
+	// same source string without aliases has different meaning
+	third, err := NewCached("a,b,c,3,AVERAGE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual, expected := len(third.OpenBindings()), 4; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+}
+
+func TestCaseInsensitiveOperators(t *testing.T) {
+	list := map[string]string{
+		"a,b,c,3,avg":        "a,b,c,3,AVG",
+		"qps,100,gt,1,0,If":  "qps,100,GT,1,0,IF",
+		"Qps,unkn,+":         "Qps,UNKN,+",
+		"60,24,*,Day,/":      "0.016666666666666666",
+		"'avg',x,+":          "'avg',x,+",   // quoted symbols are untouched
+		"a,b,c,3,average":    "a,b,c,3,AVG", // aliases too
+		"cpu.user,cpu.sys,+": "cpu.user,cpu.sys,+",
+	}
+	for input, output := range list {
+		exp, err := New(input, CaseInsensitiveOperators(), Aliases(map[string]string{"AVERAGE": "AVG"}), CanonicalOperators())
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if actual := exp.String(); actual != output {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, actual, output)
+		}
+	}
+
+	// without the configurator, lower case operators are symbols
+	exp, err := New("a,b,c,3,avg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual, expected := len(exp.OpenBindings()), 4; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+
+	exp, err = New("now,'time',-", CaseInsensitiveOperators())
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := exp.Evaluate(map[string]interface{}{"time": 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value <= 0 {
+		t.Errorf("Actual: %#v; Expected: positive value", value)
+	}
+}
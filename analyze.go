@@ -0,0 +1,262 @@
+package gorpn
+
+import (
+	"math"
+)
+
+// Monotonicity describes how the result of an Expression changes as one of its symbols grows while
+// its other symbols remain the same.
+type Monotonicity int
+
+const (
+	// Independent means the result does not change as the symbol grows.
+	Independent Monotonicity = iota
+
+	// Increasing means the result never shrinks as the symbol grows, although it may remain the
+	// same, as comparisons do.
+	Increasing
+
+	// Decreasing means the result never grows as the symbol grows, although it may remain the
+	// same.
+	Decreasing
+
+	// NotMonotonic means the result is not known to either never shrink or never grow as the
+	// symbol grows.
+	NotMonotonic
+)
+
+// String returns a description of the monotonicity, such as "increasing".
+func (m Monotonicity) String() string {
+	switch m {
+	case Independent:
+		return "independent"
+	case Increasing:
+		return "increasing"
+	case Decreasing:
+		return "decreasing"
+	}
+	return "not monotonic"
+}
+
+// Analysis describes the results an Expression may compute when each of its symbols is bound to
+// any number within its respective interval.
+type Analysis struct {
+	// Range is the interval that holds every result, just like the result of EvaluateInterval.
+	Range Interval
+
+	// Monotonicity describes how the result changes as each open binding of the Expression grows
+	// within its interval.
+	Monotonicity map[string]Monotonicity
+}
+
+// Analyze returns the range of the results of the Expression when each of its symbols is bound to
+// any number within its respective interval, along with whether the Expression is monotonic in
+// each of its open bindings over those intervals. This permits reviewing alert thresholds, for
+// instance to confirm that an alert that fires at some request rate also fires at every greater
+// rate. The analysis is conservative: an Expression in which a symbol appears more than once, such
+// as "a,a,-", may be reported as not monotonic in it even when it is.
+//
+// The parts of the Expression that depend on a symbol may only use the operators supported by
+// EvaluateInterval. An Expression is reported as not monotonic in the symbols an operation depends
+// on when that operation is not defined over the entire interval of an operand.
+//
+//	func example() {
+//		exp, err := gorpn.New("errors,requests,/,0.01,GT")
+//		if err != nil {
+//			panic(err)
+//		}
+//		analysis, err := exp.Analyze(map[string]gorpn.Interval{
+//			"errors":   {Min: 0, Max: 1000},
+//			"requests": {Min: 1, Max: 100000},
+//		})
+//		// analysis.Range is [0, 1]
+//		// analysis.Monotonicity["errors"] is gorpn.Increasing
+//		// analysis.Monotonicity["requests"] is gorpn.Decreasing
+//	}
+func (e *Expression) Analyze(bindings map[string]Interval) (Analysis, error) {
+	root, err := e.intervalTree(bindings, "analyze")
+	if err != nil {
+		return Analysis{}, err
+	}
+	interval, monotonicity, err := analyze(root, bindings)
+	if err != nil {
+		return Analysis{}, err
+	}
+	analysis := Analysis{Range: interval, Monotonicity: make(map[string]Monotonicity)}
+	for symbol, count := range e.openBindings {
+		if count > 0 {
+			analysis.Monotonicity[symbol] = monotonicity[symbol] // Independent when absent
+		}
+	}
+	return analysis, nil
+}
+
+// analyze returns the interval of the results computed by the tree n, and its monotonicity in each
+// symbol it depends on.
+func analyze(n *node, bindings map[string]Interval) (Interval, map[string]Monotonicity, error) {
+	if !n.isOperator() {
+		if value, ok := n.token.(float64); ok {
+			return hull(value), nil, nil
+		}
+		symbol := n.token.(string)
+		return bindings[symbol], map[string]Monotonicity{symbol: Increasing}, nil
+	}
+
+	operands := make([]Interval, len(n.children))
+	monotonicities := make([]map[string]Monotonicity, len(n.children))
+	for i, child := range n.children {
+		operand, monotonicity, err := analyze(child, bindings)
+		if err != nil {
+			return Interval{}, nil, err
+		}
+		operands[i], monotonicities[i] = operand, monotonicity
+	}
+	a, ma := operands[0], monotonicities[0]
+
+	var monotonicity map[string]Monotonicity
+	switch n.token {
+	case "+", "MAX", "MIN":
+		monotonicity = combineMonotonicity(ma, monotonicities[1])
+	case "-":
+		monotonicity = combineMonotonicity(ma, negateMonotonicity(monotonicities[1]))
+	case "*":
+		// a*b grows with a where b is not negative, and with b where a is not negative
+		monotonicity = combineMonotonicity(scaleMonotonicity(ma, operands[1]), scaleMonotonicity(monotonicities[1], a))
+	case "/":
+		if operands[1].contains(0) {
+			monotonicity = notMonotonic(ma, monotonicities[1])
+			break
+		}
+		// a/b is a times the reciprocal of b, which shrinks as b grows
+		reciprocal := divideIntervals(hull(1), operands[1])
+		monotonicity = combineMonotonicity(scaleMonotonicity(ma, reciprocal), scaleMonotonicity(negateMonotonicity(monotonicities[1]), a))
+	case "ABS":
+		monotonicity = scaleMonotonicity(ma, a)
+	case "ATAN", "CEIL", "DEG2RAD", "EXP", "FLOOR", "LOG", "RAD2DEG", "SQRT":
+		monotonicity = ma
+	case "COS", "SIN":
+		monotonicity = notMonotonic(ma)
+	case "GE", "GT":
+		monotonicity = combineMonotonicity(ma, negateMonotonicity(monotonicities[1]))
+	case "LE", "LT":
+		monotonicity = combineMonotonicity(negateMonotonicity(ma), monotonicities[1])
+	case "IF":
+		switch {
+		case a.isNaN():
+			monotonicity = notMonotonic(ma, monotonicities[1], monotonicities[2])
+		case !a.contains(0):
+			monotonicity = monotonicities[1]
+		case a.Min == 0 && a.Max == 0:
+			monotonicity = monotonicities[2]
+		default:
+			// when the condition does not depend on a symbol, the branch taken does not change
+			// as the symbol grows, but when it does, the result may jump between branches
+			monotonicity = combineMonotonicity(notMonotonic(ma), monotonicities[1], monotonicities[2])
+		}
+	case "POW":
+		monotonicity = powerMonotonicity(a, operands[1], ma, monotonicities[1])
+	default:
+		return Interval{}, nil, newErrSyntax("cannot analyze %s operator", n.token)
+	}
+
+	interval, err := applyInterval(n, operands)
+	if err != nil {
+		return Interval{}, nil, err
+	}
+	if interval.isNaN() {
+		monotonicity = notMonotonic(monotonicities...)
+	}
+	return interval, monotonicity, nil
+}
+
+// powerMonotonicity returns the monotonicity of a raised to the powers in b, given the
+// monotonicities of a and b.
+func powerMonotonicity(a, b Interval, ma, mb map[string]Monotonicity) map[string]Monotonicity {
+	if b.Min == b.Max && b.Min == math.Trunc(b.Min) && !math.IsInf(b.Min, 0) {
+		n := b.Min
+		switch {
+		case n == 0:
+			return nil
+		case math.Mod(n, 2) != 0: // odd powers grow with the base, and their reciprocals shrink
+			if n < 0 && a.contains(0) {
+				return notMonotonic(ma)
+			}
+			return scaleMonotonicity(ma, hull(n))
+		}
+		// even powers grow with the magnitude of the base, and their reciprocals shrink
+		return scaleMonotonicity(scaleMonotonicity(ma, a), hull(n))
+	}
+	if a.Min < 0 {
+		return notMonotonic(ma, mb)
+	}
+	// with a non-negative base, the power grows with the base where the exponent is not negative,
+	// and with the exponent where the base is at least one
+	return combineMonotonicity(scaleMonotonicity(ma, b), scaleMonotonicity(mb, Interval{a.Min - 1, a.Max - 1}))
+}
+
+// combineMonotonicity returns the monotonicity of a result that depends on each of the
+// monotonicities in the same direction, such as a sum.
+func combineMonotonicity(monotonicities ...map[string]Monotonicity) map[string]Monotonicity {
+	var result map[string]Monotonicity
+	for _, monotonicity := range monotonicities {
+		for symbol, m := range monotonicity {
+			if result == nil {
+				result = make(map[string]Monotonicity)
+			}
+			switch previous := result[symbol]; {
+			case previous == Independent:
+				result[symbol] = m
+			case m != Independent && m != previous:
+				result[symbol] = NotMonotonic
+			}
+		}
+	}
+	return result
+}
+
+// negateMonotonicity returns the monotonicity of the negation of a result.
+func negateMonotonicity(monotonicity map[string]Monotonicity) map[string]Monotonicity {
+	result := make(map[string]Monotonicity, len(monotonicity))
+	for symbol, m := range monotonicity {
+		switch m {
+		case Increasing:
+			m = Decreasing
+		case Decreasing:
+			m = Increasing
+		}
+		result[symbol] = m
+	}
+	return result
+}
+
+// scaleMonotonicity returns the monotonicity of a result multiplied by a factor within interval,
+// which is not known unless the factor has the same sign throughout the interval.
+func scaleMonotonicity(monotonicity map[string]Monotonicity, interval Interval) map[string]Monotonicity {
+	switch {
+	case interval.isNaN():
+		return notMonotonic(monotonicity)
+	case interval.Min >= 0:
+		return monotonicity
+	case interval.Max <= 0:
+		return negateMonotonicity(monotonicity)
+	}
+	return notMonotonic(monotonicity)
+}
+
+// notMonotonic returns a monotonicity in which each symbol the monotonicities depend on is
+// NotMonotonic.
+func notMonotonic(monotonicities ...map[string]Monotonicity) map[string]Monotonicity {
+	var result map[string]Monotonicity
+	for _, monotonicity := range monotonicities {
+		for symbol, m := range monotonicity {
+			if m == Independent {
+				continue
+			}
+			if result == nil {
+				result = make(map[string]Monotonicity)
+			}
+			result[symbol] = NotMonotonic
+		}
+	}
+	return result
+}
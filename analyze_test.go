@@ -0,0 +1,112 @@
+package gorpn
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	bindings := map[string]Interval{
+		"a": {Min: 1, Max: 2},
+		"b": {Min: -3, Max: 4},
+		"c": {Min: 0, Max: 0},
+		"d": {Min: -2, Max: -1},
+	}
+	const (
+		I = Independent
+		U = Increasing
+		D = Decreasing
+		N = NotMonotonic
+	)
+	list := map[string]struct {
+		interval     Interval
+		monotonicity map[string]Monotonicity
+	}{
+		"42":                 {Interval{42, 42}, map[string]Monotonicity{}},
+		"a":                  {Interval{1, 2}, map[string]Monotonicity{"a": U}},
+		"a,b,+":              {Interval{-2, 6}, map[string]Monotonicity{"a": U, "b": U}},
+		"a,b,-":              {Interval{-3, 5}, map[string]Monotonicity{"a": U, "b": D}},
+		"a,d,*":              {Interval{-4, -1}, map[string]Monotonicity{"a": D, "d": U}},
+		"a,b,*":              {Interval{-6, 8}, map[string]Monotonicity{"a": N, "b": U}},
+		"a,a,-":              {Interval{-1, 1}, map[string]Monotonicity{"a": N}},
+		"a,a,*":              {Interval{1, 4}, map[string]Monotonicity{"a": U}},
+		"a,d,/":              {Interval{-2, -0.5}, map[string]Monotonicity{"a": D, "d": D}},
+		"d,a,/":              {Interval{-2, -0.5}, map[string]Monotonicity{"a": U, "d": U}},
+		"a,b,/":              {Interval{math.Inf(-1), math.Inf(1)}, map[string]Monotonicity{"a": N, "b": N}},
+		"d,ABS":              {Interval{1, 2}, map[string]Monotonicity{"d": D}},
+		"b,ABS":              {Interval{0, 4}, map[string]Monotonicity{"b": N}},
+		"a,LOG,EXP,SQRT":     {Interval{1, math.Sqrt(2)}, map[string]Monotonicity{"a": U}},
+		"b,SQRT":             {Interval{math.NaN(), math.NaN()}, map[string]Monotonicity{"b": N}},
+		"a,SIN":              {Interval{math.Sin(1), 1}, map[string]Monotonicity{"a": N}},
+		"a,b,MAX":            {Interval{1, 4}, map[string]Monotonicity{"a": U, "b": U}},
+		"a,d,MIN":            {Interval{-2, -1}, map[string]Monotonicity{"a": U, "d": U}},
+		"a,b,GT":             {Interval{0, 1}, map[string]Monotonicity{"a": U, "b": D}},
+		"a,b,LE":             {Interval{0, 1}, map[string]Monotonicity{"a": D, "b": U}},
+		"b,2,POW":            {Interval{0, 16}, map[string]Monotonicity{"b": N}},
+		"d,2,POW":            {Interval{1, 4}, map[string]Monotonicity{"d": D}},
+		"d,3,POW":            {Interval{-8, -1}, map[string]Monotonicity{"d": U}},
+		"a,-2,POW":           {Interval{0.25, 1}, map[string]Monotonicity{"a": D}},
+		"b,-1,POW":           {Interval{math.Inf(-1), math.Inf(1)}, map[string]Monotonicity{"b": N}},
+		"a,b,POW":            {Interval{0.125, 16}, map[string]Monotonicity{"a": N, "b": U}},
+		"0.5,a,POW":          {Interval{0.25, 0.5}, map[string]Monotonicity{"a": D}},
+		"b,0,POW":            {Interval{1, 1}, map[string]Monotonicity{"b": I}},
+		"c,a,b,IF":           {Interval{-3, 4}, map[string]Monotonicity{"a": I, "b": U, "c": I}},
+		"a,d,GT,a,b,IF":      {Interval{1, 2}, map[string]Monotonicity{"a": U, "b": I, "d": I}},
+		"b,a,d,IF":           {Interval{-2, 2}, map[string]Monotonicity{"a": U, "b": N, "d": U}},
+		"b,0,GT,a,d,-,0,IF":  {Interval{0, 4}, map[string]Monotonicity{"a": U, "b": N, "d": D}},
+		"c,b,SQRT,a,IF":      {Interval{1, 2}, map[string]Monotonicity{"a": U, "b": I, "c": I}},
+		"a,b,*,b,+,100,GT":   {Interval{0, 0}, map[string]Monotonicity{"a": N, "b": U}},
+		"a,c,+,b,d,-,/,2,LT": {Interval{0, 1}, map[string]Monotonicity{"a": N, "b": N, "c": N, "d": N}},
+	}
+	for input, item := range list {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		analysis, err := exp.Analyze(bindings)
+		if err != nil {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+			continue
+		}
+		if actual := analysis.Range; actual != item.interval && !(actual.isNaN() && item.interval.isNaN()) {
+			t.Errorf("Case: %s; Actual: %v; Expected: %v", input, actual, item.interval)
+		}
+		if actual := analysis.Monotonicity; !reflect.DeepEqual(actual, item.monotonicity) {
+			t.Errorf("Case: %s; Actual: %v; Expected: %v", input, actual, item.monotonicity)
+		}
+	}
+}
+
+func TestAnalyzeErrors(t *testing.T) {
+	list := map[string]string{
+		"a,b,+":      "open bindings: b",
+		"a,1,2,3,IF": "syntax error : cannot analyze expression that leaves 2 items on stack",
+		"a,2,%":      "syntax error : cannot analyze % operator",
+		"a,5,TREND":  "syntax error : cannot analyze TREND operator",
+	}
+	for input, expected := range list {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		_, err = exp.Analyze(map[string]Interval{"a": {Min: 1, Max: 2}})
+		if err == nil || err.Error() != expected {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, err, expected)
+		}
+	}
+}
+
+func TestMonotonicityString(t *testing.T) {
+	list := map[Monotonicity]string{
+		Independent:  "independent",
+		Increasing:   "increasing",
+		Decreasing:   "decreasing",
+		NotMonotonic: "not monotonic",
+	}
+	for m, expected := range list {
+		if actual := m.String(); actual != expected {
+			t.Errorf("Case: %d; Actual: %#v; Expected: %#v", m, actual, expected)
+		}
+	}
+}
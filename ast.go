@@ -0,0 +1,151 @@
+package gorpn
+
+import "strings"
+
+// Node is a node of the syntax tree of an Expression returned by AST: a Const, SymbolRef,
+// SeriesRef, BinaryOp, or Call.
+type Node interface {
+	// String returns the RPN program that computes the node, using the default delimiter, which
+	// New reads back, so that a transformed syntax tree may be compiled into a new Expression.
+	String() string
+
+	appendTokens(tokens []string) []string
+}
+
+// Const is a number.
+type Const struct {
+	Value float64
+}
+
+// SymbolRef is a symbol bound to a number when the Expression is evaluated.
+type SymbolRef struct {
+	Name string
+}
+
+// SeriesRef is a symbol bound to a series of numbers when the Expression is evaluated, such as the
+// label consumed by TREND.
+type SeriesRef struct {
+	Name string
+}
+
+// BinaryOp is an operator that consumes two operands, such as + or GT.
+type BinaryOp struct {
+	Operator    string
+	Left, Right Node
+}
+
+// Call is an operator that consumes other than two operands, such as SQRT or IF, or a reserved word
+// that pushes a value without consuming any, such as NOW.
+type Call struct {
+	Operator string
+	Args     []Node
+}
+
+// AST returns the syntax tree of the simplified program of the Expression, so that tools may
+// inspect and transform it structurally, for instance to convert the units of a symbol wherever it
+// is used. Repeated subexpressions that the program computes once appear in the tree at each place
+// they are used. Operators are named by their names rather than any of their aliases.
+//
+// It returns an error when the program leaves other than one value on the stack, or uses an
+// operator whose operands are not known until evaluation, such as COPY or SORT.
+//
+//	func example() {
+//		exp, err := gorpn.New("bytes,8,*,interval,/")
+//		if err != nil {
+//			panic(err)
+//		}
+//		root, err := exp.AST()
+//		if err != nil {
+//			panic(err)
+//		}
+//		// root is gorpn.BinaryOp{Operator: "/",
+//		//     Left:  gorpn.BinaryOp{Operator: "*", Left: gorpn.SymbolRef{Name: "bytes"}, Right: gorpn.Const{Value: 8}},
+//		//     Right: gorpn.SymbolRef{Name: "interval"}}
+//	}
+func (e *Expression) AST() (Node, error) {
+	root, err := expressionTree(e.tokens, "build syntax tree of")
+	if err != nil {
+		return nil, err
+	}
+	return syntaxTree(root, false), nil
+}
+
+// syntaxTree returns the syntax tree of the expression tree n, which is the label of a series when
+// isSeries is true.
+func syntaxTree(n *node, isSeries bool) Node {
+	if !n.isOperator() {
+		switch token := n.token.(type) {
+		case float64:
+			return Const{Value: token}
+		case string:
+			switch {
+			case reserved[token]:
+				return Call{Operator: token}
+			case isSeries:
+				return SeriesRef{Name: token}
+			}
+			return SymbolRef{Name: token}
+		}
+	}
+	operator := n.token.(string)
+	if len(n.children) == 2 {
+		isTrend := operator == "TREND" || operator == "TRENDNAN" // label,count,TREND
+		return BinaryOp{Operator: operator, Left: syntaxTree(n.children[0], isTrend), Right: syntaxTree(n.children[1], false)}
+	}
+	args := make([]Node, len(n.children))
+	for i, child := range n.children {
+		args[i] = syntaxTree(child, false)
+	}
+	return Call{Operator: operator, Args: args}
+}
+
+// String returns the RPN program that computes the node.
+func (n Const) String() string { return nodeString(n) }
+
+// String returns the RPN program that computes the node.
+func (n SymbolRef) String() string { return nodeString(n) }
+
+// String returns the RPN program that computes the node.
+func (n SeriesRef) String() string { return nodeString(n) }
+
+// String returns the RPN program that computes the node.
+func (n BinaryOp) String() string { return nodeString(n) }
+
+// String returns the RPN program that computes the node.
+func (n Call) String() string { return nodeString(n) }
+
+func (n Const) appendTokens(tokens []string) []string {
+	return append(tokens, formatNumber(n.Value, -1))
+}
+
+func (n SymbolRef) appendTokens(tokens []string) []string {
+	return append(tokens, quoteSymbol(n.Name, string(DefaultDelimiter)))
+}
+
+func (n SeriesRef) appendTokens(tokens []string) []string {
+	return append(tokens, quoteSymbol(n.Name, string(DefaultDelimiter)))
+}
+
+func (n BinaryOp) appendTokens(tokens []string) []string {
+	if n.Left != nil {
+		tokens = n.Left.appendTokens(tokens)
+	}
+	if n.Right != nil {
+		tokens = n.Right.appendTokens(tokens)
+	}
+	return append(tokens, n.Operator)
+}
+
+func (n Call) appendTokens(tokens []string) []string {
+	for _, arg := range n.Args {
+		if arg != nil {
+			tokens = arg.appendTokens(tokens)
+		}
+	}
+	return append(tokens, n.Operator)
+}
+
+// nodeString returns the RPN program that computes n, using the default delimiter.
+func nodeString(n Node) string {
+	return strings.Join(n.appendTokens(nil), string(DefaultDelimiter))
+}
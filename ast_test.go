@@ -0,0 +1,133 @@
+package gorpn
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestAST(t *testing.T) {
+	list := map[string]Node{
+		"42":  Const{Value: 42},
+		"INF": Const{Value: math.Inf(1)},
+		"a":   SymbolRef{Name: "a"},
+		"bytes,8,*,interval,/": BinaryOp{Operator: "/",
+			Left:  BinaryOp{Operator: "*", Left: SymbolRef{Name: "bytes"}, Right: Const{Value: 8}},
+			Right: SymbolRef{Name: "interval"},
+		},
+		"a,SQRT":   Call{Operator: "SQRT", Args: []Node{SymbolRef{Name: "a"}}},
+		"a,b,c,IF": Call{Operator: "IF", Args: []Node{SymbolRef{Name: "a"}, SymbolRef{Name: "b"}, SymbolRef{Name: "c"}}},
+		"a,b,+,a,b,+,*": BinaryOp{Operator: "*", // computed once by the program, using DUP
+			Left:  BinaryOp{Operator: "+", Left: SymbolRef{Name: "a"}, Right: SymbolRef{Name: "b"}},
+			Right: BinaryOp{Operator: "+", Left: SymbolRef{Name: "a"}, Right: SymbolRef{Name: "b"}},
+		},
+		"qps,300,TREND": BinaryOp{Operator: "TREND", Left: SeriesRef{Name: "qps"}, Right: Const{Value: 300}},
+		"NOW,start,-":   BinaryOp{Operator: "-", Left: Call{Operator: "NOW"}, Right: SymbolRef{Name: "start"}},
+	}
+	for input, expected := range list {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		actual, err := exp.AST()
+		if err != nil {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+			continue
+		}
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, actual, expected)
+		}
+	}
+}
+
+func TestASTAliases(t *testing.T) {
+	exp, err := New("a,b,times", Aliases(map[string]string{"times": "*"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual, err := exp.AST()
+	expected := BinaryOp{Operator: "*", Left: SymbolRef{Name: "a"}, Right: SymbolRef{Name: "b"}}
+	if err != nil || !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Actual: %#v, %#v; Expected: %#v", actual, err, expected)
+	}
+}
+
+func TestASTString(t *testing.T) {
+	list := map[string]string{
+		"bytes,8,*,interval,/":  "bytes,8,*,interval,/",
+		"'a,b',c,+":             "'a,b',c,+",
+		"'1e3',b,+":             "'1e3',b,+",
+		"a,b,+,a,b,+,*":         "a,b,+,a,b,+,*",
+		"qps,300,TREND,NOW,MAX": "qps,300,TREND,NOW,MAX",
+	}
+	for input, expected := range list {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		root, err := exp.AST()
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if actual := root.String(); actual != expected {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, actual, expected)
+		}
+		// reading back the program results in the same syntax tree
+		again, err := New(root.String())
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if other, err := again.AST(); err != nil || !reflect.DeepEqual(other, root) {
+			t.Errorf("Case: %s; Actual: %#v, %#v; Expected: %#v", input, other, err, root)
+		}
+	}
+}
+
+func TestASTTransform(t *testing.T) {
+	exp, err := New("bytes,interval,/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := exp.AST()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// convert bytes to bits wherever used
+	var convert func(Node) Node
+	convert = func(n Node) Node {
+		switch v := n.(type) {
+		case SymbolRef:
+			if v.Name == "bytes" {
+				return BinaryOp{Operator: "*", Left: v, Right: Const{Value: 8}}
+			}
+		case BinaryOp:
+			return BinaryOp{Operator: v.Operator, Left: convert(v.Left), Right: convert(v.Right)}
+		}
+		return n
+	}
+	converted, err := New(convert(root).String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := converted.Evaluate(map[string]interface{}{"bytes": 10, "interval": 4})
+	if err != nil || value != 20 {
+		t.Errorf("Actual: %#v, %#v; Expected: %#v", value, err, 20.0)
+	}
+}
+
+func TestASTErrors(t *testing.T) {
+	list := map[string]string{
+		"a,b":              "syntax error : cannot build syntax tree of expression that leaves 2 items on stack",
+		"a,b,n,COPY,+,+,+": "syntax error : cannot build syntax tree of COPY operator",
+		"a,b,c,3,SORT,+,+": "syntax error : cannot build syntax tree of SORT operator",
+	}
+	for input, expected := range list {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if _, err = exp.AST(); err == nil || err.Error() != expected {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, err, expected)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package gorpn
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// EvaluateBig evaluates the Expression using arbitrary precision arithmetic, carrying each value as
+// a big.Float with prec bits of mantissa, for scientific users combining values of wildly different
+// magnitudes, where float64 arithmetic would lose the smaller values to cancellation. A symbol may
+// be bound to a *big.Float, or to any number Evaluate accepts. Numbers written in the source of the
+// Expression are read again with prec bits of precision, so that 0.1 is not limited to the nearest
+// float64. However, constants folded when the Expression was created or specialized by Partial were
+// computed with float64 arithmetic, so values whose precision matters ought to be bound to symbols.
+//
+// Only the +, -, *, /, ABS, MAX, MIN, and SQRT operators are supported. Because a big.Float cannot
+// represent NaN, an operation that would result in NaN, such as the square root of a negative
+// number, returns a big.ErrNaN error, and dividing by zero results in an ErrDivisionByZero error,
+// unless the DivisionByZeroInf policy allows dividing a number other than zero to result in ±Inf.
+//
+//	func example() {
+//		exp, err := gorpn.New("big,small,+,big,-")
+//		if err != nil {
+//			panic(err)
+//		}
+//		value, err := exp.EvaluateBig(map[string]interface{}{"big": 1e20, "small": 1}, 128)
+//		// value is 1, whereas Evaluate returns 0
+//	}
+func (e *Expression) EvaluateBig(bindings map[string]interface{}, prec uint) (result *big.Float, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if nan, ok := r.(big.ErrNaN); ok {
+				result, err = nil, nan
+				return
+			}
+			result, err = nil, newErrInternal(r, e.config, e.tokens, -1)
+		}
+	}()
+
+	if prec == 0 || prec > big.MaxPrec {
+		return nil, newErrSyntax("invalid precision: %d", prec)
+	}
+
+	values := make(map[string]*big.Float, len(bindings))
+	others := make(map[string]interface{}, len(bindings))
+	for symbol, value := range bindings {
+		if f, ok := value.(*big.Float); ok {
+			values[symbol] = new(big.Float).SetPrec(prec).Set(f)
+		} else {
+			others[symbol] = value
+		}
+	}
+	coerced, err := e.coerceMapValuesToFloat64(others)
+	if err != nil {
+		return nil, err
+	}
+	unsupported := make(map[string]interface{})
+	for symbol, value := range coerced {
+		if v, ok := liveValue(symbol, value); ok {
+			value = v
+		}
+		if v, ok := value.(float64); ok && !math.IsNaN(v) {
+			values[symbol] = new(big.Float).SetPrec(prec).SetFloat64(v)
+		} else {
+			unsupported[symbol] = value // only an error when the symbol is used
+		}
+	}
+
+	root, err := expressionTree(e.tokens, "evaluate big.Float of")
+	if err != nil {
+		return nil, err
+	}
+	var openBindings []string
+	for symbol, count := range e.openBindings {
+		if _, ok := values[symbol]; count > 0 && !ok {
+			if _, ok = unsupported[symbol]; !ok {
+				openBindings = append(openBindings, symbol)
+			}
+		}
+	}
+	if len(openBindings) > 0 {
+		return nil, e.errOpenBindings(openBindings, e.tokens)
+	}
+
+	x := &bigEvaluator{prec: prec, values: values, unsupported: unsupported, literals: e.literals(), divisionByZero: e.divisionByZero}
+	return x.evaluate(root)
+}
+
+// literals returns the text in the source of the Expression of each of its numbers that was written
+// there, rather than folded from other tokens.
+func (e *Expression) literals() map[float64]string {
+	literals := make(map[float64]string)
+	for idx, tok := range e.tokens {
+		value, ok := tok.(float64)
+		if !ok || idx >= len(e.sources) {
+			continue
+		}
+		text := e.source[e.sources[idx].Start:e.sources[idx].End]
+		if v, ok := parseNumber(text); ok && v == value {
+			literals[value] = text
+		}
+	}
+	return literals
+}
+
+// bigEvaluator evaluates expression trees with big.Float values.
+type bigEvaluator struct {
+	prec           uint
+	values         map[string]*big.Float
+	unsupported    map[string]interface{} // bindings that are not numbers, or are NaN
+	literals       map[float64]string     // text of numbers written in the source
+	divisionByZero DivisionByZeroPolicy
+}
+
+// evaluate returns the value computed by the tree n.
+func (x *bigEvaluator) evaluate(n *node) (*big.Float, error) {
+	if !n.isOperator() {
+		switch v := n.token.(type) {
+		case float64:
+			if text, ok := x.literals[v]; ok {
+				if f, _, err := big.ParseFloat(text, 10, x.prec, big.ToNearestEven); err == nil {
+					return f, nil
+				}
+			}
+			if math.IsNaN(v) {
+				return nil, newErrSyntax("cannot evaluate big.Float of UNKN")
+			}
+			return new(big.Float).SetPrec(x.prec).SetFloat64(v), nil
+		case string:
+			if f, ok := x.values[v]; ok {
+				return f, nil
+			}
+			if value, ok := x.unsupported[v]; ok {
+				if _, ok = value.(float64); ok {
+					return nil, newErrSyntax("cannot bind %q to NaN", v)
+				}
+				return nil, ErrBadBindingType{fmt.Sprintf("%q: %q", v, fmt.Sprintf("%T", value))}
+			}
+		}
+		return nil, newErrSyntax("cannot evaluate big.Float of %v", n.token)
+	}
+
+	operands := make([]*big.Float, len(n.children))
+	for i, child := range n.children {
+		operand, err := x.evaluate(child)
+		if err != nil {
+			return nil, err
+		}
+		operands[i] = operand
+	}
+	a := operands[0]
+	z := new(big.Float).SetPrec(x.prec)
+
+	switch n.token {
+	case "+":
+		return z.Add(a, operands[1]), nil
+	case "-":
+		return z.Sub(a, operands[1]), nil
+	case "*":
+		return z.Mul(a, operands[1]), nil
+	case "/":
+		if operands[1].Sign() == 0 {
+			return x.divideByZero(a)
+		}
+		return z.Quo(a, operands[1]), nil
+	case "ABS":
+		return z.Abs(a), nil
+	case "MAX":
+		if a.Cmp(operands[1]) < 0 {
+			return operands[1], nil
+		}
+		return a, nil
+	case "MIN":
+		if a.Cmp(operands[1]) > 0 {
+			return operands[1], nil
+		}
+		return a, nil
+	case "SQRT":
+		return z.Sqrt(a), nil
+	}
+	return nil, newErrSyntax("cannot evaluate big.Float of %s operator", n.token)
+}
+
+// divideByZero returns the result of dividing dividend by zero according to the division by zero
+// policy, which results in an error rather than NaN.
+func (x *bigEvaluator) divideByZero(dividend *big.Float) (*big.Float, error) {
+	if x.divisionByZero == DivisionByZeroInf && dividend.Sign() != 0 {
+		return new(big.Float).SetPrec(x.prec).SetInf(dividend.Signbit()), nil
+	}
+	f, _ := dividend.Float64()
+	return nil, ErrDivisionByZero{Operator: "/", Dividend: f}
+}
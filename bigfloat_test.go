@@ -0,0 +1,79 @@
+package gorpn
+
+import (
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestEvaluateBig(t *testing.T) {
+	live := 4.0
+	bindings := map[string]interface{}{
+		"live":  &live,
+		"gauge": func() float64 { return 5 },
+		"big":   1e20,
+		"small": 1,
+		"a":     3,
+		"neg":   -2,
+		"third": new(big.Float).SetPrec(128).Quo(big.NewFloat(1), big.NewFloat(3)),
+	}
+	list := map[string]string{
+		"big,small,+,big,-":  "1",
+		"0.1,a,*":            "0.3",
+		"1,a,/,a,*":          "1",
+		"third,a,*":          "1",
+		"neg,ABS,SQRT,DUP,*": "2",
+		"a,neg,MAX":          "3",
+		"a,neg,MIN":          "-2",
+		"a,small,-,big,*":    "200000000000000000000",
+		"live,gauge,*":       "20",
+	}
+	for input, expected := range list {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		value, err := exp.EvaluateBig(bindings, 128)
+		if err != nil {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+			continue
+		}
+		if actual := value.Text('g', 30); actual != expected {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, actual, expected)
+		}
+	}
+}
+
+func TestEvaluateBigErrors(t *testing.T) {
+	bindings := map[string]interface{}{"a": 3, "neg": -2, "zero": 0, "unknown": math.NaN(), "series": []float64{1, 2}}
+	list := map[string]string{
+		"a,b,+":          "open bindings: b",
+		"a,2,POW":        "syntax error : cannot evaluate big.Float of POW operator",
+		"a,1":            "syntax error : cannot evaluate big.Float of expression that leaves 2 items on stack",
+		"neg,SQRT":       "square root of negative operand",
+		"a,zero,/":       "division by zero: 3,0,/",
+		"series,a,+":     "bad binding type for \"series\": \"[]float64\"",
+		"UNKN,a,MAX,1,+": "syntax error : cannot evaluate big.Float of UNKN",
+		"unknown,a,+":    "syntax error : cannot bind \"unknown\" to NaN",
+	}
+	for input, expected := range list {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if _, err = exp.EvaluateBig(bindings, 64); err == nil || err.Error() != expected {
+			t.Errorf("Case: %s; Actual: %v; Expected: %#v", input, err, expected)
+		}
+	}
+
+	exp, err := New("a,zero,/", DivisionByZero(DivisionByZeroInf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, err := exp.EvaluateBig(bindings, 64); err != nil || !value.IsInf() || value.Signbit() {
+		t.Errorf("Actual: %v, %#v; Expected: %v, %#v", value, err, "+Inf", nil)
+	}
+	if _, err = exp.EvaluateBig(bindings, 0); err == nil || err.Error() != "syntax error : invalid precision: 0" {
+		t.Errorf("Actual: %v; Expected: %#v", err, "syntax error : invalid precision: 0")
+	}
+}
@@ -0,0 +1,115 @@
+package gorpn
+
+// bindSlot is a token of a bound program whose value is read through a pointer, or returned by a
+// function, each time the program is evaluated.
+type bindSlot struct {
+	index   int
+	pointer *float64
+	call    func() float64
+}
+
+// Bind resolves the symbols of the Expression once, and returns a function that evaluates it
+// without looking up any symbol, for callers that evaluate the same Expression many times with the
+// same bindings whose values change in place. A symbol may be bound to a *float64, whose value is
+// read each time the function is called, to a func() float64, which is called each time the
+// function is called, or to any other value Evaluate accepts, which is bound once, as if by
+// Partial, except for TIME and NOW, which are given to each evaluation just as Evaluate is given
+// them. It returns an ErrOpenBindings error when a symbol of the Expression is not bound. Just like
+// the Expression, the returned function is not safe for concurrent use by multiple goroutines,
+// and each goroutine ought to bind its own Clone of the Expression.
+//
+//	func example() {
+//		exp, err := gorpn.New("rx,tx,+,8,*")
+//		if err != nil {
+//			panic(err)
+//		}
+//		var rx, tx float64
+//		bitsPerSecond, err := exp.Bind(map[string]interface{}{"rx": &rx, "tx": &tx})
+//		if err != nil {
+//			panic(err)
+//		}
+//		for sample := range samples {
+//			rx, tx = sample.rx, sample.tx
+//			value, err := bitsPerSecond()
+//		}
+//	}
+func (e *Expression) Bind(bindings map[string]interface{}) (func() (float64, error), error) {
+	fixed := make(map[string]interface{}, len(bindings))
+	live := make(map[string]bindSlot)
+	for symbol, value := range bindings {
+		switch v := value.(type) {
+		case *float64:
+			if v == nil {
+				return nil, newErrSyntax("cannot bind %q to nil pointer", symbol)
+			}
+			live[symbol] = bindSlot{pointer: v}
+		case func() float64:
+			if v == nil {
+				return nil, newErrSyntax("cannot bind %q to nil function", symbol)
+			}
+			live[symbol] = bindSlot{call: v}
+		default:
+			fixed[symbol] = value
+		}
+	}
+
+	exp, err := e.Partial(fixed)
+	if err != nil {
+		return nil, err
+	}
+
+	// Partial leaves TIME and NOW, and the operators computed from them, to Evaluate
+	var timeBindings map[string]interface{}
+	for symbol, value := range fixed {
+		if reserved[symbol] {
+			if timeBindings == nil {
+				timeBindings = make(map[string]interface{})
+			}
+			timeBindings[symbol] = value
+		}
+	}
+
+	var openBindings []string
+	for symbol, count := range exp.openBindings {
+		_, isLive := live[symbol]
+		_, isTime := timeBindings[symbol]
+		if count > 0 && !isLive && !isTime {
+			openBindings = append(openBindings, symbol)
+		}
+	}
+	if len(openBindings) > 0 {
+		return nil, exp.errOpenBindings(openBindings, exp.tokens)
+	}
+
+	program := exp.clone()
+	var slots []bindSlot
+	for idx, tok := range program.tokens {
+		if symbol, ok := tok.(string); ok && exp.openBindings[symbol] > 0 {
+			if slot, ok := live[symbol]; ok {
+				slot.index = idx
+				slots = append(slots, slot)
+			}
+		}
+	}
+
+	// the time operators other than TIME itself read the time from the bindings
+	if time, ok := bindings["TIME"]; ok && program.performTimeSubstitutions {
+		if _, ok = live["TIME"]; ok {
+			if timeBindings == nil {
+				timeBindings = make(map[string]interface{})
+			}
+			timeBindings["TIME"] = time
+		}
+	}
+
+	return func() (float64, error) {
+		for _, slot := range slots {
+			if slot.pointer != nil {
+				program.tokens[slot.index] = *slot.pointer
+			} else {
+				program.tokens[slot.index] = slot.call()
+			}
+		}
+		return program.Evaluate(timeBindings)
+	}, nil
+}
@@ -0,0 +1,155 @@
+package gorpn
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestBind(t *testing.T) {
+	exp, err := New("rx,tx,+,scale,*,a,b,c,3,AVG,+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rx, tx float64
+	scale := func() float64 { return 8 }
+	evaluate, err := exp.Bind(map[string]interface{}{"rx": &rx, "tx": &tx, "scale": scale, "a": 1, "b": 2, "c": 6})
+	if err != nil {
+		t.Fatalf("Actual: %#v; Expected: %#v", err, nil)
+	}
+
+	list := []struct {
+		rx, tx   float64
+		expected float64
+	}{
+		{1, 2, 27},
+		{10, 20, 243},
+		{0, 0, 3},
+	}
+	for _, item := range list {
+		rx, tx = item.rx, item.tx
+		actual, err := evaluate()
+		if err != nil {
+			t.Errorf("Case: %#v; Actual: %#v; Expected: %#v", item, err, nil)
+			continue
+		}
+		if actual != item.expected {
+			t.Errorf("Case: %#v; Actual: %#v; Expected: %#v", item, actual, item.expected)
+		}
+	}
+
+	// the Expression itself remains unbound
+	actual := exp.OpenBindings()
+	sort.Strings(actual)
+	if expected := []string{"a", "b", "c", "rx", "scale", "tx"}; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+}
+
+func TestBindTime(t *testing.T) {
+	exp, err := New("TIME,NEWDAY,+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var now float64
+	evaluate, err := exp.Bind(map[string]interface{}{"TIME": &now})
+	if err != nil {
+		t.Fatalf("Actual: %#v; Expected: %#v", err, nil)
+	}
+	for _, seconds := range []float64{1500000000, 1500000300} {
+		now = seconds
+		expected, err := exp.Evaluate(map[string]interface{}{"TIME": seconds})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual, err := evaluate(); err != nil || actual != expected {
+			t.Errorf("Case: %v; Actual: %#v, %#v; Expected: %#v", seconds, actual, err, expected)
+		}
+	}
+}
+
+func TestBindFixedTime(t *testing.T) {
+	exp, err := New("TIME,NEWDAY,+,rx,+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rx float64
+	evaluate, err := exp.Bind(map[string]interface{}{"TIME": 1500000000, "rx": &rx})
+	if err != nil {
+		t.Fatalf("Actual: %#v; Expected: %#v", err, nil)
+	}
+	for _, value := range []float64{1, 2} {
+		rx = value
+		expected, err := exp.Evaluate(map[string]interface{}{"TIME": 1500000000, "rx": value})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual, err := evaluate(); err != nil || actual != expected {
+			t.Errorf("Case: %v; Actual: %#v, %#v; Expected: %#v", value, actual, err, expected)
+		}
+	}
+}
+
+func TestBindErrors(t *testing.T) {
+	exp, err := New("a,b,/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var a float64
+	list := map[string]struct {
+		bindings map[string]interface{}
+		expected string
+	}{
+		"open binding": {map[string]interface{}{"a": &a}, "open bindings: b"},
+		"nil pointer":  {map[string]interface{}{"a": &a, "b": (*float64)(nil)}, "syntax error : cannot bind \"b\" to nil pointer"},
+		"nil function": {map[string]interface{}{"a": &a, "b": (func() float64)(nil)}, "syntax error : cannot bind \"b\" to nil function"},
+		"bad type":     {map[string]interface{}{"a": &a, "b": "13"}, "bad binding type for \"b\": \"string\""},
+	}
+	for name, item := range list {
+		evaluate, err := exp.Bind(item.bindings)
+		if err == nil || err.Error() != item.expected {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, err, item.expected)
+		}
+		if evaluate != nil {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, "function", nil)
+		}
+	}
+}
+
+func TestBindEvaluateErrors(t *testing.T) {
+	exp, err := New("a,b,/", DivisionByZero(DivisionByZeroError))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := 1.0, 0.0
+	evaluate, err := exp.Bind(map[string]interface{}{"a": &a, "b": &b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = evaluate(); err == nil {
+		t.Errorf("Actual: %#v; Expected: %#v", err, ErrDivisionByZero{Operator: "/", Dividend: 1})
+	}
+	b = 4
+	if actual, err := evaluate(); err != nil || actual != 0.25 {
+		t.Errorf("Actual: %#v, %#v; Expected: %#v", actual, err, 0.25)
+	}
+}
+
+func BenchmarkBind(b *testing.B) {
+	exp, err := New("rx,tx,+,8,*,limit,MIN")
+	if err != nil {
+		b.Fatal(err)
+	}
+	rx, tx, limit := 10.0, 20.0, 1000.0
+	evaluate, err := exp.Bind(map[string]interface{}{"rx": &rx, "tx": &tx, "limit": &limit})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rx = float64(i)
+		if _, err = evaluate(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package gorpn
+
+import "math"
+
+// ErrUnknownResult error is returned by EvaluateBool when an RPN Expression configured with
+// RejectUnknownBool evaluates to UNKN, which is neither true nor false.
+type ErrUnknownResult struct {
+	Expression string
+}
+
+// Error returns the error string representation for ErrUnknownResult errors.
+func (e ErrUnknownResult) Error() string {
+	return "unknown result: " + e.Expression
+}
+
+// RejectUnknownBool causes EvaluateBool to return an ErrUnknownResult error when an RPN Expression
+// evaluates to UNKN, rather than false, for alerting pipelines that must distinguish a condition
+// that does not hold from one that cannot be determined for lack of data.
+//
+//	func example() {
+//		exp, err := gorpn.New("errors,requests,/,0.01,GT", gorpn.RejectUnknownBool())
+//		if err != nil {
+//			panic(err)
+//		}
+//		_, err = exp.EvaluateBool(map[string]interface{}{"errors": math.NaN(), "requests": 100})
+//		// err is gorpn.ErrUnknownResult
+//	}
+func RejectUnknownBool() ExpressionConfigurator {
+	return func(e *Expression) error {
+		e.rejectUnknownBool = true
+		return nil
+	}
+}
+
+// EvaluateBool evaluates the Expression just like Evaluate, but returns whether its result is true
+// in the sense of the IF operator: every number other than zero and UNKN is true, including the
+// infinities. UNKN is false, unless the Expression is configured with RejectUnknownBool, in which
+// case EvaluateBool returns an ErrUnknownResult error.
+//
+//	func example() {
+//		exp, err := gorpn.New("errors,requests,/,0.01,GT")
+//		if err != nil {
+//			panic(err)
+//		}
+//		firing, err := exp.EvaluateBool(map[string]interface{}{"errors": 5, "requests": 100})
+//		// firing is true
+//	}
+func (e *Expression) EvaluateBool(bindings map[string]interface{}) (bool, error) {
+	value, err := e.Evaluate(bindings)
+	if err != nil {
+		return false, err
+	}
+	if math.IsNaN(value) {
+		if e.rejectUnknownBool {
+			return false, ErrUnknownResult{Expression: e.String()}
+		}
+		return false, nil
+	}
+	return value != 0, nil
+}
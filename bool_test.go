@@ -0,0 +1,63 @@
+package gorpn
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEvaluateBool(t *testing.T) {
+	list := map[string]struct {
+		input    string
+		bindings map[string]interface{}
+		expected bool
+	}{
+		"true":      {"a,100,GT", map[string]interface{}{"a": 120}, true},
+		"false":     {"a,100,GT", map[string]interface{}{"a": 80}, false},
+		"non-zero":  {"a", map[string]interface{}{"a": -0.5}, true},
+		"zero":      {"a", map[string]interface{}{"a": 0}, false},
+		"negative0": {"a", map[string]interface{}{"a": math.Copysign(0, -1)}, false},
+		"infinity":  {"a", map[string]interface{}{"a": math.Inf(-1)}, true},
+		"unknown":   {"a,100,GT", map[string]interface{}{"a": math.NaN()}, false},
+		"computed":  {"a,b,/", map[string]interface{}{"a": 0, "b": 0}, false},
+	}
+	for name, item := range list {
+		exp, err := New(item.input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", name, err, nil)
+		}
+		actual, err := exp.EvaluateBool(item.bindings)
+		if err != nil {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, err, nil)
+			continue
+		}
+		if actual != item.expected {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, actual, item.expected)
+		}
+	}
+}
+
+func TestEvaluateBoolRejectUnknown(t *testing.T) {
+	exp, err := New("a,b,/,0.01,GT", RejectUnknownBool())
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual, err := exp.EvaluateBool(map[string]interface{}{"a": math.NaN(), "b": 100})
+	expected := ErrUnknownResult{Expression: "a,b,/,0.01,GT"}
+	if err != expected || actual {
+		t.Errorf("Actual: %#v, %#v; Expected: %#v", actual, err, expected)
+	}
+	if err.Error() != "unknown result: a,b,/,0.01,GT" {
+		t.Errorf("Actual: %#v; Expected: %#v", err.Error(), "unknown result: a,b,/,0.01,GT")
+	}
+
+	actual, err = exp.EvaluateBool(map[string]interface{}{"a": 5, "b": 100})
+	if err != nil || !actual {
+		t.Errorf("Actual: %#v, %#v; Expected: %#v", actual, err, true)
+	}
+
+	// other errors are returned as they are
+	_, err = exp.EvaluateBool(map[string]interface{}{"a": 5})
+	if _, ok := err.(ErrOpenBindings); !ok {
+		t.Errorf("Actual: %#v; Expected: %#v", err, ErrOpenBindings{"b": ScalarKind})
+	}
+}
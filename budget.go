@@ -0,0 +1,126 @@
+package gorpn
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrBudgetExceeded error is returned when evaluating an RPN Expression configured with
+// EvaluationBudget costs more than its budget.
+type ErrBudgetExceeded struct {
+	Budget   int
+	Cost     int // cost accumulated when the budget was exceeded
+	Position int // index of the token whose cost exceeded the budget in the program being run
+}
+
+// Error returns the error string representation for ErrBudgetExceeded errors.
+func (e ErrBudgetExceeded) Error() string {
+	return fmt.Sprintf("evaluation budget of %d exceeded at token %d: cost %d", e.Budget, e.Position, e.Cost)
+}
+
+// costTable holds the weight of each operator whose cost differs from the default.
+type costTable struct {
+	weights map[string]int
+}
+
+// costTables interns each costTable by its contents, so that expressions configured with the same
+// costs share a configuration, and NewCached finds the expressions compiled with them.
+var costTables sync.Map
+
+// EvaluationBudget limits the cost of evaluating an RPN Expression, so that an expression from one
+// tenant of a shared system cannot starve the others, such as by repeatedly sorting or copying
+// thousands of items. Evaluate, and the other methods that evaluate the Expression, return an
+// ErrBudgetExceeded error once the accumulated cost passes budget, without evaluating the remaining
+// tokens. Each number and symbol costs 1, and each operator costs its weight multiplied by the
+// number of items it consumes from the stack and pushes onto it, so that sorting 1000 items costs
+// far more than adding two numbers. Every operator has a weight of 1 unless changed by
+// OperatorCosts. The Stats method of an Expression estimates the same cost without evaluating it.
+//
+//	func example() {
+//		exp, err := gorpn.New(tenantExpression, gorpn.EvaluationBudget(10000))
+//		if err != nil {
+//			panic(err)
+//		}
+//		_, err = exp.Evaluate(bindings)
+//		// err is gorpn.ErrBudgetExceeded when the expression costs more than 10000
+//	}
+func EvaluationBudget(budget int) ExpressionConfigurator {
+	return func(e *Expression) error {
+		if budget <= 0 {
+			return newErrSyntax("evaluation budget requires positive integer: %d", budget)
+		}
+		e.budget = budget
+		return nil
+	}
+}
+
+// OperatorCosts allows changing the weight of operators in the cost model used by EvaluationBudget
+// and Stats, such as making SORT costlier than other operators to account for the time it takes to
+// sort its items. Each key of costs is an operator, or an alias of one, and its value is the weight
+// of that operator, which must not be negative. When OperatorCosts is given more than once, the
+// weights accumulate.
+//
+//	func example() {
+//		exp, err := gorpn.New(tenantExpression, gorpn.OperatorCosts(map[string]int{"SORT": 10}), gorpn.EvaluationBudget(10000))
+//		if err != nil {
+//			panic(err)
+//		}
+//	}
+func OperatorCosts(costs map[string]int) ExpressionConfigurator {
+	return func(e *Expression) error {
+		weights := make(map[string]int, len(costs))
+		if e.costs != nil {
+			for operator, weight := range e.costs.weights {
+				weights[operator] = weight
+			}
+		}
+		for name, weight := range costs {
+			operator, _ := e.operatorName(name)
+			if _, ok := arity[operator]; !ok {
+				return newErrUnknownOperator("cannot set cost of %q, which is not an operator", name)
+			}
+			if weight < 0 {
+				return newErrSyntax("cannot set cost of %q to negative weight: %d", name, weight)
+			}
+			weights[operator] = weight
+		}
+		e.costs = internCostTable(weights)
+		return nil
+	}
+}
+
+// internCostTable returns the costTable for weights, creating it the first time these weights are
+// seen.
+func internCostTable(weights map[string]int) *costTable {
+	keys := make([]string, 0, len(weights))
+	for operator := range weights {
+		keys = append(keys, operator)
+	}
+	sort.Strings(keys)
+
+	var key strings.Builder
+	for _, operator := range keys {
+		key.WriteString(operator)
+		key.WriteByte(0)
+		key.WriteString(strconv.Itoa(weights[operator]))
+		key.WriteByte(0)
+	}
+	if table, ok := costTables.Load(key.String()); ok {
+		return table.(*costTable)
+	}
+	actual, _ := costTables.LoadOrStore(key.String(), &costTable{weights: weights})
+	return actual.(*costTable)
+}
+
+// weight returns the weight of operator, which is 1 unless changed by OperatorCosts.
+func (t *costTable) weight(operator string) int {
+	if t != nil {
+		if weight, ok := t.weights[operator]; ok {
+			return weight
+		}
+	}
+	return 1
+}
@@ -0,0 +1,86 @@
+package gorpn
+
+import "testing"
+
+func TestEvaluationBudget(t *testing.T) {
+	bindings := map[string]interface{}{"a": 1, "b": 2, "c": 3, "d": 4}
+	list := []string{
+		"a,b,+",
+		"a,b,+,a,b,+,*",
+		"a,b,c,d,4,SORT,+,+,+",
+		"a,b,c,d,4,AVG,NOW,-",
+		"a,b,c,2,COPY,5,REV,2,5,NLARGEST,MAX",
+		"a,b,c,3,1,ROLL,-,*",
+	}
+	configurations := map[string][]ExpressionConfigurator{
+		"default":  nil,
+		"weighted": {OperatorCosts(map[string]int{"SORT": 10, "+": 2, "-": 3, "MAX": 0})},
+	}
+	for name, setters := range configurations {
+		for _, input := range list {
+			exp, err := New(input, setters...)
+			if err != nil {
+				t.Fatalf("Case: %s %s; Actual: %#v; Expected: %#v", name, input, err, nil)
+			}
+			cost := exp.Stats().Cost
+
+			// exactly the estimated cost is within budget
+			exp, err = New(input, append(setters, EvaluationBudget(cost))...)
+			if err != nil {
+				t.Fatalf("Case: %s %s; Actual: %#v; Expected: %#v", name, input, err, nil)
+			}
+			if _, err = exp.Evaluate(bindings); err != nil {
+				t.Errorf("Case: %s %s; Actual: %#v; Expected: %#v", name, input, err, nil)
+			}
+
+			// one less is not
+			exp, err = New(input, append(setters, EvaluationBudget(cost-1))...)
+			if err != nil {
+				t.Fatalf("Case: %s %s; Actual: %#v; Expected: %#v", name, input, err, nil)
+			}
+			_, err = exp.Evaluate(bindings)
+			if _, ok := err.(ErrBudgetExceeded); !ok {
+				t.Errorf("Case: %s %s; Actual: %#v; Expected: %#v", name, input, err, ErrBudgetExceeded{})
+			}
+		}
+	}
+}
+
+func TestEvaluationBudgetExceeded(t *testing.T) {
+	exp, err := New("a,b,c,d,4,SORT,+,+,+", EvaluationBudget(12))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = exp.Evaluate(map[string]interface{}{"a": 1, "b": 2, "c": 3, "d": 4})
+	if expected := "evaluation budget of 12 exceeded at token 5: cost 14"; err == nil || err.Error() != expected {
+		t.Errorf("Actual: %v; Expected: %#v", err, expected)
+	}
+
+	// constants folded by New are not part of the cost of evaluating
+	if _, err = New("1,2,3,4,4,SORT,+,+,+", EvaluationBudget(1)); err != nil {
+		t.Errorf("Actual: %#v; Expected: %#v", err, nil)
+	}
+}
+
+func TestEvaluationBudgetErrors(t *testing.T) {
+	list := map[string]ExpressionConfigurator{
+		"syntax error : evaluation budget requires positive integer: 0":       EvaluationBudget(0),
+		"syntax error : cannot set cost of \"foo\", which is not an operator": OperatorCosts(map[string]int{"foo": 1}),
+		"syntax error : cannot set cost of \"NOW\", which is not an operator": OperatorCosts(map[string]int{"NOW": 1}),
+		"syntax error : cannot set cost of \"SORT\" to negative weight: -1":   OperatorCosts(map[string]int{"SORT": -1}),
+	}
+	for expected, setter := range list {
+		if _, err := New("a", setter); err == nil || err.Error() != expected {
+			t.Errorf("Actual: %v; Expected: %#v", err, expected)
+		}
+	}
+
+	// aliases name the operators they stand for
+	exp, err := New("a,b,c,3,ORDER", Aliases(map[string]string{"ORDER": "SORT"}), OperatorCosts(map[string]int{"ORDER": 5}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual, expected := exp.Stats().Cost, 3+1+5*(4+3); actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+}
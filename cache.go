@@ -0,0 +1,159 @@
+package gorpn
+
+import (
+	"container/list"
+	"sync"
+)
+
+// DefaultCacheSize specifies the maximum number of compiled expressions retained by the cache used
+// by NewCached. It can be overridden by the SetCacheSize() function.
+const DefaultCacheSize = 1024
+
+// cacheKey identifies a compiled expression by its source string and the configuration that
+// affects how it was compiled.
+type cacheKey struct {
+	expression string
+	config
+}
+
+// newCacheKey returns the key of an expression compiled with c. Each RandomSeed configurator makes
+// its own source of random values, so the key includes its seed rather than the source.
+func newCacheKey(someExpression string, c config) cacheKey {
+	c.random = nil
+	return cacheKey{someExpression, c}
+}
+
+type cacheEntry struct {
+	key cacheKey
+	exp *Expression
+}
+
+// lruCache is a fixed size least recently used cache of compiled expressions.
+type lruCache struct {
+	lock    sync.Mutex
+	size    int
+	entries map[cacheKey]*list.Element
+	order   *list.List // front is most recently used
+}
+
+func newLRUCache(size int) *lruCache {
+	return &lruCache{
+		size:    size,
+		entries: make(map[cacheKey]*list.Element),
+		order:   list.New(),
+	}
+}
+
+func (c *lruCache) get(key cacheKey) (*Expression, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*cacheEntry).exp, true
+}
+
+func (c *lruCache) put(key cacheKey, exp *Expression) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*cacheEntry).exp = exp
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key, exp})
+	c.evict()
+}
+
+// evict removes least recently used entries until the cache is no larger than its size. The
+// caller must hold the lock.
+func (c *lruCache) evict() {
+	for c.order.Len() > c.size {
+		element := c.order.Back()
+		c.order.Remove(element)
+		delete(c.entries, element.Value.(*cacheEntry).key)
+	}
+}
+
+func (c *lruCache) resize(size int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.size = size
+	c.evict()
+}
+
+func (c *lruCache) purge() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.entries = make(map[cacheKey]*list.Element)
+	c.order.Init()
+}
+
+func (c *lruCache) len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.order.Len()
+}
+
+var expressionCache = newLRUCache(DefaultCacheSize)
+
+// NewCached returns a new RPN Expression based on some expression, just like New, but consults a
+// package wide least recently used cache of compiled expressions first. Programs that parse the
+// same handful of expressions many times only pay the cost of compiling each one once.
+//
+// Each invocation returns its own Expression, so the result may be evaluated independently of
+// other Expressions returned for the same source string.
+//
+//	func example() {
+//		for _, datum := range data {
+//			exp, err := gorpn.NewCached("12,age,*")
+//			if err != nil {
+//				panic(err)
+//			}
+//			value, err := exp.Evaluate(map[string]interface{}{"age": datum})
+//			if err != nil {
+//				panic(err)
+//			}
+//			fmt.Println("value:", value)
+//		}
+//	}
+func NewCached(someExpression string, setters ...ExpressionConfigurator) (*Expression, error) {
+	// apply the configuration to a throw away expression to learn the cache key
+	e := &Expression{config: newConfig()}
+	for _, setter := range setters {
+		if err := setter(e); err != nil {
+			return nil, err
+		}
+	}
+	key := newCacheKey(someExpression, e.config)
+
+	if exp, ok := expressionCache.get(key); ok {
+		exp = exp.clone()
+		exp.trace, exp.metrics, exp.random = e.trace, e.metrics, e.random // not part of the key
+		return exp, nil
+	}
+
+	exp, err := New(someExpression, setters...)
+	if err != nil {
+		return nil, err
+	}
+	expressionCache.put(key, exp)
+	return exp.clone(), nil
+}
+
+// SetCacheSize changes the maximum number of compiled expressions retained by the cache used by
+// NewCached, evicting the least recently used expressions when the cache shrinks. A size of 0
+// disables caching.
+func SetCacheSize(size int) {
+	if size < 0 {
+		size = 0
+	}
+	expressionCache.resize(size)
+}
+
+// PurgeCache discards all compiled expressions from the cache used by NewCached.
+func PurgeCache() {
+	expressionCache.purge()
+}
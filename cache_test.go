@@ -0,0 +1,150 @@
+package gorpn
+
+import "testing"
+
+func TestNewCachedReturnsIndependentExpressions(t *testing.T) {
+	PurgeCache()
+	defer PurgeCache()
+
+	exp1, err := NewCached("12,age,*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp2, err := NewCached("12,age,*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp1 == exp2 {
+		t.Fatalf("Actual: %p; Expected: different pointer than %p", exp2, exp1)
+	}
+	if actual, expected := expressionCache.len(), 1; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+
+	value1, err := exp1.Evaluate(map[string]interface{}{"age": 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	value2, err := exp2.Evaluate(map[string]interface{}{"age": 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := float64(24); value1 != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", value1, expected)
+	}
+	if expected := float64(36); value2 != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", value2, expected)
+	}
+}
+
+func TestNewCachedKeyIncludesConfiguration(t *testing.T) {
+	PurgeCache()
+	defer PurgeCache()
+
+	exp1, err := NewCached("STEPWIDTH")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp2, err := NewCached("STEPWIDTH", SecondsPerInterval(60))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual, expected := exp1.String(), "300"; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+	if actual, expected := exp2.String(), "60"; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+}
+
+func TestNewCachedKeyIncludesRandomSeed(t *testing.T) {
+	PurgeCache()
+	defer PurgeCache()
+
+	values := make([]float64, 3)
+	for i, seed := range []int64{42, 42, 7} {
+		exp, err := NewCached("RANDOM", RandomSeed(seed))
+		if err != nil {
+			t.Fatal(err)
+		}
+		values[i], err = exp.Evaluate(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if actual, expected := expressionCache.len(), 2; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+	// each expression starts the sequence of its own seed, even when returned from the cache
+	if values[0] != values[1] {
+		t.Errorf("Actual: %#v; Expected: %#v", values[1], values[0])
+	}
+	if values[0] == values[2] {
+		t.Errorf("Actual: %#v; Expected: other than %#v", values[2], values[0])
+	}
+}
+
+func TestNewCachedErrorsNotCached(t *testing.T) {
+	PurgeCache()
+	defer PurgeCache()
+
+	if _, err := NewCached("4,*"); err == nil {
+		t.Errorf("Actual: %#v; Expected: %#v", err, "syntax error")
+	}
+	if _, err := NewCached("13", Delimiter('+')); err == nil {
+		t.Errorf("Actual: %#v; Expected: %#v", err, "syntax error")
+	}
+	if actual, expected := expressionCache.len(), 0; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+}
+
+func TestSetCacheSizeEvictsLeastRecentlyUsed(t *testing.T) {
+	PurgeCache()
+	defer func() {
+		SetCacheSize(DefaultCacheSize)
+		PurgeCache()
+	}()
+
+	SetCacheSize(2)
+	for _, someExpression := range []string{"a,1,+", "b,1,+", "a,1,+", "c,1,+"} {
+		if _, err := NewCached(someExpression); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if actual, expected := expressionCache.len(), 2; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+	if _, ok := expressionCache.get(cacheKey{"b,1,+", newConfig()}); ok {
+		t.Errorf("Actual: %#v; Expected: %#v", ok, false)
+	}
+	if _, ok := expressionCache.get(cacheKey{"a,1,+", newConfig()}); !ok {
+		t.Errorf("Actual: %#v; Expected: %#v", ok, true)
+	}
+
+	SetCacheSize(0)
+	if actual, expected := expressionCache.len(), 0; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+}
+
+func TestNewCachedUsesOwnTrace(t *testing.T) {
+	PurgeCache()
+	defer PurgeCache()
+
+	var first, second int
+	if _, err := NewCached("a,b,+", Trace(func(TraceEvent) { first++ })); err != nil {
+		t.Fatal(err)
+	}
+	exp, err := NewCached("a,b,+", Trace(func(TraceEvent) { second++ }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, second = 0, 0
+	if _, err = exp.Evaluate(map[string]interface{}{"a": 1, "b": 2}); err != nil {
+		t.Fatal(err)
+	}
+	if first != 0 || second != 1 {
+		t.Errorf("Actual: %#v, %#v; Expected: %#v, %#v", first, second, 0, 1)
+	}
+}
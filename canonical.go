@@ -0,0 +1,79 @@
+package gorpn
+
+// commutativeOperators are the operators that consume two operands and compute the same result
+// when their operands are swapped.
+var commutativeOperators = map[string]bool{
+	"*": true, "+": true, "ADDNAN": true, "BITAND": true, "BITOR": true, "EQ": true, "MAX": true,
+	"MAXNAN": true, "MIN": true, "MINNAN": true, "NE": true,
+}
+
+// Canonical returns a new Expression that computes the same results as the Expression, with the
+// operands of each commutative operator, such as + and MAX, in a deterministic order: constants
+// after the operands computed from symbols, and otherwise operands computed by operators before
+// symbols, which are in lexicographic order. Expressions generated by different systems that
+// differ only in the order of such operands have the same canonical Expression, and therefore the
+// same Hash, and are Equal, so that they may be deduplicated. Operands are only swapped, never
+// regrouped, because regrouping floating point arithmetic may change its results. The canonical
+// Expression is simplified just like the result of Partial.
+//
+// The programs of Expressions that leave other than one value on the stack, or use operators whose
+// operands are not known until evaluation, such as COPY or SORT, are left as they are.
+//
+//	func example() {
+//		a, err := gorpn.New("2,qps,*,latency,+")
+//		if err != nil {
+//			panic(err)
+//		}
+//		b, err := gorpn.New("latency,qps,2,*,+")
+//		if err != nil {
+//			panic(err)
+//		}
+//		ca, err := a.Canonical()
+//		if err != nil {
+//			panic(err)
+//		}
+//		cb, err := b.Canonical()
+//		if err != nil {
+//			panic(err)
+//		}
+//		same := ca.Equal(cb) // true; both are "qps,2,*,latency,+"
+//	}
+func (e *Expression) Canonical() (*Expression, error) {
+	exp := e.clone()
+	root, err := expressionTree(e.tokens, "canonicalize")
+	if err != nil {
+		return exp, nil
+	}
+	exp.tokens, exp.sources = emitForest([]*node{canonicalTree(root)}), nil // no longer derived from the source
+	exp.scratchSize = scratchSizeFor(exp.tokens)
+	exp.scratch = make([]interface{}, exp.scratchSize)
+	exp.isFloat = make([]bool, exp.scratchSize)
+	return exp.Partial(nil)
+}
+
+// canonicalTree returns the expression tree n with the operands of each commutative operator in
+// canonical order.
+func canonicalTree(n *node) *node {
+	if !n.isOperator() {
+		return n
+	}
+	children := make([]*node, len(n.children))
+	for i, child := range n.children {
+		children[i] = canonicalTree(child)
+	}
+	if operator, _ := n.token.(string); commutativeOperators[operator] && canonicalLess(children[1], children[0]) {
+		children[0], children[1] = children[1], children[0]
+	}
+	return newNode(n.token, children)
+}
+
+// canonicalLess returns true when a precedes b as the operands of a commutative operator: constants
+// come last, and otherwise operands are ordered by their keys.
+func canonicalLess(a, b *node) bool {
+	_, aIsConstant := a.token.(float64)
+	_, bIsConstant := b.token.(float64)
+	if aIsConstant != bIsConstant {
+		return bIsConstant
+	}
+	return a.key < b.key
+}
@@ -0,0 +1,108 @@
+package gorpn
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCanonical(t *testing.T) {
+	list := map[string]string{
+		"qps,2,*":                   "qps,2,*",
+		"2,qps,*":                   "qps,2,*",
+		"b,a,+":                     "a,b,+",
+		"2,qps,*,latency,+":         "qps,2,*,latency,+",
+		"latency,qps,2,*,+":         "qps,2,*,latency,+",
+		"b,a,MAX,c,MIN":             "a,b,MAX,c,MIN",
+		"c,b,a,MAX,MIN":             "a,b,MAX,c,MIN",
+		"b,a,-":                     "b,a,-", // not commutative
+		"b,a,GT":                    "b,a,GT",
+		"b,a,EQ,d,c,NE,BITAND":      "a,b,EQ,c,d,NE,BITAND",
+		"b,a,+,c,+":                 "a,b,+,c,+", // operands are swapped, but never regrouped
+		"c,b,a,+,+":                 "a,b,+,c,+",
+		"b,a,+,b,a,+,*":             "a,b,+,DUP,*",
+		"b,a,2,SORT,+":              "b,a,2,SORT,+", // not a single tree
+		"b,a,+,ALLMAX":              "b,a,+,ALLMAX",
+		"1,label,count,TREND,+":     "label,count,TREND,1,+",
+		"qps,1,2,+,*":               "qps,3,*",
+		"x,y,ADDNAN,z,MAXNAN,w,*":   "x,y,ADDNAN,z,MAXNAN,w,*",
+		"y,x,ADDNAN,z,MAXNAN,w,*":   "x,y,ADDNAN,z,MAXNAN,w,*",
+		"a,b,c,IF,a,b,c,IF,*,1,+":   "a,b,c,IF,DUP,*,1,+",
+		"b,a,BITOR,2,a,b,BITOR,+,*": "a,b,BITOR,2,+,a,b,BITOR,*",
+	}
+	for input, expected := range list {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		canonical, err := exp.Canonical()
+		if err != nil {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+			continue
+		}
+		if actual := canonical.String(); actual != expected {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, actual, expected)
+		}
+	}
+}
+
+func TestCanonicalEqual(t *testing.T) {
+	list := map[string][2]string{
+		"operands":   {"2,qps,*,latency,+", "latency,qps,2,*,+"},
+		"nested":     {"a,b,MIN,c,MAX", "c,b,a,MIN,MAX"},
+		"comparison": {"a,b,EQ", "b,a,EQ"},
+	}
+	for name, item := range list {
+		a, err := New(item[0])
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", name, err, nil)
+		}
+		b, err := New(item[1])
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", name, err, nil)
+		}
+		if a.Equal(b) {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, true, false)
+		}
+		ca, err := a.Canonical()
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", name, err, nil)
+		}
+		cb, err := b.Canonical()
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", name, err, nil)
+		}
+		if !ca.Equal(cb) {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, cb.String(), ca.String())
+		}
+		if ca.Hash() != cb.Hash() {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, cb.Hash(), ca.Hash())
+		}
+
+		bindings := map[string]interface{}{"a": 3, "b": math.NaN(), "c": 5, "qps": 7, "latency": 11}
+		expected, expectedErr := a.Evaluate(bindings)
+		actual, actualErr := ca.Evaluate(bindings)
+		if (actualErr != nil) != (expectedErr != nil) || (actual != expected && !(math.IsNaN(actual) && math.IsNaN(expected))) {
+			t.Errorf("Case: %s; Actual: %v, %#v; Expected: %v, %#v", name, actual, actualErr, expected, expectedErr)
+		}
+	}
+}
+
+func TestCanonicalIdempotent(t *testing.T) {
+	for _, input := range []string{"c,b,a,+,*,2,MAX", "b,a,+,b,a,+,*", "x,3,b,a,IF,+"} {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		once, err := exp.Canonical()
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		twice, err := once.Canonical()
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if !twice.Equal(once) {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, twice.String(), once.String())
+		}
+	}
+}
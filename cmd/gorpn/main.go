@@ -0,0 +1,152 @@
+// Command gorpn simplifies and evaluates RPN expressions from the command line, which is handy for
+// debugging expressions without writing Go.
+//
+//	$ gorpn -bind errors=6 -bind requests=100 'errors,requests,/,100,*'
+//	simplified: 6
+//	result: 6
+//
+//	$ gorpn -series qps=@qps.txt 'qps,600,TREND,limit,GT'
+//	simplified: qps,600,TREND,limit,GT
+//	open bindings: limit
+//
+// Symbols left unbound are written to standard error, and the command exits with a non-zero status.
+//
+// With -repl, lines are read from standard input and given to an interactive evaluator, which shows
+// the stack after each token of every expression, and accepts commands such as :bind to change the
+// bindings given on the command line. See package repl for the commands.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/karrick/gorpn"
+	"github.com/karrick/gorpn/repl"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// bindingFlags collects the values of the repeatable -bind and -series flags.
+type bindingFlags struct {
+	bindings map[string]interface{}
+	series   bool // true for -series, whose values name files of numbers
+}
+
+func (f bindingFlags) String() string { return "" }
+
+func (f bindingFlags) Set(arg string) error {
+	idx := strings.IndexByte(arg, '=')
+	if idx <= 0 {
+		return fmt.Errorf("expected key=value: %q", arg)
+	}
+	key, value := arg[:idx], arg[idx+1:]
+	if !f.series {
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("cannot parse value of %q: %w", key, err)
+		}
+		f.bindings[key] = v
+		return nil
+	}
+	if !strings.HasPrefix(value, "@") {
+		return fmt.Errorf("expected key=@file: %q", arg)
+	}
+	values, err := readSeries(value[1:])
+	if err != nil {
+		return err
+	}
+	f.bindings[key] = values
+	return nil
+}
+
+// readSeries returns the numbers in the named file, separated by white space or commas.
+func readSeries(pathname string) ([]float64, error) {
+	buf, err := os.ReadFile(pathname)
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.FieldsFunc(string(buf), func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+	values := make([]float64, len(fields))
+	for i, field := range fields {
+		if values[i], err = strconv.ParseFloat(field, 64); err != nil {
+			return nil, fmt.Errorf("cannot parse series in %s: %w", pathname, err)
+		}
+	}
+	return values, nil
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	bindings := make(map[string]interface{})
+	flags := flag.NewFlagSet("gorpn", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Var(bindingFlags{bindings: bindings}, "bind", "bind `key=value` (may be repeated)")
+	flags.Var(bindingFlags{bindings: bindings, series: true}, "series", "bind `key=@file` to the series of numbers in file (may be repeated)")
+	interactive := flags.Bool("repl", false, "read expressions and commands from standard input, showing the stack after each token")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: gorpn [-bind key=value]... [-series key=@file]... expression")
+		fmt.Fprintln(stderr, "       gorpn [-bind key=value]... [-series key=@file]... -repl")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if *interactive {
+		if flags.NArg() != 0 {
+			flags.Usage()
+			return 2
+		}
+		r := repl.New(stdout)
+		r.Bindings = bindings
+		if fh, ok := stdin.(*os.File); ok {
+			if fi, err := fh.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+				r.Prompt = "> " // only prompt people, not pipes
+			}
+		}
+		if err := r.Run(stdin); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		return 0
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	if err := report(stdout, flags.Arg(0), bindings); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// report writes the simplified form of someExpression after applying bindings, followed by its
+// value. It returns an ErrOpenBindings error when some of its symbols are not bound.
+func report(w io.Writer, someExpression string, bindings map[string]interface{}) error {
+	exp, err := gorpn.New(someExpression)
+	if err != nil {
+		return err
+	}
+	partial, err := exp.Partial(bindings)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, "simplified:", partial)
+
+	// Partial leaves TIME and NOW to be bound by Evaluate
+	result, err := exp.Evaluate(bindings)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, "result:", strconv.FormatFloat(result, 'g', -1, 64))
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	series := filepath.Join(t.TempDir(), "qps.txt")
+	if err := os.WriteFile(series, []byte("1\n2\n3, 4\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	list := map[string]struct {
+		args   []string
+		output string
+	}{
+		"bound": {
+			[]string{"-bind", "a=3", "-bind", "b=5", "a,b,+"},
+			"simplified: 8\nresult: 8\n",
+		},
+		"time": {
+			[]string{"-bind", "TIME=1700000000", "TIME,1,+"},
+			"simplified: TIME,1,+\nresult: 1.700000001e+09\n",
+		},
+		"now": {
+			[]string{"-bind", "NOW=1700000000", "NOW,0,GT"},
+			"simplified: NOW,0,GT\nresult: 1\n",
+		},
+		"untaken branch": {
+			[]string{"-bind", "a=0", "-bind", "b=5", "a,c,1,+,b,IF"},
+			"simplified: 5\nresult: 5\n",
+		},
+		"series": {
+			[]string{"-series", "qps=@" + series, "qps,1200,TREND"},
+			"simplified: 2.5\nresult: 2.5\n",
+		},
+	}
+	for name, item := range list {
+		var stdout, stderr strings.Builder
+		if actual, expected := run(item.args, strings.NewReader(""), &stdout, &stderr), 0; actual != expected {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v; Stderr: %s", name, actual, expected, stderr.String())
+		}
+		if actual := stdout.String(); actual != item.output {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, actual, item.output)
+		}
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	list := map[string][]string{
+		"bad binding":   {"-bind", "a=three", "a"},
+		"bad series":    {"-series", "a=qps.txt", "a"},
+		"no expression": {},
+		"bad syntax":    {"a,+"},
+	}
+	for name, args := range list {
+		var stdout, stderr strings.Builder
+		if code := run(args, strings.NewReader(""), &stdout, &stderr); code == 0 {
+			t.Errorf("Case: %s; Actual: %#v; Expected: non-zero", name, code)
+		}
+	}
+}
+
+func TestRunOpenBindings(t *testing.T) {
+	var stdout, stderr strings.Builder
+	if code := run([]string{"-bind", "a=3", "a,b,+,c,*"}, strings.NewReader(""), &stdout, &stderr); code == 0 {
+		t.Errorf("Actual: %#v; Expected: non-zero", code)
+	}
+	if actual, expected := stdout.String(), "simplified: 3,b,+,c,*\n"; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+	if actual, expected := stderr.String(), "open bindings: b,c\n"; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+}
+
+func TestRunREPL(t *testing.T) {
+	var stdout, stderr strings.Builder
+	stdin := strings.NewReader("a,2,*\n\na,+\n")
+	if actual, expected := run([]string{"-bind", "a=3", "-repl"}, stdin, &stdout, &stderr), 0; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v; Stderr: %s", actual, expected, stderr.String())
+	}
+	expected := "  a  [3]\n  2  [3 2]\n  *  [6]\n= 6\nerror: syntax error : not enough parameters: operator + requires 2 operands\n"
+	if actual := stdout.String(); actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+}
@@ -0,0 +1,75 @@
+package gorpn
+
+// Compose returns a single Expression that computes outer with each symbol that is a key of inner
+// replaced by the program of its respective Expression, leaving outer and the inner expressions
+// unchanged. An inner Expression may itself use the symbols of other inner expressions, which are
+// replaced as well. Because the result is simplified just like the result of Partial, constants
+// and repeated subexpressions are folded across the boundaries of the expressions, which is not
+// possible when evaluating them one after another. The result has the configuration of outer.
+//
+// It returns an error when an inner Expression is known to leave other than exactly one item on
+// the stack, because replacing a symbol by it would corrupt the stack of outer, or when an inner
+// Expression refers to itself, directly or indirectly.
+//
+//	func example() {
+//		outer, err := gorpn.New("errors,requests,/,100,*")
+//		if err != nil {
+//			panic(err)
+//		}
+//		errors, err := gorpn.New("http5xx,grpc_errors,+")
+//		if err != nil {
+//			panic(err)
+//		}
+//		requests, err := gorpn.New("http_requests,grpc_requests,+")
+//		if err != nil {
+//			panic(err)
+//		}
+//		fused, err := gorpn.Compose(outer, map[string]*gorpn.Expression{"errors": errors, "requests": requests})
+//		s := fused.String() // "http5xx,grpc_errors,+,http_requests,grpc_requests,+,/,100,*"
+//	}
+func Compose(outer *Expression, inner map[string]*Expression) (*Expression, error) {
+	bindings := make(map[string]interface{}, len(inner))
+	for symbol, exp := range inner {
+		if exp == nil {
+			return nil, newErrSyntax("cannot compose %q with nil expression", symbol)
+		}
+		if depth, known := exp.stackDepth(); known && depth != 1 {
+			return nil, newErrSyntax("cannot compose %q with expression that leaves %d items on stack: %s", symbol, depth, exp)
+		}
+		bindings[symbol] = exp
+	}
+	return outer.Partial(bindings)
+}
+
+// Substitute returns a new Expression with symbol replaced by the program of inner, just like
+// Compose does for a single symbol.
+//
+//	func example() {
+//		exp, err := gorpn.New("bytes,8,*")
+//		if err != nil {
+//			panic(err)
+//		}
+//		bytes, err := gorpn.New("rx,tx,+")
+//		if err != nil {
+//			panic(err)
+//		}
+//		bits, err := exp.Substitute("bytes", bytes)
+//		s := bits.String() // "rx,tx,+,8,*"
+//	}
+func (e *Expression) Substitute(symbol string, inner *Expression) (*Expression, error) {
+	return Compose(e, map[string]*Expression{symbol: inner})
+}
+
+// stackDepth returns how many items the program of the Expression leaves on the stack, and false
+// when that is not known until evaluation.
+func (e *Expression) stackDepth() (int, bool) {
+	var depth int
+	for position := range e.tokens {
+		pops, pushes, known := e.stackEffect(position, depth)
+		if !known {
+			return 0, false
+		}
+		depth += pushes - pops
+	}
+	return depth, true
+}
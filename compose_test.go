@@ -0,0 +1,129 @@
+package gorpn
+
+import (
+	"testing"
+)
+
+func TestCompose(t *testing.T) {
+	list := map[string]struct {
+		outer    string
+		inner    map[string]string
+		expected string
+	}{
+		"fused": {
+			outer:    "errors,requests,/,100,*",
+			inner:    map[string]string{"errors": "http5xx,grpc_errors,+", "requests": "http_requests,grpc_requests,+"},
+			expected: "http5xx,grpc_errors,+,http_requests,grpc_requests,+,/,100,*",
+		},
+		"folded across boundary": {
+			outer:    "x,2,MAX",
+			inner:    map[string]string{"x": "y,3,MAX"},
+			expected: "y,3,MAX",
+		},
+		"repeated": {
+			outer:    "x,x,*",
+			inner:    map[string]string{"x": "a,b,+"},
+			expected: "a,b,+,DUP,*",
+		},
+		"nested": {
+			outer:    "x,1,+",
+			inner:    map[string]string{"x": "y,10,*", "y": "a,b,-"},
+			expected: "a,b,-,10,*,1,+",
+		},
+		"constant": {
+			outer:    "x,y,*",
+			inner:    map[string]string{"x": "60,60,*", "y": "24"},
+			expected: "86400",
+		},
+		"stack operators": {
+			outer:    "x,2,/",
+			inner:    map[string]string{"x": "a,b,c,3,SORT,POP,EXC,POP"},
+			expected: "a,b,c,3,SORT,POP,EXC,POP,2,/",
+		},
+		"unused": {
+			outer:    "a,1,+",
+			inner:    map[string]string{"z": "b,c,+"},
+			expected: "a,1,+",
+		},
+	}
+	for name, item := range list {
+		outer, err := New(item.outer)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", name, err, nil)
+		}
+		inner := make(map[string]*Expression, len(item.inner))
+		for symbol, input := range item.inner {
+			if inner[symbol], err = New(input); err != nil {
+				t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", name, err, nil)
+			}
+		}
+		composed, err := Compose(outer, inner)
+		if err != nil {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, err, nil)
+			continue
+		}
+		if actual := composed.String(); actual != item.expected {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, actual, item.expected)
+		}
+		if actual := outer.String(); actual != item.outer {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, actual, item.outer)
+		}
+	}
+}
+
+func TestComposeErrors(t *testing.T) {
+	outer, err := New("x,1,+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := map[string]struct {
+		inner    map[string]string
+		expected string
+	}{
+		"two items":   {map[string]string{"x": "a,b"}, "syntax error : cannot compose \"x\" with expression that leaves 2 items on stack: a,b"},
+		"self":        {map[string]string{"x": "x,2,*"}, "syntax error : cannot bind \"x\" to an expression that refers to itself"},
+		"cycle":       {map[string]string{"x": "y,2,*", "y": "x,3,*"}, "syntax error : cannot bind \"x\" to an expression that refers to itself"},
+		"many copies": {map[string]string{"x": "a,b,2,COPY"}, "syntax error : cannot compose \"x\" with expression that leaves 4 items on stack: a,b,a,b"},
+	}
+	for name, item := range list {
+		inner := make(map[string]*Expression, len(item.inner))
+		for symbol, input := range item.inner {
+			if inner[symbol], err = New(input); err != nil {
+				t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", name, err, nil)
+			}
+		}
+		composed, err := Compose(outer, inner)
+		if err == nil || err.Error() != item.expected {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, err, item.expected)
+		}
+		if composed != nil {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, composed.String(), nil)
+		}
+	}
+
+	if _, err = Compose(outer, map[string]*Expression{"x": nil}); err == nil {
+		t.Errorf("Actual: %#v; Expected: %#v", err, "cannot compose \"x\" with nil expression")
+	}
+}
+
+func TestSubstitute(t *testing.T) {
+	exp, err := New("bytes,8,*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bytes, err := New("rx,tx,+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bits, err := exp.Substitute("bytes", bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual, expected := bits.String(), "rx,tx,+,8,*"; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+	value, err := bits.Evaluate(map[string]interface{}{"rx": 10, "tx": 5})
+	if err != nil || value != 120 {
+		t.Errorf("Actual: %#v, %#v; Expected: %#v", value, err, 120.0)
+	}
+}
@@ -0,0 +1,174 @@
+package gorpn
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// ErrExpression error is returned by EvaluateConcurrent when one of the expressions it evaluates
+// returns an error.
+type ErrExpression struct {
+	Name string // name of the expression
+	Err  error  // error returned by evaluating it
+}
+
+// Error returns the error string representation for ErrExpression errors.
+func (e ErrExpression) Error() string {
+	return fmt.Sprintf("%s: %s", e.Name, e.Err)
+}
+
+// Unwrap returns the error returned by evaluating the expression.
+func (e ErrExpression) Unwrap() error {
+	return e.Err
+}
+
+// concurrentJob is an expression ready to be evaluated, along with its bindings.
+type concurrentJob struct {
+	name       string
+	expression *Expression
+	bindings   map[string]interface{}
+}
+
+// concurrentResult is the result of evaluating a concurrentJob.
+type concurrentResult struct {
+	name  string
+	value float64
+	err   error
+}
+
+// EvaluateConcurrent evaluates a set of named expressions, such as the hundreds of CDEFs of a
+// dashboard, using up to workers goroutines, and returns the result of each by name. An expression
+// may use the name of another expression in the set as a symbol, in which case it is evaluated
+// after that expression, with its result bound to that symbol. Expressions that do not depend on
+// one another are evaluated in parallel. The names of the expressions take precedence over the
+// keys of bindings, which are given to every expression and are not modified. When workers is less
+// than 1, GOMAXPROCS goroutines are used.
+//
+// It returns an error when the expressions depend on one another in a cycle, an ErrExpression
+// error when evaluating an expression returns an error, and the error of ctx when ctx is done
+// before every expression has been evaluated. In any case, no more expressions are evaluated once
+// it returns. Each expression is evaluated using a copy, so an Expression may appear in the set
+// more than once. Because the copies are made while it runs, the Expressions in the set must not
+// be used elsewhere, such as by Evaluate or Partial, until it returns; pass a Clone instead.
+//
+//	func example(ctx context.Context) {
+//		a, _ := gorpn.New("busy,idle,+")
+//		b, _ := gorpn.New("busy,total,/,100,*")
+//		values, err := gorpn.EvaluateConcurrent(ctx, map[string]*gorpn.Expression{"total": a, "load": b},
+//			map[string]interface{}{"busy": 30, "idle": 70}, 4)
+//		// values is map[load:30 total:100]
+//	}
+func EvaluateConcurrent(ctx context.Context, expressions map[string]*Expression, bindings map[string]interface{}, workers int) (map[string]float64, error) {
+	dependencies := make(map[string][]string, len(expressions)) // names each expression uses
+	dependents := make(map[string][]string, len(expressions))   // names of expressions using each
+	pending := make(map[string]int, len(expressions))           // dependencies not yet evaluated
+	names := make([]string, 0, len(expressions))
+	for name, exp := range expressions {
+		names = append(names, name)
+		for _, symbol := range exp.OpenBindings() {
+			if _, ok := expressions[symbol]; ok {
+				dependencies[name] = append(dependencies[name], symbol)
+				dependents[symbol] = append(dependents[symbol], name)
+				pending[name]++
+			}
+		}
+	}
+	sort.Strings(names)
+	if cycle := dependencyCycle(names, dependents, pending); len(cycle) > 0 {
+		return nil, newErrSyntax("cannot evaluate expressions that depend on one another: %s", strings.Join(cycle, ", "))
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	jobs := make(chan concurrentJob, len(expressions))
+	results := make(chan concurrentResult, len(expressions))
+	defer close(jobs)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for job := range jobs {
+				if err := ctx.Err(); err != nil {
+					results <- concurrentResult{name: job.name, err: err}
+					continue
+				}
+				value, err := job.expression.clone().Evaluate(job.bindings)
+				results <- concurrentResult{name: job.name, value: value, err: err}
+			}
+		}()
+	}
+
+	values := make(map[string]float64, len(expressions))
+	enqueue := func(name string) {
+		jobBindings := make(map[string]interface{}, len(bindings)+len(dependencies[name]))
+		for symbol, value := range bindings {
+			jobBindings[symbol] = value
+		}
+		for _, symbol := range dependencies[name] {
+			jobBindings[symbol] = values[symbol]
+		}
+		jobs <- concurrentJob{name: name, expression: expressions[name], bindings: jobBindings}
+	}
+	for _, name := range names {
+		if pending[name] == 0 {
+			enqueue(name)
+		}
+	}
+
+	for len(values) < len(expressions) {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case result := <-results:
+			if result.err != nil {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+				return nil, ErrExpression{Name: result.name, Err: result.err}
+			}
+			values[result.name] = result.value
+			for _, dependent := range dependents[result.name] {
+				if pending[dependent]--; pending[dependent] == 0 {
+					enqueue(dependent)
+				}
+			}
+		}
+	}
+	return values, nil
+}
+
+// dependencyCycle returns the sorted names of the expressions that cannot be evaluated because
+// they depend on one another, directly or indirectly, or nil when there are none.
+func dependencyCycle(names []string, dependents map[string][]string, pending map[string]int) []string {
+	remaining := make(map[string]int, len(pending))
+	var ready []string
+	for _, name := range names {
+		remaining[name] = pending[name]
+		if pending[name] == 0 {
+			ready = append(ready, name)
+		}
+	}
+	for len(ready) > 0 {
+		name := ready[len(ready)-1]
+		ready = ready[:len(ready)-1]
+		delete(remaining, name)
+		for _, dependent := range dependents[name] {
+			if remaining[dependent]--; remaining[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+	if len(remaining) == 0 {
+		return nil
+	}
+	cycle := make([]string, 0, len(remaining))
+	for name := range remaining {
+		cycle = append(cycle, name)
+	}
+	sort.Strings(cycle)
+	return cycle
+}
@@ -0,0 +1,161 @@
+package gorpn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestEvaluateConcurrent(t *testing.T) {
+	list := map[string]struct {
+		expressions map[string]string
+		expected    map[string]float64
+	}{
+		"independent": {
+			expressions: map[string]string{"a": "1,2,+", "b": "x,10,*", "c": "x,y,-"},
+			expected:    map[string]float64{"a": 3, "b": 30, "c": -1},
+		},
+		"chain": {
+			expressions: map[string]string{"total": "busy,idle,+", "load": "busy,total,/,100,*", "high": "load,25,GT"},
+			expected:    map[string]float64{"total": 100, "load": 30, "high": 1},
+		},
+		"diamond": {
+			expressions: map[string]string{"a": "x,2,*", "b": "a,1,+", "c": "a,1,-", "d": "b,c,*"},
+			expected:    map[string]float64{"a": 6, "b": 7, "c": 5, "d": 35},
+		},
+		"shadows binding": {
+			expressions: map[string]string{"x": "100", "y": "x,1,+"},
+			expected:    map[string]float64{"x": 100, "y": 101},
+		},
+	}
+	bindings := map[string]interface{}{"x": 3, "y": 4, "busy": 30, "idle": 70}
+
+	for name, item := range list {
+		expressions := make(map[string]*Expression, len(item.expressions))
+		for symbol, input := range item.expressions {
+			exp, err := New(input)
+			if err != nil {
+				t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", name, err, nil)
+			}
+			expressions[symbol] = exp
+		}
+		for _, workers := range []int{0, 1, 4} {
+			actual, err := EvaluateConcurrent(context.Background(), expressions, bindings, workers)
+			if err != nil {
+				t.Errorf("Case: %s; Workers: %d; Actual: %#v; Expected: %#v", name, workers, err, nil)
+				continue
+			}
+			if !reflect.DeepEqual(actual, item.expected) {
+				t.Errorf("Case: %s; Workers: %d; Actual: %#v; Expected: %#v", name, workers, actual, item.expected)
+			}
+		}
+	}
+	if bindings["x"] != 3 || len(bindings) != 4 {
+		t.Errorf("Case: bindings modified; Actual: %#v", bindings)
+	}
+}
+
+func TestEvaluateConcurrentMany(t *testing.T) {
+	// every expression adds one to the one before it, and is the same Expression as many others
+	expressions := make(map[string]*Expression)
+	independent, err := New("x,1,+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expressions["e0"] = independent
+	for i := 1; i < 200; i++ {
+		exp, err := New(fmt.Sprintf("e%d,1,+", i-1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expressions[fmt.Sprintf("e%d", i)] = exp
+		expressions[fmt.Sprintf("s%d", i)] = independent
+	}
+	actual, err := EvaluateConcurrent(context.Background(), expressions, map[string]interface{}{"x": 0}, 8)
+	if err != nil {
+		t.Fatalf("Actual: %#v; Expected: %#v", err, nil)
+	}
+	for i := 0; i < 200; i++ {
+		if value, expected := actual[fmt.Sprintf("e%d", i)], float64(i+1); value != expected {
+			t.Errorf("Case: e%d; Actual: %#v; Expected: %#v", i, value, expected)
+		}
+	}
+	if len(actual) != len(expressions) {
+		t.Errorf("Actual: %#v; Expected: %#v", len(actual), len(expressions))
+	}
+}
+
+func TestEvaluateConcurrentErrors(t *testing.T) {
+	list := map[string]struct {
+		expressions map[string]string
+		expected    string
+	}{
+		"cycle": {
+			expressions: map[string]string{"a": "b,1,+", "b": "c,1,+", "c": "a,1,+", "d": "x,1,+"},
+			expected:    "syntax error : cannot evaluate expressions that depend on one another: a, b, c",
+		},
+		"self": {
+			expressions: map[string]string{"a": "a,1,+"},
+			expected:    "syntax error : cannot evaluate expressions that depend on one another: a",
+		},
+		"after cycle": {
+			expressions: map[string]string{"a": "b,1,+", "b": "a,1,+", "c": "a,1,+"},
+			expected:    "syntax error : cannot evaluate expressions that depend on one another: a, b, c",
+		},
+		"open binding": {
+			expressions: map[string]string{"a": "x,1,+", "b": "a,missing,+"},
+			expected:    "b: open bindings: missing",
+		},
+	}
+	for name, item := range list {
+		expressions := make(map[string]*Expression, len(item.expressions))
+		for symbol, input := range item.expressions {
+			exp, err := New(input)
+			if err != nil {
+				t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", name, err, nil)
+			}
+			expressions[symbol] = exp
+		}
+		actual, err := EvaluateConcurrent(context.Background(), expressions, map[string]interface{}{"x": 1}, 2)
+		if err == nil || err.Error() != item.expected {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, err, item.expected)
+		}
+		if actual != nil {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, actual, nil)
+		}
+	}
+}
+
+func TestEvaluateConcurrentErrExpression(t *testing.T) {
+	exp, err := New("x,y,+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = EvaluateConcurrent(context.Background(), map[string]*Expression{"sum": exp}, map[string]interface{}{"x": 1}, 1)
+	var expressionError ErrExpression
+	if !errors.As(err, &expressionError) || expressionError.Name != "sum" {
+		t.Fatalf("Actual: %#v; Expected: %#v", err, ErrExpression{Name: "sum"})
+	}
+	var openBindings ErrOpenBindings
+	if !errors.As(err, &openBindings) || !reflect.DeepEqual(openBindings, ErrOpenBindings{"y": ScalarKind}) {
+		t.Errorf("Actual: %#v; Expected: %#v", expressionError.Err, ErrOpenBindings{"y": ScalarKind})
+	}
+}
+
+func TestEvaluateConcurrentCanceled(t *testing.T) {
+	exp, err := New("1,2,+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	actual, err := EvaluateConcurrent(ctx, map[string]*Expression{"a": exp}, nil, 1)
+	if err != context.Canceled {
+		t.Errorf("Actual: %#v; Expected: %#v", err, context.Canceled)
+	}
+	if actual != nil {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, nil)
+	}
+}
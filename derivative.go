@@ -0,0 +1,197 @@
+package gorpn
+
+// Derivative returns a new Expression that computes the derivative of the Expression with respect
+// to symbol, which is useful for sensitivity analysis of composed formulas, such as how much the
+// capacity required by a model changes as its request rate grows. The parts of the Expression that
+// depend on symbol may only use the +, -, *, /, POW, EXP, LOG, SIN, and COS operators, while the
+// parts that do not depend on symbol may use any operator that computes a single value from its
+// operands. The derivative is simplified just like the result of Partial.
+//
+//	func example() {
+//		exp, err := gorpn.New("qps,qps,*,3,*,latency,+")
+//		if err != nil {
+//			panic(err)
+//		}
+//		sensitivity, err := exp.Derivative("qps")
+//		if err != nil {
+//			panic(err)
+//		}
+//		s := sensitivity.String() // "qps,qps,+,3,*"
+//	}
+func (e *Expression) Derivative(symbol string) (*Expression, error) {
+	root, err := expressionTree(e.tokens, "differentiate")
+	if err != nil {
+		return nil, err
+	}
+	derivative, err := differentiate(root, symbol)
+	if err != nil {
+		return nil, err
+	}
+	exp := e.clone()
+	exp.tokens, exp.sources = emitForest([]*node{derivative}), nil // no longer derived from the source
+	exp.scratchSize = scratchSizeFor(exp.tokens)
+	exp.scratch = make([]interface{}, exp.scratchSize)
+	exp.isFloat = make([]bool, exp.scratchSize)
+	return exp.Partial(nil)
+}
+
+// expressionTree converts a stored program into the single expression tree it computes. Unlike
+// buildForest, it expands the DUP and n,INDEX operators that eliminateCommonSubexpressions
+// introduces, so that the tree of any simplified Expression may be analyzed. Errors describe the
+// analysis that cannot be performed using verb, such as "differentiate".
+func expressionTree(tokens []interface{}, verb string) (*node, error) {
+	var stack []*node
+	for _, tok := range tokens {
+		token, ok := tok.(string)
+		if !ok {
+			stack = append(stack, newNode(tok, nil))
+			continue
+		}
+		opArity, isOperator := arity[token]
+		if !isOperator {
+			stack = append(stack, newNode(token, nil))
+			continue
+		}
+		switch {
+		case token == "DUP" && len(stack) > 0:
+			stack = append(stack, stack[len(stack)-1])
+		case token == "INDEX" && len(stack) > 0 && !stack[len(stack)-1].isOperator():
+			n, ok := stack[len(stack)-1].token.(float64)
+			if !ok || n < 1 || int(n) > len(stack)-1 || n != float64(int(n)) {
+				return nil, newErrSyntax("cannot %s %s operator", verb, token)
+			}
+			stack[len(stack)-1] = stack[len(stack)-1-int(n)]
+		case treeOperators[token] && len(stack) >= opArity.popCount:
+			children := make([]*node, opArity.popCount)
+			copy(children, stack[len(stack)-opArity.popCount:])
+			stack = append(stack[:len(stack)-opArity.popCount], newNode(token, children))
+		default:
+			return nil, newErrSyntax("cannot %s %s operator", verb, token)
+		}
+	}
+	if len(stack) != 1 {
+		return nil, newErrSyntax("cannot %s expression that leaves %d items on stack", verb, len(stack))
+	}
+	return stack[0], nil
+}
+
+// differentiate returns the expression tree computing the derivative of the tree n with respect to
+// symbol.
+func differentiate(n *node, symbol string) (*node, error) {
+	if !dependsOn(n, symbol) {
+		return derivativeConstant(0), nil
+	}
+	if !n.isOperator() {
+		return derivativeConstant(1), nil // n is symbol itself
+	}
+
+	// derivatives of the operands, which are needed by every operator below
+	derivatives := make([]*node, len(n.children))
+	for i, child := range n.children {
+		derivative, err := differentiate(child, symbol)
+		if err != nil {
+			return nil, err
+		}
+		derivatives[i] = derivative
+	}
+	a, da := n.children[0], derivatives[0]
+
+	switch n.token {
+	case "+": // a' + b'
+		return derivativeAdd(da, derivatives[1]), nil
+	case "-": // a' - b'
+		return derivativeSubtract(da, derivatives[1]), nil
+	case "*": // a'b + ab'
+		b, db := n.children[1], derivatives[1]
+		return derivativeAdd(derivativeMultiply(da, b), derivativeMultiply(a, db)), nil
+	case "/": // (a'b - ab') / b^2
+		b, db := n.children[1], derivatives[1]
+		if isDerivativeConstant(db, 0) { // a' / b
+			return newNode("/", []*node{da, b}), nil
+		}
+		numerator := derivativeSubtract(derivativeMultiply(da, b), derivativeMultiply(a, db))
+		if isDerivativeConstant(numerator, 0) {
+			return numerator, nil
+		}
+		return newNode("/", []*node{numerator, newNode("*", []*node{b, b})}), nil
+	case "POW":
+		b, db := n.children[1], derivatives[1]
+		if isDerivativeConstant(db, 0) { // b a^(b-1) a'
+			power := newNode("POW", []*node{a, derivativeSubtract(b, derivativeConstant(1))})
+			return derivativeMultiply(derivativeMultiply(b, power), da), nil
+		}
+		// a^b (b' ln(a) + b a' / a)
+		sum := derivativeMultiply(db, newNode("LOG", []*node{a}))
+		if !isDerivativeConstant(da, 0) {
+			sum = derivativeAdd(sum, newNode("/", []*node{derivativeMultiply(b, da), a}))
+		}
+		return derivativeMultiply(n, sum), nil
+	case "EXP": // e^a a'
+		return derivativeMultiply(n, da), nil
+	case "LOG": // a' / a
+		return newNode("/", []*node{da, a}), nil
+	case "SIN": // cos(a) a'
+		return derivativeMultiply(newNode("COS", []*node{a}), da), nil
+	case "COS": // -sin(a) a'
+		return derivativeMultiply(newNode("SIN", []*node{a}), derivativeMultiply(derivativeConstant(-1), da)), nil
+	}
+	return nil, newErrSyntax("cannot differentiate %s operator", n.token)
+}
+
+// dependsOn returns true when the tree n refers to symbol.
+func dependsOn(n *node, symbol string) bool {
+	if !n.isOperator() {
+		return n.token == symbol
+	}
+	for _, child := range n.children {
+		if dependsOn(child, symbol) {
+			return true
+		}
+	}
+	return false
+}
+
+func derivativeConstant(value float64) *node {
+	return newNode(value, nil)
+}
+
+// isDerivativeConstant returns true when the tree n is the number value.
+func isDerivativeConstant(n *node, value float64) bool {
+	v, ok := n.token.(float64)
+	return ok && v == value
+}
+
+// derivativeAdd, derivativeSubtract, and derivativeMultiply build the trees computing their
+// respective operations, omitting the terms that are known to vanish, which keeps derivatives
+// from growing needlessly, and keeps Partial from having to simplify terms whose operands are
+// operators.
+
+func derivativeAdd(a, b *node) *node {
+	if isDerivativeConstant(a, 0) {
+		return b
+	}
+	if isDerivativeConstant(b, 0) {
+		return a
+	}
+	return newNode("+", []*node{a, b})
+}
+
+func derivativeSubtract(a, b *node) *node {
+	if isDerivativeConstant(b, 0) {
+		return a
+	}
+	return newNode("-", []*node{a, b})
+}
+
+func derivativeMultiply(a, b *node) *node {
+	if isDerivativeConstant(a, 0) || isDerivativeConstant(b, 0) {
+		return derivativeConstant(0)
+	}
+	if isDerivativeConstant(a, 1) {
+		return b
+	}
+	if isDerivativeConstant(b, 1) {
+		return a
+	}
+	return newNode("*", []*node{a, b})
+}
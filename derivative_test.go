@@ -0,0 +1,97 @@
+package gorpn
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDerivative(t *testing.T) {
+	list := map[string]string{
+		"x":                   "1",
+		"y":                   "0",
+		"42":                  "0",
+		"x,x,*,3,*,latency,+": "x,x,+,3,*",
+		"x,2,POW":             "2,x,*",
+		"x,y,POW":             "y,x,y,1,-,POW,*",
+		"2,x,POW":             "2,x,POW,0.6931471805599453,*",
+		"x,EXP":               "x,EXP",
+		"x,LOG":               "1,x,/",
+		"x,SIN":               "x,COS",
+		"x,COS":               "x,SIN,-1,*",
+		"x,y,/":               "1,y,/",
+		"1,x,/":               "-1,x,x,*,/",
+		"x,y,+,x,y,+,*":       "x,y,+,DUP,+", // common subexpressions are expanded
+		"x,2,*,SIN,3,+":       "x,2,*,COS,2,*",
+		"y,z,MAX,x,*":         "y,z,MAX", // any operator may be used independently of x
+		"c,a,b,IF,x,+":        "1",
+	}
+	for input, output := range list {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		derivative, err := exp.Derivative("x")
+		if err != nil {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+			continue
+		}
+		if actual := derivative.String(); actual != output {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, actual, output)
+		}
+	}
+}
+
+func TestDerivativeErrors(t *testing.T) {
+	errors := map[string]string{
+		"x,y,MAX":      "syntax error : cannot differentiate MAX operator",
+		"c,x,y,IF":     "syntax error : cannot differentiate IF operator",
+		"x,y,z,3,SORT": "syntax error : cannot differentiate SORT operator",
+		"x,y":          "syntax error : cannot differentiate expression that leaves 2 items on stack",
+	}
+	for input, expected := range errors {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if _, err = exp.Derivative("x"); err == nil || err.Error() != expected {
+			t.Errorf("Case: %s; Actual: %v; Expected: %#v", input, err, expected)
+		}
+	}
+}
+
+func TestDerivativeNumerically(t *testing.T) {
+	const h = 1e-6
+	list := []string{
+		"x,x,*,y,*,x,SIN,+",
+		"x,y,POW,x,EXP,/",
+		"x,x,POW",
+		"x,3,*,COS,x,LOG,*",
+		"y,x,-,x,y,+,/",
+	}
+	bindings := map[string]interface{}{"x": 1.5, "y": 2.5}
+	for _, input := range list {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		derivative, err := exp.Derivative("x")
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		actual, err := derivative.Evaluate(bindings)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		above, err := exp.Evaluate(map[string]interface{}{"x": 1.5 + h, "y": 2.5})
+		if err != nil {
+			t.Fatal(err)
+		}
+		below, err := exp.Evaluate(map[string]interface{}{"x": 1.5 - h, "y": 2.5})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := (above - below) / (2 * h); math.Abs(actual-expected) > 1e-6 {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, actual, expected)
+		}
+	}
+}
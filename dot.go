@@ -0,0 +1,248 @@
+package gorpn
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// dotOutput is an item on the stack while building the graph of a program: the vertex that
+// produced it, and which of its outputs it is, for operators such as SORT that produce several.
+type dotOutput struct {
+	vertex int
+	port   int // 1 for the first output, and so on, or 0 when the vertex has a single output
+}
+
+// dotGraph accumulates the vertices and edges of the graph of a program.
+type dotGraph struct {
+	vertices []string       // attributes of each vertex
+	edges    []string       // edges in the order operands were consumed
+	symbols  map[string]int // vertex of each symbol, so every use of a binding shares one leaf
+	used     map[int]bool   // vertices consumed by some operator
+}
+
+func (g *dotGraph) vertex(attributes string) int {
+	g.vertices = append(g.vertices, attributes)
+	return len(g.vertices) - 1
+}
+
+// operator adds a vertex for token that consumes operands, and returns it.
+func (g *dotGraph) operator(token string, operands []dotOutput) int {
+	v := g.vertex(fmt.Sprintf("label=%s, shape=box, style=rounded", dotQuote(token)))
+	for _, operand := range operands {
+		g.used[operand.vertex] = true
+		if operand.port > 0 {
+			g.edges = append(g.edges, fmt.Sprintf("n%d -> n%d [label=%d]", operand.vertex, v, operand.port))
+		} else {
+			g.edges = append(g.edges, fmt.Sprintf("n%d -> n%d", operand.vertex, v))
+		}
+	}
+	return v
+}
+
+// dotQuote returns s as a quoted Graphviz string.
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// dotCountOperators are the operators whose top operand is a count of the items they consume.
+var dotCountOperators = map[string]bool{
+	"AVG": true, "AVGNAN": true, "COPY": true, "MAD": true, "MEDIAN": true, "REV": true,
+	"SMAX": true, "SMIN": true, "SORT": true, "SSTDEV": true, "STDEV": true, "STDEVNAN": true,
+	"SVAR": true, "VAR": true,
+}
+
+// WriteDOT writes a Graphviz representation of the Expression to w, as a graph of the computation
+// it performs. Each symbol to be bound is drawn once as an ellipse, no matter how many times the
+// expression uses it, constants are shaded boxes, including those folded from other constants when
+// the Expression was simplified, and each operator is a rounded box with an edge from every value
+// it consumes. The final result is drawn with a double border. Operators that only rearrange items
+// on the stack, such as DUP or EXC, are not drawn; instead they change which edges are drawn, so
+// that a value used more than once has more than one edge.
+//
+// It returns an error when the stack effect of an operator is not known until the Expression is
+// evaluated, for instance when the count of items for AVG is itself bound at evaluation time.
+//
+//	func example() {
+//		exp, err := gorpn.New("a,b,+,a,*")
+//		if err != nil {
+//			panic(err)
+//		}
+//		if err = exp.WriteDOT(os.Stdout); err != nil {
+//			panic(err)
+//		}
+//		// $ dot -Tsvg -o expression.svg
+//	}
+func (e *Expression) WriteDOT(w io.Writer) error {
+	g := &dotGraph{symbols: make(map[string]int), used: make(map[int]bool)}
+	var stack []dotOutput
+
+	// pop removes and returns the top n items of the stack, deepest first.
+	pop := func(token string, n int) ([]dotOutput, error) {
+		if n > len(stack) {
+			return nil, newErrStackUnderflow("%s operand requires %d items, but only %d on stack", token, n, len(stack))
+		}
+		items := make([]dotOutput, n)
+		copy(items, stack[len(stack)-n:])
+		stack = stack[:len(stack)-n]
+		return items, nil
+	}
+	// count returns the value of the item depth positions below the top of the stack, and true, or
+	// false when that item is not a finite constant known before evaluation.
+	constants := make(map[int]float64)
+	count := func(depth int) (int, bool) {
+		if depth >= len(stack) {
+			return 0, false
+		}
+		item := stack[len(stack)-1-depth]
+		value, ok := constants[item.vertex]
+		if !ok || item.port > 0 || math.IsNaN(value) || math.IsInf(value, 0) {
+			return 0, false
+		}
+		return saturatingInt(value), true
+	}
+
+	for _, tok := range e.tokens {
+		switch token := tok.(type) {
+		case float64:
+			v := g.vertex(fmt.Sprintf("label=%s, shape=box, style=filled, fillcolor=lightgrey", dotQuote(formatNumber(token, e.precision))))
+			constants[v] = token
+			stack = append(stack, dotOutput{vertex: v})
+			continue
+		case string:
+			opArity, isOperator := arity[token]
+			if !isOperator {
+				v, ok := g.symbols[token]
+				if !ok {
+					v = g.vertex(fmt.Sprintf("label=%s, shape=ellipse", dotQuote(token)))
+					g.symbols[token] = v
+				}
+				stack = append(stack, dotOutput{vertex: v})
+				continue
+			}
+
+			popCount := opArity.popCount
+			var n, m int // counts of operators whose stack effect depends on them
+			ok := true
+			switch {
+			case token == "HIST": // n,width,HIST
+				// how many buckets it pushes is not known until evaluation
+				return newErrSyntax("%s operator pushes count of buckets not known before evaluation", token)
+			case token == "INDEX": // n,INDEX
+				n, ok = count(0)
+			case token == "NLARGEST" || token == "NSMALLEST": // k,n,NLARGEST
+				if n, ok = count(1); ok {
+					m, ok = count(0)
+				}
+				popCount = m + 2
+			case token == "PERCENT": // p,m,PERCENT
+				m, ok = count(0)
+				popCount = m + 2
+			case token == "ROLL": // n,m,ROLL
+				if n, ok = count(1); ok {
+					m, ok = count(0)
+				}
+				popCount = n + 2
+			case wholeStackOperators[token]:
+				popCount = len(stack)
+			case dotCountOperators[token]: // n,AVG
+				n, ok = count(0)
+				popCount = n + 1
+			}
+			if !ok {
+				return newErrSyntax("%s operator requires count known before evaluation", token)
+			}
+
+			items, err := pop(token, popCount)
+			if err != nil {
+				return err
+			}
+
+			switch token {
+			case "COPY":
+				items = items[:len(items)-1]
+				stack = append(stack, items...)
+				stack = append(stack, items...)
+			case "DEPTH":
+				stack = append(stack, dotOutput{vertex: g.operator(token, nil)})
+			case "DUP":
+				stack = append(stack, items[0], items[0])
+			case "EXC", "SWAP":
+				stack = append(stack, items[1], items[0])
+			case "INDEX":
+				if n < 1 || n > len(stack) {
+					return newErrStackUnderflow("%s operand requires %d items, but only %d on stack", token, n, len(stack))
+				}
+				stack = append(stack, stack[len(stack)-n])
+			case "NIP":
+				stack = append(stack, items[1])
+			case "OVER":
+				stack = append(stack, items[0], items[1], items[0])
+			case "POP":
+				// discarded
+			case "REV":
+				items = items[:len(items)-1]
+				for i := len(items) - 1; i >= 0; i-- {
+					stack = append(stack, items[i])
+				}
+			case "ROLL":
+				// rotate towards the top of the stack, just as evaluation does
+				items = items[:n]
+				if n > 0 {
+					if m = m % n; m < 0 {
+						m += n
+					}
+					stack = append(stack, items[n-m:]...)
+					stack = append(stack, items[:n-m]...)
+				}
+			case "NLARGEST", "NSMALLEST":
+				// which items are kept is not known until evaluation
+				items = items[:m]
+				v := g.operator(token, items)
+				for i := 0; i < n && i < m; i++ {
+					stack = append(stack, dotOutput{vertex: v, port: i + 1})
+				}
+			case "ROT":
+				stack = append(stack, items[1], items[2], items[0])
+			case "SORT":
+				// which item ends up where is not known until evaluation
+				items = items[:len(items)-1]
+				v := g.operator(token, items)
+				for i := range items {
+					stack = append(stack, dotOutput{vertex: v, port: i + 1})
+				}
+			case "TUCK":
+				stack = append(stack, items[1], items[0], items[1])
+			default:
+				stack = append(stack, dotOutput{vertex: g.operator(token, items)})
+			}
+		}
+	}
+
+	results := make(map[int]bool, len(stack))
+	for _, item := range stack {
+		results[item.vertex] = true
+	}
+	if len(results) == 0 {
+		return newErrSyntax("expression leaves no value on the stack")
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString("digraph expression {\n\tordering=in;\n")
+	for v, attributes := range g.vertices {
+		if !g.used[v] && !results[v] {
+			continue // count consumed by an operator that only rearranges the stack
+		}
+		if results[v] {
+			attributes += ", peripheries=2"
+		}
+		fmt.Fprintf(bw, "\tn%d [%s];\n", v, attributes)
+	}
+	for _, edge := range g.edges {
+		fmt.Fprintf(bw, "\t%s;\n", edge)
+	}
+	bw.WriteString("}\n")
+	return bw.Flush()
+}
@@ -0,0 +1,137 @@
+package gorpn
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteDOT(t *testing.T) {
+	list := map[string]string{
+		"a": `digraph expression {
+	ordering=in;
+	n0 [label="a", shape=ellipse, peripheries=2];
+}
+`,
+		"a,b,+,a,*": `digraph expression {
+	ordering=in;
+	n0 [label="a", shape=ellipse];
+	n1 [label="b", shape=ellipse];
+	n2 [label="+", shape=box, style=rounded];
+	n3 [label="*", shape=box, style=rounded, peripheries=2];
+	n0 -> n2;
+	n1 -> n2;
+	n2 -> n3;
+	n0 -> n3;
+}
+`,
+		"a,b,+,DUP,*,2,+": `digraph expression {
+	ordering=in;
+	n0 [label="a", shape=ellipse];
+	n1 [label="b", shape=ellipse];
+	n2 [label="+", shape=box, style=rounded];
+	n3 [label="*", shape=box, style=rounded];
+	n4 [label="2", shape=box, style=filled, fillcolor=lightgrey];
+	n5 [label="+", shape=box, style=rounded, peripheries=2];
+	n0 -> n2;
+	n1 -> n2;
+	n2 -> n3;
+	n2 -> n3;
+	n3 -> n5;
+	n4 -> n5;
+}
+`,
+		"a,b,+,c,d,-,2,1,ROLL,/": `digraph expression {
+	ordering=in;
+	n0 [label="a", shape=ellipse];
+	n1 [label="b", shape=ellipse];
+	n2 [label="+", shape=box, style=rounded];
+	n3 [label="c", shape=ellipse];
+	n4 [label="d", shape=ellipse];
+	n5 [label="-", shape=box, style=rounded];
+	n8 [label="/", shape=box, style=rounded, peripheries=2];
+	n0 -> n2;
+	n1 -> n2;
+	n3 -> n5;
+	n4 -> n5;
+	n5 -> n8;
+	n2 -> n8;
+}
+`,
+		"a,b,c,2,3,NLARGEST,+": `digraph expression {
+	ordering=in;
+	n0 [label="a", shape=ellipse];
+	n1 [label="b", shape=ellipse];
+	n2 [label="c", shape=ellipse];
+	n5 [label="NLARGEST", shape=box, style=rounded];
+	n6 [label="+", shape=box, style=rounded, peripheries=2];
+	n0 -> n5;
+	n1 -> n5;
+	n2 -> n5;
+	n5 -> n6 [label=1];
+	n5 -> n6 [label=2];
+}
+`,
+		"a,b,c,2,SORT,-,-": `digraph expression {
+	ordering=in;
+	n0 [label="a", shape=ellipse];
+	n1 [label="b", shape=ellipse];
+	n2 [label="c", shape=ellipse];
+	n4 [label="SORT", shape=box, style=rounded];
+	n5 [label="-", shape=box, style=rounded];
+	n6 [label="-", shape=box, style=rounded, peripheries=2];
+	n1 -> n4;
+	n2 -> n4;
+	n4 -> n5 [label=1];
+	n4 -> n5 [label=2];
+	n0 -> n6;
+	n5 -> n6;
+}
+`,
+		"'say \"hi\"',60,*": `digraph expression {
+	ordering=in;
+	n0 [label="say \"hi\"", shape=ellipse];
+	n1 [label="60", shape=box, style=filled, fillcolor=lightgrey];
+	n2 [label="*", shape=box, style=rounded, peripheries=2];
+	n0 -> n2;
+	n1 -> n2;
+}
+`,
+	}
+	for input, expected := range list {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		var b strings.Builder
+		if err = exp.WriteDOT(&b); err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if actual := b.String(); actual != expected {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, actual, expected)
+		}
+	}
+}
+
+func TestWriteDOTUnknownCount(t *testing.T) {
+	exp, err := New("a,b,n,AVG")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	err = exp.WriteDOT(&b)
+	if expected := "syntax error : AVG operator requires count known before evaluation"; err == nil || err.Error() != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", err, expected)
+	}
+}
+
+func TestWriteDOTHistogram(t *testing.T) {
+	exp, err := New("a,b,2,10,HIST")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	err = exp.WriteDOT(&b)
+	if expected := "syntax error : HIST operator pushes count of buckets not known before evaluation"; err == nil || err.Error() != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", err, expected)
+	}
+}
@@ -0,0 +1,239 @@
+package gorpn
+
+import (
+	"encoding/json"
+	"math"
+)
+
+// Explanation is a node of the evaluation tree returned by Explain. Leaves are the numbers and
+// symbols of the expression, and every other node is an operator along with the nodes whose values
+// it consumed.
+type Explanation struct {
+	Token    string         // the operator, symbol, or number
+	Value    float64        // value of the node; NaN for a symbol bound to a series
+	Folded   bool           // true when the value was known before Evaluate, having been written as a number, or folded into one when the Expression was simplified
+	Operands []*Explanation // nodes consumed by the operator, deepest first; nil for leaves
+	Zone     string         // for LTIME, NEWDAY, NEWWEEK, NEWMONTH, and NEWYEAR, the abbreviated name of the time zone in effect at TIME, such as "EDT"
+	Offset   int            // for LTIME, NEWDAY, NEWWEEK, NEWMONTH, and NEWYEAR, the offset of that time zone in seconds east of UTC
+
+	valued bool // true once the value of a leaf is known
+}
+
+// MarshalJSON returns the JSON representation of the evaluation tree rooted at the Explanation.
+// Because JSON has no representation for them, NaN, +Inf, and -Inf values are written as the
+// strings "UNKN", "INF", and "NEGINF", respectively.
+func (x *Explanation) MarshalJSON() ([]byte, error) {
+	var value interface{} = x.Value
+	if math.IsNaN(x.Value) || math.IsInf(x.Value, 0) {
+		value = formatNumber(x.Value, -1)
+	}
+	return json.Marshal(struct {
+		Token    string         `json:"token"`
+		Value    interface{}    `json:"value"`
+		Folded   bool           `json:"folded,omitempty"`
+		Operands []*Explanation `json:"operands,omitempty"`
+		Zone     string         `json:"zone,omitempty"`
+		Offset   int            `json:"offset,omitempty"`
+	}{x.Token, value, x.Folded, x.Operands, x.Zone, x.Offset})
+}
+
+// stackOperatorCounts lists the operators that only rearrange, duplicate, or discard items on the
+// stack, along with how many of their operands are counts rather than items being rearranged.
+// Rather than becoming nodes of an evaluation tree, these operators pass along the nodes of the
+// items they rearrange.
+var stackOperatorCounts = map[string]int{
+	"COPY": 1, "DUP": 0, "EXC": 0, "INDEX": 1, "NIP": 0, "NLARGEST": 2, "NSMALLEST": 2, "OVER": 0,
+	"POP": 0, "REV": 1, "ROLL": 2, "ROT": 0, "SORT": 1, "SWAP": 0, "TUCK": 0,
+}
+
+// explainer builds an evaluation tree from the trace events of running a program.
+type explainer struct {
+	tokens    []interface{}
+	precision int
+	rewritten bool           // true when tokens hold the values of some bindings, so numbers are not known to be folded
+	nodes     []*Explanation // one node for each item on the stack
+	next      int            // index of the next token whose node has not been pushed
+	zone      string         // abbreviated name of the time zone in effect at TIME, or empty when TIME is not bound
+	offset    int            // offset of that time zone in seconds east of UTC
+}
+
+// leaves pushes a node for each token before position, all of which are operands, because the
+// trace function is only invoked for operators.
+func (x *explainer) leaves(position int) {
+	for ; x.next < position; x.next++ {
+		leaf := &Explanation{Value: math.NaN()}
+		switch v := x.tokens[x.next].(type) {
+		case float64:
+			leaf.Token = formatNumber(v, x.precision)
+			leaf.Value, leaf.Folded, leaf.valued = v, !x.rewritten, true
+		case string:
+			leaf.Token = v
+			switch v {
+			case "LTIME", "NEWDAY", "NEWWEEK", "NEWMONTH", "NEWYEAR":
+				leaf.Zone, leaf.Offset = x.zone, x.offset
+			}
+		}
+		x.nodes = append(x.nodes, leaf)
+	}
+}
+
+// value records the value of each leaf in nodes from the respective item in items.
+func value(nodes []*Explanation, items []interface{}) {
+	for i, node := range nodes {
+		if node.valued || i >= len(items) {
+			continue
+		}
+		if v, ok := items[i].(float64); ok {
+			node.Value = v
+		}
+		node.valued = true
+	}
+}
+
+func (x *explainer) event(event TraceEvent) {
+	x.leaves(event.Position)
+	x.next = event.Position + 1
+
+	consumed := len(event.Inputs)
+	if consumed > len(x.nodes) {
+		consumed = len(x.nodes)
+	}
+	inputs := make([]*Explanation, consumed)
+	copy(inputs, x.nodes[len(x.nodes)-consumed:])
+	x.nodes = x.nodes[:len(x.nodes)-consumed]
+	value(inputs, event.Inputs)
+
+	if event.Deferred {
+		// operands not yet known; the program is about to be rewritten and run again
+		x.nodes = append(x.nodes, &Explanation{Token: event.Operator, Value: math.NaN(), Operands: inputs})
+		return
+	}
+
+	counts, ok := stackOperatorCounts[event.Operator]
+	if !ok {
+		for _, output := range event.Outputs {
+			node := &Explanation{Token: event.Operator, Value: math.NaN(), Operands: inputs}
+			if v, ok := output.(float64); ok {
+				node.Value = v
+			}
+			x.nodes = append(x.nodes, node)
+		}
+		return
+	}
+
+	// match each output with an item having the same value, preferring items not yet matched
+	items := inputs[:len(inputs)-counts]
+	used := make([]bool, len(items))
+	for _, output := range event.Outputs {
+		match := -1
+		for i, item := range items {
+			if sameItem(item, output) && (match < 0 || (used[match] && !used[i])) {
+				match = i
+			}
+		}
+		if match < 0 {
+			v, _ := output.(float64)
+			x.nodes = append(x.nodes, &Explanation{Token: event.Operator, Value: v, Operands: inputs, valued: true})
+			continue
+		}
+		used[match] = true
+		x.nodes = append(x.nodes, items[match])
+	}
+}
+
+// sameItem returns true when node has the value of item, treating NaN values as equal to one
+// another.
+func sameItem(node *Explanation, item interface{}) bool {
+	v, ok := item.(float64)
+	if !ok {
+		return false
+	}
+	return node.Value == v || (math.IsNaN(node.Value) && math.IsNaN(v))
+}
+
+// Explain evaluates the Expression after applying the parameter bindings, just like Evaluate, but
+// returns the tree of values computed along the way rather than only the final result, so that
+// users may be shown why an expression evaluated to the value it did. The tree may be rendered as
+// JSON by encoding/json.
+//
+//	func example() {
+//		exp, err := gorpn.New("errors,requests,/,0.05,GT")
+//		if err != nil {
+//			panic(err)
+//		}
+//		explanation, err := exp.Explain(map[string]interface{}{"errors": 6, "requests": 100})
+//		if err != nil {
+//			panic(err)
+//		}
+//		buf, err := json.Marshal(explanation)
+//		// {"token":"GT","value":1,"operands":[{"token":"/","value":0.06,"operands":[...]},...]}
+//	}
+//
+// Operators that only rearrange items on the stack, such as DUP or SORT, do not appear in the tree.
+// Instead, their operands appear wherever the items they rearranged were consumed. When some open
+// bindings are only needed by the untaken branch of an IF whose condition could not be known before
+// evaluation, the tree explains the program that remains after that branch is discarded, in which
+// the values of the other bindings appear as numbers. When TIME is bound, the leaves for LTIME,
+// NEWDAY, NEWWEEK, NEWMONTH, and NEWYEAR also name the time zone in effect at that time, and its
+// offset from UTC, so users may see which side of a daylight saving time transition was used.
+func (e *Expression) Explain(bindings map[string]interface{}) (explanation *Explanation, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			explanation, err = nil, newErrInternal(r, e.config, e.tokens, -1)
+		}
+	}()
+
+	exp := e.clone()
+	exp.performTimeSubstitutions = e.performTimeSubstitutions || bindingsNeedTime(bindings)
+	exp.isEvaluating = true
+
+	coerced, err := e.coerceMapValuesToFloat64(bindings)
+	if err != nil {
+		return nil, err
+	}
+
+	var zone string
+	var offset int
+	if epoch, ok := coerced["TIME"].(float64); ok {
+		jTime, _ := epochToJuliet(int(epoch), e.location)
+		zone, offset = jTime.Zone()
+	}
+
+	var rewritten bool
+	for {
+		tokens := exp.tokens
+		if hasExpressionBindings(coerced) {
+			// mirror simplify, so that token positions refer to the program it runs
+			if tokens, err = inlineExpressionBindings(exp.tokens, coerced, make(map[*Expression]bool)); err != nil {
+				return nil, err
+			}
+		}
+		x := &explainer{tokens: tokens, precision: e.precision, rewritten: rewritten, zone: zone, offset: offset}
+		exp.trace = x.event
+		if err = exp.simplify(coerced); err != nil {
+			return nil, err
+		}
+
+		if openBindings := exp.OpenBindings(); len(openBindings) > 0 {
+			// as with Evaluate, open bindings might only be needed by an untaken branch
+			remaining := make([]interface{}, exp.scratchHead)
+			copy(remaining, exp.scratch)
+			if tokens, _, ok := exp.eliminateDeadBranches(remaining, nil); ok {
+				exp.tokens, rewritten = tokens, true
+				if size := scratchSizeFor(tokens); size > len(exp.scratch) {
+					exp.scratch = make([]interface{}, size)
+					exp.isFloat = make([]bool, size)
+				}
+				continue
+			}
+			return nil, exp.errOpenBindings(openBindings, exp.scratch[:exp.scratchHead])
+		}
+
+		x.leaves(len(tokens))
+		if exp.scratchHead != 1 || len(x.nodes) != 1 {
+			return nil, newErrSyntax("extra parameters: %v", exp.scratch[:exp.scratchHead])
+		}
+		value(x.nodes, exp.scratch[:1])
+		return x.nodes[0], nil
+	}
+}
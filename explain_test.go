@@ -0,0 +1,152 @@
+package gorpn
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+// render writes an evaluation tree in a compact form for comparison.
+func render(x *Explanation) string {
+	s := x.Token + "=" + formatNumber(x.Value, -1)
+	if x.Folded {
+		s += "!"
+	}
+	if len(x.Operands) > 0 {
+		s += "("
+		for i, operand := range x.Operands {
+			if i > 0 {
+				s += " "
+			}
+			s += render(operand)
+		}
+		s += ")"
+	}
+	return s
+}
+
+func TestExplain(t *testing.T) {
+	bindings := map[string]interface{}{"a": 3, "b": 5, "c": 0, "qps": []float64{1, 2, 3}}
+	list := map[string]string{
+		"a":                      "a=3",
+		"a,b,+":                  "+=8(a=3 b=5)",
+		"60,24,*,a,+":            "+=1443(1440=1440! a=3)",
+		"a,b,+,a,b,+,*":          "*=64(+=8(a=3 b=5) +=8(a=3 b=5))",
+		"a,b,EXC,-":              "-=2(b=5 a=3)",
+		"a,b,OVER,*,+":           "+=18(a=3 *=15(b=5 a=3))",
+		"a,b,c,3,SORT,+,+":       "+=8(c=0 +=8(a=3 b=5))",
+		"a,b,c,2,3,NLARGEST,+":   "+=8(a=3 b=5)",
+		"c,a,b,IF":               "IF=5(c=0 a=3 b=5)",
+		"qps,600,TREND,a,*":      "*=7.5(TREND=2.5(qps=UNKN 600=600!) a=3)",
+		"c,c,/,UN":               "UN=1(/=UNKN(c=0 c=0))",
+		"a,b,missing,IF":         "IF=5(a=3 b=5 missing=UNKN)",
+		"c,missing,1,+,a,IF,2,*": "*=6(3=3 2=2)",
+		"a,b,c,3,COPY,6,AVG,a,-": "-=-0.3333333333333335(AVG=2.6666666666666665(a=3 b=5 c=0 a=3 b=5 c=0 6=6!) a=3)",
+	}
+	for input, expected := range list {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		explanation, err := exp.Explain(bindings)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if actual := render(explanation); actual != expected {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, actual, expected)
+		}
+		value, err := exp.Evaluate(bindings)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if value != explanation.Value && !(math.IsNaN(value) && math.IsNaN(explanation.Value)) {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, explanation.Value, value)
+		}
+	}
+}
+
+func TestExplainErrors(t *testing.T) {
+	exp, err := New("a,b,+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = exp.Explain(map[string]interface{}{"a": 1})
+	if _, ok := err.(ErrOpenBindings); !ok {
+		t.Errorf("Actual: %#v; Expected: %#v", err, ErrOpenBindings{"b": ScalarKind})
+	}
+	_, err = exp.Explain(map[string]interface{}{"a": 1, "b": "two"})
+	if _, ok := err.(ErrBadBindingType); !ok {
+		t.Errorf("Actual: %#v; Expected: %#v", err, ErrBadBindingType{})
+	}
+}
+
+func TestExplainJSON(t *testing.T) {
+	exp, err := New("a,b,/,2,*", DivisionByZero(DivisionByZeroInf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	explanation, err := exp.Explain(map[string]interface{}{"a": 1, "b": 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := json.Marshal(explanation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"token":"*","value":"INF","operands":[{"token":"/","value":"INF","operands":[{"token":"a","value":1},{"token":"b","value":0}]},{"token":"2","value":2,"folded":true}]}`
+	if actual := string(buf); actual != expected {
+		t.Errorf("Actual: %s; Expected: %s", actual, expected)
+	}
+}
+
+func TestExplainRandom(t *testing.T) {
+	exp, err := New("RANDOM,2,*", RandomSeed(42))
+	if err != nil {
+		t.Fatal(err)
+	}
+	explanation, err := exp.Explain(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if explanation.Token != "*" || len(explanation.Operands) != 2 || explanation.Operands[0].Token != "RANDOM" {
+		t.Fatalf("Actual: %#v; Expected: RANDOM,2,* tree", explanation)
+	}
+	if value := explanation.Operands[0].Value; value < 0 || value >= 1 {
+		t.Errorf("Actual: %#v; Expected: value in [0, 1)", value)
+	}
+	if actual, expected := explanation.Value, 2*explanation.Operands[0].Value; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+}
+
+func TestExplainTimeZone(t *testing.T) {
+	exp, err := New("LTIME,TIME,-", TimeZone("America/New_York"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := map[string]struct {
+		epoch  int
+		zone   string
+		offset int
+	}{
+		"EST": {1615705199, "EST", -18000},
+		"EDT": {1615705200, "EDT", -14400},
+	}
+	for name, item := range list {
+		explanation, err := exp.Explain(map[string]interface{}{"TIME": item.epoch})
+		if err != nil {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, err, nil)
+			continue
+		}
+		ltime := explanation.Operands[0]
+		if ltime.Zone != item.zone || ltime.Offset != item.offset {
+			t.Errorf("Case: %s; Actual: %s %d; Expected: %s %d", name, ltime.Zone, ltime.Offset, item.zone, item.offset)
+		}
+		if ltime.Value != float64(item.epoch+item.offset) {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, ltime.Value, float64(item.epoch+item.offset))
+		}
+		if time := explanation.Operands[1]; time.Zone != "" {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, time.Zone, "")
+		}
+	}
+}
@@ -1,12 +1,15 @@
 package gorpn
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
+	"math/rand"
 	"reflect"
 	"sort"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -19,6 +22,10 @@ const DefaultDelimiter = ','
 // time-series. It can be overridden by SecondsPerInterval() function.
 const DefaultSecondsPerInterval = 300
 
+// DefaultStackLimit specifies the most items the stack of an RPN Expression may hold once operators
+// such as COPY grow it. It can be overridden by the StackLimit() function.
+const DefaultStackLimit = 1 << 20
+
 // type arityTuple [3]int
 type arityTuple struct {
 	popCount, floatOffset, floatCount, nonOperatorOffset, nonOperatorCount int
@@ -27,59 +34,86 @@ type arityTuple struct {
 // arity resolves to the number of items an operation must pop, and
 // how many of those must be floats
 var arity = map[string]arityTuple{
-	"%":        {2, 2, 0, 0, 0},
-	"*":        {2, 2, 0, 0, 0},
-	"+":        {2, 2, 0, 0, 0},
-	"-":        {2, 2, 0, 0, 0},
-	"/":        {2, 2, 0, 0, 0},
-	"ABS":      {1, 1, 1, 0, 0},
-	"ADDNAN":   {2, 2, 2, 0, 0},
-	"ATAN":     {1, 1, 1, 0, 0},
-	"ATAN2":    {2, 2, 2, 0, 0},
-	"AVG":      {1, 1, 1, 0, 0}, // other operands must be floats
-	"CEIL":     {1, 1, 1, 0, 0},
-	"COPY":     {1, 1, 1, 0, 0}, // other operands cannot be operators
-	"COS":      {1, 1, 1, 0, 0},
-	"DEG2RAD":  {1, 1, 1, 0, 0},
-	"DEPTH":    {0, 0, 0, 0, 0},
-	"DUP":      {1, 0, 0, 1, 1}, // equivalent to: 1,COPY
-	"EQ":       {2, 0, 0, 2, 2},
-	"EXC":      {2, 0, 0, 2, 2}, // equivalent to: 2,REV
-	"EXP":      {1, 1, 1, 0, 0},
-	"FLOOR":    {1, 1, 1, 0, 0},
-	"GE":       {2, 0, 0, 2, 2},
-	"GT":       {2, 0, 0, 2, 2},
-	"IF":       {3, 3, 1, 2, 2}, // a,b,c,IF
-	"INDEX":    {1, 1, 1, 0, 0}, // other operands cannot be operators
-	"ISINF":    {1, 1, 1, 0, 0},
-	"LE":       {2, 0, 0, 2, 2},
-	"LIMIT":    {3, 3, 3, 0, 0},
-	"LOG":      {1, 1, 1, 0, 0},
-	"LT":       {2, 0, 0, 2, 2},
-	"MAD":      {1, 1, 1, 0, 0}, // other operands must be floats
-	"MAX":      {2, 0, 0, 2, 2},
-	"MAXNAN":   {2, 0, 0, 2, 2},
-	"MEDIAN":   {1, 1, 1, 0, 0}, // other operands must be floats
-	"MIN":      {2, 0, 0, 2, 2},
-	"MINNAN":   {2, 0, 0, 2, 2},
-	"NE":       {2, 0, 0, 2, 2},
-	"PERCENT":  {2, 2, 2, 0, 0}, // n,m,PERCENT (a,b,c,95,3,PERCENT -> find 95percentile of a,b,c)
-	"POP":      {1, 0, 0, 0, 0},
-	"POW":      {2, 2, 0, 0, 0},
-	"RAD2DEG":  {1, 1, 1, 0, 0},
-	"REV":      {1, 1, 1, 0, 0}, // other operands cannot be operators
-	"ROLL":     {2, 2, 2, 0, 0}, // n,m,ROLL (rotate the top n elements of the stack by m)
-	"SIN":      {1, 1, 1, 0, 0},
-	"SMAX":     {1, 1, 1, 0, 0}, // other operands must be floats
-	"SMIN":     {1, 1, 1, 0, 0}, // other operands must be floats
-	"SORT":     {1, 1, 1, 0, 0}, // other operands must be floats
-	"SQRT":     {1, 1, 1, 0, 0},
-	"STDEV":    {1, 1, 1, 0, 0}, // other operands must be floats
-	"TREND":    {2, 1, 1, 2, 1}, // label,count,TREND
-	"TRENDNAN": {2, 1, 1, 2, 1}, // label,count,TRENDNAN
-	"UN":       {1, 1, 1, 0, 0},
+	"%":         {2, 2, 0, 1, 1}, // top operand cannot be operator
+	"*":         {2, 2, 0, 1, 1}, // top operand cannot be operator
+	"+":         {2, 2, 0, 1, 1}, // top operand cannot be operator
+	"-":         {2, 2, 0, 1, 1}, // top operand cannot be operator
+	"/":         {2, 2, 0, 1, 1}, // top operand cannot be operator
+	"ABS":       {1, 1, 1, 0, 0},
+	"ADDNAN":    {2, 2, 2, 0, 0},
+	"ALLAVG":    {0, 0, 0, 0, 0}, // consumes the whole stack, which must be floats
+	"ALLMAX":    {0, 0, 0, 0, 0}, // consumes the whole stack, which must be floats
+	"ALLMIN":    {0, 0, 0, 0, 0}, // consumes the whole stack, which must be floats
+	"ATAN":      {1, 1, 1, 0, 0},
+	"ATAN2":     {2, 2, 2, 0, 0},
+	"AVG":       {1, 1, 1, 0, 0}, // other operands must be floats
+	"AVGNAN":    {1, 1, 1, 0, 0}, // other operands must be floats
+	"BITAND":    {2, 2, 2, 0, 0},
+	"BITOR":     {2, 2, 2, 0, 0},
+	"CEIL":      {1, 1, 1, 0, 0},
+	"COPY":      {1, 1, 1, 0, 0}, // other operands cannot be operators
+	"COS":       {1, 1, 1, 0, 0},
+	"DEG2RAD":   {1, 1, 1, 0, 0},
+	"DEPTH":     {0, 0, 0, 0, 0},
+	"DUP":       {1, 0, 0, 1, 1}, // equivalent to: 1,COPY
+	"EQ":        {2, 0, 0, 2, 2},
+	"EXC":       {2, 0, 0, 2, 2}, // equivalent to: 2,REV
+	"EXP":       {1, 1, 1, 0, 0},
+	"FLOOR":     {1, 1, 1, 0, 0},
+	"GAUSSIAN":  {2, 2, 2, 0, 0}, // mean,stddev,GAUSSIAN
+	"GE":        {2, 0, 0, 2, 2},
+	"GT":        {2, 0, 0, 2, 2},
+	"HIST":      {2, 1, 1, 2, 1}, // n,width,HIST or label,width,HIST
+	"IF":        {3, 3, 1, 2, 2}, // a,b,c,IF
+	"INDEX":     {1, 1, 1, 0, 0}, // other operands cannot be operators
+	"ISINF":     {1, 1, 1, 0, 0},
+	"LE":        {2, 0, 0, 2, 2},
+	"LIMIT":     {3, 3, 3, 0, 0},
+	"LOG":       {1, 1, 1, 0, 0},
+	"LT":        {2, 0, 0, 2, 2},
+	"MAD":       {1, 0, 0, 1, 1}, // n,MAD or label,MAD; other operands must be floats
+	"MAX":       {2, 0, 0, 2, 2},
+	"MAXNAN":    {2, 0, 0, 2, 2},
+	"MEDIAN":    {1, 0, 0, 1, 1}, // n,MEDIAN or label,MEDIAN; other operands must be floats
+	"MIN":       {2, 0, 0, 2, 2},
+	"MINNAN":    {2, 0, 0, 2, 2},
+	"MODINT":    {2, 2, 2, 0, 0},
+	"NE":        {2, 0, 0, 2, 2},
+	"NIP":       {2, 0, 0, 2, 2}, // equivalent to: EXC,POP
+	"NLARGEST":  {2, 2, 2, 0, 0}, // k,n,NLARGEST (keep the k largest of the top n elements of the stack)
+	"NSMALLEST": {2, 2, 2, 0, 0}, // k,n,NSMALLEST (keep the k smallest of the top n elements of the stack)
+	"OVER":      {2, 0, 0, 2, 2}, // equivalent to: 2,INDEX
+	"PERCENT":   {2, 2, 1, 1, 1}, // n,m,PERCENT (a,b,c,95,3,PERCENT -> find 95percentile of a,b,c) or n,label,PERCENT
+	"POP":       {1, 0, 0, 1, 1}, // cannot pop the result of an operator
+	"POW":       {2, 2, 0, 1, 1}, // top operand cannot be operator
+	"RAD2DEG":   {1, 1, 1, 0, 0},
+	"RANDOM":    {0, 0, 0, 0, 0},
+	"REV":       {1, 1, 1, 0, 0}, // other operands cannot be operators
+	"ROLL":      {2, 2, 2, 0, 0}, // n,m,ROLL (rotate the top n elements of the stack by m)
+	"ROT":       {3, 0, 0, 3, 3}, // equivalent to: 3,-1,ROLL
+	"SHL":       {2, 2, 2, 0, 0},
+	"SHR":       {2, 2, 2, 0, 0},
+	"SIN":       {1, 1, 1, 0, 0},
+	"SMAX":      {1, 1, 1, 0, 0}, // other operands must be floats
+	"SMIN":      {1, 1, 1, 0, 0}, // other operands must be floats
+	"SORT":      {1, 1, 1, 0, 0}, // other operands must be floats
+	"SQRT":      {1, 1, 1, 0, 0},
+	"SSTDEV":    {1, 1, 1, 0, 0}, // other operands must be floats
+	"STDEV":     {1, 1, 1, 0, 0}, // other operands must be floats
+	"STDEVNAN":  {1, 1, 1, 0, 0}, // other operands must be floats
+	"SVAR":      {1, 1, 1, 0, 0}, // other operands must be floats
+	"SWAP":      {2, 0, 0, 2, 2}, // equivalent to: EXC
+	"TREND":     {2, 1, 1, 2, 1}, // label,count,TREND
+	"TRENDNAN":  {2, 1, 1, 2, 1}, // label,count,TRENDNAN
+	"TUCK":      {2, 0, 0, 2, 2}, // equivalent to: DUP,3,1,ROLL
+	"UN":        {1, 1, 1, 0, 0},
+	"VAR":       {1, 1, 1, 0, 0}, // other operands must be floats
 }
 
+// wholeStackOperators are the operators that consume every item on the stack, however many there
+// are, rather than a count of items given as their operand.
+var wholeStackOperators = map[string]bool{"ALLAVG": true, "ALLMAX": true, "ALLMIN": true}
+
 // ExpectedFloat error is returned if a different data type is
 // discovered where a float64 value is required.
 type ExpectedFloat struct {
@@ -104,22 +138,120 @@ func (e ErrBadBindingType) Error() string {
 }
 
 // ErrOpenBindings error is returned when one or more open bindings
-// remain when evaluating a RPN Expression.
-type ErrOpenBindings []string
+// remain when evaluating a RPN Expression. It maps the name of each
+// to the kind of value it must be bound to, so that callers may fetch
+// data of the correct shape.
+type ErrOpenBindings map[string]BindingKind
 
 // Error returns the error string representation for ErrOpenVariables
 // errors.
 func (e ErrOpenBindings) Error() string {
-	return "open bindings: " + strings.Join(e, ",")
+	names := make([]string, 0, len(e))
+	for name := range e {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return "open bindings: " + strings.Join(names, ",")
+}
+
+// ErrNaNInput error is returned when evaluating an RPN Expression configured with RejectNaNInputs
+// binds one or more of its symbols to NaN. It lists the names of those symbols.
+type ErrNaNInput []string
+
+// Error returns the error string representation for ErrNaNInput errors.
+func (e ErrNaNInput) Error() string {
+	return "NaN bindings: " + strings.Join(e, ",")
+}
+
+// ErrInternal error is returned when evaluating or simplifying an RPN
+// Expression reaches a state this library did not anticipate. It
+// indicates a bug in this library rather than a problem with the
+// expression, but is returned rather than crashing the program.
+type ErrInternal struct {
+	Expression string      // the program being run when the problem was found
+	Position   int         // index of the token being run, or -1 when not known
+	Token      string      // the token being run, when known
+	Cause      interface{} // the value recovered from the panic
+}
+
+// Error returns the error string representation for ErrInternal errors.
+func (e ErrInternal) Error() string {
+	if e.Position < 0 {
+		return fmt.Sprintf("internal error running %q: %v", e.Expression, e.Cause)
+	}
+	return fmt.Sprintf("internal error running %q at token %d (%s): %v", e.Expression, e.Position, e.Token, e.Cause)
+}
+
+// ErrCallbackPanic error is returned when a function given by the caller panics while an RPN
+// Expression is evaluated or simplified, such as a func() float64 bound to a symbol, or the function
+// registered with Trace. Unlike ErrInternal, it indicates a bug in that function rather than in
+// this library.
+type ErrCallbackPanic struct {
+	Symbol string      // the symbol bound to the function that panicked, or empty for the Trace function
+	Cause  interface{} // the value recovered from the panic
+}
+
+// Error returns the error string representation for ErrCallbackPanic errors.
+func (e ErrCallbackPanic) Error() string {
+	if e.Symbol == "" {
+		return fmt.Sprintf("panic in Trace function: %v", e.Cause)
+	}
+	return fmt.Sprintf("panic in function bound to %q: %v", e.Symbol, e.Cause)
+}
+
+// callback invokes fn, which calls a function given by the caller, raising a panic in it again as
+// an ErrCallbackPanic, so that it is not mistaken for a bug in this library.
+func callback(symbol string, fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			panic(ErrCallbackPanic{Symbol: symbol, Cause: r})
+		}
+	}()
+	fn()
+}
+
+// newErrInternal describes the value recovered from a panic while running tokens, the program of
+// an Expression with the given configuration, as an ErrInternal error, unless it was raised by
+// callback. A negative position means that the token being run is not known.
+func newErrInternal(cause interface{}, c config, tokens []interface{}, position int) error {
+	if err, ok := cause.(ErrCallbackPanic); ok {
+		return err
+	}
+	exp := Expression{config: c, tokens: tokens}
+	err := ErrInternal{Expression: exp.String(), Position: position, Cause: cause}
+	if position >= 0 && position < len(tokens) {
+		err.Token = fmt.Sprint(tokens[position])
+	} else {
+		err.Position = -1
+	}
+	return err
 }
 
 // ErrSyntax error is returned if the specified RPN expression
-// does not evaluate because of a syntax error.
+// does not evaluate because of a syntax error. Syntax errors caused
+// by an operator lacking operands match ErrStackUnderflow, and those
+// caused by naming an operator that does not exist match
+// ErrUnknownOperator, when compared with errors.Is.
 type ErrSyntax struct {
 	Message string
 	Err     error
+	kind    error // sentinel error this matches, or nil
 }
 
+var (
+	// ErrStackUnderflow matches, by errors.Is, the syntax errors returned when an operator of an
+	// RPN Expression requires more operands than are on the stack.
+	ErrStackUnderflow = errors.New("stack underflow")
+
+	// ErrUnknownOperator matches, by errors.Is, the syntax errors returned when a configurator is
+	// given the name of an operator that does not exist, such as an alias for it.
+	ErrUnknownOperator = errors.New("unknown operator")
+
+	// ErrDivideByZero matches, by errors.Is, the ErrDivisionByZero errors returned when an RPN
+	// Expression configured with DivisionByZeroError divides by zero.
+	ErrDivideByZero = errors.New("division by zero")
+)
+
 // Error returns the error string representation for ErrSyntax errors.
 func (e ErrSyntax) Error() string {
 	if e.Err == nil {
@@ -128,12 +260,22 @@ func (e ErrSyntax) Error() string {
 	return "syntax error " + e.Message + ": " + e.Err.Error()
 }
 
+// Unwrap returns the error that caused the syntax error, if any.
+func (e ErrSyntax) Unwrap() error {
+	return e.Err
+}
+
+// Is returns true when target is the sentinel error matching the cause of the syntax error.
+func (e ErrSyntax) Is(target error) bool {
+	return e.kind != nil && target == e.kind
+}
+
 func newErrSyntax(a ...interface{}) ErrSyntax {
 	var err error
 	var format, message string
 	var ok bool
 	if len(a) == 0 {
-		return ErrSyntax{"no reason given", nil}
+		return ErrSyntax{Message: "no reason given"}
 	}
 	// if last item is error: save it
 	if err, ok = a[len(a)-1].(error); ok {
@@ -149,14 +291,31 @@ func newErrSyntax(a ...interface{}) ErrSyntax {
 	if message != "" {
 		message = ": " + message
 	}
-	return ErrSyntax{message, err}
+	return ErrSyntax{Message: message, Err: err}
+}
+
+// newErrStackUnderflow returns a syntax error, formatted just as by newErrSyntax, that matches
+// ErrStackUnderflow.
+func newErrStackUnderflow(a ...interface{}) ErrSyntax {
+	err := newErrSyntax(a...)
+	err.kind = ErrStackUnderflow
+	return err
+}
+
+// newErrUnknownOperator returns a syntax error, formatted just as by newErrSyntax, that matches
+// ErrUnknownOperator.
+func newErrUnknownOperator(a ...interface{}) ErrSyntax {
+	err := newErrSyntax(a...)
+	err.kind = ErrUnknownOperator
+	return err
 }
 
 // ExpressionConfigurator represents a function that modifies an RPN Expression.
 type ExpressionConfigurator func(*Expression) error
 
 // Delimiter allows changing the expected delimiter for an RPN Expression from the default
-// delimiter, the comma. Changing the delimiter to one of the math operators is not supported.
+// delimiter, the comma. Changing the delimiter to one of the math operators, or to the single quote
+// or backslash characters used for quoting symbols, is not supported.
 //
 //	func example() {
 //		exp, err := gorpn.New("42|13|2|MEDIAN", gorpn.Delimiter('|'))
@@ -170,268 +329,1604 @@ type ExpressionConfigurator func(*Expression) error
 //		fmt.Println("value:", value)
 //	}
 func Delimiter(someDelimiter rune) ExpressionConfigurator {
+	return DelimiterString(string(someDelimiter))
+}
+
+// DelimiterString allows changing the expected delimiter for an RPN Expression to a sequence of one
+// or more characters. The same restrictions apply as for Delimiter, and additionally the delimiter
+// may not contain the single quote or backslash characters.
+//
+//	func example() {
+//		exp, err := gorpn.New("42 :: 13 :: 2 :: MEDIAN", gorpn.DelimiterString("::"))
+//		if err != nil {
+//			panic(err)
+//		}
+//	}
+func DelimiterString(someDelimiter string) ExpressionConfigurator {
 	return func(e *Expression) error {
-		if _, ok := arity[string(someDelimiter)]; ok {
-			return newErrSyntax("cannot use %c operator for delimiter", someDelimiter)
+		if someDelimiter == "" {
+			return newErrSyntax("cannot use empty delimiter")
 		}
-		e.delimiter = someDelimiter
+		if _, ok := arity[someDelimiter]; ok {
+			return newErrSyntax("cannot use %s operator for delimiter", someDelimiter)
+		}
+		if strings.ContainsRune(someDelimiter, quote) || strings.ContainsRune(someDelimiter, escape) {
+			return newErrSyntax("cannot use %s quoting character for delimiter", someDelimiter)
+		}
+		e.delimiter, e.whitespace = someDelimiter, false
 		return nil
 	}
 }
 
-// SecondsPerInterval allows changing the expected number of seconds per interval to be used when
-// evaluating an RPN Expression from the default value of 300..
+// WhitespaceDelimited allows writing an RPN Expression with its tokens separated by any run of
+// whitespace rather than by a delimiter, which is far more readable when expressions are written by
+// hand, for instance in configuration files. Symbols that contain whitespace must be quoted, and the
+// String method separates tokens by a single space.
 //
 //	func example() {
-//		exp, err := gorpn.New("42,13,2,MEDIAN", gorpn.SecondsPerInterval(60))
+//		exp, err := gorpn.New("5 3 +\n\tfoo *", gorpn.WhitespaceDelimited())
 //		if err != nil {
 //			panic(err)
 //		}
+//		s := exp.String() // "8 foo *"
 //	}
-func SecondsPerInterval(seconds float64) ExpressionConfigurator {
+func WhitespaceDelimited() ExpressionConfigurator {
 	return func(e *Expression) error {
-		if seconds <= 0 {
-			return newErrSyntax("cannot use %d seconds as interval", seconds)
-		}
-		e.secondsPerInterval = seconds
+		e.delimiter, e.whitespace = " ", true
 		return nil
 	}
 }
 
-// Expression represents a RPN expression.
-type Expression struct {
-	delimiter                rune
-	openBindings             map[string]int // count of number of instances
-	secondsPerInterval       float64
-	tokens                   []interface{} // components of the expression
-	performTimeSubstitutions bool
-	// work area
-	scratchSize int           // how much work area this needs
-	scratchHead int           // index of top of scratch and isFloat slices
-	scratch     []interface{} // work area where calculations are done
-	isFloat     []bool        // true iff corresponding scratch item is a float64 (consider using reflection, but might be slower)
+// DivisionByZeroPolicy determines the result of dividing by zero with the /, %, and MODINT operators.
+type DivisionByZeroPolicy int
+
+const (
+	// DivisionByZeroNaN results in NaN, which is UNKN, as with RRDtool. This is the default.
+	DivisionByZeroNaN DivisionByZeroPolicy = iota
+
+	// DivisionByZeroInf results in what IEEE 754 arithmetic results in: +Inf or -Inf depending on
+	// the sign of the dividend, or NaN when the dividend is zero or NaN, and always NaN for % and
+	// MODINT.
+	DivisionByZeroInf
+
+	// DivisionByZeroError results in ErrDivisionByZero being returned, by New when both operands
+	// are constants, and otherwise by Evaluate.
+	DivisionByZeroError
+)
+
+// ErrDivisionByZero error is returned when an RPN Expression configured with DivisionByZeroError
+// divides by zero.
+type ErrDivisionByZero struct {
+	Operator string
+	Dividend float64
 }
 
-// New returns a new RPN Expression based on some expression.  Creating a new RPN expression
-// automatically invokes the Partial method on the expression to ensure the most reduced form of the
-// RPN expression is returned. See notes on the Partial method for additional reasoning behind this
-// decision.
+// Error returns the error string representation for ErrDivisionByZero errors.
+func (e ErrDivisionByZero) Error() string {
+	return fmt.Sprintf("division by zero: %s,0,%s", formatNumber(e.Dividend, -1), e.Operator)
+}
+
+// Is returns true when target is ErrDivideByZero.
+func (e ErrDivisionByZero) Is(target error) bool {
+	return target == ErrDivideByZero
+}
+
+// ErrOverflow error is returned when an RPN Expression configured with CheckedArithmetic computes a
+// result too large in magnitude to be represented by a float64 from finite operands.
+type ErrOverflow struct {
+	Operator string
+	Operands []float64
+	Position int // index of the operator in the program being run
+}
+
+// Error returns the error string representation for ErrOverflow errors.
+func (e ErrOverflow) Error() string {
+	return "overflow at token " + formatOperation(e.Position, e.Operands, e.Operator)
+}
+
+// ErrUnderflow error is returned when an RPN Expression configured with CheckedArithmetic computes a
+// result from nonzero finite operands that is too small in magnitude to be represented by a normal
+// float64, so that it became 0, or a subnormal number with less precision than its operands.
+type ErrUnderflow struct {
+	Operator string
+	Operands []float64
+	Position int // index of the operator in the program being run
+}
+
+// Error returns the error string representation for ErrUnderflow errors.
+func (e ErrUnderflow) Error() string {
+	return "underflow at token " + formatOperation(e.Position, e.Operands, e.Operator)
+}
+
+// formatOperation returns the position of an operator, followed by the operator applied to its
+// operands.
+func formatOperation(position int, operands []float64, operator string) string {
+	strs := make([]string, len(operands))
+	for i, operand := range operands {
+		strs[i] = formatNumber(operand, -1)
+	}
+	return fmt.Sprintf("%d: %s,%s", position, strings.Join(strs, ","), operator)
+}
+
+// ErrLimitExceeded error is returned when an operator of an RPN Expression, such as COPY or HIST,
+// would grow the stack to more items than allowed by StackLimit.
+type ErrLimitExceeded struct {
+	Limit    int
+	Size     int // items the stack would have held
+	Position int // index of the operator in the program being run
+}
+
+// Error returns the error string representation for ErrLimitExceeded errors.
+func (e ErrLimitExceeded) Error() string {
+	return fmt.Sprintf("stack limit of %d exceeded at token %d: %d items", e.Limit, e.Position, e.Size)
+}
+
+// DivisionByZero allows changing what an RPN Expression results in when the / or % operators
+// divide by zero, because alerting pipelines disagree on the right semantics.
 //
-//	expression, err := gorpn.New("60,24,*")
-//	if err != nil {
-//	    panic(err)
-//	}
-//	result, err := expression.Evaluate(nil)
-//	if err != nil {
-//	    panic(err)
+//	func example() {
+//		exp, err := gorpn.New("errors,requests,/", gorpn.DivisionByZero(gorpn.DivisionByZeroError))
+//		if err != nil {
+//			panic(err)
+//		}
+//		_, err = exp.Evaluate(map[string]interface{}{"errors": 0, "requests": 0})
+//		// err is gorpn.ErrDivisionByZero
 //	}
-func New(someExpression string, setters ...ExpressionConfigurator) (*Expression, error) {
-	if someExpression == "" {
-		return nil, ErrSyntax{"empty expression", nil}
-	}
-	e := &Expression{
-		delimiter:          DefaultDelimiter,
-		secondsPerInterval: DefaultSecondsPerInterval,
-	}
-	for _, setter := range setters {
-		if err := setter(e); err != nil {
-			return nil, err
+func DivisionByZero(policy DivisionByZeroPolicy) ExpressionConfigurator {
+	return func(e *Expression) error {
+		switch policy {
+		case DivisionByZeroNaN, DivisionByZeroInf, DivisionByZeroError:
+			e.divisionByZero = policy
+			return nil
 		}
+		return newErrSyntax("unknown division by zero policy: %d", int(policy))
 	}
-	tokens := strings.Split(someExpression, string(e.delimiter))
-	e.scratchSize = len(tokens)
+}
 
-	e.tokens = make([]interface{}, e.scratchSize)
-	for idx, token := range tokens {
-		switch token {
-		case "NOW", "TIME", "LTIME", "NEWDAY", "NEWWEEK", "NEWMONTH", "NEWYEAR":
-			e.performTimeSubstitutions = true
-		case "DUP":
-			e.scratchSize++
+// ComparisonPolicy determines the result of the GE, GT, LE, and LT operators when either operand is
+// NaN, which is UNKN.
+type ComparisonPolicy int
+
+const (
+	// ComparisonNaN results in NaN, for historical reasons. This is the default.
+	ComparisonNaN ComparisonPolicy = iota
+
+	// ComparisonFalse results in false, which is 0, just as IEEE 754 comparisons do.
+	ComparisonFalse
+
+	// ComparisonUnknownAsFalse treats each NaN operand as false, which is 0, before comparing, so
+	// that 5,UNKN,GT results in 1.
+	ComparisonUnknownAsFalse
+)
+
+// ComparisonsWithNaN allows changing what the GE, GT, LE, and LT operators of an RPN Expression
+// result in when either operand is NaN. By default they result in NaN, which breaks chains of
+// boolean operators, because NaN is neither true nor false. EQ and NE are not affected: when either
+// operand is NaN, EQ results in 0 and NE results in 1.
+//
+//	func example() {
+//		exp, err := gorpn.New("qps,100,GT,errors,5,GT,+", gorpn.ComparisonsWithNaN(gorpn.ComparisonFalse))
+//		if err != nil {
+//			panic(err)
+//		}
+//	}
+func ComparisonsWithNaN(policy ComparisonPolicy) ExpressionConfigurator {
+	return func(e *Expression) error {
+		switch policy {
+		case ComparisonNaN, ComparisonFalse, ComparisonUnknownAsFalse:
+			e.comparisonsWithNaN = policy
+			return nil
 		}
-		e.tokens[idx] = token
+		return newErrSyntax("unknown comparison policy: %d", int(policy))
 	}
-	// scratchSize may be larger than it was before above loop
-	e.scratch = make([]interface{}, e.scratchSize)
-	e.isFloat = make([]bool, e.scratchSize)
-
-	return e.Partial(nil)
 }
 
-// Evaluate evaluates the Expression after applying the parameter bindings. An empty map or, more
-// idiomatically a nil value, is given to Evaluate for RPN expressions that have no open bindings.
+// ThreeValuedLogic causes an RPN Expression to treat UNKN as a third truth value, as rrdtool
+// documents: the EQ, NE, GE, GT, LE, and LT operators result in UNKN when either operand is UNKN,
+// regardless of ComparisonsWithNaN, and the IF operator results in UNKN when its condition is
+// UNKN, rather than taking its else branch. Consequently, a symbol is no longer known to equal
+// itself, because it may be bound to UNKN.
 //
-//	expression, err := gorpn.New("60,24,*")
-//	if err != nil {
-//	    panic(err)
-//	}
-//	result, err := expression.Evaluate(nil)
-//	if err != nil {
-//	    panic(err)
+//	func example() {
+//		exp, err := gorpn.New("qps,100,GT,1,0,IF", gorpn.ThreeValuedLogic())
+//		if err != nil {
+//			panic(err)
+//		}
+//		value, err := exp.Evaluate(map[string]interface{}{"qps": math.NaN()})
+//		// value is NaN, rather than 0
 //	}
+func ThreeValuedLogic() ExpressionConfigurator {
+	return func(e *Expression) error {
+		e.threeValuedLogic = true
+		return nil
+	}
+}
+
+// StrictAggregates causes the AVG, ALLAVG, and STDEV operators of an RPN Expression to result in UNKN when
+// any of the items they consume is UNKN, just as arithmetic operators do, rather than ignoring those
+// items. The AVGNAN and STDEVNAN operators always ignore UNKN items, so that expressions may choose
+// for each aggregate whether missing data is tolerated.
 //
-// For RPN expressions that have open bindings, simply create a map and set keys to the parameter
-// names and their respective values to their desired bound values.
-//
-//	expression, err := gorpn.New("12,age,*")
-//	if err != nil {
-//	    panic(err)
-//	}
-//	bindings := map[string]interface{} {
-//	    "age": 21,
-//	}
-//	result, err := expression.Evaluate(bindings)
-//	if err != nil {
-//	    panic(err)
+//	func example() {
+//		exp, err := gorpn.New("a,b,c,3,AVG", gorpn.StrictAggregates())
+//		if err != nil {
+//			panic(err)
+//		}
+//		value, err := exp.Evaluate(map[string]interface{}{"a": 1, "b": math.NaN(), "c": 3})
+//		// value is NaN, rather than 2
 //	}
-func (e *Expression) Evaluate(bindings map[string]interface{}) (float64, error) {
-	var err error
-
-	if err = e.simplify(bindings); err != nil {
-		return 0, err
+func StrictAggregates() ExpressionConfigurator {
+	return func(e *Expression) error {
+		e.strictAggregates = true
+		return nil
 	}
+}
 
-	var openBindings []string
-	for k, v := range e.openBindings {
-		if v > 0 {
-			openBindings = append(openBindings, k)
+// SecondsPerInterval allows changing the expected number of seconds per interval to be used when
+// evaluating an RPN Expression from the default value of 300..
+//
+//	func example() {
+//		exp, err := gorpn.New("42,13,2,MEDIAN", gorpn.SecondsPerInterval(60))
+//		if err != nil {
+//			panic(err)
+//		}
+//	}
+func SecondsPerInterval(seconds float64) ExpressionConfigurator {
+	return func(e *Expression) error {
+		if seconds <= 0 {
+			return newErrSyntax("cannot use %d seconds as interval", seconds)
 		}
+		e.secondsPerInterval = seconds
+		return nil
 	}
-	if len(openBindings) > 0 {
-		return 0, ErrOpenBindings(openBindings)
-	}
+}
 
-	if e.scratchHead != 1 {
-		return 0, newErrSyntax("extra parameters: %v", e.scratch)
-	}
-	result, ok := e.scratch[0].(float64)
-	if !ok {
-		return 0, ExpectedFloat{e.scratch[0]}
+// locations interns each time zone loaded by TimeZone by its name, so that expressions configured
+// with the same time zone share a configuration, and NewCached finds the expressions compiled with
+// it.
+var locations sync.Map
+
+// TimeZone allows changing the time zone in which LTIME, NEWDAY, NEWWEEK, NEWMONTH, and NEWYEAR
+// interpret the time bound to TIME from the local time zone of the process. The name is given to
+// time.LoadLocation, so "UTC" and names from the IANA Time Zone database such as
+// "America/New_York" are accepted. For time zones that observe daylight saving time, the offset
+// from UTC is the one in effect at the time bound to TIME, rather than the one in effect when the
+// expression is evaluated.
+//
+//	func example() {
+//		exp, err := gorpn.New("LTIME,TIME,-", gorpn.TimeZone("America/New_York"))
+//		if err != nil {
+//			panic(err)
+//		}
+//		value, err := exp.Evaluate(map[string]interface{}{"TIME": 1615705200}) // -14400, during EDT
+//	}
+func TimeZone(name string) ExpressionConfigurator {
+	return func(e *Expression) error {
+		if loc, ok := locations.Load(name); ok {
+			e.location = loc.(*time.Location)
+			return nil
+		}
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			return newErrSyntax("cannot load time zone %q: %s", name, err)
+		}
+		actual, _ := locations.LoadOrStore(name, loc)
+		e.location = actual.(*time.Location)
+		return nil
 	}
-	return result, nil
 }
 
-// OpenBindings returns a slice of strings representing the remaining open
-// bindings in the Expression.
-func (e *Expression) OpenBindings() []string {
-	l := len(e.openBindings)
-	if l == 0 {
+// RandomSeed allows making the RANDOM and GAUSSIAN operators of an RPN Expression produce the same
+// sequence of values every time the program runs, which is useful for tests. By default, they use
+// the global source of random values of the math/rand package. Expressions derived from the
+// Expression by Partial or Rename continue the same sequence.
+//
+//	func example() {
+//		exp, err := gorpn.New("qps,0,5,GAUSSIAN,+", gorpn.RandomSeed(42))
+//		if err != nil {
+//			panic(err)
+//		}
+//	}
+func RandomSeed(seed int64) ExpressionConfigurator {
+	return func(e *Expression) error {
+		e.random, e.seed = newRandom(seed), seed
 		return nil
 	}
+}
 
-	openBindings := make([]string, 0, l)
-	for k, v := range e.openBindings {
-		if v > 0 {
-			openBindings = append(openBindings, k)
-		}
-	}
+// newRandom returns a source of random values seeded with seed that is safe for concurrent use.
+func newRandom(seed int64) *rand.Rand {
+	return rand.New(&lockedSource{src: rand.NewSource(seed).(rand.Source64)})
+}
 
-	return openBindings
+// lockedSource is a source of random values that is safe for concurrent use, so that Expressions
+// sharing one may be evaluated by different goroutines.
+type lockedSource struct {
+	lock sync.Mutex
+	src  rand.Source64
 }
 
-// String returns the string representation of an Expression.
+func (s *lockedSource) Int63() int64 {
+	s.lock.Lock()
+	n := s.src.Int63()
+	s.lock.Unlock()
+	return n
+}
+
+func (s *lockedSource) Uint64() uint64 {
+	s.lock.Lock()
+	n := s.src.Uint64()
+	s.lock.Unlock()
+	return n
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.lock.Lock()
+	s.src.Seed(seed)
+	s.lock.Unlock()
+}
+
+// config holds the settings an ExpressionConfigurator may change.
+type config struct {
+	delimiter                string
+	whitespace               bool // tokens are separated by runs of whitespace, and delimiter is a space for String
+	divisionByZero           DivisionByZeroPolicy
+	comparisonsWithNaN       ComparisonPolicy
+	precision                int  // digits after the decimal point when printing numbers, or -1 for shortest
+	decimalSeparator         rune // separates the integer and fractional parts of numbers, or 0 for the period
+	secondsPerInterval       float64
+	location                 *time.Location // nil for the local time zone of the process
+	random                   *rand.Rand     // nil to use the global source of the math/rand package
+	seed                     int64          // seed of random, so that NewCached may key on it
+	aliases                  *aliasTable    // nil when no operator has an alias
+	canonicalOperators       bool           // String writes operators rather than their aliases
+	caseInsensitiveOperators bool           // operators may be written in any letter case
+	lenientCounts            bool           // counts of items are truncated to integers rather than rejected
+	checkedArithmetic        bool           // overflowing or underflowing arithmetic returns an error
+	stackLimit               int            // most items COPY and HIST may grow the stack to
+	budget                   int            // maximum cost of evaluating, or 0 when unlimited
+	costs                    *costTable     // nil when every operator has the default weight
+	numericStrings           bool           // strings holding numbers may be bound to symbols
+	rejectNaNInputs          bool           // symbols bound to NaN return ErrNaNInput when evaluated
+	threeValuedLogic         bool           // comparisons with UNKN, and IF with an UNKN condition, are UNKN
+	rejectUnknownBool        bool           // EvaluateBool returns ErrUnknownResult rather than false for UNKN
+	noSimplify               bool           // New keeps the program as written rather than simplifying it
+	strictAggregates         bool           // AVG and STDEV are UNKN when any of their operands are UNKN
+	wholeSeriesTrend         bool           // EvaluateSeriesResult binds labels of TREND to whole series
+	rewrites                 *rewriteTable  // nil when no rewrite rules are registered
+}
+
+func newConfig() config {
+	return config{
+		delimiter:          string(DefaultDelimiter),
+		precision:          -1,
+		secondsPerInterval: DefaultSecondsPerInterval,
+		stackLimit:         DefaultStackLimit,
+	}
+}
+
+// Precision allows changing how many digits after the decimal point the String method writes for
+// each number in an RPN Expression. By default, String writes each number using the fewest digits
+// that read back as the same value, which for values such as 0.1+0.2 can be unwieldy for systems
+// that expect a fixed precision. A negative precision restores the default.
 //
 //	func example() {
-//		exp, err := gorpn.New("5,3,+,foo,*")
+//		exp, err := gorpn.New("0.1,0.2,+,foo,*", gorpn.Precision(2))
 //		if err != nil {
 //			panic(err)
 //		}
-//		s := exp.String() // "8,foo,*"
+//		s := exp.String() // "0.30,foo,*"
 //	}
-func (e Expression) String() string {
-	strs := make([]string, len(e.tokens))
-	for idx, v := range e.tokens {
-		switch v.(type) {
-		case float64:
-			switch {
-			case math.IsNaN(v.(float64)):
-				// strs[idx] = "NaN" // would prefer this
-				strs[idx] = "UNKN" // don't like this
-			case math.IsInf(v.(float64), 1):
-				strs[idx] = "INF"
-			case math.IsInf(v.(float64), -1):
-				strs[idx] = "NEGINF"
-			default:
-				strs[idx] = fmt.Sprint(v)
+func Precision(prec int) ExpressionConfigurator {
+	return func(e *Expression) error {
+		if prec < 0 {
+			prec = -1
+		}
+		e.precision = prec
+		return nil
+	}
+}
+
+// DecimalSeparator allows reading and writing the numbers of an RPN Expression with a decimal
+// separator other than the period, such as the decimal comma of many locales, so that expressions
+// taken from configurations written for those locales, such as "3,5 foo *", need not be rewritten.
+// The separator must be either the period or the comma, and may not be part of the delimiter, which
+// New reports as an error rather than splitting each number in two. Numbers are written without
+// grouping their digits, and once another separator is configured, New rejects numbers written with
+// the period, which are likely mistakes. The String method writes numbers with the separator.
+//
+//	func example() {
+//		exp, err := gorpn.New("3,5 foo *", gorpn.WhitespaceDelimited(), gorpn.DecimalSeparator(','))
+//		if err != nil {
+//			panic(err)
+//		}
+//		s := exp.String() // "3,5 foo *"
+//	}
+func DecimalSeparator(separator rune) ExpressionConfigurator {
+	return func(e *Expression) error {
+		if separator != '.' && separator != ',' {
+			return newErrSyntax("cannot use %q as decimal separator", separator)
+		}
+		e.decimalSeparator = separator
+		if separator == '.' {
+			e.decimalSeparator = 0
+		}
+		return nil
+	}
+}
+
+// parseLocaleNumber returns the value of token when it is a number written with the decimal
+// separator of the configuration, and false when it is not a number. It returns an error when
+// token is a number written with the period while another decimal separator is configured.
+func (c config) parseLocaleNumber(token string) (float64, bool, error) {
+	if c.decimalSeparator == 0 {
+		value, ok := parseNumber(token)
+		return value, ok, nil
+	}
+	if strings.ContainsRune(token, '.') {
+		if _, ok := parseNumber(token); ok {
+			return 0, false, newErrSyntax("cannot use number %q written with a period when the decimal separator is %q", token, c.decimalSeparator)
+		}
+		return 0, false, nil
+	}
+	value, ok := parseNumber(strings.Replace(token, string(c.decimalSeparator), ".", 1))
+	return value, ok, nil
+}
+
+// formatLocaleNumber returns the literal token for value, written as formatNumber writes it, but
+// with the decimal separator of the configuration.
+func (c config) formatLocaleNumber(value float64) string {
+	s := formatNumber(value, c.precision)
+	if c.decimalSeparator == 0 {
+		return s
+	}
+	return strings.Replace(s, ".", string(c.decimalSeparator), 1)
+}
+
+// TraceEvent describes one operator applied while simplifying or evaluating an Expression, and is
+// given to the function registered with the Trace configurator.
+type TraceEvent struct {
+	Position int           // index of the operator in the program being run
+	Operator string        // name of the operator
+	Inputs   []interface{} // items the operator consumed from the stack, deepest first
+	Outputs  []interface{} // items the operator left on the stack in their place
+	Stack    []interface{} // the whole stack after the operator
+	Deferred bool          // true when some operands are not yet known, so the operator remains in the program
+}
+
+// LenientCounts allows the operators of an RPN Expression that take a count of items, such as COPY,
+// INDEX, ROLL, SORT, and AVG, to accept counts that are not integers, truncating them to integers
+// as earlier versions of this library did. By default, such counts are rejected with an ErrSyntax
+// error naming the offending value, because silently truncating a count like 2.7 to 2 hides
+// mistakes in machine generated expressions.
+//
+//	func example() {
+//		exp, err := gorpn.New("a,b,c,2.7,COPY", gorpn.LenientCounts())
+//		if err != nil {
+//			panic(err)
+//		}
+//		s := exp.String() // "a,b,c,b,c"
+//	}
+func LenientCounts() ExpressionConfigurator {
+	return func(e *Expression) error {
+		e.lenientCounts = true
+		return nil
+	}
+}
+
+// CheckedArithmetic causes the +, -, *, and POW operators of an RPN Expression to return an
+// ErrOverflow error, naming the position of the operator, when they overflow to +Inf or -Inf from
+// finite operands, rather than silently propagating the infinity, which otherwise surfaces as a
+// confusing UNKN far downstream in chains of LIMIT or MAX operators. Likewise, the * and POW
+// operators return an ErrUnderflow error when they underflow from nonzero finite operands to 0 or
+// to a subnormal number, as 1e-300,1e-300,* does. The + and - operators cannot lose precision by
+// underflowing, because their subnormal results are exact. Like division by zero, the error is
+// returned by New when both operands are constants, and otherwise by Evaluate.
+//
+//	func example() {
+//		exp, err := gorpn.New("bytes,1e300,*", gorpn.CheckedArithmetic())
+//		if err != nil {
+//			panic(err)
+//		}
+//		_, err = exp.Evaluate(map[string]interface{}{"bytes": 1e10})
+//		// err is gorpn.ErrOverflow
+//	}
+func CheckedArithmetic() ExpressionConfigurator {
+	return func(e *Expression) error {
+		e.checkedArithmetic = true
+		return nil
+	}
+}
+
+// StackLimit allows changing the most items the stack of an RPN Expression may hold once operators
+// that push a count of items, COPY and HIST, grow it beyond what the program itself pushes, which
+// by default is DefaultStackLimit. A few tokens such as "DUP,DEPTH,COPY" double the stack each time
+// they are repeated, so without a limit a short expression could exhaust memory. Those operators
+// return an ErrLimitExceeded error rather than growing the stack beyond the limit, from New when
+// their operands are constants, and otherwise from Evaluate.
+//
+//	func example() {
+//		exp, err := gorpn.New(tenantExpression, gorpn.StackLimit(10000))
+//		if err != nil {
+//			panic(err)
+//		}
+//		_, err = exp.Evaluate(bindings)
+//		// err is gorpn.ErrLimitExceeded when the expression copies more than 10000 items
+//	}
+func StackLimit(limit int) ExpressionConfigurator {
+	return func(e *Expression) error {
+		if limit <= 0 {
+			return newErrSyntax("stack limit requires positive integer: %d", limit)
+		}
+		e.stackLimit = limit
+		return nil
+	}
+}
+
+// RejectNaNInputs causes Evaluate, and the other methods that evaluate an RPN Expression, to return
+// an ErrNaNInput error listing the symbols of the Expression that are bound to NaN, rather than
+// silently propagating UNKN, for pipelines that prefer an error for missing data over an unknown
+// result. Only symbols bound to a single number are checked, so a series may hold NaN values, and
+// bindings the Expression does not use are ignored.
+//
+//	func example() {
+//		exp, err := gorpn.New("errors,requests,/", gorpn.RejectNaNInputs())
+//		if err != nil {
+//			panic(err)
+//		}
+//		_, err = exp.Evaluate(map[string]interface{}{"errors": math.NaN(), "requests": 100})
+//		// err is gorpn.ErrNaNInput{"errors"}
+//	}
+func RejectNaNInputs() ExpressionConfigurator {
+	return func(e *Expression) error {
+		e.rejectNaNInputs = true
+		return nil
+	}
+}
+
+// NumericStrings allows binding a symbol to a string that holds a number, such as "13" or "1.5e3",
+// as written in an RPN Expression, because values that arrive from JSON APIs are often encoded as
+// strings. Without it, binding a symbol to a string results in an ErrBadBindingType error.
+//
+//	func example() {
+//		exp, err := gorpn.New("used,total,/", gorpn.NumericStrings())
+//		if err != nil {
+//			panic(err)
+//		}
+//		value, err := exp.Evaluate(map[string]interface{}{"used": "512", "total": "2048"})
+//		// value is 0.25
+//	}
+func NumericStrings() ExpressionConfigurator {
+	return func(e *Expression) error {
+		e.numericStrings = true
+		return nil
+	}
+}
+
+// NoSimplify causes New to keep the program of an RPN Expression as written, rather than
+// simplifying it as if by Partial, for loaders of many expressions that will be specialized by
+// Partial with real bindings right away, which simplifies them anyway. New still returns an error
+// for an expression that cannot be evaluated, and String, Tokens, and Hash describe the program as
+// written, apart from how its numbers are written. Evaluate computes the same results either way.
+//
+//	func example() {
+//		exp, err := gorpn.New("60,60,*,qps,*", gorpn.NoSimplify())
+//		if err != nil {
+//			panic(err)
+//		}
+//		s := exp.String() // "60,60,*,qps,*", rather than "3600,qps,*"
+//	}
+func NoSimplify() ExpressionConfigurator {
+	return func(e *Expression) error {
+		e.noSimplify = true
+		return nil
+	}
+}
+
+// Trace allows registering a function that is invoked for every operator applied while simplifying
+// or evaluating an RPN Expression, which is invaluable for learning why a long expression does not
+// evaluate to the expected value. Numbers are float64 values, and symbols and operators that
+// cannot yet be evaluated are strings. Because New simplifies the expression, the function is
+// invoked by New as well as by Evaluate and Partial.
+//
+//	func example() {
+//		exp, err := gorpn.New("a,b,/,c,+", gorpn.Trace(func(event gorpn.TraceEvent) {
+//			fmt.Printf("%d %s %v => %v\n", event.Position, event.Operator, event.Inputs, event.Outputs)
+//		}))
+//		if err != nil {
+//			panic(err)
+//		}
+//		value, err := exp.Evaluate(map[string]interface{}{"a": 0, "b": 0, "c": 3})
+//		// 2 / [0 0] => [NaN]
+//		// 4 + [NaN 3] => [NaN]
+//	}
+func Trace(fn func(TraceEvent)) ExpressionConfigurator {
+	return func(e *Expression) error {
+		e.trace = nil
+		if fn != nil {
+			e.trace = func(event TraceEvent) {
+				callback("", func() { fn(event) })
+			}
+		}
+		return nil
+	}
+}
+
+// Expression represents a RPN expression.
+type Expression struct {
+	config
+	openBindings             map[string]int // count of number of instances
+	tokens                   []interface{}  // components of the expression
+	performTimeSubstitutions bool
+	needsTime                bool // program uses TIME, or an operator computed from it, such as LTIME
+	needsNow                 bool // program uses NOW
+	isEvaluating             bool // true when every value must be computed, including random values
+	// work area
+	scratchSize int           // how much work area this needs
+	scratchHead int           // index of top of scratch and isFloat slices
+	scratch     []interface{} // work area where calculations are done
+	isFloat     []bool        // true iff corresponding scratch item is a float64 (consider using reflection, but might be slower)
+	sorter      scratchSorter // reused by SORT so sorting does not allocate
+	trace       func(TraceEvent)
+	metrics     Metrics    // nil when no measurements are reported
+	memo        *memoTable // results remembered by EvaluateMemo
+	info        *Info      // collects what EvaluateWithInfo reports, only while it evaluates
+	// provenance
+	partialOf       *Expression            // the Expression this one was derived from by Partial, if any
+	partialBindings map[string]interface{} // the coerced bindings Partial applied to partialOf
+	source          string                 // the expression given to New
+	sources         []SourceRange          // range of source each token was derived from, or nil when not known
+}
+
+// scratchSorter sorts a region of the work area holding only float64 values in ascending order,
+// placing NaN values first, just like sort.Float64s.
+type scratchSorter []interface{}
+
+func (s *scratchSorter) Len() int { return len(*s) }
+
+func (s *scratchSorter) Less(i, j int) bool {
+	a, b := (*s)[i].(float64), (*s)[j].(float64)
+	return a < b || (math.IsNaN(a) && !math.IsNaN(b))
+}
+
+func (s *scratchSorter) Swap(i, j int) { (*s)[i], (*s)[j] = (*s)[j], (*s)[i] }
+
+// reverse reverses the order of the items in the work area from index i up to but not including
+// index j.
+func (e *Expression) reverse(i, j int) {
+	for j--; i < j; i, j = i+1, j-1 {
+		e.scratch[i], e.scratch[j] = e.scratch[j], e.scratch[i]
+		e.isFloat[i], e.isFloat[j] = e.isFloat[j], e.isFloat[i]
+	}
+}
+
+// New returns a new RPN Expression based on some expression.  Creating a new RPN expression
+// automatically invokes the Partial method on the expression to ensure the most reduced form of the
+// RPN expression is returned. See notes on the Partial method for additional reasoning behind this
+// decision.
+//
+//	expression, err := gorpn.New("60,24,*")
+//	if err != nil {
+//	    panic(err)
+//	}
+//	result, err := expression.Evaluate(nil)
+//	if err != nil {
+//	    panic(err)
+//	}
+func New(someExpression string, setters ...ExpressionConfigurator) (*Expression, error) {
+	if someExpression == "" {
+		return nil, ErrSyntax{Message: "empty expression"}
+	}
+	e := &Expression{config: newConfig()}
+	for _, setter := range setters {
+		if err := setter(e); err != nil {
+			return nil, err
+		}
+	}
+	if e.decimalSeparator != 0 && !e.whitespace && strings.ContainsRune(e.delimiter, e.decimalSeparator) {
+		return nil, newErrSyntax("cannot use %q as decimal separator with delimiter %q", e.decimalSeparator, e.delimiter)
+	}
+	delimiter := e.delimiter
+	if e.whitespace {
+		delimiter = "" // separated by runs of whitespace
+	}
+	lexemes, err := tokenize(someExpression, delimiter)
+	if err != nil {
+		return nil, err
+	}
+	e.scratchSize = len(lexemes)
+
+	e.source = someExpression
+	e.sources = make([]SourceRange, len(lexemes))
+	e.tokens = make([]interface{}, e.scratchSize)
+	for idx, l := range lexemes {
+		e.sources[idx] = SourceRange{l.offset, l.end}
+		token := l.text
+		if l.quoted {
+			e.tokens[idx] = token // quoted tokens are always symbols
+			continue
+		}
+		token, _ = e.operatorName(token)
+		if token == "DUP" || token == "OVER" || token == "TUCK" {
+			e.scratchSize++
+		}
+		if _, ok := arity[token]; !ok {
+			// convert numeric tokens once so evaluation never needs to parse them again
+			value, ok, err := e.parseLocaleNumber(token)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				e.tokens[idx] = value
+				continue
+			}
+		}
+		e.tokens[idx] = token
+	}
+	e.needsTime, e.needsNow = timeTokens(e.tokens)
+	e.performTimeSubstitutions = e.needsTime || e.needsNow
+	// scratchSize may be larger than it was before above loop
+	e.scratch = make([]interface{}, e.scratchSize)
+	e.isFloat = make([]bool, e.scratchSize)
+
+	if e.noSimplify {
+		// still find the errors and open bindings of the program, without rewriting it
+		if err = e.simplify(nil); err != nil {
+			return nil, err
+		}
+		if e.scratchHead == 0 {
+			return nil, newErrSyntax("expression leaves no value on the stack")
+		}
+		if err = checkStackTypes(e.tokens, e.sources); err != nil {
+			return nil, err
+		}
+		if e.metrics != nil {
+			e.metrics.Compiled(e.foldRatio(len(lexemes)))
+		}
+		return e, nil
+	}
+
+	exp, err := e.Partial(nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(exp.tokens) == 0 {
+		return nil, newErrSyntax("expression leaves no value on the stack")
+	}
+	if err = checkStackTypes(exp.tokens, exp.sources); err != nil {
+		return nil, err
+	}
+	if exp.metrics != nil {
+		exp.metrics.Compiled(exp.foldRatio(len(lexemes)))
+	}
+	return exp, nil
+}
+
+// NewAutoDelimiter returns a new RPN Expression based on some expression, just like New, but first
+// detects whether the expression uses the comma, vertical bar, semicolon, or whitespace as its
+// delimiter. Characters within quoted or escaped symbols are not considered. It returns an error
+// rather than guessing when the expression contains more than one of these delimiters.
+//
+//	func example(ingested []string) {
+//		for _, someExpression := range ingested {
+//			// "42,13,2,MEDIAN", "42|13|2|MEDIAN", "42 13 2 MEDIAN", ...
+//			exp, err := gorpn.NewAutoDelimiter(someExpression)
+//			if err != nil {
+//				panic(err)
+//			}
+//		}
+//	}
+func NewAutoDelimiter(someExpression string, setters ...ExpressionConfigurator) (*Expression, error) {
+	delimiter, err := detectDelimiter(someExpression)
+	if err != nil {
+		return nil, err
+	}
+	detected := WhitespaceDelimited()
+	if delimiter != "" {
+		detected = DelimiterString(delimiter)
+	}
+	return New(someExpression, append([]ExpressionConfigurator{detected}, setters...)...)
+}
+
+// Evaluate evaluates the Expression after applying the parameter bindings. An empty map or, more
+// idiomatically a nil value, is given to Evaluate for RPN expressions that have no open bindings.
+//
+//	expression, err := gorpn.New("60,24,*")
+//	if err != nil {
+//	    panic(err)
+//	}
+//	result, err := expression.Evaluate(nil)
+//	if err != nil {
+//	    panic(err)
+//	}
+//
+// For RPN expressions that have open bindings, simply create a map and set keys to the parameter
+// names and their respective values to their desired bound values.
+//
+//	expression, err := gorpn.New("12,age,*")
+//	if err != nil {
+//	    panic(err)
+//	}
+//	bindings := map[string]interface{} {
+//	    "age": 21,
+//	}
+//	result, err := expression.Evaluate(bindings)
+//	if err != nil {
+//	    panic(err)
+//	}
+//
+// A symbol may also be bound to another *Expression, in which case that expression is evaluated in
+// place of the symbol, using the same bindings.
+//
+// A symbol may also be bound to a *float64 or a func() float64, whose value is read each time the
+// Expression is evaluated, so that an Expression may be evaluated repeatedly against live gauges
+// without rebuilding the bindings. Partial leaves such symbols open.
+//
+//	var connections float64
+//	bindings := map[string]interface{} {
+//	    "connections": &connections,
+//	    "load": func() float64 { return loadAverage() },
+//	}
+//	result, err := expression.Evaluate(bindings) // reads connections and calls load
+func (e *Expression) Evaluate(bindings map[string]interface{}) (float64, error) {
+	if e.metrics == nil {
+		return e.evaluate(bindings)
+	}
+	start := time.Now()
+	result, err := e.evaluate(bindings)
+	e.metrics.Evaluated(time.Since(start), errorKind(err))
+	return result, err
+}
+
+// evaluate evaluates the Expression for Evaluate, which reports a single measurement to Metrics no
+// matter how many times evaluate invokes itself.
+func (e *Expression) evaluate(bindings map[string]interface{}) (result float64, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = 0, newErrInternal(r, e.config, e.tokens, -1)
+		}
+	}()
+
+	if !e.performTimeSubstitutions && bindingsNeedTime(bindings) {
+		// an expression bound to one of the symbols needs to know about time
+		exp := e.clone()
+		exp.performTimeSubstitutions = true
+		exp.info = e.info
+		return exp.evaluate(bindings)
+	}
+
+	e.isEvaluating = true
+	if err = e.simplify(bindings); err != nil {
+		return 0, err
+	}
+
+	var openBindings []string
+	for k, v := range e.openBindings {
+		if v > 0 {
+			openBindings = append(openBindings, k)
+		}
+	}
+	if len(openBindings) > 0 {
+		// Open bindings might only be needed by the untaken branch of an IF whose condition is
+		// now known, in which case that branch is discarded and the remainder evaluated.
+		remaining := make([]interface{}, e.scratchHead)
+		copy(remaining, e.scratch)
+		if tokens, _, ok := e.eliminateDeadBranches(remaining, nil); ok {
+			exp := &Expression{
+				config:                   e.config,
+				trace:                    e.trace,
+				tokens:                   tokens,
+				performTimeSubstitutions: e.performTimeSubstitutions,
+				scratchSize:              e.scratchSize,
+				scratch:                  make([]interface{}, len(e.scratch)),
+				isFloat:                  make([]bool, len(e.isFloat)),
+			}
+			return exp.evaluate(bindings)
+		}
+		return 0, e.errOpenBindings(openBindings, e.scratch[:e.scratchHead])
+	}
+
+	if e.scratchHead != 1 {
+		return 0, newErrSyntax("extra parameters: %v", e.scratch)
+	}
+	result, ok := e.scratch[0].(float64)
+	if !ok {
+		return 0, ExpectedFloat{e.scratch[0]}
+	}
+	return result, nil
+}
+
+// OpenBindings returns a slice of strings representing the remaining open
+// bindings in the Expression.
+func (e *Expression) OpenBindings() []string {
+	l := len(e.openBindings)
+	if l == 0 {
+		return nil
+	}
+
+	openBindings := make([]string, 0, l)
+	for k, v := range e.openBindings {
+		if v > 0 {
+			openBindings = append(openBindings, k)
+		}
+	}
+
+	return openBindings
+}
+
+// NeedsTime returns true when evaluating the Expression requires TIME to be bound, because its
+// program uses TIME, LTIME, NEWDAY, NEWWEEK, NEWMONTH, or NEWYEAR, so that schedulers need only
+// compute a TIME binding for the expressions that use it. It is determined when the Expression is
+// compiled, and does not account for expressions bound to its symbols when it is evaluated.
+//
+//	func example(when time.Time) {
+//		exp, err := gorpn.New("qps,NEWDAY,*")
+//		if err != nil {
+//			panic(err)
+//		}
+//		bindings := map[string]interface{}{"qps": 42}
+//		if exp.NeedsTime() {
+//			bindings["TIME"] = when
+//		}
+//		value, err := exp.Evaluate(bindings)
+//	}
+func (e *Expression) NeedsTime() bool {
+	return e.needsTime
+}
+
+// NeedsNow returns true when the program of the Expression uses NOW, so that its result depends on
+// the moment it is evaluated, and may not be reused at a later time. It is determined when the
+// Expression is compiled, just like NeedsTime.
+func (e *Expression) NeedsNow() bool {
+	return e.needsNow
+}
+
+// timeTokens returns whether a stored program uses TIME, or an operator computed from it, and
+// whether it uses NOW. These are the tokens that require time substitutions when evaluated.
+func timeTokens(tokens []interface{}) (needsTime, needsNow bool) {
+	for _, tok := range tokens {
+		switch tok {
+		case "TIME", "LTIME", "NEWDAY", "NEWWEEK", "NEWMONTH", "NEWYEAR":
+			needsTime = true
+		case "NOW":
+			needsNow = true
+		}
+	}
+	return needsTime, needsNow
+}
+
+// BindingKind identifies the kind of value an open binding must be bound to.
+type BindingKind int
+
+const (
+	// ScalarKind symbols must be bound to a single number.
+	ScalarKind BindingKind = iota
+
+	// SeriesKind symbols must be bound to a series of numbers, because they are the label
+	// operand of TREND, TRENDNAN, MEDIAN, MAD, or PERCENT.
+	SeriesKind
+)
+
+// String returns the string representation of a BindingKind.
+func (k BindingKind) String() string {
+	switch k {
+	case ScalarKind:
+		return "scalar"
+	case SeriesKind:
+		return "series"
+	default:
+		return fmt.Sprintf("BindingKind(%d)", int(k))
+	}
+}
+
+// OpenBindingKinds returns the remaining open bindings in the Expression, just like OpenBindings,
+// along with the kind of value each must be bound to, so callers can fetch data of the correct
+// shape before invoking Evaluate. A symbol before MEDIAN, MAD, or PERCENT is only reported as a
+// series when no values are below it on the stack, since it may otherwise be the count of values
+// those operators consume.
+//
+//	func example() {
+//		exp, err := gorpn.New("qps,600,TREND,limit,MIN")
+//		if err != nil {
+//			panic(err)
+//		}
+//		kinds := exp.OpenBindingKinds() // map[limit:scalar qps:series]
+//	}
+func (e *Expression) OpenBindingKinds() map[string]BindingKind {
+	if len(e.openBindings) == 0 {
+		return nil
+	}
+	var symbols []string
+	for k, v := range e.openBindings {
+		if v > 0 {
+			symbols = append(symbols, k)
+		}
+	}
+	return e.errOpenBindings(symbols, e.tokens)
+}
+
+// errOpenBindings returns an ErrOpenBindings error for symbols, which are open bindings of the
+// program tokens, along with the kind of value each must be bound to.
+func (e *Expression) errOpenBindings(symbols []string, tokens []interface{}) ErrOpenBindings {
+	labels := e.seriesLabels(tokens)
+	err := make(ErrOpenBindings, len(symbols))
+	for _, symbol := range symbols {
+		err[symbol] = ScalarKind
+		if labels[symbol] {
+			err[symbol] = SeriesKind
+		}
+	}
+	return err
+}
+
+// seriesLabels returns the symbols that the program tokens uses as the label operand of TREND or
+// TRENDNAN, which must be bound to a series of numbers. It also returns the symbols used as the
+// label operand of MEDIAN, MAD, or PERCENT where they cannot instead be the count of the values
+// those operators consume, because no values are below them on the stack, as in qps,MEDIAN or
+// 95,qps,PERCENT.
+func (e *Expression) seriesLabels(tokens []interface{}) map[string]bool {
+	probe := &Expression{config: e.config, tokens: tokens}
+	labels := make(map[string]bool)
+	depth, known := 0, true // depth of the stack before each token, while it is known
+	for idx, tok := range tokens {
+		var label string
+		if idx > 0 {
+			if symbol, ok := tokens[idx-1].(string); ok && !isOperatorName(symbol) {
+				label = symbol
+			}
+		}
+		switch tok {
+		case "TREND", "TRENDNAN":
+			if idx < 2 {
+				break
+			}
+			if window, ok := tokens[idx-1].(string); ok {
+				if _, ok = arity[window]; ok {
+					break // label is somewhere below the subexpression computing the window
+				}
 			}
+			if symbol, ok := tokens[idx-2].(string); ok && !isOperatorName(symbol) {
+				labels[symbol] = true
+			}
+		case "MEDIAN", "MAD":
+			if label != "" && known && depth == 1 {
+				labels[label] = true
+				continue // label,MEDIAN replaces the label with its statistic
+			}
+		case "PERCENT":
+			if label != "" && known && depth == 2 {
+				labels[label] = true
+				depth--
+				continue // n,label,PERCENT replaces both operands with the percentile
+			}
+		}
+		pops, pushes, ok := probe.stackEffect(idx, depth)
+		known = known && ok
+		depth += pushes - pops
+	}
+	return labels
+}
+
+// IsConstant returns true iff the Expression has been fully folded to a single number, and
+// therefore evaluates to the same value regardless of the bindings provided to Evaluate.
+//
+//	func example() {
+//		exp, err := gorpn.New("60,24,*")
+//		if err != nil {
+//			panic(err)
+//		}
+//		fmt.Println(exp.IsConstant()) // true
+//	}
+func (e *Expression) IsConstant() bool {
+	_, ok := e.ConstantValue()
+	return ok
+}
+
+// ConstantValue returns the value of the Expression and true when the Expression has been fully
+// folded to a single number. Otherwise it returns 0 and false.
+//
+//	func example() {
+//		exp, err := gorpn.New("foo,3,+")
+//		if err != nil {
+//			panic(err)
+//		}
+//		if value, ok := exp.ConstantValue(); ok {
+//			fmt.Println("value:", value) // not printed: foo is an open binding
+//		}
+//	}
+func (e *Expression) ConstantValue() (float64, bool) {
+	if len(e.tokens) != 1 {
+		return 0, false
+	}
+	value, ok := e.tokens[0].(float64)
+	return value, ok
+}
+
+// String returns the string representation of an Expression.
+//
+//	func example() {
+//		exp, err := gorpn.New("5,3,+,foo,*")
+//		if err != nil {
+//			panic(err)
+//		}
+//		s := exp.String() // "8,foo,*"
+//	}
+func (e Expression) String() string {
+	return strings.Join(e.tokenStrings(), e.delimiter)
+}
+
+// TokenKind distinguishes the kinds of tokens in the program of an Expression.
+type TokenKind int
+
+const (
+	// TokenNumber is a number, including one written in the expression as a symbol would never
+	// be, such as "1e3".
+	TokenNumber TokenKind = iota
+
+	// TokenSymbol is a symbol, which is bound to a value when the Expression is evaluated.
+	TokenSymbol
+
+	// TokenOperator is an operator, or a reserved word that pushes a value, such as NOW or INF.
+	TokenOperator
+)
+
+// Token is one token of the program of an Expression.
+type Token struct {
+	Kind   TokenKind
+	Number float64 // value of a TokenNumber
+	Text   string  // name of a TokenSymbol, or of a TokenOperator rather than any of its aliases
+}
+
+// Tokens returns the tokens of the simplified program of an Expression, each along with its kind,
+// so that tools may analyze the program without reading back the result of String. The slice
+// belongs to the caller, so changing it does not change the Expression.
+//
+//	func example() {
+//		exp, err := gorpn.New("5,3,+,foo,*")
+//		if err != nil {
+//			panic(err)
+//		}
+//		tokens := exp.Tokens()
+//		// []gorpn.Token{{Kind: gorpn.TokenNumber, Number: 8}, {Kind: gorpn.TokenSymbol, Text: "foo"},
+//		// {Kind: gorpn.TokenOperator, Text: "*"}}
+//	}
+func (e *Expression) Tokens() []Token {
+	tokens := make([]Token, len(e.tokens))
+	for idx, v := range e.tokens {
+		switch token := v.(type) {
+		case float64:
+			tokens[idx] = Token{Kind: TokenNumber, Number: token}
 		case string:
-			strs[idx] = v.(string)
+			tokens[idx] = Token{Kind: TokenSymbol, Text: token}
+			if _, ok := arity[token]; ok || reserved[token] {
+				tokens[idx].Kind = TokenOperator
+			}
+		}
+	}
+	return tokens
+}
+
+// tokenStrings returns the tokens of the simplified program of an Expression, each written as
+// String writes it.
+func (e Expression) tokenStrings() []string {
+	strs := make([]string, len(e.tokens))
+	for idx, v := range e.tokens {
+		switch v.(type) {
+		case float64:
+			strs[idx] = e.formatLocaleNumber(v.(float64))
+		case string:
+			if _, ok := arity[v.(string)]; ok || reserved[v.(string)] {
+				strs[idx] = v.(string)
+				if !e.canonicalOperators {
+					strs[idx] = e.aliases.name(v.(string))
+				}
+			} else if _, ok := e.operatorName(v.(string)); ok {
+				strs[idx] = quoteAlways(v.(string)) // would otherwise be read back as an operator
+			} else if _, ok, _ := e.parseLocaleNumber(v.(string)); ok {
+				strs[idx] = quoteAlways(v.(string)) // would otherwise be read back as a number
+			} else {
+				strs[idx] = quoteSymbol(v.(string), e.delimiter)
+			}
 		default:
 			strs[idx] = fmt.Sprint(v)
 		}
 	}
-	return strings.Join(strs, string(e.delimiter))
+	return strs
+}
+
+// Partial creates a new Expression by partial application of the parameter bindings. With the
+// additional bindings, it attempts to further simplify the expression. Many RPN expressions are
+// machine built, and then evaluated hundreds of thousands of times. The Partial method will
+// simplify all possible operations on the expression and return a new expression. Symbols bound to
+// a *float64 or a func() float64 are live values that may change, and remain open.
+//
+//	func example1() {
+//		// Recall that New invokes Partial on your behalf.
+//		// (below is example actually found in config file)
+//		exp, err := gorpn.New("0,0,GT,qps,0,0,EQ,-2,0,IF,IF")
+//		if err != nil {
+//			panic(err)
+//		}
+//		s := exp.String() // "2"
+//	}
+//
+//	func example2() {
+//		// Recall that New invokes Partial on your behalf.
+//		// (below is example actually found in config file)
+//		exp, err := gorpn.New("1,0,GT,qps,-2,IF")
+//		if err != nil {
+//			panic(err)
+//		}
+//		s := exp.String() // "qps"
+//	}
+//
+// While simplification of the initial RPN is great, there are many times where you might want to
+// create a new expression with some of the variables bound to a particular set of values. The new
+// expression will be further optimized for running many times.
+//
+//	func example2() {
+//		// Recall that New invokes Partial on your behalf.
+//		exp1, err := gorpn.New("foo,1000,*,bar,3,+,/")
+//		if err != nil {
+//			panic(err)
+//		}
+//		s1 := exp1.String() // "foo,1000,*,bar,3,+,/"
+//
+//		exp2, err := exp1.Partial(map[string]interface{}{"bar":13})
+//		if err != nil {
+//			panic(err)
+//		}
+//		s2 := exp2.String() // "foo,1000,*,16,/"
+//	}
+//
+// Constants that are separated from one another by symbols in a chain of MIN or MAX operators are
+// gathered together and folded into a single constant. Chains of + and * operators are left as they
+// are, because regrouping floating point arithmetic may change its results.
+//
+//	func example3() {
+//		exp, err := gorpn.New("x,2,MAX,3,MAX")
+//		if err != nil {
+//			panic(err)
+//		}
+//		s := exp.String() // "x,3,MAX"
+//	}
+//
+// Partial also rewrites subexpressions that are computed more than once so that they are only
+// computed the first time, re-using the earlier result by way of DUP or INDEX.
+//
+//	func example4() {
+//		exp, err := gorpn.New("a,b,+,c,a,b,+,*,+")
+//		if err != nil {
+//			panic(err)
+//		}
+//		s := exp.String() // "a,b,+,c,2,INDEX,*,+"
+//	}
+func (e *Expression) Partial(bindings map[string]interface{}) (_ *Expression, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = newErrInternal(r, e.config, e.tokens, -1)
+		}
+	}()
+
+	// NOTE: We leave exp.performTimeSubstitutions as its default boolean value of false,
+	// preventing time substitutions from being made during this simplify operation
+	exp := &Expression{
+		config:      e.config,
+		trace:       e.trace,
+		metrics:     e.metrics,
+		tokens:      make([]interface{}, len(e.tokens)),
+		scratchSize: e.scratchSize,
+		scratch:     make([]interface{}, e.scratchSize),
+		isFloat:     make([]bool, e.scratchSize),
+		source:      e.source,
+	}
+	copy(exp.tokens, e.tokens)
+	if e.sources != nil {
+		exp.sources = make([]SourceRange, len(e.sources))
+		copy(exp.sources, e.sources)
+	}
+
+	if err := exp.fold(bindings); err != nil {
+		return nil, err
+	}
+
+	// discard the untaken branch of each IF whose condition is now known, then fold again
+	if tokens, sources, ok := exp.eliminateDeadBranches(exp.tokens, exp.sources); ok {
+		exp.tokens, exp.sources = tokens, sources
+		if err := exp.fold(nil); err != nil {
+			return nil, err
+		}
+	}
+
+	// gather constants scattered throughout chains of MIN or MAX operators, then fold again
+	if tokens, sources, ok := reassociateConstants(exp.tokens, exp.sources); ok {
+		exp.tokens, exp.sources = tokens, sources
+		if err := exp.fold(nil); err != nil {
+			return nil, err
+		}
+	}
+
+	// apply the rules given to RewriteRules until none matches
+	if err := exp.applyRewriteRules(); err != nil {
+		return nil, err
+	}
+
+	// exp will need to know about time when Evaluate is called on it
+	exp.performTimeSubstitutions = e.performTimeSubstitutions || bindingsNeedTime(bindings)
+	exp.needsTime, exp.needsNow = timeTokens(exp.tokens)
+
+	// compute repeated subexpressions only once
+	exp.tokens, exp.sources = eliminateCommonSubexpressions(exp.tokens, exp.sources)
+
+	// remember where the bound values came from, so Unbind can restore their symbols, keeping
+	// only the bindings of symbols used by e or by the Expressions bound to them, so that unused
+	// series are not retained
+	if len(bindings) == 0 {
+		exp.partialOf, exp.partialBindings = e.partialOf, e.partialBindings
+	} else if coerced, cerr := e.coerceMapValuesToFloat64(bindings); cerr == nil {
+		used := make(map[string]bool)
+		var use func(*Expression)
+		use = func(x *Expression) {
+			for symbol, count := range x.openBindings {
+				if count > 0 && !used[symbol] {
+					used[symbol] = true
+					if bound, ok := coerced[symbol].(*Expression); ok {
+						use(bound)
+					}
+				}
+			}
+		}
+		use(e)
+		for symbol := range coerced {
+			if !used[symbol] {
+				delete(coerced, symbol)
+			}
+		}
+		exp.partialOf, exp.partialBindings = e, coerced
+	}
+
+	return exp, nil
+}
+
+// Unbind returns a new Expression just like the Expression, except that each of symbols is an open
+// binding once again, even though the values bound to them by Partial have been folded into other
+// constants. This permits exploring what-if changes to an Expression that has already been
+// specialized with some bindings. To do so, an Expression returned by Partial retains the
+// Expression it was derived from along with the bindings of the symbols it used, including the
+// slices of any series bound to them, for as long as the returned Expression, or any Expression
+// derived from it, is reachable. Callers that bind large series and keep the result of Partial may
+// release them by compiling its String again with New and the same configurators. Unbinding the name
+// of a namespace unbinds each of its symbols, and symbols that were never bound are ignored.
+//
+//	func example() {
+//		exp, err := gorpn.New("foo,1000,*,bar,3,+,/")
+//		if err != nil {
+//			panic(err)
+//		}
+//		specialized, err := exp.Partial(map[string]interface{}{"foo": 2, "bar": 13})
+//		if err != nil {
+//			panic(err)
+//		}
+//		s1 := specialized.String() // "125"
+//		whatIf, err := specialized.Unbind("bar")
+//		if err != nil {
+//			panic(err)
+//		}
+//		s2 := whatIf.String() // "2000,bar,3,+,/"
+//	}
+func (e *Expression) Unbind(symbols ...string) (*Expression, error) {
+	var chain []*Expression // the expressions from which e was derived, most recent first
+	root := e
+	for ; root.partialOf != nil; root = root.partialOf {
+		chain = append(chain, root)
+	}
+
+	exp := root
+	for i := len(chain) - 1; i >= 0; i-- {
+		bindings := make(map[string]interface{}, len(chain[i].partialBindings))
+		for symbol, value := range chain[i].partialBindings {
+			if !unbound(symbol, symbols) {
+				bindings[symbol] = value
+			}
+		}
+		var err error
+		if exp, err = exp.Partial(bindings); err != nil {
+			return nil, err
+		}
+	}
+	if exp == e {
+		return e.Partial(nil) // nothing was bound
+	}
+	return exp, nil
+}
+
+// unbound returns true when symbol is one of symbols, or is within the namespace of one of them.
+func unbound(symbol string, symbols []string) bool {
+	for _, s := range symbols {
+		if symbol == s || strings.HasPrefix(symbol, s+".") {
+			return true
+		}
+	}
+	return false
 }
 
-// Partial creates a new Expression by partial application of the parameter bindings. With the
-// additional bindings, it attempts to further simplify the expression. Many RPN expressions are
-// machine built, and then evaluated hundreds of thousands of times. The Partial method will
-// simplify all possible operations on the expression and return a new expression
+// BoundValues returns the value of each symbol that Partial bound to a number and folded into the
+// Expression, including those bound by earlier calls to Partial from which it was derived, so that
+// auditing systems may learn which concrete thresholds a deployed expression was built with.
+// Bindings the Expression did not use, and symbols bound to a series, to another Expression, or
+// to a live value, are not included. It returns nil when no number was bound.
 //
-//	func example1() {
-//		// Recall that New invokes Partial on your behalf.
-//		// (below is example actually found in config file)
-//		exp, err := gorpn.New("0,0,GT,qps,0,0,EQ,-2,0,IF,IF")
+//	func example() {
+//		exp, err := gorpn.New("latency,threshold,GT")
 //		if err != nil {
 //			panic(err)
 //		}
-//		s := exp.String() // "2"
-//	}
-//
-//	func example2() {
-//		// Recall that New invokes Partial on your behalf.
-//		// (below is example actually found in config file)
-//		exp, err := gorpn.New("1,0,GT,qps,-2,IF")
+//		deployed, err := exp.Partial(map[string]interface{}{"threshold": 250, "unused": 1})
 //		if err != nil {
 //			panic(err)
 //		}
-//		s := exp.String() // "qps"
+//		values := deployed.BoundValues() // map[threshold:250]
 //	}
+func (e *Expression) BoundValues() map[string]float64 {
+	var values map[string]float64
+	for exp := e; exp.partialOf != nil; exp = exp.partialOf {
+		tokens, err := inlineExpressionBindings(exp.partialOf.tokens, exp.partialBindings, make(map[*Expression]bool))
+		if err != nil {
+			continue // Partial would have failed, so nothing was bound
+		}
+		for _, tok := range tokens {
+			symbol, ok := tok.(string)
+			if !ok || reserved[symbol] {
+				continue // TIME is only substituted when evaluating
+			}
+			if value, ok := exp.partialBindings[symbol].(float64); ok {
+				if _, ok = values[symbol]; !ok {
+					if values == nil {
+						values = make(map[string]float64)
+					}
+					values[symbol] = value
+				}
+			}
+		}
+	}
+	return values
+}
+
+// fold simplifies the stored program with the parameter bindings, and promotes what remains in
+// the work area to be the new stored program. When the source range of each token is known, it
+// follows the trace of simplifying to learn those of the new stored program.
+func (e *Expression) fold(bindings map[string]interface{}) error {
+	var p *provenance
+	if e.sources != nil {
+		sources := e.sources
+		if coerced, err := e.coerceMapValuesToFloat64(bindings); err == nil && hasExpressionBindings(coerced) {
+			if sources, err = inlineSources(e.tokens, e.sources, coerced); err != nil {
+				return err
+			}
+		}
+		p = &provenance{sources: sources}
+		trace := e.trace
+		e.trace = func(event TraceEvent) {
+			p.event(event)
+			if trace != nil {
+				trace(event)
+			}
+		}
+		defer func() { e.trace = trace }()
+	}
+
+	if err := e.simplify(bindings); err != nil {
+		return err
+	}
+	if p != nil {
+		e.sources = p.ranges(len(p.sources), e.scratchHead)
+	}
+	e.tokens = make([]interface{}, e.scratchHead)
+	copy(e.tokens, e.scratch)
+	if size := scratchSizeFor(e.tokens); size > e.scratchSize {
+		e.scratchSize = size
+		e.scratch = make([]interface{}, size)
+		e.isFloat = make([]bool, size)
+	}
+	return nil
+}
+
+// clone returns a copy of the Expression that shares nothing mutable with the original, including
+// its own work area, so that both may be evaluated independently.
+func (e *Expression) clone() *Expression {
+	exp := &Expression{
+		config:                   e.config,
+		trace:                    e.trace,
+		metrics:                  e.metrics,
+		openBindings:             make(map[string]int, len(e.openBindings)),
+		tokens:                   make([]interface{}, len(e.tokens)),
+		performTimeSubstitutions: e.performTimeSubstitutions,
+		needsTime:                e.needsTime,
+		needsNow:                 e.needsNow,
+		scratchSize:              e.scratchSize,
+		scratch:                  make([]interface{}, len(e.scratch)),
+		isFloat:                  make([]bool, len(e.isFloat)),
+		source:                   e.source,
+	}
+	copy(exp.tokens, e.tokens)
+	if e.sources != nil {
+		exp.sources = make([]SourceRange, len(e.sources))
+		copy(exp.sources, e.sources)
+	}
+	for k, v := range e.openBindings {
+		exp.openBindings[k] = v
+	}
+	return exp
+}
+
+// Clone returns a copy of the Expression with its own work area, so that a compiled Expression may
+// be handed to several goroutines, each evaluating its own copy, without compiling it again. The
+// copy has the same configuration, including its Trace function, and the same provenance for
+// Explain and Unbind, but does not share the results remembered by EvaluateMemo. When configured
+// by RandomSeed, the RANDOM and GAUSSIAN operators of the copy start the sequence of values of the
+// seed again, independently of the original, rather than continuing it.
 //
-// While simplification of the initial RPN is great, there are many times where you might want to
-// create a new expression with some of the variables bound to a particular set of values. The new
-// expression will be further optimized for running many times.
+//	func example(exp *gorpn.Expression, jobs <-chan map[string]interface{}) {
+//		for i := 0; i < runtime.GOMAXPROCS(0); i++ {
+//			go func(exp *gorpn.Expression) {
+//				for bindings := range jobs {
+//					value, err := exp.Evaluate(bindings)
+//				}
+//			}(exp.Clone())
+//		}
+//	}
+func (e *Expression) Clone() *Expression {
+	exp := e.clone()
+	exp.partialOf, exp.partialBindings = e.partialOf, e.partialBindings
+	if e.random != nil {
+		exp.random = newRandom(e.seed)
+	}
+	return exp
+}
+
+// Rename returns a new Expression with each symbol that is a key of renames replaced by its
+// respective value, leaving the original Expression unchanged. Because symbols are renamed after
+// the expression has been tokenized, a new symbol may contain the delimiter or any other character.
+// It returns an error when a new symbol is empty, or is the name of an operator or a reserved word,
+// and therefore could not be a symbol.
 //
-//	func example2() {
-//		// Recall that New invokes Partial on your behalf.
-//		exp1, err := gorpn.New("foo,1000,*,bar,3,+,/")
+//	func example() {
+//		template, err := gorpn.New("{{host}}.qps,1000,*")
 //		if err != nil {
 //			panic(err)
 //		}
-//		s1 := exp1.String() // "foo,1000,*,bar,3,+,/"
-//
-//		exp2, err := exp1.Partial(map[string]interface{}{"bar":13})
+//		exp, err := template.Rename(map[string]string{"{{host}}.qps": "web,1.qps"})
 //		if err != nil {
 //			panic(err)
 //		}
-//		s2 := exp2.String() // "foo,1000,*,16,/"
+//		s := exp.String() // "'web,1.qps',1000,*"
 //	}
-//
-func (e *Expression) Partial(bindings map[string]interface{}) (*Expression, error) {
-	// NOTE: We leave exp.performTimeSubstitutions as its default boolean value of false,
-	// preventing time substitutions from being made during this simplify operation
-	exp := &Expression{
-		delimiter:          e.delimiter,
-		secondsPerInterval: e.secondsPerInterval,
-		tokens:             make([]interface{}, len(e.tokens)),
-		scratchSize:        e.scratchSize,
-		scratch:            make([]interface{}, e.scratchSize),
-		isFloat:            make([]bool, e.scratchSize),
+func (e *Expression) Rename(renames map[string]string) (*Expression, error) {
+	for from, to := range renames {
+		if to == "" {
+			return nil, newErrSyntax("cannot rename %q to empty symbol", from)
+		}
+		if _, ok := arity[to]; ok || reserved[to] {
+			return nil, newErrSyntax("cannot rename %q to operator %q", from, to)
+		}
 	}
-	copy(exp.tokens, e.tokens)
 
-	if err := exp.simplify(bindings); err != nil {
-		return nil, err
+	exp := e.clone()
+	for idx, tok := range exp.tokens {
+		symbol, ok := tok.(string)
+		if !ok {
+			continue
+		}
+		if _, ok = arity[symbol]; ok || reserved[symbol] {
+			continue
+		}
+		if to, ok := renames[symbol]; ok {
+			exp.tokens[idx] = to
+		}
 	}
 
-	// exp will need to know about time when Evaluate is called on it
-	exp.performTimeSubstitutions = e.performTimeSubstitutions
-
-	// promote what's remaining in work area to new simplified stored program
-	exp.tokens = exp.tokens[:exp.scratchHead] // first, shrink tokens slice
-	copy(exp.tokens, exp.scratch)             // then copy
-
-	return exp, nil
+	// symbols that were distinct may now be the same, permitting further simplification
+	return exp.Partial(nil)
 }
 
 func (e Expression) valid(bindings map[string]interface{}) bool {
@@ -451,36 +1946,62 @@ func (e Expression) valid(bindings map[string]interface{}) bool {
 	return e.isFloat[0]
 }
 
-func epochToJuliet(secondsSinceEpoch int) (time.Time, int) {
-	julietTime := time.Unix(int64(secondsSinceEpoch), 0) // Juliet time zone is "local" time zone
+// epochToJuliet returns the time of secondsSinceEpoch in the time zone of loc, or in the local time
+// zone of the process when loc is nil, along with the offset of that time zone in seconds east of
+// UTC in effect at that time, which differs from the offset in effect at other times of the year
+// for time zones that observe daylight saving time.
+func epochToJuliet(secondsSinceEpoch int, loc *time.Location) (time.Time, int) {
+	if loc == nil {
+		loc = time.Local // Juliet time zone is "local" time zone
+	}
+	julietTime := time.Unix(int64(secondsSinceEpoch), 0).In(loc)
 	_, julietOffset := julietTime.Zone()
 	return julietTime, julietOffset
 }
 
-func isFirstOfDay(jSeconds, secondsPerInterval float64) float64 {
-	// is julietTime first datum of day?
-	const secondsPerDay = 86400
-	js := int(jSeconds)
-
-	tLeft := (int(js) / secondsPerDay) * secondsPerDay
-	tRight := tLeft + int(secondsPerInterval)
+// startOfDay returns the first instant of the calendar day of t in its time zone, which is usually
+// midnight, but is the transition to daylight saving time when that transition skips midnight.
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	start := time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+	if _, _, startDay := start.Date(); startDay != d {
+		// time.Date normalized the missing midnight into the previous day
+		_, start = start.ZoneBounds()
+	}
+	return start
+}
 
-	if ijts := js; ijts < tLeft || ijts > tRight {
+// isFirstOfDay returns 1 when julietTime is within the first interval of its calendar day, and 0
+// otherwise. The interval is measured from the start of the day, rather than from a multiple of
+// 86400 seconds, so it is correct on days that are 23 or 25 hours long.
+func isFirstOfDay(julietTime time.Time, secondsPerInterval float64) float64 {
+	if julietTime.Sub(startOfDay(julietTime)).Seconds() > secondsPerInterval {
 		return 0
 	}
 	return 1
 }
 
-func (e *Expression) simplify(bindings map[string]interface{}) error {
+func (e *Expression) simplify(bindings map[string]interface{}) (err error) {
 	// NOTE: scratch is not local variable so Partial has access to it
 	// TODO: change method signature to pass it back and make it local
 
-	var err error
-
-	bindings, err = coerceMapValuesToFloat64(bindings)
+	bindings, err = e.coerceMapValuesToFloat64(bindings)
 	if err != nil {
 		return err
 	}
+	resolveLiveBindings(bindings, e.isEvaluating)
+
+	// symbols bound to other expressions are replaced by the programs of those expressions
+	tokens := e.tokens
+	if hasExpressionBindings(bindings) {
+		if tokens, err = inlineExpressionBindings(e.tokens, bindings, make(map[*Expression]bool)); err != nil {
+			return err
+		}
+		if size := scratchSizeFor(tokens); size > len(e.scratch) {
+			e.scratch = make([]interface{}, size)
+			e.isFloat = make([]bool, size)
+		}
+	}
 
 	// with a fresh start comes fresh workspace
 	e.scratchHead = 0
@@ -501,7 +2022,7 @@ func (e *Expression) simplify(bindings map[string]interface{}) error {
 				return newErrSyntax("TIME ought to be bound to number rather than %T", epoch)
 			}
 			var jo int
-			jTime, jo = epochToJuliet(int(zTimeSeconds))
+			jTime, jo = epochToJuliet(int(zTimeSeconds), e.location)
 			jTimeSeconds = float64(jTime.Unix() + int64(jo))
 		}
 
@@ -517,16 +2038,27 @@ func (e *Expression) simplify(bindings map[string]interface{}) error {
 
 	// variables outside of loop to reduce allocations
 	var cannotSimplify, isFloat, ok, stackUpdated, firstNaN, secondNaN bool
-	var total, value float64
-	var argIdx, additionalArgumentCount, indexOfFirstArg, itemIdx, tokIdx, used int
+	var sum compensatedSum
+	var argIdx, additionalArgumentCount, indexOfFirstArg, tokIdx, used int
+	var cost, headBefore int // accumulated cost, and size of the stack before each token
 	var opArity arityTuple
 	var result, tok interface{}
+	var traceBefore []interface{} // stack before each operator, only when tracing
+	var nanInputs []string        // symbols bound to NaN, only when rejecting or reporting them
+
+	// an unanticipated stack state is a bug in this library, but must not crash the program
+	defer func() {
+		if r := recover(); r != nil {
+			err = newErrInternal(r, e.config, tokens, tokIdx)
+		}
+	}()
 
 	// tokens is our stored program, and scratch is our work area
-	for tokIdx, tok = range e.tokens {
+	for tokIdx, tok = range tokens {
+		headBefore = e.scratchHead
 		switch token := tok.(type) {
 		case float64:
-			e.scratch[e.scratchHead] = token
+			e.scratch[e.scratchHead] = tok // already boxed
 			e.isFloat[e.scratchHead] = true
 			e.scratchHead++
 		case string:
@@ -563,7 +2095,7 @@ func (e *Expression) simplify(bindings map[string]interface{}) error {
 				e.scratchHead++
 			case "NEWDAY":
 				if isTimeSet {
-					e.scratch[e.scratchHead] = isFirstOfDay(jTimeSeconds, e.secondsPerInterval)
+					e.scratch[e.scratchHead] = isFirstOfDay(jTime, e.secondsPerInterval)
 				} else {
 					e.openBindings["TIME"] = e.openBindings["TIME"] + 1 // NOTE: actually requires TIME to be bound
 					e.scratch[e.scratchHead] = token
@@ -573,7 +2105,7 @@ func (e *Expression) simplify(bindings map[string]interface{}) error {
 			case "NEWMONTH":
 				if isTimeSet {
 					if jTime.Day() == 1 {
-						e.scratch[e.scratchHead] = isFirstOfDay(jTimeSeconds, e.secondsPerInterval)
+						e.scratch[e.scratchHead] = isFirstOfDay(jTime, e.secondsPerInterval)
 					} else {
 						e.scratch[e.scratchHead] = 0.0
 					}
@@ -586,7 +2118,7 @@ func (e *Expression) simplify(bindings map[string]interface{}) error {
 			case "NEWWEEK":
 				if isTimeSet {
 					if jTime.Weekday() == time.Sunday {
-						e.scratch[e.scratchHead] = isFirstOfDay(jTimeSeconds, e.secondsPerInterval)
+						e.scratch[e.scratchHead] = isFirstOfDay(jTime, e.secondsPerInterval)
 					} else {
 						e.scratch[e.scratchHead] = 0.0
 					}
@@ -599,7 +2131,7 @@ func (e *Expression) simplify(bindings map[string]interface{}) error {
 			case "NEWYEAR":
 				if isTimeSet {
 					if _, m, d := jTime.Date(); m == 1 && d == 1 {
-						e.scratch[e.scratchHead] = isFirstOfDay(jTimeSeconds, e.secondsPerInterval)
+						e.scratch[e.scratchHead] = isFirstOfDay(jTime, e.secondsPerInterval)
 					} else {
 						e.scratch[e.scratchHead] = 0.0
 					}
@@ -650,7 +2182,7 @@ func (e *Expression) simplify(bindings map[string]interface{}) error {
 					// ??? popCount = floatCount + nonOperatorCount
 
 					if e.scratchHead < opArity.popCount {
-						return newErrSyntax("not enough parameters: operator %s requires %d operands", token, opArity.popCount)
+						return newErrStackUnderflow("not enough parameters: operator %s requires %d operands", token, opArity.popCount)
 					}
 					indexOfFirstArg = e.scratchHead - opArity.popCount
 
@@ -676,6 +2208,10 @@ func (e *Expression) simplify(bindings map[string]interface{}) error {
 							}
 						}
 					}
+					if e.trace != nil {
+						traceBefore = append(traceBefore[:0], e.scratch[:e.scratchHead]...)
+					}
+
 					if !cannotSimplify {
 						switch token {
 						case "+":
@@ -717,15 +2253,15 @@ func (e *Expression) simplify(bindings map[string]interface{}) error {
 								if e.isFloat[indexOfFirstArg+1] { // b is also float
 									result = e.scratch[indexOfFirstArg].(float64) * e.scratch[indexOfFirstArg+1].(float64)
 								} else if a := e.scratch[indexOfFirstArg].(float64); a == 0 {
-									result = 0
+									result = 0.0
 								} else if a == 1 {
 									result = e.scratch[indexOfFirstArg+1]
 								} else {
 									cannotSimplify = true
 								}
 							} else if e.isFloat[indexOfFirstArg+1] { // only b is float
-								if b := e.scratch[indexOfFirstArg+1].(float64); b == 0 {
-									result = 0
+								if b := e.scratch[indexOfFirstArg+1].(float64); b == 0 && !e.isOperatorAt(indexOfFirstArg) {
+									result = 0.0
 								} else if b == 1 {
 									result = e.scratch[indexOfFirstArg]
 								} else {
@@ -737,15 +2273,23 @@ func (e *Expression) simplify(bindings map[string]interface{}) error {
 						case "/":
 							if e.isFloat[indexOfFirstArg] { // a is float
 								if e.isFloat[indexOfFirstArg+1] { // b is also float
-									result = e.scratch[indexOfFirstArg].(float64) / e.scratch[indexOfFirstArg+1].(float64)
-								} else if a := e.scratch[indexOfFirstArg].(float64); a == 0 {
-									result = float64(0)
+									if b := e.scratch[indexOfFirstArg+1].(float64); b != 0 {
+										result = e.scratch[indexOfFirstArg].(float64) / b
+									} else if value, err := e.divideByZero(token, e.scratch[indexOfFirstArg].(float64)); err != nil {
+										return err
+									} else {
+										result = value
+									}
 								} else {
-									cannotSimplify = true
+									cannotSimplify = true // even 0 divided by b depends on b
 								}
 							} else if e.isFloat[indexOfFirstArg+1] { // only b is float
 								if b := e.scratch[indexOfFirstArg+1].(float64); b == 0 {
-									result = math.NaN()
+									if e.divisionByZero == DivisionByZeroNaN && !e.isOperatorAt(indexOfFirstArg) {
+										result = math.NaN()
+									} else {
+										cannotSimplify = true // result or error depends on a
+									}
 								} else if b == 1 {
 									result = e.scratch[indexOfFirstArg]
 								} else {
@@ -757,13 +2301,25 @@ func (e *Expression) simplify(bindings map[string]interface{}) error {
 						case "%":
 							if e.isFloat[indexOfFirstArg] { // a is float
 								if e.isFloat[indexOfFirstArg+1] { // b is also float
-									result = math.Mod(e.scratch[indexOfFirstArg].(float64), e.scratch[indexOfFirstArg+1].(float64))
+									if b := e.scratch[indexOfFirstArg+1].(float64); b != 0 {
+										result = math.Mod(e.scratch[indexOfFirstArg].(float64), b)
+									} else if value, err := e.divideByZero(token, e.scratch[indexOfFirstArg].(float64)); err != nil {
+										return err
+									} else {
+										result = value
+									}
 								} else {
 									cannotSimplify = true
 								}
 							} else if e.isFloat[indexOfFirstArg+1] { // only b is float
-								if b := e.scratch[indexOfFirstArg+1].(float64); b == 0 {
-									result = math.NaN()
+								if e.isOperatorAt(indexOfFirstArg) {
+									cannotSimplify = true // cannot discard the operands of a
+								} else if b := e.scratch[indexOfFirstArg+1].(float64); b == 0 {
+									if e.divisionByZero == DivisionByZeroError {
+										cannotSimplify = true // error only if evaluated
+									} else {
+										result = math.NaN() // even IEEE remainder by zero is NaN
+									}
 								} else if b == 1 {
 									result = float64(0)
 								} else {
@@ -784,19 +2340,68 @@ func (e *Expression) simplify(bindings map[string]interface{}) error {
 							} else {
 								result = e.scratch[indexOfFirstArg+1]
 							}
+						case "ALLAVG", "ALLMAX", "ALLMIN":
+							if e.scratchHead == 0 {
+								return newErrStackUnderflow("%s operand requires %d items, but only %d on stack", token, 1, 0)
+							}
+							additionalArgumentCount = e.scratchHead
+							if additionalArgumentCount == 1 {
+								// pin-hole optimization for 1 item, which may only be an operator that consumes nothing
+								result = e.scratch[0]
+								break
+							}
+							for argIdx = 0; argIdx < e.scratchHead; argIdx++ {
+								if !e.isFloat[argIdx] {
+									cannotSimplify = true
+									break
+								}
+							}
+							if cannotSimplify {
+								break
+							}
+							switch token {
+							case "ALLAVG":
+								sum = compensatedSum{}
+								used = 0
+								for argIdx = 0; argIdx < e.scratchHead; argIdx++ {
+									if !math.IsNaN(e.scratch[argIdx].(float64)) {
+										sum.add(e.scratch[argIdx].(float64))
+										used++
+									} else if e.strictAggregates {
+										sum.add(math.NaN())
+									}
+								}
+								result = sum.total() / float64(used)
+							case "ALLMAX":
+								max := e.scratch[e.scratchHead-1].(float64)
+								for argIdx = 0; argIdx < e.scratchHead-1; argIdx++ {
+									if item := e.scratch[argIdx].(float64); item > max {
+										max = item
+									}
+								}
+								result = max
+							case "ALLMIN":
+								min := e.scratch[e.scratchHead-1].(float64)
+								for argIdx = 0; argIdx < e.scratchHead-1; argIdx++ {
+									if item := e.scratch[argIdx].(float64); item < min {
+										min = item
+									}
+								}
+								result = min
+							}
 						case "ATAN":
 							result = math.Atan(e.scratch[indexOfFirstArg].(float64))
 						case "ATAN2":
 							result = math.Atan2(e.scratch[indexOfFirstArg+1].(float64), e.scratch[indexOfFirstArg].(float64))
-						case "AVG":
-							if math.IsNaN(e.scratch[indexOfFirstArg].(float64)) || math.IsInf(e.scratch[indexOfFirstArg].(float64), 1) || math.IsInf(e.scratch[indexOfFirstArg].(float64), -1) || e.scratch[indexOfFirstArg].(float64) <= 0 {
+						case "AVG", "AVGNAN":
+							if !e.isCount(e.scratch[indexOfFirstArg].(float64)) {
 								return newErrSyntax("%s operator requires positive finite integer: %v", token, e.scratch[indexOfFirstArg])
 							}
-							additionalArgumentCount = int(e.scratch[indexOfFirstArg].(float64))
+							additionalArgumentCount = saturatingInt(e.scratch[indexOfFirstArg].(float64))
 							if additionalArgumentCount > e.scratchHead-1 {
-								return newErrSyntax("%s operand requires %d items, but only %d on stack", token, additionalArgumentCount, e.scratchHead-1)
+								return newErrStackUnderflow("%s operand requires %d items, but only %d on stack", token, additionalArgumentCount, e.scratchHead-1)
 							}
-							total = 0
+							sum = compensatedSum{}
 							used = 0
 							for argIdx = indexOfFirstArg - additionalArgumentCount; argIdx < indexOfFirstArg; argIdx++ {
 								if !e.isFloat[argIdx] {
@@ -804,22 +2409,34 @@ func (e *Expression) simplify(bindings map[string]interface{}) error {
 									break
 								}
 								if !math.IsNaN(e.scratch[argIdx].(float64)) {
-									total += e.scratch[argIdx].(float64)
+									sum.add(e.scratch[argIdx].(float64))
 									used++
+								} else if token == "AVG" && e.strictAggregates {
+									sum.add(math.NaN())
 								}
 							}
 							if !cannotSimplify {
-								result = total / float64(used)
+								result = sum.total() / float64(used)
+							}
+						case "BITAND", "BITOR":
+							a, aok := toInt64(e.scratch[indexOfFirstArg].(float64))
+							b, bok := toInt64(e.scratch[indexOfFirstArg+1].(float64))
+							if !aok || !bok {
+								result = math.NaN()
+							} else if token == "BITAND" {
+								result = float64(a & b)
+							} else {
+								result = float64(a | b)
 							}
 						case "CEIL":
 							result = math.Ceil(e.scratch[indexOfFirstArg].(float64))
 						case "COPY":
-							if math.IsNaN(e.scratch[indexOfFirstArg].(float64)) || math.IsInf(e.scratch[indexOfFirstArg].(float64), 1) || math.IsInf(e.scratch[indexOfFirstArg].(float64), -1) || e.scratch[indexOfFirstArg].(float64) <= 0 {
+							if !e.isCount(e.scratch[indexOfFirstArg].(float64)) {
 								return newErrSyntax("%s operator requires positive finite integer: %v", token, e.scratch[indexOfFirstArg])
 							}
-							additionalArgumentCount = int(e.scratch[indexOfFirstArg].(float64))
+							additionalArgumentCount = saturatingInt(e.scratch[indexOfFirstArg].(float64))
 							if additionalArgumentCount > e.scratchHead-1 {
-								return newErrSyntax("%s operand requires %d items, but only %d on stack", token, additionalArgumentCount, e.scratchHead-1)
+								return newErrStackUnderflow("%s operand requires %d items, but only %d on stack", token, additionalArgumentCount, e.scratchHead-1)
 							}
 							for argIdx = indexOfFirstArg - additionalArgumentCount; argIdx < indexOfFirstArg; argIdx++ {
 								if !e.isFloat[argIdx] {
@@ -831,14 +2448,9 @@ func (e *Expression) simplify(bindings map[string]interface{}) error {
 							}
 							if !cannotSimplify {
 								e.scratchHead--
-								if e.scratchHead-1+additionalArgumentCount > cap(e.scratch) {
-									// COPY requires larger scratch and isFloat slices
-									scratch := make([]interface{}, e.scratchHead+additionalArgumentCount)
-									copy(scratch, e.scratch)
-									e.scratch = scratch
-									isFloat := make([]bool, e.scratchHead+additionalArgumentCount)
-									copy(isFloat, e.isFloat)
-									e.isFloat = isFloat
+								// COPY requires larger scratch and isFloat slices, with room for remaining tokens
+								if err = e.growScratch(e.scratchHead+additionalArgumentCount, tokens[tokIdx+1:], tokIdx); err != nil {
+									return err
 								}
 								for argIdx = indexOfFirstArg - additionalArgumentCount; argIdx < indexOfFirstArg; argIdx++ {
 									e.scratch[e.scratchHead] = e.scratch[argIdx]
@@ -852,10 +2464,21 @@ func (e *Expression) simplify(bindings map[string]interface{}) error {
 						case "DEG2RAD":
 							result = e.scratch[indexOfFirstArg].(float64) * math.Pi / 180
 						case "DEPTH":
-							e.scratch[e.scratchHead] = e.scratchHead
-							e.isFloat[e.scratchHead] = true
-							e.scratchHead++
-							stackUpdated = true
+							// cannot count items if any are operators
+							for argIdx = 0; argIdx < e.scratchHead; argIdx++ {
+								if !e.isFloat[argIdx] {
+									if _, ok = arity[e.scratch[argIdx].(string)]; ok {
+										cannotSimplify = true
+										break
+									}
+								}
+							}
+							if !cannotSimplify {
+								e.scratch[e.scratchHead] = float64(e.scratchHead)
+								e.isFloat[e.scratchHead] = true
+								e.scratchHead++
+								stackUpdated = true
+							}
 						case "DUP":
 							e.scratch[e.scratchHead] = e.scratch[e.scratchHead-1]
 							e.isFloat[e.scratchHead] = e.isFloat[e.scratchHead-1]
@@ -863,12 +2486,14 @@ func (e *Expression) simplify(bindings map[string]interface{}) error {
 							stackUpdated = true
 						case "EQ":
 							if e.isFloat[indexOfFirstArg] && e.isFloat[indexOfFirstArg+1] {
-								if e.scratch[indexOfFirstArg].(float64) == e.scratch[indexOfFirstArg+1].(float64) {
+								if e.threeValuedLogic && e.isUnknownOperand(indexOfFirstArg, 2) {
+									result = math.NaN()
+								} else if e.scratch[indexOfFirstArg].(float64) == e.scratch[indexOfFirstArg+1].(float64) {
 									result = float64(1)
 								} else {
 									result = float64(0)
 								}
-							} else if !e.isFloat[indexOfFirstArg] && !e.isFloat[indexOfFirstArg+1] {
+							} else if !e.isFloat[indexOfFirstArg] && !e.isFloat[indexOfFirstArg+1] && !e.threeValuedLogic {
 								if e.scratch[indexOfFirstArg].(string) == e.scratch[indexOfFirstArg+1].(string) {
 									result = float64(1)
 								} else {
@@ -877,7 +2502,7 @@ func (e *Expression) simplify(bindings map[string]interface{}) error {
 							} else {
 								cannotSimplify = true
 							}
-						case "EXC":
+						case "EXC", "SWAP":
 							e.scratch[indexOfFirstArg], e.scratch[indexOfFirstArg+1] = e.scratch[indexOfFirstArg+1], e.scratch[indexOfFirstArg]
 							e.isFloat[indexOfFirstArg], e.isFloat[indexOfFirstArg+1] = e.isFloat[indexOfFirstArg+1], e.isFloat[indexOfFirstArg]
 							stackUpdated = true
@@ -885,19 +2510,18 @@ func (e *Expression) simplify(bindings map[string]interface{}) error {
 							result = math.Exp(e.scratch[indexOfFirstArg].(float64))
 						case "FLOOR":
 							result = math.Floor(e.scratch[indexOfFirstArg].(float64))
+						case "GAUSSIAN":
+							if e.isEvaluating {
+								result = e.scratch[indexOfFirstArg].(float64) + e.scratch[indexOfFirstArg+1].(float64)*e.normFloat64()
+							} else {
+								cannotSimplify = true // each evaluation draws a new value
+							}
 						case "GE":
 							if e.isFloat[indexOfFirstArg] && e.isFloat[indexOfFirstArg+1] {
-								if math.IsNaN(e.scratch[indexOfFirstArg].(float64)) {
-									result = math.NaN()
-								} else if math.IsNaN(e.scratch[indexOfFirstArg+1].(float64)) {
-									result = math.NaN()
-								} else if e.scratch[indexOfFirstArg].(float64) >= e.scratch[indexOfFirstArg+1].(float64) {
-									result = float64(1)
-								} else {
-									result = float64(0)
-								}
-							} else if !e.isFloat[indexOfFirstArg] && !e.isFloat[indexOfFirstArg+1] {
-								if e.scratch[indexOfFirstArg].(string) == e.scratch[indexOfFirstArg+1].(string) {
+								result = e.compare(token, e.scratch[indexOfFirstArg].(float64), e.scratch[indexOfFirstArg+1].(float64))
+							} else if !e.isFloat[indexOfFirstArg] && !e.isFloat[indexOfFirstArg+1] && !e.threeValuedLogic {
+								// NaN is not even equal to itself when comparisons with NaN are false
+								if e.scratch[indexOfFirstArg].(string) == e.scratch[indexOfFirstArg+1].(string) && e.comparisonsWithNaN != ComparisonFalse {
 									result = float64(1)
 								} else {
 									cannotSimplify = true
@@ -907,16 +2531,8 @@ func (e *Expression) simplify(bindings map[string]interface{}) error {
 							}
 						case "GT":
 							if e.isFloat[indexOfFirstArg] && e.isFloat[indexOfFirstArg+1] {
-								if math.IsNaN(e.scratch[indexOfFirstArg].(float64)) {
-									result = math.NaN()
-								} else if math.IsNaN(e.scratch[indexOfFirstArg+1].(float64)) {
-									result = math.NaN()
-								} else if e.scratch[indexOfFirstArg].(float64) > e.scratch[indexOfFirstArg+1].(float64) {
-									result = float64(1)
-								} else {
-									result = float64(0)
-								}
-							} else if !e.isFloat[indexOfFirstArg] && !e.isFloat[indexOfFirstArg+1] {
+								result = e.compare(token, e.scratch[indexOfFirstArg].(float64), e.scratch[indexOfFirstArg+1].(float64))
+							} else if !e.isFloat[indexOfFirstArg] && !e.isFloat[indexOfFirstArg+1] && !e.threeValuedLogic {
 								if e.scratch[indexOfFirstArg].(string) == e.scratch[indexOfFirstArg+1].(string) {
 									result = float64(0)
 								} else {
@@ -925,24 +2541,81 @@ func (e *Expression) simplify(bindings map[string]interface{}) error {
 							} else {
 								cannotSimplify = true
 							}
+						case "HIST": // n,width,HIST -- a,b,c,3,10,HIST -> count of a,b,c in each bucket of width 10, then count of buckets
+							histogram, err := NewHistogram(e.scratch[indexOfFirstArg+1].(float64))
+							if err != nil {
+								return newErrSyntax("%s operator requires positive finite bucket width: %v", token, e.scratch[indexOfFirstArg+1])
+							}
+							if label, ok := e.scratch[indexOfFirstArg].(string); ok {
+								// label,width,HIST bins the values of a series
+								if series, ok := bindings[label]; !ok {
+									cannotSimplify = true
+								} else if s, ok := seriesValues(series); ok {
+									e.openBindings[label] = e.openBindings[label] - 1
+									histogram.Add(s...)
+								} else {
+									return newErrSyntax("%s operand specifies %q label, which is not a series of numbers: %T", token, label, series)
+								}
+							} else {
+								if !e.isCount(e.scratch[indexOfFirstArg].(float64)) {
+									return newErrSyntax("%s operator requires positive finite integer: %v", token, e.scratch[indexOfFirstArg])
+								}
+								additionalArgumentCount = saturatingInt(e.scratch[indexOfFirstArg].(float64))
+								if additionalArgumentCount > e.scratchHead-2 {
+									return newErrStackUnderflow("%s operand requires %d items, but only %d on stack", token, additionalArgumentCount, e.scratchHead-2)
+								}
+								for argIdx = indexOfFirstArg - additionalArgumentCount; argIdx < indexOfFirstArg; argIdx++ {
+									if !e.isFloat[argIdx] {
+										cannotSimplify = true
+										break
+									}
+									histogram.Add(e.scratch[argIdx].(float64))
+								}
+							}
+							if !cannotSimplify {
+								counts, ok := histogram.span()
+								if !ok {
+									return newErrSyntax("%s operator requires more than %d buckets of width %v", token, maxHistogramBuckets, histogram.Width())
+								}
+								e.scratchHead = indexOfFirstArg - additionalArgumentCount
+								// HIST requires larger scratch and isFloat slices, with room for remaining tokens
+								if err = e.growScratch(e.scratchHead+len(counts)+1, tokens[tokIdx+1:], tokIdx); err != nil {
+									return err
+								}
+								for _, count := range counts {
+									e.scratch[e.scratchHead] = float64(count)
+									e.isFloat[e.scratchHead] = true
+									e.scratchHead++
+								}
+								e.scratch[e.scratchHead] = float64(len(counts))
+								e.isFloat[e.scratchHead] = true
+								e.scratchHead++
+								stackUpdated = true
+							}
 						case "IF":
 							// A,B,C,IF ==> A ? B : C
 							if e.isFloat[indexOfFirstArg] {
-								if e.scratch[indexOfFirstArg].(float64) < 0 || e.scratch[indexOfFirstArg].(float64) > 0 {
+								if e.threeValuedLogic && e.isUnknownOperand(indexOfFirstArg, 1) {
+									result = math.NaN()
+									e.discard(e.scratch[indexOfFirstArg+1])
+									e.discard(e.scratch[indexOfFirstArg+2])
+								} else if e.scratch[indexOfFirstArg].(float64) < 0 || e.scratch[indexOfFirstArg].(float64) > 0 {
 									result = e.scratch[indexOfFirstArg+1]
+									e.discard(e.scratch[indexOfFirstArg+2])
 								} else {
 									result = e.scratch[indexOfFirstArg+2]
+									e.discard(e.scratch[indexOfFirstArg+1])
 								}
 							} else {
 								cannotSimplify = true
 							}
 						case "INDEX":
-							if math.IsNaN(e.scratch[indexOfFirstArg].(float64)) || math.IsInf(e.scratch[indexOfFirstArg].(float64), 1) || math.IsInf(e.scratch[indexOfFirstArg].(float64), -1) || e.scratch[indexOfFirstArg].(float64) <= 0 {
+							if !e.isCount(e.scratch[indexOfFirstArg].(float64)) {
 								return newErrSyntax("%s operator requires positive finite integer: %v", token, e.scratch[indexOfFirstArg])
 							}
-							additionalArgumentCount = int(e.scratch[indexOfFirstArg].(float64))
+							additionalArgumentCount = saturatingInt(e.scratch[indexOfFirstArg].(float64))
 							if additionalArgumentCount > e.scratchHead-1 {
-								return newErrSyntax("%s operand requires %d items, but only %d on stack", token, additionalArgumentCount, e.scratchHead-1)
+								return newErrStackUnderflow("%s operand requires %d items, but only %d on stack", token, additionalArgumentCount, e.scratchHead-1)
 							}
 							for argIdx = indexOfFirstArg - additionalArgumentCount; argIdx < indexOfFirstArg; argIdx++ {
 								if !e.isFloat[argIdx] {
@@ -965,17 +2638,10 @@ func (e *Expression) simplify(bindings map[string]interface{}) error {
 							}
 						case "LE":
 							if e.isFloat[indexOfFirstArg] && e.isFloat[indexOfFirstArg+1] {
-								if math.IsNaN(e.scratch[indexOfFirstArg].(float64)) {
-									result = math.NaN()
-								} else if math.IsNaN(e.scratch[indexOfFirstArg+1].(float64)) {
-									result = math.NaN()
-								} else if e.scratch[indexOfFirstArg].(float64) <= e.scratch[indexOfFirstArg+1].(float64) {
-									result = float64(1)
-								} else {
-									result = float64(0)
-								}
-							} else if !e.isFloat[indexOfFirstArg] && !e.isFloat[indexOfFirstArg+1] {
-								if e.scratch[indexOfFirstArg].(string) == e.scratch[indexOfFirstArg+1].(string) {
+								result = e.compare(token, e.scratch[indexOfFirstArg].(float64), e.scratch[indexOfFirstArg+1].(float64))
+							} else if !e.isFloat[indexOfFirstArg] && !e.isFloat[indexOfFirstArg+1] && !e.threeValuedLogic {
+								// NaN is not even equal to itself when comparisons with NaN are false
+								if e.scratch[indexOfFirstArg].(string) == e.scratch[indexOfFirstArg+1].(string) && e.comparisonsWithNaN != ComparisonFalse {
 									result = float64(1)
 								} else {
 									cannotSimplify = true
@@ -997,16 +2663,8 @@ func (e *Expression) simplify(bindings map[string]interface{}) error {
 							result = math.Log(e.scratch[indexOfFirstArg].(float64))
 						case "LT":
 							if e.isFloat[indexOfFirstArg] && e.isFloat[indexOfFirstArg+1] {
-								if math.IsNaN(e.scratch[indexOfFirstArg].(float64)) {
-									result = math.NaN()
-								} else if math.IsNaN(e.scratch[indexOfFirstArg+1].(float64)) {
-									result = math.NaN()
-								} else if e.scratch[indexOfFirstArg].(float64) < e.scratch[indexOfFirstArg+1].(float64) {
-									result = float64(1)
-								} else {
-									result = float64(0)
-								}
-							} else if !e.isFloat[indexOfFirstArg] && !e.isFloat[indexOfFirstArg+1] {
+								result = e.compare(token, e.scratch[indexOfFirstArg].(float64), e.scratch[indexOfFirstArg+1].(float64))
+							} else if !e.isFloat[indexOfFirstArg] && !e.isFloat[indexOfFirstArg+1] && !e.threeValuedLogic {
 								if e.scratch[indexOfFirstArg].(string) == e.scratch[indexOfFirstArg+1].(string) {
 									result = float64(0)
 								} else {
@@ -1016,12 +2674,27 @@ func (e *Expression) simplify(bindings map[string]interface{}) error {
 								cannotSimplify = true
 							}
 						case "MAD":
-							if math.IsNaN(e.scratch[indexOfFirstArg].(float64)) || math.IsInf(e.scratch[indexOfFirstArg].(float64), 1) || math.IsInf(e.scratch[indexOfFirstArg].(float64), -1) || e.scratch[indexOfFirstArg].(float64) <= 0 {
+							if label, ok := e.scratch[indexOfFirstArg].(string); ok {
+								// label,MAD is the median absolute deviation of the known values of a series
+								items, ok, err := e.knownSeriesValues(token, label, bindings)
+								if err != nil {
+									return err
+								}
+								if !ok {
+									cannotSimplify = true
+								} else if len(items) == 0 {
+									result = math.NaN()
+								} else {
+									result = mad(items)
+								}
+								break
+							}
+							if !e.isCount(e.scratch[indexOfFirstArg].(float64)) {
 								return newErrSyntax("%s operator requires positive finite integer: %v", token, e.scratch[indexOfFirstArg])
 							}
-							additionalArgumentCount = int(e.scratch[indexOfFirstArg].(float64))
+							additionalArgumentCount = saturatingInt(e.scratch[indexOfFirstArg].(float64))
 							if additionalArgumentCount > e.scratchHead-1 {
-								return newErrSyntax("%s operand requires %d items, but only %d on stack", token, additionalArgumentCount, e.scratchHead-1)
+								return newErrStackUnderflow("%s operand requires %d items, but only %d on stack", token, additionalArgumentCount, e.scratchHead-1)
 							}
 							if additionalArgumentCount == 1 {
 								// pin-hole optimization for 1 item
@@ -1084,12 +2757,27 @@ func (e *Expression) simplify(bindings map[string]interface{}) error {
 								cannotSimplify = true
 							}
 						case "MEDIAN":
-							if math.IsNaN(e.scratch[indexOfFirstArg].(float64)) || math.IsInf(e.scratch[indexOfFirstArg].(float64), 1) || math.IsInf(e.scratch[indexOfFirstArg].(float64), -1) || e.scratch[indexOfFirstArg].(float64) <= 0 {
+							if label, ok := e.scratch[indexOfFirstArg].(string); ok {
+								// label,MEDIAN is the median of the known values of a series
+								items, ok, err := e.knownSeriesValues(token, label, bindings)
+								if err != nil {
+									return err
+								}
+								if !ok {
+									cannotSimplify = true
+								} else if len(items) == 0 {
+									result = math.NaN()
+								} else {
+									result = median(items)
+								}
+								break
+							}
+							if !e.isCount(e.scratch[indexOfFirstArg].(float64)) {
 								return newErrSyntax("%s operator requires positive finite integer: %v", token, e.scratch[indexOfFirstArg])
 							}
-							additionalArgumentCount = int(e.scratch[indexOfFirstArg].(float64))
+							additionalArgumentCount = saturatingInt(e.scratch[indexOfFirstArg].(float64))
 							if additionalArgumentCount > e.scratchHead-1 {
-								return newErrSyntax("%s operand requires %d items, but only %d on stack", token, additionalArgumentCount, e.scratchHead-1)
+								return newErrStackUnderflow("%s operand requires %d items, but only %d on stack", token, additionalArgumentCount, e.scratchHead-1)
 							}
 							if additionalArgumentCount == 1 {
 								// pin-hole optimization for 1 item
@@ -1151,35 +2839,132 @@ func (e *Expression) simplify(bindings map[string]interface{}) error {
 							} else {
 								cannotSimplify = true
 							}
+						case "MODINT":
+							a, aok := toInt64(e.scratch[indexOfFirstArg].(float64))
+							b, bok := toInt64(e.scratch[indexOfFirstArg+1].(float64))
+							if !aok || !bok {
+								result = math.NaN()
+							} else if b != 0 {
+								result = float64(a % b)
+							} else if value, err := e.divideByZero(token, float64(a)); err != nil {
+								return err
+							} else {
+								result = value
+							}
 						case "NE":
 							if e.isFloat[indexOfFirstArg] && e.isFloat[indexOfFirstArg+1] {
-								if e.scratch[indexOfFirstArg].(float64) != e.scratch[indexOfFirstArg+1].(float64) {
+								if e.threeValuedLogic && e.isUnknownOperand(indexOfFirstArg, 2) {
+									result = math.NaN()
+								} else if e.scratch[indexOfFirstArg].(float64) != e.scratch[indexOfFirstArg+1].(float64) {
 									result = float64(1)
 								} else {
 									result = float64(0)
 								}
-							} else if !e.isFloat[indexOfFirstArg] && !e.isFloat[indexOfFirstArg+1] {
+							} else if !e.isFloat[indexOfFirstArg] && !e.isFloat[indexOfFirstArg+1] && !e.threeValuedLogic {
 								if e.scratch[indexOfFirstArg].(string) == e.scratch[indexOfFirstArg+1].(string) {
 									result = float64(0)
 								} else {
 									cannotSimplify = true
 								}
-							} else {
-								cannotSimplify = true
+							} else {
+								cannotSimplify = true
+							}
+						case "NIP":
+							e.scratch[indexOfFirstArg] = e.scratch[indexOfFirstArg+1]
+							e.isFloat[indexOfFirstArg] = e.isFloat[indexOfFirstArg+1]
+							e.scratchHead--
+							stackUpdated = true
+						case "NLARGEST", "NSMALLEST": // k,n,NLARGEST -- a,b,c,d,2,4,NLARGEST -> keep the 2 largest of a,b,c,d
+							// count to keep
+							if !e.isCount(e.scratch[indexOfFirstArg].(float64)) {
+								return newErrSyntax("%s operator requires positive finite integer: %v", token, e.scratch[indexOfFirstArg])
+							}
+							keep := saturatingInt(e.scratch[indexOfFirstArg].(float64))
+							// count of values
+							if !e.isCount(e.scratch[indexOfFirstArg+1].(float64)) {
+								return newErrSyntax("%s operator requires positive finite integer: %v", token, e.scratch[indexOfFirstArg+1])
+							}
+							additionalArgumentCount = saturatingInt(e.scratch[indexOfFirstArg+1].(float64))
+							if additionalArgumentCount > e.scratchHead-2 {
+								return newErrStackUnderflow("%s operand requires %d items, but only %d on stack", token, additionalArgumentCount, e.scratchHead-2)
+							}
+							if keep > additionalArgumentCount {
+								return newErrSyntax("%s operand keeps %d items, but only examines %d", token, keep, additionalArgumentCount)
+							}
+							for argIdx = indexOfFirstArg - additionalArgumentCount; argIdx < indexOfFirstArg; argIdx++ {
+								if !e.isFloat[argIdx] {
+									cannotSimplify = true
+									break
+								}
+							}
+							if !cannotSimplify {
+								// rank the values, with UNK values ranked last, then keep the values ranked
+								// high enough in the order they were on the stack
+								first := indexOfFirstArg - additionalArgumentCount
+								ranked := make([]int, additionalArgumentCount)
+								for i := range ranked {
+									ranked[i] = first + i
+								}
+								sort.SliceStable(ranked, func(i, j int) bool {
+									a, b := e.scratch[ranked[i]].(float64), e.scratch[ranked[j]].(float64)
+									if math.IsNaN(b) {
+										return !math.IsNaN(a)
+									}
+									if token == "NLARGEST" {
+										return a > b
+									}
+									return a < b
+								})
+								kept := make([]bool, additionalArgumentCount)
+								for _, idx := range ranked[:keep] {
+									kept[idx-first] = true
+								}
+								e.scratchHead = first
+								for i, ok := range kept {
+									if ok {
+										e.scratch[e.scratchHead] = e.scratch[first+i]
+										e.scratchHead++ // isFloat is already true where every examined value was
+									}
+								}
+								stackUpdated = true
 							}
+						case "OVER":
+							e.scratch[e.scratchHead] = e.scratch[indexOfFirstArg]
+							e.isFloat[e.scratchHead] = e.isFloat[indexOfFirstArg]
+							e.scratchHead++
+							stackUpdated = true
 						case "PERCENT": // n,m,PERCENT -- a,b,c,95,3,PERCENT -> find 95percentile of a,b,c using the nearest rank method (https://en.wikipedia.org/wiki/Percentile)
 							// percentile
 							if math.IsNaN(e.scratch[indexOfFirstArg].(float64)) || math.IsInf(e.scratch[indexOfFirstArg].(float64), 1) || math.IsInf(e.scratch[indexOfFirstArg].(float64), -1) || e.scratch[indexOfFirstArg].(float64) <= 0 {
 								return newErrSyntax("%s operator requires positive finite integer: %v", token, e.scratch[indexOfFirstArg])
 							}
 							percent := e.scratch[indexOfFirstArg].(float64)
+							if percent > 100 {
+								return newErrSyntax("%s operator requires percentile no greater than 100: %v", token, percent)
+							}
+							if label, ok := e.scratch[indexOfFirstArg+1].(string); ok {
+								// n,label,PERCENT is the percentile of the known values of a series
+								items, ok, err := e.knownSeriesValues(token, label, bindings)
+								if err != nil {
+									return err
+								}
+								if !ok {
+									cannotSimplify = true
+								} else if len(items) == 0 {
+									result = math.NaN()
+								} else {
+									sort.Float64s(items)
+									result = items[int(math.Ceil(percent/100*float64(len(items))))-1]
+								}
+								break
+							}
 							// count of values
-							if math.IsNaN(e.scratch[indexOfFirstArg+1].(float64)) || math.IsInf(e.scratch[indexOfFirstArg+1].(float64), 1) || math.IsInf(e.scratch[indexOfFirstArg+1].(float64), -1) {
+							if !e.isCount(e.scratch[indexOfFirstArg+1].(float64)) {
 								return newErrSyntax("%s operator requires positive finite integer: %v", token, e.scratch[indexOfFirstArg+1])
 							}
-							additionalArgumentCount = int(e.scratch[indexOfFirstArg+1].(float64))
+							additionalArgumentCount = saturatingInt(e.scratch[indexOfFirstArg+1].(float64))
 							if additionalArgumentCount > e.scratchHead-2 {
-								return newErrSyntax("%s operand requires %d items, but only %d on stack", token, additionalArgumentCount, e.scratchHead-2)
+								return newErrStackUnderflow("%s operand requires %d items, but only %d on stack", token, additionalArgumentCount, e.scratchHead-2)
 							}
 							items := make([]float64, 0, additionalArgumentCount)
 							// cannot calculate percent if any are operators
@@ -1209,7 +2994,7 @@ func (e *Expression) simplify(bindings map[string]interface{}) error {
 									cannotSimplify = true
 								}
 							} else if e.isFloat[indexOfFirstArg+1] { // only b is float
-								if b := e.scratch[indexOfFirstArg+1].(float64); b == 0 {
+								if b := e.scratch[indexOfFirstArg+1].(float64); b == 0 && !e.isOperatorAt(indexOfFirstArg) {
 									result = float64(1)
 								} else if b == 1 {
 									result = e.scratch[indexOfFirstArg]
@@ -1221,13 +3006,19 @@ func (e *Expression) simplify(bindings map[string]interface{}) error {
 							}
 						case "RAD2DEG":
 							result = e.scratch[indexOfFirstArg].(float64) * 180 / math.Pi
+						case "RANDOM":
+							if e.isEvaluating {
+								result = e.float64()
+							} else {
+								cannotSimplify = true // each evaluation draws a new value
+							}
 						case "REV":
-							if math.IsNaN(e.scratch[indexOfFirstArg].(float64)) || math.IsInf(e.scratch[indexOfFirstArg].(float64), 1) || math.IsInf(e.scratch[indexOfFirstArg].(float64), -1) || e.scratch[indexOfFirstArg].(float64) <= 0 {
+							if !e.isCount(e.scratch[indexOfFirstArg].(float64)) {
 								return newErrSyntax("%s operator requires positive finite integer: %v", token, e.scratch[indexOfFirstArg])
 							}
-							additionalArgumentCount = int(e.scratch[indexOfFirstArg].(float64))
+							additionalArgumentCount = saturatingInt(e.scratch[indexOfFirstArg].(float64))
 							if additionalArgumentCount > e.scratchHead-1 {
-								return newErrSyntax("%s operand requires %d items, but only %d on stack", token, additionalArgumentCount, e.scratchHead-1)
+								return newErrStackUnderflow("%s operand requires %d items, but only %d on stack", token, additionalArgumentCount, e.scratchHead-1)
 							}
 							// cannot rev if any are operators
 							for argIdx = indexOfFirstArg - additionalArgumentCount; argIdx < indexOfFirstArg; argIdx++ {
@@ -1239,35 +3030,26 @@ func (e *Expression) simplify(bindings map[string]interface{}) error {
 								}
 							}
 							if !cannotSimplify {
-								items := make([]interface{}, additionalArgumentCount)
+								e.reverse(indexOfFirstArg-additionalArgumentCount, indexOfFirstArg)
 								e.scratchHead-- // drop the count
-								copy(items, e.scratch[e.scratchHead-additionalArgumentCount:])
-								itemIdx = additionalArgumentCount - 1
-								for argIdx = indexOfFirstArg - additionalArgumentCount; argIdx < indexOfFirstArg; argIdx++ {
-									// overwrite other elements
-									_, isFloat = items[itemIdx].(float64)
-									e.scratch[argIdx] = items[itemIdx]
-									e.isFloat[argIdx] = isFloat
-									itemIdx--
-								}
 								stackUpdated = true
 							}
 						case "ROLL": // n,m,ROLL -- rotate the top n elements of the stack by m
 							// n
-							if math.IsNaN(e.scratch[indexOfFirstArg].(float64)) || math.IsInf(e.scratch[indexOfFirstArg].(float64), 1) || math.IsInf(e.scratch[indexOfFirstArg].(float64), -1) || e.scratch[indexOfFirstArg].(float64) <= 0 {
+							if !e.isCount(e.scratch[indexOfFirstArg].(float64)) {
 								return newErrSyntax("%s operator requires positive finite integer: %v", token, e.scratch[indexOfFirstArg])
 							}
-							n := int(e.scratch[indexOfFirstArg].(float64))
-							if n > e.scratchHead-1 {
-								return newErrSyntax("%s operand requires %d items, but only %d on stack", token, n, e.scratchHead-1)
-							}
+							n := saturatingInt(e.scratch[indexOfFirstArg].(float64))
 							// m
-							if math.IsNaN(e.scratch[indexOfFirstArg+1].(float64)) || math.IsInf(e.scratch[indexOfFirstArg+1].(float64), 1) || math.IsInf(e.scratch[indexOfFirstArg+1].(float64), -1) {
+							if math.IsNaN(e.scratch[indexOfFirstArg+1].(float64)) || math.IsInf(e.scratch[indexOfFirstArg+1].(float64), 1) || math.IsInf(e.scratch[indexOfFirstArg+1].(float64), -1) || (!e.lenientCounts && e.scratch[indexOfFirstArg+1].(float64) != math.Trunc(e.scratch[indexOfFirstArg+1].(float64))) {
 								return newErrSyntax("%s operator requires positive finite integer: %v", token, e.scratch[indexOfFirstArg+1])
 							}
-							m := int(e.scratch[indexOfFirstArg+1].(float64))
+							m := saturatingInt(e.scratch[indexOfFirstArg+1].(float64))
 							if m > e.scratchHead-1 {
-								return newErrSyntax("%s operand requires %d items, but only %d on stack", token, m, e.scratchHead-1)
+								return newErrStackUnderflow("%s operand requires %d items, but only %d on stack", token, m, e.scratchHead-1)
+							}
+							if n > indexOfFirstArg {
+								return newErrStackUnderflow("%s operand requires %d items, but only %d on stack", token, n, indexOfFirstArg)
 							}
 							// cannot roll if any are operators
 							for argIdx = indexOfFirstArg - n; argIdx < indexOfFirstArg; argIdx++ {
@@ -1279,28 +3061,40 @@ func (e *Expression) simplify(bindings map[string]interface{}) error {
 								}
 							}
 							if !cannotSimplify {
-								var items []interface{}
-								// TODO: optimize this
-								for j := 0; j < 3; j++ {
-									for i := 0; i < n; i++ {
-										items = append(items, e.scratch[i+indexOfFirstArg-n])
-									}
+								// rotate towards the top of the stack by reversing the whole, then each part
+								if m = m % n; m < 0 {
+									m += n
 								}
-								first := len(items)/3 - m
-								last := first + n
-								copy(e.scratch[indexOfFirstArg-n:], items[first:last])
+								e.reverse(indexOfFirstArg-n, indexOfFirstArg)
+								e.reverse(indexOfFirstArg-n, indexOfFirstArg-n+m)
+								e.reverse(indexOfFirstArg-n+m, indexOfFirstArg)
 								e.scratchHead -= 2 // drop the count
+								additionalArgumentCount = n
 								stackUpdated = true
 							}
+						case "SHL", "SHR":
+							a, aok := toInt64(e.scratch[indexOfFirstArg].(float64))
+							n, nok := toInt64(e.scratch[indexOfFirstArg+1].(float64))
+							if !aok || !nok || n < 0 {
+								result = math.NaN()
+							} else if token == "SHL" {
+								result = float64(a << uint64(n))
+							} else {
+								result = float64(a >> uint64(n)) // arithmetic shift keeps the sign
+							}
+						case "ROT":
+							e.scratch[indexOfFirstArg], e.scratch[indexOfFirstArg+1], e.scratch[indexOfFirstArg+2] = e.scratch[indexOfFirstArg+1], e.scratch[indexOfFirstArg+2], e.scratch[indexOfFirstArg]
+							e.isFloat[indexOfFirstArg], e.isFloat[indexOfFirstArg+1], e.isFloat[indexOfFirstArg+2] = e.isFloat[indexOfFirstArg+1], e.isFloat[indexOfFirstArg+2], e.isFloat[indexOfFirstArg]
+							stackUpdated = true
 						case "SIN":
 							result = math.Sin(e.scratch[indexOfFirstArg].(float64))
 						case "SMAX":
-							if math.IsNaN(e.scratch[indexOfFirstArg].(float64)) || math.IsInf(e.scratch[indexOfFirstArg].(float64), 1) || math.IsInf(e.scratch[indexOfFirstArg].(float64), -1) || e.scratch[indexOfFirstArg].(float64) <= 0 {
+							if !e.isCount(e.scratch[indexOfFirstArg].(float64)) {
 								return newErrSyntax("%s operator requires positive finite integer: %v", token, e.scratch[indexOfFirstArg])
 							}
-							additionalArgumentCount = int(e.scratch[indexOfFirstArg].(float64))
+							additionalArgumentCount = saturatingInt(e.scratch[indexOfFirstArg].(float64))
 							if additionalArgumentCount > e.scratchHead-1 {
-								return newErrSyntax("%s operand requires %d items, but only %d on stack", token, additionalArgumentCount, e.scratchHead-1)
+								return newErrStackUnderflow("%s operand requires %d items, but only %d on stack", token, additionalArgumentCount, e.scratchHead-1)
 							}
 							if additionalArgumentCount == 1 {
 								// pin-hole optimization for 1 item
@@ -1324,12 +3118,12 @@ func (e *Expression) simplify(bindings map[string]interface{}) error {
 								}
 							}
 						case "SMIN":
-							if math.IsNaN(e.scratch[indexOfFirstArg].(float64)) || math.IsInf(e.scratch[indexOfFirstArg].(float64), 1) || math.IsInf(e.scratch[indexOfFirstArg].(float64), -1) || e.scratch[indexOfFirstArg].(float64) <= 0 {
+							if !e.isCount(e.scratch[indexOfFirstArg].(float64)) {
 								return newErrSyntax("%s operator requires positive finite integer: %v", token, e.scratch[indexOfFirstArg])
 							}
-							additionalArgumentCount = int(e.scratch[indexOfFirstArg].(float64))
+							additionalArgumentCount = saturatingInt(e.scratch[indexOfFirstArg].(float64))
 							if additionalArgumentCount > e.scratchHead-1 {
-								return newErrSyntax("%s operand requires %d items, but only %d on stack", token, additionalArgumentCount, e.scratchHead-1)
+								return newErrStackUnderflow("%s operand requires %d items, but only %d on stack", token, additionalArgumentCount, e.scratchHead-1)
 							}
 							if additionalArgumentCount == 1 {
 								// pin-hole optimization for 1 item
@@ -1353,63 +3147,66 @@ func (e *Expression) simplify(bindings map[string]interface{}) error {
 								}
 							}
 						case "SORT":
-							if math.IsNaN(e.scratch[indexOfFirstArg].(float64)) || math.IsInf(e.scratch[indexOfFirstArg].(float64), 1) || math.IsInf(e.scratch[indexOfFirstArg].(float64), -1) || e.scratch[indexOfFirstArg].(float64) <= 0 {
+							if !e.isCount(e.scratch[indexOfFirstArg].(float64)) {
 								return newErrSyntax("%s operator requires positive finite integer: %v", token, e.scratch[indexOfFirstArg])
 							}
-							additionalArgumentCount = int(e.scratch[indexOfFirstArg].(float64))
+							additionalArgumentCount = saturatingInt(e.scratch[indexOfFirstArg].(float64))
 							if additionalArgumentCount > e.scratchHead-1 {
-								return newErrSyntax("%s operand requires %d items, but only %d on stack", token, additionalArgumentCount, e.scratchHead-1)
+								return newErrStackUnderflow("%s operand requires %d items, but only %d on stack", token, additionalArgumentCount, e.scratchHead-1)
 							}
-							items := make([]float64, 0, additionalArgumentCount)
 							for argIdx = indexOfFirstArg - additionalArgumentCount; argIdx < indexOfFirstArg; argIdx++ {
 								if !e.isFloat[argIdx] {
 									cannotSimplify = true
 									break
 								}
-								// items[argIdx+indexOfFirstArg-additionalArgumentCount] = e.scratch[argIdx].(float64)
-								items = append(items, e.scratch[argIdx].(float64))
 							}
 							if !cannotSimplify {
-								sort.Float64s(items)
-								for argIdx = indexOfFirstArg - additionalArgumentCount; argIdx < indexOfFirstArg; argIdx++ {
-									e.scratch[argIdx] = items[argIdx+indexOfFirstArg-additionalArgumentCount]
-									e.isFloat[argIdx] = true
-								}
+								// sort the boxed values in place rather than unboxing and boxing them again
+								e.sorter = scratchSorter(e.scratch[indexOfFirstArg-additionalArgumentCount : indexOfFirstArg])
+								sort.Sort(&e.sorter)
+								e.sorter = nil
 								e.scratchHead-- // drop the count
 								stackUpdated = true
 							}
 						case "SQRT":
 							result = math.Sqrt(e.scratch[indexOfFirstArg].(float64))
-						case "STDEV":
-							if math.IsNaN(e.scratch[indexOfFirstArg].(float64)) || math.IsInf(e.scratch[indexOfFirstArg].(float64), 1) || math.IsInf(e.scratch[indexOfFirstArg].(float64), -1) || e.scratch[indexOfFirstArg].(float64) <= 0 {
+						case "SSTDEV", "STDEV", "STDEVNAN", "SVAR", "VAR":
+							if !e.isCount(e.scratch[indexOfFirstArg].(float64)) {
 								return newErrSyntax("%s operator requires positive finite integer: %v", token, e.scratch[indexOfFirstArg])
 							}
-							additionalArgumentCount = int(e.scratch[indexOfFirstArg].(float64))
+							additionalArgumentCount = saturatingInt(e.scratch[indexOfFirstArg].(float64))
 							if additionalArgumentCount > e.scratchHead-1 {
-								return newErrSyntax("%s operand requires %d items, but only %d on stack", token, additionalArgumentCount, e.scratchHead-1)
+								return newErrStackUnderflow("%s operand requires %d items, but only %d on stack", token, additionalArgumentCount, e.scratchHead-1)
 							}
-							total = 0
+							// Welford's algorithm computes the variance in a single pass, without
+							// keeping the items to subtract the mean from each of them afterwards
+							var mean, squares float64
 							used = 0
-							items := make([]float64, 0, additionalArgumentCount)
 							for argIdx = indexOfFirstArg - additionalArgumentCount; argIdx < indexOfFirstArg; argIdx++ {
 								if !e.isFloat[argIdx] {
 									cannotSimplify = true
 									break
 								}
-								if !math.IsNaN(e.scratch[argIdx].(float64)) {
-									total += e.scratch[argIdx].(float64)
+								if value := e.scratch[argIdx].(float64); !math.IsNaN(value) {
 									used++
-									items = append(items, e.scratch[argIdx].(float64))
+									diff := value - mean
+									mean += diff / float64(used)
+									squares += diff * (value - mean)
+								} else if token == "STDEV" && e.strictAggregates {
+									squares = math.NaN()
 								}
 							}
 							if !cannotSimplify {
-								mean := total / float64(used)
-								total = 0
-								for i := range items {
-									diff := items[i] - mean
-									total += diff * diff
+								if token == "SSTDEV" || token == "SVAR" {
+									used-- // sample rather than population: n-1 denominator
+								}
+								if used <= 0 {
+									result = math.NaN() // not enough values
+								} else if variance := squares / float64(used); token == "STDEV" || token == "STDEVNAN" || token == "SSTDEV" {
+									result = math.Sqrt(variance)
+								} else {
+									result = variance
 								}
-								result = math.Sqrt(total / float64(used))
 							}
 						case "TREND": // label,count,TREND
 							// get the count
@@ -1417,7 +3214,6 @@ func (e *Expression) simplify(bindings map[string]interface{}) error {
 							if math.IsNaN(v) || v <= 0 || math.IsInf(v, 1) {
 								return newErrSyntax("%s operator requires positive finite integer: %v", token, v)
 							}
-							additionalArgumentCount = int(math.Ceil(v / float64(e.secondsPerInterval)))
 							// get series label
 							label, ok := e.scratch[indexOfFirstArg].(string)
 							if !ok {
@@ -1429,27 +3225,22 @@ func (e *Expression) simplify(bindings map[string]interface{}) error {
 								// log.Printf("cannot find label binding: %q", label)
 								cannotSimplify = true
 							} else {
-								if s, ok := series.([]float64); ok {
-									// log.Printf("label bound to []float64")
-									if additionalArgumentCount > len(s) {
-										return newErrSyntax("%s operand specifies %d values, but only %d available", token, additionalArgumentCount, len(s))
-									} else {
-										e.openBindings[label] = e.openBindings[label] - 1
-										total = 0
-										used = 0
-										for argIdx = len(s) - additionalArgumentCount; argIdx < len(s); argIdx++ {
-											total += s[argIdx]
-											used++
-										}
-										e.scratchHead -= opArity.popCount
-										e.scratch[e.scratchHead] = total / float64(used)
-										e.isFloat[e.scratchHead] = true
-										e.scratchHead++
-										stackUpdated = true
-									}
-								} else {
-									return newErrSyntax("%s operand specifies %q label, which is not a series of numbers: %T", token, label, s)
+								window, err := e.trendWindow(token, label, series, v, bindings)
+								if err != nil {
+									return err
 								}
+								e.openBindings[label] = e.openBindings[label] - 1
+								sum = compensatedSum{}
+								used = 0
+								for _, value := range window {
+									sum.add(value)
+									used++
+								}
+								e.scratchHead -= opArity.popCount
+								e.scratch[e.scratchHead] = sum.total() / float64(used)
+								e.isFloat[e.scratchHead] = true
+								e.scratchHead++
+								stackUpdated = true
 							}
 						case "TRENDNAN": // label,count,TRENDNAN
 							// get the count
@@ -1457,7 +3248,6 @@ func (e *Expression) simplify(bindings map[string]interface{}) error {
 							if math.IsNaN(v) || v <= 0 || math.IsInf(v, 1) {
 								return newErrSyntax("%s operator requires positive finite integer: %v", token, v)
 							}
-							additionalArgumentCount = int(math.Ceil(v / e.secondsPerInterval))
 							// get series label
 							label, ok := e.scratch[indexOfFirstArg].(string)
 							if !ok {
@@ -1469,30 +3259,32 @@ func (e *Expression) simplify(bindings map[string]interface{}) error {
 								// log.Printf("cannot find label binding: %q", label)
 								cannotSimplify = true
 							} else {
-								if s, ok := series.([]float64); ok {
-									// log.Printf("label bound to []float64")
-									if additionalArgumentCount > len(s) {
-										return newErrSyntax("%s operand specifies %d values, but only %d available", token, additionalArgumentCount, len(s))
-									} else {
-										e.openBindings[label] = e.openBindings[label] - 1
-										total = 0
-										used = 0
-										for argIdx = len(s) - additionalArgumentCount; argIdx < len(s); argIdx++ {
-											if !math.IsNaN(s[argIdx]) {
-												total += s[argIdx]
-												used++
-											}
-										}
-										e.scratchHead -= opArity.popCount
-										e.scratch[e.scratchHead] = total / float64(used)
-										e.isFloat[e.scratchHead] = true
-										e.scratchHead++
-										stackUpdated = true
+								window, err := e.trendWindow(token, label, series, v, bindings)
+								if err != nil {
+									return err
+								}
+								e.openBindings[label] = e.openBindings[label] - 1
+								sum = compensatedSum{}
+								used = 0
+								for _, value := range window {
+									if !math.IsNaN(value) {
+										sum.add(value)
+										used++
 									}
-								} else {
-									return newErrSyntax("%s operand specifies %q label, which is not a series of numbers: %T", token, label, s)
 								}
+								e.scratchHead -= opArity.popCount
+								e.scratch[e.scratchHead] = sum.total() / float64(used)
+								e.isFloat[e.scratchHead] = true
+								e.scratchHead++
+								stackUpdated = true
 							}
+						case "TUCK":
+							e.scratch[e.scratchHead] = e.scratch[indexOfFirstArg+1]
+							e.isFloat[e.scratchHead] = e.isFloat[indexOfFirstArg+1]
+							e.scratch[indexOfFirstArg], e.scratch[indexOfFirstArg+1] = e.scratch[indexOfFirstArg+1], e.scratch[indexOfFirstArg]
+							e.isFloat[indexOfFirstArg], e.isFloat[indexOfFirstArg+1] = e.isFloat[indexOfFirstArg+1], e.isFloat[indexOfFirstArg]
+							e.scratchHead++
+							stackUpdated = true
 						case "UN":
 							if math.IsNaN(e.scratch[indexOfFirstArg].(float64)) {
 								result = float64(1)
@@ -1507,25 +3299,36 @@ func (e *Expression) simplify(bindings map[string]interface{}) error {
 						e.isFloat[e.scratchHead] = false
 						e.scratchHead++
 					} else if !stackUpdated {
+						if e.checkedArithmetic {
+							if err = e.checkArithmetic(token, tokIdx, e.scratch[indexOfFirstArg:e.scratchHead], result); err != nil {
+								return err
+							}
+						}
 						e.scratchHead -= opArity.popCount + additionalArgumentCount
 						e.scratch[e.scratchHead] = result
 						_, e.isFloat[e.scratchHead] = result.(float64)
 						e.scratchHead++
 					}
-				} else if value, err = strconv.ParseFloat(token, 64); err == nil {
-					// token is the string representation of a number
-					e.scratch[e.scratchHead] = value
-					e.isFloat[e.scratchHead] = true
-					e.scratchHead++
+
+					if e.trace != nil {
+						if cannotSimplify {
+							e.emitTrace(tokIdx, token, traceBefore, opArity.popCount, true)
+						} else {
+							e.emitTrace(tokIdx, token, traceBefore, opArity.popCount+additionalArgumentCount, false)
+						}
+					}
 				} else if val, ok := bindings[token]; ok {
 					// token is a symbol to a binding
 					switch v := val.(type) {
 					case float64:
 						// token is a symbol that binds to a variable
+						if (e.rejectNaNInputs || e.info != nil) && e.isEvaluating && math.IsNaN(v) {
+							nanInputs = append(nanInputs, token)
+						}
 						e.scratch[e.scratchHead] = v
 						e.isFloat[e.scratchHead] = true
 						e.scratchHead++
-					case []float64:
+					case []float64, SeriesBinding:
 						// token is a symbol that binds to a series
 						e.openBindings[token] = e.openBindings[token] + 1
 						e.scratch[e.scratchHead] = token
@@ -1543,33 +3346,449 @@ func (e *Expression) simplify(bindings map[string]interface{}) error {
 		default:
 			return newErrSyntax("unexpected token type at position %d: %v", tokIdx+1, tok)
 		}
+
+		if e.budget > 0 && e.isEvaluating {
+			token, _ := tok.(string)
+			if _, isOperator := arity[token]; isOperator && !cannotSimplify {
+				consumed := opArity.popCount + additionalArgumentCount
+				cost += e.costs.weight(token) * (consumed + e.scratchHead - (headBefore - consumed))
+			} else {
+				cost++ // a number, a symbol, or an operator that remains in the program
+			}
+			if cost > e.budget {
+				return ErrBudgetExceeded{Budget: e.budget, Cost: cost, Position: tokIdx}
+			}
+		}
+	}
+	if e.info != nil {
+		e.info.NaNBindings = append(e.info.NaNBindings, nanInputs...)
+	}
+	if e.rejectNaNInputs && len(nanInputs) > 0 {
+		return ErrNaNInput(uniqueSorted(nanInputs))
 	}
 	return nil
 }
 
-func coerceMapValuesToFloat64(bindings map[string]interface{}) (map[string]interface{}, error) {
-	var err error
-	newBindings := make(map[string]interface{})
+// uniqueSorted sorts symbols in place, and returns them without duplicates.
+func uniqueSorted(symbols []string) []string {
+	if len(symbols) == 0 {
+		return symbols
+	}
+	sort.Strings(symbols)
+	unique := symbols[:1]
+	for _, symbol := range symbols[1:] {
+		if symbol != unique[len(unique)-1] {
+			unique = append(unique, symbol)
+		}
+	}
+	return unique
+}
 
-	for key, value := range bindings {
-		switch reflect.TypeOf(value).Kind() {
-		case reflect.Slice:
-			newBindings[key], err = coerceValuesToFloat64(value)
-			if err != nil {
-				return nil, ErrBadBindingType{fmt.Sprintf("%q: %q", key, err.(ErrBadBindingType).t)}
+// discard notes that an item removed from the work area without being consumed by an operator is
+// no longer an open binding, if it was one.
+// emitTrace invokes the trace function for the operator at position, given the stack before the
+// operator was applied, and the number of items it consumed.
+func (e *Expression) emitTrace(position int, operator string, before []interface{}, consumed int, deferred bool) {
+	if consumed > len(before) {
+		consumed = len(before)
+	}
+	event := TraceEvent{
+		Position: position,
+		Operator: operator,
+		Inputs:   append([]interface{}(nil), before[len(before)-consumed:]...),
+		Stack:    append([]interface{}(nil), e.scratch[:e.scratchHead]...),
+		Deferred: deferred,
+	}
+	if !deferred {
+		event.Outputs = append([]interface{}(nil), e.scratch[len(before)-consumed:e.scratchHead]...)
+	}
+	e.trace(event)
+}
+
+// compare returns 1 when a and b are ordered as operator, one of GE, GT, LE, or LT, requires, and 0
+// when they are not, according to the NaN comparison policy of the Expression.
+func (e *Expression) compare(operator string, a, b float64) float64 {
+	if math.IsNaN(a) || math.IsNaN(b) {
+		if e.threeValuedLogic {
+			return math.NaN()
+		}
+		switch e.comparisonsWithNaN {
+		case ComparisonFalse:
+			return 0
+		case ComparisonUnknownAsFalse:
+			if math.IsNaN(a) {
+				a = 0
+			}
+			if math.IsNaN(b) {
+				b = 0
 			}
 		default:
-			newBindings[key], err = coerceValueToFloat64(value)
-			if err != nil {
-				return nil, ErrBadBindingType{fmt.Sprintf("%q: %q", key, err.(ErrBadBindingType).t)}
+			return math.NaN()
+		}
+	}
+	var holds bool
+	switch operator {
+	case "GE":
+		holds = a >= b
+	case "GT":
+		holds = a > b
+	case "LE":
+		holds = a <= b
+	case "LT":
+		holds = a < b
+	}
+	if holds {
+		return 1
+	}
+	return 0
+}
+
+// float64 returns a uniformly distributed random value in [0, 1).
+func (e *Expression) float64() float64 {
+	if e.random != nil {
+		return e.random.Float64()
+	}
+	return rand.Float64()
+}
+
+// normFloat64 returns a normally distributed random value with mean 0 and standard deviation 1.
+func (e *Expression) normFloat64() float64 {
+	if e.random != nil {
+		return e.random.NormFloat64()
+	}
+	return rand.NormFloat64()
+}
+
+// toInt64 returns value truncated to an integer, and true, or false when value is NaN, infinite, or
+// too large to represent as an int64.
+func toInt64(value float64) (int64, bool) {
+	if math.IsNaN(value) || value >= math.MaxInt64 || value < math.MinInt64 {
+		return 0, false
+	}
+	return int64(value), true
+}
+
+// divideByZero returns the result of dividing dividend by zero with operator, either /, %, or MODINT,
+// according to the division by zero policy of the Expression.
+func (e *Expression) divideByZero(operator string, dividend float64) (float64, error) {
+	switch e.divisionByZero {
+	case DivisionByZeroInf:
+		if operator != "/" {
+			return math.NaN(), nil // remainders have no IEEE 754 infinity
+		}
+		return dividend / 0, nil
+	case DivisionByZeroError:
+		return 0, ErrDivisionByZero{Operator: operator, Dividend: dividend}
+	default:
+		return math.NaN(), nil
+	}
+}
+
+// checkArithmetic returns ErrOverflow when operator, one of +, -, *, or POW, computed an infinite
+// result from finite operands, and ErrUnderflow when * or POW computed 0 or a subnormal result from
+// nonzero finite operands.
+func (e *Expression) checkArithmetic(operator string, position int, operands []interface{}, result interface{}) error {
+	switch operator {
+	case "+", "-", "*", "POW":
+	default:
+		return nil
+	}
+	value, ok := result.(float64)
+	if !ok {
+		return nil
+	}
+	underflow := (operator == "*" || operator == "POW") && math.Abs(value) < smallestNormal
+	if !math.IsInf(value, 0) && !underflow {
+		return nil
+	}
+	if operator == "POW" && operands[0] == 0.0 {
+		return nil // a pole rather than an overflow, as in 0,-1,POW
+	}
+	values := make([]float64, 0, len(operands))
+	for _, operand := range operands {
+		v, ok := operand.(float64)
+		if !ok || math.IsInf(v, 0) || math.IsNaN(v) || (underflow && v == 0) {
+			return nil
+		}
+		values = append(values, v)
+	}
+	if underflow {
+		return ErrUnderflow{Operator: operator, Operands: values, Position: position}
+	}
+	return ErrOverflow{Operator: operator, Operands: values, Position: position}
+}
+
+// smallestNormal is the smallest positive normal float64, below which numbers are subnormal, and
+// have fewer significant bits.
+const smallestNormal = 0x1p-1022
+
+// isUnknownOperand returns true when any of the count items of the work area starting at index is
+// NaN.
+func (e *Expression) isUnknownOperand(index, count int) bool {
+	for ; count > 0; count-- {
+		if v, ok := e.scratch[index].(float64); ok && math.IsNaN(v) {
+			return true
+		}
+		index++
+	}
+	return false
+}
+
+// isOperatorAt returns true when the item at index of the work area is an operator, which cannot be
+// discarded without also discarding the items that compute its operands.
+func (e *Expression) isOperatorAt(index int) bool {
+	if e.isFloat[index] {
+		return false
+	}
+	_, ok := arity[e.scratch[index].(string)]
+	return ok
+}
+
+func (e *Expression) discard(item interface{}) {
+	symbol, ok := item.(string)
+	if !ok {
+		return
+	}
+	switch symbol {
+	case "LTIME", "NEWDAY", "NEWWEEK", "NEWMONTH", "NEWYEAR":
+		symbol = "TIME" // NOTE: actually requires TIME to be bound
+	}
+	if e.openBindings[symbol] > 0 {
+		e.openBindings[symbol]--
+	}
+}
+
+func hasExpressionBindings(bindings map[string]interface{}) bool {
+	for _, value := range bindings {
+		switch v := value.(type) {
+		case *Expression:
+			return true
+		case map[string]interface{}:
+			if hasExpressionBindings(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// bindingsNeedTime returns true when any expression bound in bindings, or in any of its namespaces,
+// requires time substitutions to be evaluated.
+func bindingsNeedTime(bindings map[string]interface{}) bool {
+	for _, value := range bindings {
+		switch v := value.(type) {
+		case *Expression:
+			if v.performTimeSubstitutions {
+				return true
+			}
+		case map[string]interface{}:
+			if bindingsNeedTime(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// inlineExpressionBindings returns a copy of tokens where each symbol bound to an Expression is
+// replaced by the stored program of that Expression, recursively. It returns an error when an
+// Expression is bound, directly or indirectly, within its own program.
+func inlineExpressionBindings(tokens []interface{}, bindings map[string]interface{}, visiting map[*Expression]bool) ([]interface{}, error) {
+	inlined := make([]interface{}, 0, len(tokens))
+	for _, tok := range tokens {
+		symbol, ok := tok.(string)
+		if !ok {
+			inlined = append(inlined, tok)
+			continue
+		}
+		exp, ok := bindings[symbol].(*Expression)
+		if !ok {
+			inlined = append(inlined, tok)
+			continue
+		}
+		if visiting[exp] {
+			return nil, newErrSyntax("cannot bind %q to an expression that refers to itself", symbol)
+		}
+		if roots, ok := buildForest(exp.tokens); ok && len(roots) != 1 {
+			return nil, newErrSyntax("cannot bind %q to an expression that does not produce a single value: %s", symbol, exp)
+		}
+		for _, tok := range exp.tokens {
+			if operator, ok := tok.(string); ok && wholeStackOperators[operator] {
+				// would also consume the items below the symbol it replaces
+				return nil, newErrSyntax("cannot bind %q to an expression using %s operator, which consumes the whole stack: %s", symbol, operator, exp)
 			}
 		}
+		visiting[exp] = true
+		nested, err := inlineExpressionBindings(exp.tokens, bindings, visiting)
+		delete(visiting, exp)
+		if err != nil {
+			return nil, err
+		}
+		inlined = append(inlined, nested...)
+	}
+	return inlined, nil
+}
+
+// isCount returns true when value may be used as a count of items, which must be positive, finite,
+// and, unless the LenientCounts configurator was given, an integer.
+func (e *Expression) isCount(value float64) bool {
+	if math.IsNaN(value) || math.IsInf(value, 0) || value <= 0 {
+		return false
+	}
+	return e.lenientCounts || value == math.Trunc(value)
+}
+
+// saturatingInt converts an operand used as a count or an offset to an int, clamping values too
+// large in magnitude to be meaningful rather than letting the conversion overflow.
+func saturatingInt(value float64) int {
+	if value > math.MaxInt32 {
+		return math.MaxInt32
+	}
+	if value < math.MinInt32 {
+		return math.MinInt32
+	}
+	return int(value)
+}
+
+// growScratch ensures the scratch and isFloat slices have room for depth items, along with room
+// for the remaining tokens of the program, doubling their size as needed so that repeatedly growing
+// the stack takes amortized linear time. It returns ErrLimitExceeded when depth exceeds the stack
+// limit, naming the operator at position.
+func (e *Expression) growScratch(depth int, remaining []interface{}, position int) error {
+	if depth > e.stackLimit {
+		return ErrLimitExceeded{Limit: e.stackLimit, Size: depth, Position: position}
+	}
+	rest := scratchSizeFor(remaining)
+	size := depth + rest
+	if size <= len(e.scratch) {
+		return nil
+	}
+	if doubled := 2 * len(e.scratch); doubled > size {
+		size = doubled
+		if most := e.stackLimit + rest; size > most {
+			size = most
+		}
+	}
+	scratch := make([]interface{}, size)
+	copy(scratch, e.scratch)
+	e.scratch = scratch
+	isFloat := make([]bool, size)
+	copy(isFloat, e.isFloat)
+	e.isFloat = isFloat
+	return nil
+}
+
+// scratchSizeFor returns how much work area a stored program needs.
+func scratchSizeFor(tokens []interface{}) int {
+	size := len(tokens)
+	for _, tok := range tokens {
+		if tok == "DUP" || tok == "OVER" || tok == "TUCK" {
+			size++
+		}
 	}
+	return size
+}
 
+func (c config) coerceMapValuesToFloat64(bindings map[string]interface{}) (map[string]interface{}, error) {
+	newBindings := make(map[string]interface{})
+	for key, value := range bindings {
+		if err := c.coerceBinding(newBindings, key, value); err != nil {
+			return nil, err
+		}
+	}
 	return newBindings, nil
 }
 
-func coerceValuesToFloat64(value interface{}) ([]float64, error) {
+// coerceBinding stores the coerced value of the binding for key in newBindings. A value that is a
+// map with string keys is a namespace: each of its bindings is stored under its own key prefixed by
+// key and a period, so that the symbol host1.qps refers to the qps binding of the host1 namespace.
+func (c config) coerceBinding(newBindings map[string]interface{}, key string, value interface{}) error {
+	var err error
+	if exp, ok := value.(*Expression); ok {
+		newBindings[key] = exp // inlined rather than coerced
+		return nil
+	}
+	if series, ok := value.(SeriesBinding); ok {
+		if series.Step <= 0 {
+			return newErrSyntax("cannot bind %q to series with step %v", key, series.Step)
+		}
+		if _, ok := newBindings[key]; ok {
+			return newErrSyntax("cannot bind %q more than once", key)
+		}
+		newBindings[key] = series // kept whole, so TREND and TRENDNAN know when its values were measured
+		return nil
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() { // Invalid for nil values
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return ErrBadBindingType{fmt.Sprintf("%q: %q", key, fmt.Sprintf("%T", value))}
+		}
+		iter := rv.MapRange()
+		for iter.Next() {
+			if err = c.coerceBinding(newBindings, key+"."+iter.Key().String(), iter.Value().Interface()); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Ptr, reflect.Func:
+		switch value.(type) {
+		case *float64, func() float64:
+		default:
+			return ErrBadBindingType{fmt.Sprintf("%q: %q", key, fmt.Sprintf("%T", value))}
+		}
+		if rv.IsNil() {
+			return newErrSyntax("cannot bind %q to nil %T", key, value)
+		}
+		// read each time the expression is evaluated rather than coerced now
+	case reflect.Slice:
+		value, err = c.coerceValuesToFloat64(value)
+	default:
+		value, err = c.coerceValueToFloat64(value)
+	}
+	if bad, ok := err.(ErrBadBindingType); ok {
+		return ErrBadBindingType{fmt.Sprintf("%q: %q", key, bad.t)}
+	}
+	if err != nil {
+		return err // a string or json.Number that is not a number
+	}
+	if _, ok := newBindings[key]; ok {
+		return newErrSyntax("cannot bind %q more than once", key)
+	}
+	newBindings[key] = value
+	return nil
+}
+
+// liveValue returns the current value of the binding of symbol to a *float64 or to a func() float64,
+// and false for any other binding.
+func liveValue(symbol string, value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case *float64:
+		return *v, true
+	case func() float64:
+		var f float64
+		callback(symbol, func() { f = v() })
+		return f, true
+	}
+	return 0, false
+}
+
+// resolveLiveBindings replaces each live value in the coerced bindings by its current value when
+// evaluating, and otherwise removes it, so that simplifying leaves its symbol open.
+func resolveLiveBindings(bindings map[string]interface{}, evaluating bool) {
+	for symbol, value := range bindings {
+		switch value.(type) {
+		case *float64, func() float64:
+			if evaluating {
+				bindings[symbol], _ = liveValue(symbol, value)
+			} else {
+				delete(bindings, symbol)
+			}
+		}
+	}
+}
+
+func (c config) coerceValuesToFloat64(value interface{}) ([]float64, error) {
 	var newList []float64
 
 	switch oldList := value.(type) {
@@ -1583,9 +3802,9 @@ func coerceValuesToFloat64(value interface{}) ([]float64, error) {
 	case []interface{}:
 		// slice of unknowns: need to coerce each one dynamically
 		for _, v := range oldList {
-			cf, err := coerceValueToFloat64(v)
+			cf, err := c.coerceValueToFloat64(v)
 			if err != nil {
-				return nil, ErrBadBindingType{fmt.Sprintf("%T", v)}
+				return nil, err
 			}
 			newList = append(newList, cf)
 		}
@@ -1601,6 +3820,37 @@ func coerceValuesToFloat64(value interface{}) ([]float64, error) {
 		for _, v := range oldList {
 			newList = append(newList, float64(v))
 		}
+	case []uint:
+		for _, v := range oldList {
+			newList = append(newList, float64(v))
+		}
+	case []uint32:
+		for _, v := range oldList {
+			newList = append(newList, float64(v))
+		}
+	case []uint64:
+		for _, v := range oldList {
+			newList = append(newList, float64(v))
+		}
+	case []json.Number:
+		for _, v := range oldList {
+			cf, err := c.coerceValueToFloat64(v)
+			if err != nil {
+				return nil, err
+			}
+			newList = append(newList, cf)
+		}
+	case []string:
+		if !c.numericStrings {
+			return nil, ErrBadBindingType{fmt.Sprintf("%T", oldList)}
+		}
+		for _, v := range oldList {
+			cf, err := c.coerceValueToFloat64(v)
+			if err != nil {
+				return nil, err
+			}
+			newList = append(newList, cf)
+		}
 	default:
 		return nil, ErrBadBindingType{fmt.Sprintf("%T", oldList)}
 	}
@@ -1608,10 +3858,17 @@ func coerceValuesToFloat64(value interface{}) ([]float64, error) {
 	return newList, nil
 }
 
-func coerceValueToFloat64(value interface{}) (float64, error) {
+// coerceValueToFloat64 converts a number to float64, a time.Time to seconds since the Unix epoch,
+// and a time.Duration to seconds, the units of TIME and of the time operators. A json.Number, or a
+// string when NumericStrings was given, is converted when it holds a number.
+func (c config) coerceValueToFloat64(value interface{}) (float64, error) {
 	switch v := value.(type) {
 	case float64:
 		return v, nil
+	case time.Time:
+		return float64(v.Unix()) + float64(v.Nanosecond())/1e9, nil
+	case time.Duration:
+		return v.Seconds(), nil
 	case float32:
 		return float64(v), nil
 	case int:
@@ -1620,11 +3877,87 @@ func coerceValueToFloat64(value interface{}) (float64, error) {
 		return float64(v), nil
 	case int32:
 		return float64(v), nil
+	case int16:
+		return float64(v), nil
+	case int8:
+		return float64(v), nil
+	case uint:
+		return float64(v), nil
+	case uint64:
+		return float64(v), nil
+	case uint32:
+		return float64(v), nil
+	case uint16:
+		return float64(v), nil
+	case uint8:
+		return float64(v), nil
+	case json.Number:
+		if f, ok := parseNumber(string(v)); ok {
+			return f, nil
+		}
+		return 0, newErrSyntax("cannot bind json.Number that is not a number: %q", string(v))
+	case string:
+		if !c.numericStrings {
+			return 0, ErrBadBindingType{fmt.Sprintf("%T", v)}
+		}
+		if f, ok := parseNumber(v); ok {
+			return f, nil
+		}
+		return 0, newErrSyntax("cannot bind string that is not a number: %q", v)
 	default:
 		return 0, ErrBadBindingType{fmt.Sprintf("%T", v)}
 	}
 }
 
+// compensatedSum accumulates a sum using Neumaier's improvement of Kahan summation, which tracks
+// the low order bits lost by each addition, so that summing the long windows of a series does not
+// lose precision.
+type compensatedSum struct {
+	sum, compensation float64
+}
+
+func (s *compensatedSum) add(value float64) {
+	t := s.sum + value
+	if math.IsInf(t, 0) || math.IsNaN(t) {
+		s.sum = t // nothing left to compensate
+		return
+	}
+	if math.Abs(s.sum) >= math.Abs(value) {
+		s.compensation += (s.sum - t) + value
+	} else {
+		s.compensation += (value - t) + s.sum
+	}
+	s.sum = t
+}
+
+func (s *compensatedSum) total() float64 {
+	if math.IsInf(s.sum, 0) || math.IsNaN(s.sum) {
+		return s.sum
+	}
+	return s.sum + s.compensation
+}
+
+// knownSeriesValues returns a copy of the numbers other than UNKN of the series bound to label,
+// which is the operand of the operator token, when label is bound, or false otherwise.
+func (e *Expression) knownSeriesValues(token, label string, bindings map[string]interface{}) ([]float64, bool, error) {
+	series, ok := bindings[label]
+	if !ok {
+		return nil, false, nil
+	}
+	s, ok := seriesValues(series)
+	if !ok {
+		return nil, false, newErrSyntax("%s operand specifies %q label, which is not a series of numbers: %T", token, label, series)
+	}
+	e.openBindings[label] = e.openBindings[label] - 1
+	items := make([]float64, 0, len(s))
+	for _, v := range s {
+		if !math.IsNaN(v) {
+			items = append(items, v)
+		}
+	}
+	return items, true, nil
+}
+
 func median(items []float64) float64 {
 	sort.Float64s(items)
 	middle := len(items) / 2
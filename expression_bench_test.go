@@ -0,0 +1,97 @@
+package gorpn_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/karrick/gorpn"
+	"github.com/karrick/gorpn/gorpntest"
+)
+
+// benchmarkShapes are representative expressions, along with the bindings needed to evaluate them,
+// and the most allocations evaluating each is expected to make.
+var benchmarkShapes = []struct {
+	name       string
+	expression string
+	bindings   map[string]interface{}
+	maxAllocs  float64
+}{
+	{
+		name:       "Arithmetic",
+		expression: "a,b,+,c,*,d,/,e,-,1000,*",
+		bindings:   map[string]interface{}{"a": 1, "b": 2, "c": 3, "d": 4, "e": 5},
+		maxAllocs:  24,
+	},
+	{
+		name:       "TREND",
+		expression: "a,600,TREND,b,900,TRENDNAN,+,c,1200,TREND,+",
+		bindings: map[string]interface{}{
+			"a": []float64{1, 2, 3, 4, 5, 6},
+			"b": []float64{1, 2, 3, 4, 5, 6},
+			"c": []float64{1, 2, 3, 4, 5, 6},
+		},
+		maxAllocs: 20,
+	},
+	{
+		name:       "COPY",
+		expression: "a,b,c,3,COPY,3,COPY,9,AVG",
+		bindings:   map[string]interface{}{"a": 1, "b": 2, "c": 3},
+		maxAllocs:  20,
+	},
+	{
+		name:       "IF",
+		expression: "a,0,GT,b,c,IF,d,0,LT,e,f,IF,+,a,d,EQ,b,f,IF,*",
+		bindings:   map[string]interface{}{"a": 1, "b": 2, "c": 3, "d": 4, "e": 5, "f": 6},
+		maxAllocs:  28,
+	},
+}
+
+func BenchmarkEvaluate(b *testing.B) {
+	for _, shape := range benchmarkShapes {
+		b.Run(shape.name, func(b *testing.B) {
+			gorpntest.Benchmark(b, shape.expression, shape.bindings)
+		})
+	}
+}
+
+func TestEvaluateAllocations(t *testing.T) {
+	for _, shape := range benchmarkShapes {
+		exp, err := gorpn.New(shape.expression)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", shape.name, err, nil)
+		}
+		if _, err = exp.Evaluate(shape.bindings); err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", shape.name, err, nil)
+		}
+		if actual := gorpntest.AllocsPerEvaluate(exp, shape.bindings, 100); actual > shape.maxAllocs {
+			t.Errorf("Case: %s; Actual: %v; Expected: <= %v", shape.name, actual, shape.maxAllocs)
+		}
+	}
+}
+
+func longMachineGeneratedExpression(count int) (string, map[string]interface{}) {
+	tokens := []string{"0"}
+	bindings := make(map[string]interface{})
+	for i := 0; i < count; i++ {
+		label := fmt.Sprintf("host%d", i)
+		bindings[label] = float64(i)
+		tokens = append(tokens, label, "1000", "*", "8", "/", "+")
+	}
+	return strings.Join(tokens, ","), bindings
+}
+
+func BenchmarkEvaluateLongExpression(b *testing.B) {
+	someExpression, bindings := longMachineGeneratedExpression(100)
+	exp, err := gorpn.New(someExpression)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err = exp.Evaluate(bindings); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
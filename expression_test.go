@@ -1,11 +1,18 @@
 package gorpn
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+	_ "time/tzdata" // time zones used by the tests of TimeZone need not be installed
 )
 
 func TestNewExpressionEmptyString(t *testing.T) {
@@ -129,52 +136,63 @@ func TestNewExpressionSimplifiesWhatItCan(t *testing.T) {
 		"2,UNKN,-": "UNKN",
 
 		// multiplication
-		"0,b,*":    "0",
-		"1,b,*":    "b",
-		"5,2,*":    "10",
-		"2,5,*":    "10",
-		"a,0,*":    "0",
-		"a,1,*":    "a",
-		"a,b,*":    "a,b,*",
-		"x,x,*":    "x,x,*",
-		"UNKN,2,*": "UNKN",
-		"2,UNKN,*": "UNKN",
+		"0,b,*":     "0",
+		"1,b,*":     "b",
+		"5,2,*":     "10",
+		"2,5,*":     "10",
+		"a,0,*":     "0",
+		"a,b,+,0,*": "a,b,+,0,*", // cannot discard only the operator
+		"a,1,*":     "a",
+		"a,b,*":     "a,b,*",
+		"x,x,*":     "x,x,*",
+		"UNKN,2,*":  "UNKN",
+		"2,UNKN,*":  "UNKN",
 
 		// division
-		"0,b,/":    "0",
-		"1,b,/":    "1,b,/",
-		"5,2,/":    "2.5",
-		"2,5,/":    "0.4",
-		"a,0,/":    "UNKN",
-		"a,1,/":    "a",
-		"a,b,/":    "a,b,/",
-		"x,x,/":    "x,x,/", // cannot simplify to 1 because x might be infinite
-		"UNKN,2,/": "UNKN",
-		"2,UNKN,/": "UNKN",
+		"0,b,/":     "0,b,/", // cannot simplify to 0 because b might be zero
+		"1,b,/":     "1,b,/",
+		"5,2,/":     "2.5",
+		"2,5,/":     "0.4",
+		"a,0,/":     "UNKN",
+		"a,b,+,0,/": "a,b,+,0,/",
+		"a,1,/":     "a",
+		"a,b,/":     "a,b,/",
+		"x,x,/":     "x,x,/", // cannot simplify to 1 because x might be infinite
+		"UNKN,2,/":  "UNKN",
+		"2,UNKN,/":  "UNKN",
 
 		// modulo
-		"0,b,%":    "0,b,%", // ???
-		"1,b,%":    "1,b,%",
-		"5,2,%":    "1",
-		"2,5,%":    "2",
-		"a,0,%":    "UNKN",
-		"a,1,%":    "0",
-		"a,b,%":    "a,b,%",
-		"x,x,%":    "x,x,%", // cannot simplify to 0 because x might be infinite
-		"UNKN,2,%": "UNKN",
-		"2,UNKN,%": "UNKN",
+		"0,b,%":     "0,b,%", // ???
+		"1,b,%":     "1,b,%",
+		"5,2,%":     "1",
+		"2,5,%":     "2",
+		"a,0,%":     "UNKN",
+		"a,1,%":     "0",
+		"a,b,+,1,%": "a,b,+,1,%",
+		"a,b,%":     "a,b,%",
+		"x,x,%":     "x,x,%", // cannot simplify to 0 because x might be infinite
+		"UNKN,2,%":  "UNKN",
+		"2,UNKN,%":  "UNKN",
 
 		// exponentiation (power)
-		"0,b,POW":    "0", // https://www.quora.com/What-is-infinity-to-the-power-zero-1
-		"1,b,POW":    "1",
-		"5,2,POW":    "25",
-		"2,5,POW":    "32",
-		"a,0,POW":    "1",
-		"a,1,POW":    "a",
-		"a,b,POW":    "a,b,POW",
-		"x,x,POW":    "x,x,POW",
-		"UNKN,2,POW": "UNKN",
-		"2,UNKN,POW": "UNKN",
+		"0,b,POW":     "0", // https://www.quora.com/What-is-infinity-to-the-power-zero-1
+		"1,b,POW":     "1",
+		"5,2,POW":     "25",
+		"2,5,POW":     "32",
+		"a,0,POW":     "1",
+		"a,b,+,0,POW": "a,b,+,0,POW",
+		"a,1,POW":     "a",
+		"a,b,POW":     "a,b,POW",
+		"x,x,POW":     "x,x,POW",
+		"UNKN,2,POW":  "UNKN",
+		"2,UNKN,POW":  "UNKN",
+
+		// operand computed by an operator
+		"x,1,+,0,+": "x,1,+",
+		"x,1,+,1,*": "x,1,+",
+		"0,x,1,+,+": "0,x,1,+,+",
+		"1,x,2,+,*": "1,x,2,+,*",
+		"0,0,x,*,+": "0",
 	}
 	for input, output := range list {
 		exp, err := New(input)
@@ -321,6 +339,123 @@ func TestNewExpressionSTDEV(t *testing.T) {
 	}
 }
 
+func TestNewExpressionStrictAggregates(t *testing.T) {
+	list := map[string]map[string]string{
+		"42,UNKN,13,3,AVG":      {"default": "27.5", "strict": "UNKN"},
+		"42,UNKN,13,3,AVGNAN":   {"default": "27.5", "strict": "27.5"},
+		"13,UNKN,42,3,STDEV":    {"default": "14.5", "strict": "UNKN"},
+		"13,UNKN,42,3,STDEVNAN": {"default": "14.5", "strict": "14.5"},
+		"13,UNKN,42,3,SSTDEV":   {"default": "20.506096654409877", "strict": "20.506096654409877"},
+		"UNKN,UNKN,2,AVGNAN":    {"default": "UNKN", "strict": "UNKN"},
+		"a,b,c,3,AVGNAN":        {"default": "a,b,c,3,AVGNAN", "strict": "a,b,c,3,AVGNAN"},
+	}
+	for input, outputs := range list {
+		for mode, output := range outputs {
+			var setters []ExpressionConfigurator
+			if mode == "strict" {
+				setters = append(setters, StrictAggregates())
+			}
+			exp, err := New(input, setters...)
+			if err != nil {
+				t.Fatalf("Case: %s %s; Actual: %#v; Expected: %#v", input, mode, err, nil)
+			}
+			if exp.String() != output {
+				t.Errorf("Case: %s %s; Actual: %#v; Expected: %#v", input, mode, exp.String(), output)
+			}
+		}
+	}
+
+	exp, err := New("a,b,c,3,AVG", StrictAggregates())
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := exp.Evaluate(map[string]interface{}{"a": 1, "b": math.NaN(), "c": 3})
+	if err != nil || !math.IsNaN(value) {
+		t.Errorf("Actual: %#v, %#v; Expected: %#v", value, err, math.NaN())
+	}
+}
+
+func TestNewExpressionVariance(t *testing.T) {
+	errors := map[string]string{
+		"1,2,3,0,SSTDEV": "syntax error : SSTDEV operator requires positive finite integer: 0",
+		"1,2,3,4,SVAR":   "syntax error : SVAR operand requires 4 items, but only 3 on stack",
+		"1,2,3,INF,VAR":  "syntax error : VAR operator requires positive finite integer: +Inf",
+	}
+	for i, e := range errors {
+		if _, err := New(i); err == nil || err.Error() != e {
+			t.Errorf("Case: %s; Actual: %s; Expected: %#v", i, err, e)
+		}
+	}
+	list := map[string]string{
+		"a,b,c,3,SSTDEV":          "a,b,c,3,SSTDEV", // cannot average variables
+		"2,4,4,4,5,5,7,9,8,STDEV": "2",
+		"2,4,4,4,5,5,7,9,8,VAR":   "4",
+		"2,4,4,4,5,5,7,9,8,SVAR":  "4.571428571428571",
+		"1,3,2,SSTDEV":            "1.4142135623730951",
+		"1,3,UNKN,3,SVAR":         "2", // ignoring UNKN
+		"42,1,SSTDEV":             "UNKN",
+		"42,1,STDEV":              "0",
+		"UNKN,UNKN,2,VAR":         "UNKN",
+	}
+	for input, output := range list {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if exp.String() != output {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, exp.String(), output)
+		}
+	}
+}
+
+func TestNewExpressionNLARGEST(t *testing.T) {
+	errors := map[string]string{
+		"1,2,3,0,3,NLARGEST":    "syntax error : NLARGEST operator requires positive finite integer: 0",
+		"1,2,3,1,0,NSMALLEST":   "syntax error : NSMALLEST operator requires positive finite integer: 0",
+		"1,2,3,1,4,NLARGEST":    "syntax error : NLARGEST operand requires 4 items, but only 3 on stack",
+		"1,2,3,3,2,NSMALLEST":   "syntax error : NSMALLEST operand keeps 3 items, but only examines 2",
+		"1,2,3,UNKN,3,NLARGEST": "syntax error : NLARGEST operator requires positive finite integer: NaN",
+	}
+	for i, e := range errors {
+		if _, err := New(i); err == nil || err.Error() != e {
+			t.Errorf("Case: %s; Actual: %s; Expected: %#v", i, err, e)
+		}
+	}
+	list := map[string]string{
+		"3,1,4,1,5,2,5,NLARGEST":       "4,5",
+		"3,1,4,1,5,2,5,NSMALLEST":      "1,1",
+		"3,1,4,1,5,3,4,NLARGEST":       "3,1,4,5", // keeps bottom of stack
+		"3,1,4,1,5,9,2,6,3,5,NLARGEST": "3,1,4,5,9,6",
+		"5,5,5,2,3,NLARGEST":           "5,5",
+		"UNKN,1,2,2,3,NLARGEST":        "1,2",
+		"UNKN,1,UNKN,2,3,NSMALLEST":    "UNKN,1",
+		"3,1,4,3,3,NLARGEST,3,AVG":     "2.6666666666666665",
+		"a,b,c,2,3,NLARGEST":           "a,b,c,2,3,NLARGEST", // cannot rank variables
+		"a,b,c,k,3,NSMALLEST":          "a,b,c,k,3,NSMALLEST",
+	}
+	for input, output := range list {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if exp.String() != output {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, exp.String(), output)
+		}
+	}
+
+	exp, err := New("web1,web2,web3,web4,3,4,NLARGEST,3,AVG")
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := exp.Evaluate(map[string]interface{}{"web1": 10, "web2": 40, "web3": 20, "web4": 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := 30.0; value != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", value, expected)
+	}
+}
+
 func TestNewExpressionSMIN(t *testing.T) {
 	errors := map[string]string{
 		"1,2,3,-1,SMIN":     "syntax error : SMIN operator requires positive finite integer: -1",
@@ -413,6 +548,7 @@ func TestNewExpressionCOPY(t *testing.T) {
 		"1,2,3,4,COPY":      "syntax error : COPY operand requires 4 items, but only 3 on stack",
 		"1,2,3,INF,COPY":    "syntax error : COPY operator requires positive finite integer: +Inf",
 		"1,2,3,NEGINF,COPY": "syntax error : COPY operator requires positive finite integer: -Inf",
+		"1,2,3,1e300,COPY":  "syntax error : COPY operand requires 2147483647 items, but only 3 on stack",
 	}
 	for i, e := range errors {
 		if _, err := New(i); err == nil || err.Error() != e {
@@ -435,6 +571,68 @@ func TestNewExpressionCOPY(t *testing.T) {
 	}
 }
 
+func TestStackLimit(t *testing.T) {
+	// each DEPTH,COPY doubles the stack
+	_, err := New("1,DUP"+strings.Repeat(",DEPTH,COPY", 25), StackLimit(1000))
+	var limitError ErrLimitExceeded
+	if !errors.As(err, &limitError) || limitError.Limit != 1000 || limitError.Size != 1024 || limitError.Position != 19 {
+		t.Errorf("Actual: %#v; Expected: %#v", err, ErrLimitExceeded{Limit: 1000, Size: 1024, Position: 19})
+	}
+
+	list := map[string]string{
+		"a,b,c,d,e,f,6,COPY":                  "stack limit of 10 exceeded at token 7: 12 items",
+		"1,1000,2,1,HIST":                     "stack limit of 10 exceeded at token 4: 1001 items",
+		"a,DUP,DUP,DUP,DEPTH,COPY,DEPTH,COPY": "stack limit of 10 exceeded at token 7: 16 items",
+	}
+	for input, expected := range list {
+		if _, err := New(input, StackLimit(10)); err == nil || err.Error() != expected {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, err, expected)
+		}
+	}
+	if _, err := New("a,b,c,d,e,5,COPY", StackLimit(10)); err != nil {
+		t.Errorf("Actual: %#v; Expected: %#v", err, nil)
+	}
+	if _, err := New("a", StackLimit(0)); err == nil || err.Error() != "syntax error : stack limit requires positive integer: 0" {
+		t.Errorf("Actual: %#v; Expected: %#v", err, "syntax error : stack limit requires positive integer: 0")
+	}
+
+	// counts not known until evaluation are limited by Evaluate
+	exp, err := New("a,DUP,DUP,DUP,DUP,n,COPY,ALLMAX", StackLimit(9))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = exp.Evaluate(map[string]interface{}{"a": 1, "n": 4}); err != nil {
+		t.Errorf("Actual: %#v; Expected: %#v", err, nil)
+	}
+	_, err = exp.Evaluate(map[string]interface{}{"a": 1, "n": 5})
+	if expected := "stack limit of 9 exceeded at token 6: 10 items"; err == nil || err.Error() != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", err, expected)
+	}
+}
+
+func TestGrowScratch(t *testing.T) {
+	e := &Expression{config: newConfig()}
+	e.stackLimit = 20
+	e.scratch, e.isFloat = make([]interface{}, 4), make([]bool, 4)
+	e.scratch[3], e.isFloat[3] = 42.0, true
+
+	// sizes double, so that repeatedly growing the stack takes amortized linear time
+	for _, item := range []struct{ depth, size int }{{3, 4}, {5, 8}, {9, 16}, {17, 21}, {20, 21}} {
+		if err := e.growScratch(item.depth, []interface{}{"+"}, 0); err != nil {
+			t.Fatalf("Case: %d; Actual: %#v; Expected: %#v", item.depth, err, nil)
+		}
+		if len(e.scratch) != item.size || len(e.isFloat) != item.size {
+			t.Errorf("Case: %d; Actual: %#v; Expected: %#v", item.depth, len(e.scratch), item.size)
+		}
+	}
+	if e.scratch[3] != 42.0 || !e.isFloat[3] {
+		t.Errorf("Actual: %#v; Expected: %#v", e.scratch[3], 42.0)
+	}
+	if err := e.growScratch(21, nil, 3); err != (ErrLimitExceeded{Limit: 20, Size: 21, Position: 3}) {
+		t.Errorf("Actual: %#v; Expected: %#v", err, ErrLimitExceeded{Limit: 20, Size: 21, Position: 3})
+	}
+}
+
 // COUNT
 
 func TestEvaluateCOUNTWithoutCOUNT(t *testing.T) {
@@ -466,8 +664,34 @@ func TestEvaluateCOUNTWithTime(t *testing.T) {
 
 func TestNewExpressionDEPTH(t *testing.T) {
 	list := map[string]string{
-		"DEPTH":     "0",
-		"a,b,DEPTH": "a,b,2",
+		"DEPTH":         "0",
+		"a,b,DEPTH":     "a,b,2",
+		"a,b,+,DEPTH":   "a,b,+,DEPTH",
+		"a,b,DEPTH,+,+": "a,b,2,+,+",
+	}
+	for input, output := range list {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if exp.String() != output {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, exp.String(), output)
+		}
+	}
+}
+
+func TestNewExpressionWholeStack(t *testing.T) {
+	list := map[string]string{
+		"1,5,3,ALLMAX":       "5",
+		"1,5,3,ALLMIN":       "1",
+		"1,5,3,ALLAVG":       "3",
+		"1,UNKN,3,ALLAVG":    "2",
+		"a,ALLMAX":           "a",
+		"a,b,+,ALLMIN":       "a,b,+,ALLMIN",
+		"a,5,3,ALLMAX":       "a,5,3,ALLMAX",
+		"a,b,+,c,ALLAVG":     "a,b,+,c,ALLAVG",
+		"a,b,ALLMAX,1,*":     "a,b,ALLMAX",
+		"2,3,*,4,ALLMAX,a,+": "6,a,+",
 	}
 	for input, output := range list {
 		exp, err := New(input)
@@ -478,6 +702,51 @@ func TestNewExpressionDEPTH(t *testing.T) {
 			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, exp.String(), output)
 		}
 	}
+
+	bindings := map[string]interface{}{"a": 4, "b": 9, "c": 2}
+	values := map[string]float64{
+		"a,b,c,ALLMAX":     9,
+		"a,b,c,ALLMIN":     2,
+		"a,b,c,ALLAVG":     5,
+		"a,b,+,c,ALLMAX":   13,
+		"a,b,-,c,ALLMIN":   -5,
+		"a,b,ALLAVG,c,MAX": 6.5,
+	}
+	for input, expected := range values {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if actual, err := exp.Evaluate(bindings); err != nil || actual != expected {
+			t.Errorf("Case: %s; Actual: %#v, %#v; Expected: %#v", input, actual, err, expected)
+		}
+	}
+
+	exp, err := New("a,b,c,ALLAVG", StrictAggregates())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual, err := exp.Evaluate(map[string]interface{}{"a": 1, "b": math.NaN(), "c": 3}); err != nil || !math.IsNaN(actual) {
+		t.Errorf("Actual: %#v, %#v; Expected: %#v", actual, err, math.NaN())
+	}
+
+	if _, err = New("ALLMAX"); !errors.Is(err, ErrStackUnderflow) {
+		t.Errorf("Actual: %#v; Expected: %#v", err, ErrStackUnderflow)
+	}
+
+	// an expression consuming the whole stack would also consume the items below where it is bound
+	outer, err := New("x,y,+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner, err := New("a,b,ALLMAX")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = outer.Partial(map[string]interface{}{"y": inner})
+	if expected := "syntax error : cannot bind \"y\" to an expression using ALLMAX operator, which consumes the whole stack: a,b,ALLMAX"; err == nil || err.Error() != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", err, expected)
+	}
 }
 
 func TestNewExpressionDUP(t *testing.T) {
@@ -549,6 +818,74 @@ func TestNewExpressionEXC(t *testing.T) {
 	}
 }
 
+func TestNewExpressionStackWords(t *testing.T) {
+	errors := map[string]string{
+		"1,NIP":   "syntax error : not enough parameters: operator NIP requires 2 operands",
+		"1,OVER":  "syntax error : not enough parameters: operator OVER requires 2 operands",
+		"1,2,ROT": "syntax error : not enough parameters: operator ROT requires 3 operands",
+		"SWAP":    "syntax error : not enough parameters: operator SWAP requires 2 operands",
+		"1,TUCK":  "syntax error : not enough parameters: operator TUCK requires 2 operands",
+	}
+	for i, e := range errors {
+		if _, err := New(i); err == nil || err.Error() != e {
+			t.Errorf("Case: %s; Actual: %s; Expected: %#v", i, err, e)
+		}
+	}
+	list := map[string]string{
+		"13,42,SWAP":        "42,13",
+		"13,42,OVER":        "13,42,13",
+		"13,42,NIP":         "42",
+		"1,2,3,ROT":         "2,3,1",
+		"13,42,TUCK":        "42,13,42",
+		"a,b,SWAP,-":        "b,a,-",
+		"a,b,NIP,2,*":       "b,2,*",
+		"a,b,c,ROT,-,-":     "b,c,a,-,-",
+		"a,b,+,c,SWAP,-":    "a,b,+,c,SWAP,-", // cannot rearrange result of operator
+		"a,b,+,c,ROT":       "a,b,+,c,ROT",
+		"a,b,OVER,OVER,*,*": "a,b,a,b,*,*",
+	}
+	for input, output := range list {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if exp.String() != output {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, exp.String(), output)
+		}
+	}
+
+	// each word leaves the stack just as the sequence of operators it abbreviates does
+	equivalents := map[string]string{
+		"SWAP": "EXC",
+		"OVER": "2,INDEX",
+		"NIP":  "EXC,POP",
+		"ROT":  "3,-1,ROLL",
+		"TUCK": "DUP,3,1,ROLL",
+	}
+	for word, sequence := range equivalents {
+		for _, prefix := range []string{"a,b,c,d,+,", "a,b,c,+,d,"} {
+			bindings := map[string]interface{}{"a": 2, "b": 3, "c": 5, "d": 7}
+			exp, err := New(prefix + word)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if exp, err = exp.Partial(bindings); err != nil {
+				t.Fatal(err)
+			}
+			other, err := New(prefix + sequence)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if other, err = other.Partial(bindings); err != nil {
+				t.Fatal(err)
+			}
+			if actual, expected := exp.String(), other.String(); actual != expected {
+				t.Errorf("Case: %s; Actual: %#v; Expected: %#v", prefix+word, actual, expected)
+			}
+		}
+	}
+}
+
 func TestNewExpressionFLOOR(t *testing.T) {
 	list := map[string]string{
 		"-0.5,FLOOR":   "-1",
@@ -680,9 +1017,9 @@ func TestNewExpressionIF(t *testing.T) {
 		"1,1,EQ,ab,bc,IF": "ab",
 		"qps,1,0,IF":      "qps,1,0,IF", // when predicate is a variable
 		"1,2,+,4,5,IF":    "4",
-		"1,a,3,+,5,IF":    "1,a,3,+,5,IF",
+		"1,a,3,+,5,IF":    "a,3,+", // untaken branch eliminated
 		"7,2,4,+,5,IF":    "6",
-		"7,a,4,+,5,IF":    "7,a,4,+,5,IF",
+		"7,a,4,+,5,IF":    "a,4,+",
 		"a,7,+,3,5,IF":    "a,7,+,3,5,IF",
 	}
 	for input, output := range list {
@@ -1030,7 +1367,8 @@ func TestNewExpressionNOWNeverSimplified(t *testing.T) {
 
 func TestNewExpressionPOP(t *testing.T) {
 	errors := map[string]string{
-		"POP": "syntax error : not enough parameters: operator POP requires 1 operands",
+		"POP":    "syntax error : not enough parameters: operator POP requires 1 operands",
+		"13,POP": "syntax error : expression leaves no value on the stack",
 	}
 	for i, e := range errors {
 		if _, err := New(i); err == nil || err.Error() != e {
@@ -1038,7 +1376,9 @@ func TestNewExpressionPOP(t *testing.T) {
 		}
 	}
 	list := map[string]string{
-		"13,42,POP": "13",
+		"13,42,POP":   "13",
+		"a,b,+,c,POP": "a,b,+",
+		"a,b,+,POP":   "a,b,+,POP", // pops the sum, not just the operator
 	}
 	for input, output := range list {
 		exp, err := New(input)
@@ -1081,11 +1421,9 @@ func TestNewExpressionREV(t *testing.T) {
 }
 
 func TestNewExpressionROLL(t *testing.T) {
-	// ??? unknown cases ???
-	// "4,3,2.5,1,ROLL": "syntax error : ",
-	// "4,3,2,1.5,ROLL": "syntax error : ",
-
 	errors := map[string]string{
+		"4,3,2.5,1,ROLL":    "syntax error : ROLL operator requires positive finite integer: 2.5",
+		"4,3,2,1.5,ROLL":    "syntax error : ROLL operator requires positive finite integer: 1.5",
 		"1,2,0,3,ROLL":      "syntax error : ROLL operator requires positive finite integer: 0",
 		"1,2,3,4,ROLL":      "syntax error : ROLL operand requires 4 items, but only 3 on stack",
 		"1,2,3,INF,ROLL":    "syntax error : ROLL operator requires positive finite integer: +Inf",
@@ -1119,6 +1457,45 @@ func TestNewExpressionROLL(t *testing.T) {
 	}
 }
 
+func TestNewExpressionNonIntegerCounts(t *testing.T) {
+	errors := map[string]string{
+		"a,b,c,2.7,COPY":         "syntax error : COPY operator requires positive finite integer: 2.7",
+		"a,b,c,1.5,INDEX":        "syntax error : INDEX operator requires positive finite integer: 1.5",
+		"a,b,c,2.5,REV":          "syntax error : REV operator requires positive finite integer: 2.5",
+		"1,2,3,2.9,SORT":         "syntax error : SORT operator requires positive finite integer: 2.9",
+		"1,2,3,2.5,AVG":          "syntax error : AVG operator requires positive finite integer: 2.5",
+		"1,2,3,0.5,SMAX":         "syntax error : SMAX operator requires positive finite integer: 0.5",
+		"1,2,3,1.5,3,NLARGEST":   "syntax error : NLARGEST operator requires positive finite integer: 1.5",
+		"1,2,3,95.5,2.5,PERCENT": "syntax error : PERCENT operator requires positive finite integer: 2.5",
+	}
+	for i, e := range errors {
+		if _, err := New(i); err == nil || err.Error() != e {
+			t.Errorf("Case: %s; Actual: %s; Expected: %#v", i, err, e)
+		}
+	}
+
+	// counts that are integers written with a fraction are fine
+	if _, err := New("a,b,c,2.0,COPY"); err != nil {
+		t.Errorf("Actual: %#v; Expected: %#v", err, nil)
+	}
+
+	list := map[string]string{
+		"a,b,c,2.7,COPY":  "a,b,c,b,c",
+		"a,b,c,1.5,INDEX": "a,b,c,c",
+		"1,2,3,2.9,SORT":  "1,2,3",
+		"4,3,2,1.5,ROLL":  "3,4",
+	}
+	for input, output := range list {
+		exp, err := New(input, LenientCounts())
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if actual := exp.String(); actual != output {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, actual, output)
+		}
+	}
+}
+
 func TestNewExpressionPERCENT(t *testing.T) {
 	errors := map[string]string{
 		"0,1,2,0,3,PERCENT":       "syntax error : PERCENT operator requires positive finite integer: 0",
@@ -1127,6 +1504,9 @@ func TestNewExpressionPERCENT(t *testing.T) {
 		"1,2,3,95,NEGINF,PERCENT": "syntax error : PERCENT operator requires positive finite integer: -Inf",
 		"1,2,3,INF,3,PERCENT":     "syntax error : PERCENT operator requires positive finite integer: +Inf",
 		"1,2,3,NEGINF,3,PERCENT":  "syntax error : PERCENT operator requires positive finite integer: -Inf",
+		"1,2,3,95,0,PERCENT":      "syntax error : PERCENT operator requires positive finite integer: 0",
+		"1,2,3,95,-1,PERCENT":     "syntax error : PERCENT operator requires positive finite integer: -1",
+		"1,2,3,101,3,PERCENT":     "syntax error : PERCENT operator requires percentile no greater than 100: 101",
 	}
 	for i, e := range errors {
 		if _, err := New(i); err == nil || err.Error() != e {
@@ -1340,8 +1720,8 @@ func TestEvaluateWithoutBindings(t *testing.T) {
 
 	value, err := exp.Evaluate(bindings)
 	if _, ok := err.(ErrOpenBindings); err == nil || !ok {
-		want := []string{"a", "b", "c", "d"}
-		t.Errorf("Actual: %#v; Expected: %#v", err, ErrOpenBindings(want))
+		want := ErrOpenBindings{"a": ScalarKind, "b": ScalarKind, "c": ScalarKind, "d": ScalarKind}
+		t.Errorf("Actual: %#v; Expected: %#v", err, want)
 	}
 	if want := float64(0); value != want {
 		t.Errorf("Actual: %#v; Expected: %#v", value, want)
@@ -1364,112 +1744,369 @@ func TestPartialIgnoresNOWInBindings(t *testing.T) {
 	}
 }
 
-func TestEvaluateTREND(t *testing.T) {
-	exp, err := New("sam,10,TREND", SecondsPerInterval(1))
+func TestUnbind(t *testing.T) {
+	exp, err := New("foo,1000,*,bar,3,+,/")
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	bindings := map[string]interface{}{
-		"sam": []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, math.NaN()},
-	}
-	value, err := exp.Evaluate(bindings)
+	specialized, err := exp.Partial(map[string]interface{}{"foo": 2, "bar": 13})
 	if err != nil {
-		t.Errorf("Actual: %s; Expected: %#v", err, nil)
+		t.Fatal(err)
 	}
-	if !math.IsNaN(value) {
-		t.Errorf("Actual: %#v; Expected: %#v", value, math.NaN())
+	foo, err := exp.Partial(map[string]interface{}{"foo": 2})
+	if err != nil {
+		t.Fatal(err)
 	}
-}
-
-func TestEvaluateTRENDNotEnoughValues(t *testing.T) {
-	exp, err := New("sam,10,TREND", SecondsPerInterval(1))
+	chained, err := foo.Partial(map[string]interface{}{"bar": 13})
 	if err != nil {
-		t.Errorf("Actual: %s; Expected: %#v", err, nil)
+		t.Fatal(err)
 	}
-	bindings := map[string]interface{}{
-		"sam": []interface{}{1, 2},
+	if chained, err = chained.Partial(nil); err != nil {
+		t.Fatal(err)
 	}
-	_, err = exp.Evaluate(bindings)
-	if err == nil || err.Error() != "syntax error : TREND operand specifies 10 values, but only 2 available" {
-		t.Errorf("Actual: %s; Expected: %#v", err, nil)
+
+	list := []struct {
+		exp      *Expression
+		symbols  []string
+		expected string
+	}{
+		{specialized, []string{"bar"}, "2000,bar,3,+,/"},
+		{specialized, []string{"foo"}, "foo,1000,*,16,/"},
+		{specialized, []string{"foo", "bar"}, "foo,1000,*,bar,3,+,/"},
+		{specialized, []string{"baz"}, "125"},
+		{specialized, nil, "125"},
+		{chained, []string{"foo"}, "foo,1000,*,16,/"},
+		{chained, []string{"bar"}, "2000,bar,3,+,/"},
+		{exp, []string{"foo"}, "foo,1000,*,bar,3,+,/"},
+	}
+	for _, item := range list {
+		actual, err := item.exp.Unbind(item.symbols...)
+		if err != nil {
+			t.Errorf("Case: %v; Actual: %#v; Expected: %#v", item.symbols, err, nil)
+			continue
+		}
+		if actual.String() != item.expected {
+			t.Errorf("Case: %v; Actual: %#v; Expected: %#v", item.symbols, actual.String(), item.expected)
+		}
+	}
+
+	// the Expression remains unchanged
+	if specialized.String() != "125" {
+		t.Errorf("Actual: %#v; Expected: %#v", specialized.String(), "125")
 	}
 }
 
-func TestEvaluateTRENDNotBoundToFloatSlice(t *testing.T) {
-	exp, err := New("sam,10,TREND", SecondsPerInterval(1))
+func TestPartialRetainsOnlyUsedBindings(t *testing.T) {
+	exp, err := New("qps,600,TREND,limit,GT")
 	if err != nil {
-		t.Errorf("Actual: %s; Expected: %#v", err, nil)
+		t.Fatal(err)
 	}
-	bindings := map[string]interface{}{
-		"sam": 134,
+	history := make([]float64, 1000)
+	specialized, err := exp.Partial(map[string]interface{}{"qps": []float64{1, 2, 3}, "history": history, "other": 1})
+	if err != nil {
+		t.Fatal(err)
 	}
-	_, err = exp.Evaluate(bindings)
-	if err == nil || err.Error() != "syntax error : TREND operator requires label but found float64: 134" {
-		t.Errorf("Actual: %s; Expected: %#v", err, nil)
+	if actual, expected := len(specialized.partialBindings), 1; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", specialized.partialBindings, expected)
+	}
+	if _, ok := specialized.partialBindings["qps"]; !ok {
+		t.Errorf("Actual: %#v; Expected: %#v", specialized.partialBindings, "qps")
 	}
 }
 
-func TestEvaluateTRENDNAN(t *testing.T) {
-	exp, err := New("sam,10,TRENDNAN", SecondsPerInterval(1))
+func TestUnbindNamespace(t *testing.T) {
+	exp, err := New("web.rx,web.tx,+,db.rx,-")
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	bindings := map[string]interface{}{
-		"sam": []float64{1, 2, math.NaN(), 4, 5, math.NaN(), 7, 8, 9, 10},
+	specialized, err := exp.Partial(map[string]interface{}{
+		"web": map[string]interface{}{"rx": 1, "tx": 2},
+		"db":  map[string]interface{}{"rx": 4},
+	})
+	if err != nil {
+		t.Fatal(err)
 	}
-	value, err := exp.Evaluate(bindings)
+	if expected := "-1"; specialized.String() != expected {
+		t.Fatalf("Actual: %#v; Expected: %#v", specialized.String(), expected)
+	}
+	actual, err := specialized.Unbind("db")
 	if err != nil {
-		t.Errorf("Actual: %s; Expected: %#v", err, nil)
+		t.Fatal(err)
 	}
-	if value != 5.75 {
-		t.Errorf("Actual: %#v; Expected: %#v", value, 5.75)
+	if expected := "3,db.rx,-"; actual.String() != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual.String(), expected)
 	}
 }
 
-func TestEvaluateTRENDNANNotEnoughValues(t *testing.T) {
-	exp, err := New("sam,10,TRENDNAN", SecondsPerInterval(1))
+func TestClone(t *testing.T) {
+	exp, err := New("foo,1000,*,bar,3,+,/")
 	if err != nil {
-		t.Errorf("Actual: %s; Expected: %#v", err, nil)
+		t.Fatal(err)
 	}
-	bindings := map[string]interface{}{
-		"sam": []interface{}{1, 2},
+	specialized, err := exp.Partial(map[string]interface{}{"foo": 2})
+	if err != nil {
+		t.Fatal(err)
 	}
-	_, err = exp.Evaluate(bindings)
-	if err == nil || err.Error() != "syntax error : TRENDNAN operand specifies 10 values, but only 2 available" {
-		t.Errorf("Actual: %s; Expected: %#v", err, nil)
+	clone := specialized.Clone()
+	if actual, expected := clone.String(), specialized.String(); actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
 	}
-}
-
-func TestEvaluateTRENDNANNotBoundToFloatSlice(t *testing.T) {
-	exp, err := New("sam,10,TRENDNAN", SecondsPerInterval(1))
+	unbound, err := clone.Unbind("foo")
 	if err != nil {
-		t.Errorf("Actual: %s; Expected: %#v", err, nil)
+		t.Fatal(err)
 	}
-	bindings := map[string]interface{}{
-		"sam": 134,
+	if actual, expected := unbound.String(), "foo,1000,*,bar,3,+,/"; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
 	}
-	_, err = exp.Evaluate(bindings)
-	if err == nil || err.Error() != "syntax error : TRENDNAN operator requires label but found float64: 134" {
-		t.Errorf("Actual: %s; Expected: %#v", err, nil)
+
+	// each goroutine evaluates its own copy
+	var wg sync.WaitGroup
+	results := make([]float64, 8)
+	errs := make([]error, len(results))
+	for i := range results {
+		wg.Add(1)
+		go func(i int, exp *Expression) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				results[i], errs[i] = exp.Evaluate(map[string]interface{}{"bar": float64(i)})
+			}
+		}(i, specialized.Clone())
+	}
+	wg.Wait()
+	for i, result := range results {
+		if expected := 2000 / float64(i+3); result != expected || errs[i] != nil {
+			t.Errorf("Case: %d; Actual: %#v, %#v; Expected: %#v", i, result, errs[i], expected)
+		}
 	}
 }
 
-// evaluate is able to coerce slices of any number type to slices of float64 values
-
-func TestEvaluateTRENDNANSliceOfEmptyInterface(t *testing.T) {
-	exp, err := New("sam,10,TRENDNAN", SecondsPerInterval(1))
+func TestCloneRestartsRandomSeed(t *testing.T) {
+	exp, err := New("RANDOM", RandomSeed(42))
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	bindings := map[string]interface{}{
-		"sam": []interface{}{1, 2, math.NaN(), 4, 5, math.NaN(), 7, 8, 9, 10},
+	first, err := exp.Evaluate(nil)
+	if err != nil {
+		t.Fatal(err)
 	}
-	value, err := exp.Evaluate(bindings)
+	clone := exp.Clone()
+	second, err := exp.Evaluate(nil)
 	if err != nil {
-		t.Errorf("Actual: %s; Expected: %#v", err, nil)
+		t.Fatal(err)
+	}
+	actual, err := clone.Evaluate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual != first || actual == second {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, first)
+	}
+}
+
+func TestBoundValues(t *testing.T) {
+	exp, err := New("latency,threshold,GT,errors,limit,GT,+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual := exp.BoundValues(); actual != nil {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, nil)
+	}
+
+	first, err := exp.Partial(map[string]interface{}{"threshold": 250, "unused": 1, "latency": []float64{1, 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual, expected := first.BoundValues(), map[string]float64{"threshold": 250}; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+
+	// values bound by earlier calls to Partial are retained
+	double, err := New("base,2,*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var live float64
+	second, err := first.Partial(map[string]interface{}{"limit": double, "base": 5, "errors": &live, "TIME": 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual, expected := second.BoundValues(), map[string]float64{"threshold": 250, "base": 5}; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+
+	// as are namespaces, by the symbols that refer to them
+	exp, err = New("db.rx,db.tx,+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	third, err := exp.Partial(map[string]interface{}{"db": map[string]interface{}{"rx": 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual, expected := third.BoundValues(), map[string]float64{"db.rx": 3}; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+
+	// unbinding a symbol forgets its value
+	whatIf, err := second.Unbind("threshold")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual, expected := whatIf.BoundValues(), map[string]float64{"base": 5}; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+}
+
+func TestSummationAccuracy(t *testing.T) {
+	list := map[string]float64{
+		"1e100,1,-1e100,3,AVG":                                     1.0 / 3,
+		"1e16,1,1,1,1,5,AVG":                                       (1e16 + 4) / 5,
+		"1000000004,1000000007,1000000013,1000000016,4,VAR":        22.5,
+		"1000000004,1000000007,1000000013,1000000016,4,SVAR":       30,
+		"1e9,1e9,UNKN,1e9,3,+,1e9,3,-,5,STDEV":                     math.Sqrt(4.5),
+		"100000000.1,100000000.2,100000000.3,100000000.4,4,SSTDEV": 0.12909944487358055,
+	}
+	for input, expected := range list {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		actual, err := exp.Evaluate(nil)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if math.Abs(actual-expected) > 1e-9*math.Abs(expected) {
+			t.Errorf("Case: %s; Actual: %v; Expected: %v", input, actual, expected)
+		}
+	}
+
+	// the average of a long window of a series is exact to within rounding of the result
+	series := make([]float64, 100000)
+	for i := range series {
+		series[i] = 0.1
+	}
+	series[0] = 1e10
+	for _, operator := range []string{"TREND", "TRENDNAN"} {
+		exp, err := New("series,100000,"+operator, SecondsPerInterval(1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual, err := exp.Evaluate(map[string]interface{}{"series": series})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := (1e10 + 99999*0.1) / 100000; actual != expected {
+			t.Errorf("Case: %s; Actual: %v; Expected: %v", operator, actual, expected)
+		}
+	}
+}
+
+func TestEvaluateTREND(t *testing.T) {
+	exp, err := New("sam,10,TREND", SecondsPerInterval(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bindings := map[string]interface{}{
+		"sam": []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, math.NaN()},
+	}
+	value, err := exp.Evaluate(bindings)
+	if err != nil {
+		t.Errorf("Actual: %s; Expected: %#v", err, nil)
+	}
+	if !math.IsNaN(value) {
+		t.Errorf("Actual: %#v; Expected: %#v", value, math.NaN())
+	}
+}
+
+func TestEvaluateTRENDNotEnoughValues(t *testing.T) {
+	exp, err := New("sam,10,TREND", SecondsPerInterval(1))
+	if err != nil {
+		t.Errorf("Actual: %s; Expected: %#v", err, nil)
+	}
+	bindings := map[string]interface{}{
+		"sam": []interface{}{1, 2},
+	}
+	_, err = exp.Evaluate(bindings)
+	if err == nil || err.Error() != "syntax error : TREND operand specifies 10 values, but only 2 available" {
+		t.Errorf("Actual: %s; Expected: %#v", err, nil)
+	}
+}
+
+func TestEvaluateTRENDNotBoundToFloatSlice(t *testing.T) {
+	exp, err := New("sam,10,TREND", SecondsPerInterval(1))
+	if err != nil {
+		t.Errorf("Actual: %s; Expected: %#v", err, nil)
+	}
+	bindings := map[string]interface{}{
+		"sam": 134,
+	}
+	_, err = exp.Evaluate(bindings)
+	if err == nil || err.Error() != "syntax error : TREND operator requires label but found float64: 134" {
+		t.Errorf("Actual: %s; Expected: %#v", err, nil)
+	}
+}
+
+func TestEvaluateTRENDNAN(t *testing.T) {
+	exp, err := New("sam,10,TRENDNAN", SecondsPerInterval(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bindings := map[string]interface{}{
+		"sam": []float64{1, 2, math.NaN(), 4, 5, math.NaN(), 7, 8, 9, 10},
+	}
+	value, err := exp.Evaluate(bindings)
+	if err != nil {
+		t.Errorf("Actual: %s; Expected: %#v", err, nil)
+	}
+	if value != 5.75 {
+		t.Errorf("Actual: %#v; Expected: %#v", value, 5.75)
+	}
+}
+
+func TestEvaluateTRENDNANNotEnoughValues(t *testing.T) {
+	exp, err := New("sam,10,TRENDNAN", SecondsPerInterval(1))
+	if err != nil {
+		t.Errorf("Actual: %s; Expected: %#v", err, nil)
+	}
+	bindings := map[string]interface{}{
+		"sam": []interface{}{1, 2},
+	}
+	_, err = exp.Evaluate(bindings)
+	if err == nil || err.Error() != "syntax error : TRENDNAN operand specifies 10 values, but only 2 available" {
+		t.Errorf("Actual: %s; Expected: %#v", err, nil)
+	}
+}
+
+func TestEvaluateTRENDNANNotBoundToFloatSlice(t *testing.T) {
+	exp, err := New("sam,10,TRENDNAN", SecondsPerInterval(1))
+	if err != nil {
+		t.Errorf("Actual: %s; Expected: %#v", err, nil)
+	}
+	bindings := map[string]interface{}{
+		"sam": 134,
+	}
+	_, err = exp.Evaluate(bindings)
+	if err == nil || err.Error() != "syntax error : TRENDNAN operator requires label but found float64: 134" {
+		t.Errorf("Actual: %s; Expected: %#v", err, nil)
+	}
+}
+
+// evaluate is able to coerce slices of any number type to slices of float64 values
+
+func TestEvaluateTRENDNANSliceOfEmptyInterface(t *testing.T) {
+	exp, err := New("sam,10,TRENDNAN", SecondsPerInterval(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bindings := map[string]interface{}{
+		"sam": []interface{}{1, 2, math.NaN(), 4, 5, math.NaN(), 7, 8, 9, 10},
+	}
+	value, err := exp.Evaluate(bindings)
+	if err != nil {
+		t.Errorf("Actual: %s; Expected: %#v", err, nil)
 	}
 	if value != 5.75 {
 		t.Errorf("Actual: %#v; Expected: %#v", value, 5.75)
@@ -1566,6 +2203,65 @@ func TestEvaluateTRENDNANSliceOfInt32(t *testing.T) {
 	}
 }
 
+func TestEvaluateTRENDSeriesBinding(t *testing.T) {
+	start := time.Unix(1600000000, 0)
+	values := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+	withNaN := []float64{1, 2, 3, math.NaN(), 5, 6}
+	list := map[string]struct {
+		input    string
+		bindings map[string]interface{}
+		expected float64
+	}{
+		"slice uses interval":  {"qps,600,TREND", map[string]interface{}{"qps": values}, 11.5},
+		"series uses step":     {"qps,600,TREND", map[string]interface{}{"qps": SeriesBinding{Values: values, Step: time.Minute}}, 7.5},
+		"series without start": {"qps,180,TREND", map[string]interface{}{"qps": SeriesBinding{Values: values, Step: time.Minute}, "TIME": start.Unix()}, 11},
+		"series ends at time":  {"qps,180,TREND", map[string]interface{}{"qps": SeriesBinding{Values: values, Step: time.Minute, Start: start}, "TIME": start.Add(330 * time.Second)}, 5},
+		"series ends at last":  {"qps,180,TREND", map[string]interface{}{"qps": SeriesBinding{Values: values, Step: time.Minute, Start: start}}, 11},
+		"series trendnan":      {"qps,180,TRENDNAN", map[string]interface{}{"qps": SeriesBinding{Values: withNaN, Step: time.Minute}}, 5.5},
+		"series partial step":  {"qps,90,TREND", map[string]interface{}{"qps": SeriesBinding{Values: values, Step: time.Minute}}, 11.5},
+		"series median":        {"qps,MEDIAN", map[string]interface{}{"qps": SeriesBinding{Values: withNaN, Step: time.Minute}}, 3},
+	}
+	for name, item := range list {
+		exp, err := New(item.input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", name, err, nil)
+		}
+		actual, err := exp.Evaluate(item.bindings)
+		if err != nil {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, err, nil)
+			continue
+		}
+		if actual != item.expected {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, actual, item.expected)
+		}
+	}
+}
+
+func TestEvaluateTRENDSeriesBindingErrors(t *testing.T) {
+	start := time.Unix(1600000000, 0)
+	values := []float64{1, 2, 3, 4}
+	list := map[string]struct {
+		bindings map[string]interface{}
+		expected string
+	}{
+		"no step":       {map[string]interface{}{"qps": SeriesBinding{Values: values}}, "syntax error : cannot bind \"qps\" to series with step 0s"},
+		"too few":       {map[string]interface{}{"qps": SeriesBinding{Values: values, Step: time.Second}}, "syntax error : TREND operand specifies 300 values, but only 4 available"},
+		"before start":  {map[string]interface{}{"qps": SeriesBinding{Values: values, Step: time.Hour, Start: start}, "TIME": start.Add(-time.Second)}, "syntax error : TREND operand specifies \"qps\" label, which has no value at TIME 1.599999999e+09"},
+		"after end":     {map[string]interface{}{"qps": SeriesBinding{Values: values, Step: time.Hour, Start: start}, "TIME": start.Add(4 * time.Hour)}, "syntax error : TREND operand specifies \"qps\" label, which has no value at TIME 1.6000144e+09"},
+		"before window": {map[string]interface{}{"qps": SeriesBinding{Values: values, Step: time.Minute, Start: start}, "TIME": start.Add(time.Minute)}, "syntax error : TREND operand specifies 5 values, but only 2 available"},
+	}
+	exp, err := New("qps,300,TREND")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, item := range list {
+		_, err := exp.Evaluate(item.bindings)
+		if err == nil || err.Error() != item.expected {
+			t.Errorf("Case: %s; Actual: %v; Expected: %#v", name, err, item.expected)
+		}
+	}
+}
+
 // STEPWIDTH
 
 func TestEvaluateSTEPWIDTHDefault(t *testing.T) {
@@ -1626,6 +2322,83 @@ func TestEvaluateTIMEWithTime(t *testing.T) {
 	}
 }
 
+func TestNeedsTime(t *testing.T) {
+	list := map[string]struct {
+		needsTime, needsNow bool
+	}{
+		"qps,1000,*":         {false, false},
+		"TIME,60,%":          {true, false},
+		"LTIME,60,%":         {true, false},
+		"qps,NEWDAY,*":       {true, false},
+		"NEWWEEK,NEWMONTH,+": {true, false},
+		"NEWYEAR":            {true, false},
+		"NOW,last,-":         {false, true},
+		"NOW,TIME,-":         {true, true},
+		"TIME,0,*,qps,+":     {false, false}, // simplified away
+		"0,TIME,NOW,IF":      {false, true},  // untaken branch discarded
+	}
+	for input, expected := range list {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if actual := exp.NeedsTime(); actual != expected.needsTime {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, actual, expected.needsTime)
+		}
+		if actual := exp.NeedsNow(); actual != expected.needsNow {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, actual, expected.needsNow)
+		}
+	}
+
+	// also known for expressions that are not simplified, and those derived by Partial
+	exp, err := New("TIME,a,+", NoSimplify())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exp.NeedsTime() || exp.NeedsNow() {
+		t.Errorf("Actual: %#v, %#v; Expected: %#v, %#v", exp.NeedsTime(), exp.NeedsNow(), true, false)
+	}
+	exp, err = New("a,TIME,NOW,IF")
+	if err != nil {
+		t.Fatal(err)
+	}
+	partial, err := exp.Partial(map[string]interface{}{"a": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !partial.NeedsTime() || partial.NeedsNow() {
+		t.Errorf("Actual: %#v, %#v; Expected: %#v, %#v", partial.NeedsTime(), partial.NeedsNow(), true, false)
+	}
+	if clone := exp.Clone(); !clone.NeedsTime() || !clone.NeedsNow() {
+		t.Errorf("Actual: %#v, %#v; Expected: %#v, %#v", clone.NeedsTime(), clone.NeedsNow(), true, true)
+	}
+}
+
+func TestEvaluateTimeBindings(t *testing.T) {
+	exp, err := New("TIME,start,-,timeout,/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Unix(1234567890, 500000000)
+	list := map[string]struct {
+		bindings map[string]interface{}
+		expected float64
+	}{
+		"time":     {map[string]interface{}{"TIME": start.Add(3 * time.Minute), "start": start, "timeout": time.Minute}, 3},
+		"duration": {map[string]interface{}{"TIME": 1234567950.5, "start": start, "timeout": 1500 * time.Millisecond}, 40},
+	}
+	for name, item := range list {
+		actual, err := exp.Evaluate(item.bindings)
+		if err != nil {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, err, nil)
+			continue
+		}
+		if actual != item.expected {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, actual, item.expected)
+		}
+	}
+}
+
 // LTIME
 
 func TestEvaluateLTIMEWithoutTime(t *testing.T) {
@@ -1663,6 +2436,55 @@ func TestEvaluateLTIMEWithTime(t *testing.T) {
 	}
 }
 
+func TestEvaluateLTIMEAcrossDST(t *testing.T) {
+	exp, err := New("LTIME,TIME,-", TimeZone("America/New_York"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := map[string]struct {
+		epoch    int64
+		expected float64
+	}{
+		"before spring forward": {time.Date(2021, 3, 14, 6, 59, 59, 0, time.UTC).Unix(), -18000},
+		"after spring forward":  {time.Date(2021, 3, 14, 7, 0, 0, 0, time.UTC).Unix(), -14400},
+		"before fall back":      {time.Date(2021, 11, 7, 5, 59, 59, 0, time.UTC).Unix(), -14400},
+		"after fall back":       {time.Date(2021, 11, 7, 6, 0, 0, 0, time.UTC).Unix(), -18000},
+	}
+	for name, item := range list {
+		actual, err := exp.Evaluate(map[string]interface{}{"TIME": item.epoch})
+		if err != nil {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, err, nil)
+			continue
+		}
+		if actual != item.expected {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, actual, item.expected)
+		}
+	}
+}
+
+func TestTimeZone(t *testing.T) {
+	exp, err := New("LTIME", TimeZone("UTC"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual, err := exp.Evaluate(map[string]interface{}{"TIME": 1234567890}); err != nil || actual != 1234567890 {
+		t.Errorf("Actual: %#v, %#v; Expected: %#v, %#v", actual, err, 1234567890.0, nil)
+	}
+
+	other, err := New("LTIME", TimeZone("UTC"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual, expected := other.Hash(), exp.Hash(); actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+
+	_, err = New("LTIME", TimeZone("Nowhere/Special"))
+	if _, ok := err.(ErrSyntax); !ok {
+		t.Errorf("Actual: %#v; Expected: %#v", err, ErrSyntax{})
+	}
+}
+
 // MEDIAN
 
 func TestNewExpressionMEDIAN(t *testing.T) {
@@ -1777,14 +2599,62 @@ func julietToZulu(julietSeconds int) int {
 	return zuluSeconds
 }
 
-func TestEvaluateNEWDAYOpenBinding(t *testing.T) {
-	exp, err := New("NEWDAY")
+func TestEvaluateStatisticsOfSeries(t *testing.T) {
+	bindings := map[string]interface{}{
+		"qps":     []float64{3, 2, math.NaN(), 5, 1, 4},
+		"unknown": []float64{math.NaN(), math.NaN()},
+		"empty":   []float64{},
+		"count":   2,
+		"a":       10,
+		"b":       20,
+	}
+	list := map[string]float64{
+		"qps,MEDIAN":         3,
+		"qps,MAD":            1,
+		"95,qps,PERCENT":     5,
+		"50,qps,PERCENT":     3,
+		"qps,MEDIAN,1,+":     4,
+		"unknown,MEDIAN":     math.NaN(),
+		"empty,MAD":          math.NaN(),
+		"50,unknown,PERCENT": math.NaN(),
+		"a,b,count,MEDIAN":   15, // a symbol bound to a number is a count of values
+	}
+	for input, expected := range list {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		actual, err := exp.Evaluate(bindings)
+		if err != nil {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+			continue
+		}
+		if actual != expected && !(math.IsNaN(actual) && math.IsNaN(expected)) {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, actual, expected)
+		}
+	}
+
+	exp, err := New("qps,MEDIAN")
 	if err != nil {
 		t.Fatal(err)
 	}
-	_, err = exp.Evaluate(nil)
-	if err == nil || err.Error() != "open bindings: TIME" {
-		t.Errorf("Actual: %#v; Expected: %#v", err, "open bindings: TIME")
+	if _, err = exp.Evaluate(nil); err == nil || err.Error() != "open bindings: qps" {
+		t.Errorf("Actual: %#v; Expected: %#v", err, "open bindings: qps")
+	}
+	_, err = exp.Evaluate(map[string]interface{}{"qps": 0})
+	if expected := "syntax error : MEDIAN operator requires positive finite integer: 0"; err == nil || err.Error() != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", err, expected)
+	}
+}
+
+func TestEvaluateNEWDAYOpenBinding(t *testing.T) {
+	exp, err := New("NEWDAY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = exp.Evaluate(nil)
+	if err == nil || err.Error() != "open bindings: TIME" {
+		t.Errorf("Actual: %#v; Expected: %#v", err, "open bindings: TIME")
 	}
 }
 
@@ -1852,6 +2722,46 @@ func TestEvaluateNEWDAYAfterRightEdge(t *testing.T) {
 	}
 }
 
+func TestEvaluateNEWDAYAcrossDST(t *testing.T) {
+	list := map[string]struct {
+		expression string
+		zone       string
+		time       time.Time
+		expected   float64
+	}{
+		"23 hour day starts":           {"NEWDAY", "America/New_York", time.Date(2021, 3, 14, 5, 0, 0, 0, time.UTC), 1},
+		"day after 23 hour day starts": {"NEWDAY", "America/New_York", time.Date(2021, 3, 15, 4, 0, 0, 0, time.UTC), 1},
+		"day after 23 hour day":        {"NEWDAY", "America/New_York", time.Date(2021, 3, 15, 5, 0, 0, 0, time.UTC), 0},
+		"25 hour day starts":           {"NEWDAY", "America/New_York", time.Date(2021, 11, 7, 4, 0, 0, 0, time.UTC), 1},
+		"day after 25 hour day starts": {"NEWDAY", "America/New_York", time.Date(2021, 11, 8, 5, 0, 0, 0, time.UTC), 1},
+		"day after 25 hour day":        {"NEWDAY", "America/New_York", time.Date(2021, 11, 8, 4, 0, 0, 0, time.UTC), 0},
+		"skipped midnight before":      {"NEWDAY", "America/Santiago", time.Date(2021, 9, 5, 3, 59, 59, 0, time.UTC), 0},
+		"skipped midnight left edge":   {"NEWDAY", "America/Santiago", time.Date(2021, 9, 5, 4, 0, 0, 0, time.UTC), 1},
+		"skipped midnight right edge":  {"NEWDAY", "America/Santiago", time.Date(2021, 9, 5, 4, 5, 0, 0, time.UTC), 1},
+		"skipped midnight after":       {"NEWDAY", "America/Santiago", time.Date(2021, 9, 5, 4, 5, 1, 0, time.UTC), 0},
+		"repeated midnight first":      {"NEWDAY", "America/Havana", time.Date(2021, 11, 7, 4, 0, 0, 0, time.UTC), 1},
+		"repeated midnight second":     {"NEWDAY", "America/Havana", time.Date(2021, 11, 7, 5, 0, 0, 0, time.UTC), 0},
+		"week starts on 23 hour day":   {"NEWWEEK", "America/New_York", time.Date(2021, 3, 14, 5, 0, 0, 0, time.UTC), 1},
+		"week after skipped midnight":  {"NEWWEEK", "America/Santiago", time.Date(2021, 9, 5, 4, 0, 0, 0, time.UTC), 1},
+		"month in other zone":          {"NEWMONTH", "Asia/Tokyo", time.Date(2021, 2, 28, 15, 0, 0, 0, time.UTC), 1},
+		"year in other zone":           {"NEWYEAR", "Asia/Tokyo", time.Date(2020, 12, 31, 15, 0, 0, 0, time.UTC), 1},
+	}
+	for name, item := range list {
+		exp, err := New(item.expression, TimeZone(item.zone))
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", name, err, nil)
+		}
+		actual, err := exp.Evaluate(map[string]interface{}{"TIME": item.time})
+		if err != nil {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, err, nil)
+			continue
+		}
+		if actual != item.expected {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, actual, item.expected)
+		}
+	}
+}
+
 // NEWWEEK
 
 func TestEvaluateNEWWEEKOpenBinding(t *testing.T) {
@@ -2106,3 +3016,1295 @@ func TestEvaluateNEWYEARAfterRightEdge(t *testing.T) {
 		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
 	}
 }
+
+// IsConstant, ConstantValue
+
+func TestExpressionIsConstant(t *testing.T) {
+	list := map[string]bool{
+		"13":              true,
+		"60,24,*":         true,
+		"UNKN":            true,
+		"1,0,GT,5,foo,IF": true,
+		"foo":             false,
+		"foo,3,+":         false,
+		"NOW":             false,
+		"TIME":            false,
+		"1,2":             false,
+	}
+	for input, expected := range list {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if actual := exp.IsConstant(); actual != expected {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, actual, expected)
+		}
+	}
+}
+
+func TestExpressionConstantValue(t *testing.T) {
+	exp, err := New("60,24,*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, ok := exp.ConstantValue()
+	if !ok {
+		t.Errorf("Actual: %#v; Expected: %#v", ok, true)
+	}
+	if expected := float64(1440); value != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", value, expected)
+	}
+
+	exp, err = New("foo,24,*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp, err = exp.Partial(map[string]interface{}{"foo": 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, ok = exp.ConstantValue()
+	if !ok {
+		t.Errorf("Actual: %#v; Expected: %#v", ok, true)
+	}
+	if expected := float64(48); value != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", value, expected)
+	}
+}
+
+// numeric token pre-conversion
+
+func TestNewExpressionConvertsNumericTokens(t *testing.T) {
+	exp, err := New("foo,1.5,+,bar,2e3,*,MAX")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tok := range exp.tokens {
+		if s, ok := tok.(string); ok {
+			if _, err := strconv.ParseFloat(s, 64); err == nil {
+				t.Errorf("Actual: %q; Expected: float64", s)
+			}
+		}
+	}
+	if expected := "foo,1.5,+,bar,2000,*,MAX"; exp.String() != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", exp.String(), expected)
+	}
+}
+
+// Expression bindings
+
+func TestEvaluateExpressionBinding(t *testing.T) {
+	month, err := New("days,DAY,*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp, err := New("month,HOUR,/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := exp.Evaluate(map[string]interface{}{"month": month, "days": 30})
+	if err != nil {
+		t.Fatalf("Actual: %#v; Expected: %#v", err, nil)
+	}
+	if expected := float64(720); value != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", value, expected)
+	}
+
+	_, err = exp.Evaluate(map[string]interface{}{"month": month})
+	if _, ok := err.(ErrOpenBindings); !ok {
+		t.Errorf("Actual: %#v; Expected: %#v", err, ErrOpenBindings{"days": ScalarKind})
+	}
+}
+
+func TestPartialInlinesExpressionBinding(t *testing.T) {
+	inner, err := New("a,b,+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp, err := New("x,2,*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp, err = exp.Partial(map[string]interface{}{"x": inner, "b": 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "a,3,+,2,*"; exp.String() != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", exp.String(), expected)
+	}
+}
+
+func TestEvaluateExpressionBindingNeedsTime(t *testing.T) {
+	inner, err := New("TIME,60,/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp, err := New("minutes,1,+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := exp.Evaluate(map[string]interface{}{"minutes": inner, "TIME": 600})
+	if err != nil {
+		t.Fatalf("Actual: %#v; Expected: %#v", err, nil)
+	}
+	if expected := float64(11); value != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", value, expected)
+	}
+}
+
+func TestEvaluateExpressionBindingCycle(t *testing.T) {
+	a, err := New("b,1,+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := New("a,1,+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = a.Evaluate(map[string]interface{}{"a": a, "b": b})
+	if _, ok := err.(ErrSyntax); !ok {
+		t.Errorf("Actual: %#v; Expected: %#v", err, ErrSyntax{})
+	}
+}
+
+func TestEvaluateExpressionBindingMultipleValues(t *testing.T) {
+	inner, err := New("a,b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp, err := New("x,2,*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = exp.Evaluate(map[string]interface{}{"x": inner})
+	if err == nil || err.Error() != "syntax error : cannot bind \"x\" to an expression that does not produce a single value: a,b" {
+		t.Errorf("Actual: %#v; Expected: %#v", err, "cannot bind")
+	}
+}
+
+// Binding namespaces
+
+func TestEvaluateNamespaceBindings(t *testing.T) {
+	exp, err := New("host1.qps,host2.qps,+,dc.east.host3.qps,+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bindings := map[string]interface{}{
+		"host1": map[string]interface{}{"qps": 5},
+		"host2": map[string]float64{"qps": 7},
+		"dc": map[string]interface{}{
+			"east": map[string]interface{}{
+				"host3": map[string]interface{}{"qps": int64(11)},
+			},
+		},
+	}
+	value, err := exp.Evaluate(bindings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := float64(23); value != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", value, expected)
+	}
+
+	// namespaces and flat keys may be mixed, but not bind the same symbol twice
+	exp, err = exp.Partial(map[string]interface{}{"host1": map[string]interface{}{"qps": 5}, "host2.qps": 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual, expected := exp.String(), "12,dc.east.host3.qps,+"; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+	_, err = exp.Evaluate(map[string]interface{}{"dc.east.host3.qps": 1, "dc": map[string]interface{}{"east.host3.qps": 2}})
+	if expected := "syntax error : cannot bind \"dc.east.host3.qps\" more than once"; err == nil || err.Error() != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", err, expected)
+	}
+}
+
+func TestEvaluateNamespaceSeriesAndExpressions(t *testing.T) {
+	inner, err := New("TIME,60,/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp, err := New("web.qps,600,TREND,web.minutes,+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bindings := map[string]interface{}{
+		"web":  map[string]interface{}{"qps": []int{1, 2, 3}, "minutes": inner},
+		"TIME": 600,
+	}
+	value, err := exp.Evaluate(bindings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := float64(12.5); value != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", value, expected)
+	}
+
+	_, err = exp.Evaluate(map[string]interface{}{"web": map[string]interface{}{"qps": "13"}})
+	if _, ok := err.(ErrBadBindingType); !ok {
+		t.Errorf("Actual: %#v; Expected: %#v", err, ErrBadBindingType{})
+	}
+}
+
+// Precision
+
+func TestExpressionStringPrecision(t *testing.T) {
+	list := map[int]string{
+		-1: "0.30000000000000004,foo,*,1e+06,UNKN,INF",
+		0:  "0,foo,*,1000000,UNKN,INF",
+		2:  "0.30,foo,*,1000000.00,UNKN,INF",
+		6:  "0.300000,foo,*,1000000.000000,UNKN,INF",
+	}
+	for prec, output := range list {
+		exp, err := New("0.1,0.2,+,foo,*,1e6,UNKN,INF", Precision(prec))
+		if err != nil {
+			t.Fatalf("Case: %d; Actual: %#v; Expected: %#v", prec, err, nil)
+		}
+		if exp.String() != output {
+			t.Errorf("Case: %d; Actual: %#v; Expected: %#v", prec, exp.String(), output)
+		}
+		// precision survives partial application
+		exp, err = exp.Partial(map[string]interface{}{"bar": 1})
+		if err != nil {
+			t.Fatalf("Case: %d; Actual: %#v; Expected: %#v", prec, err, nil)
+		}
+		if exp.String() != output {
+			t.Errorf("Case: %d; Actual: %#v; Expected: %#v", prec, exp.String(), output)
+		}
+	}
+}
+
+func TestExpressionDecimalSeparator(t *testing.T) {
+	list := map[string]string{
+		"3,5 foo *":          "3,5 foo *",
+		"0,1 0,2 + foo *":    "0,30000000000000004 foo *",
+		"-1,5e3 ,5 +":        "-1499,5",
+		"'2,5' 1 +":          "'2,5' 1 +", // quoted symbols remain symbols
+		"cpu.load 2 *":       "cpu.load 2 *",
+		"1e6 UNKN INF foo +": "1e+06 UNKN INF foo +",
+	}
+	for input, output := range list {
+		exp, err := New(input, WhitespaceDelimited(), DecimalSeparator(','))
+		if err != nil {
+			t.Fatalf("Case: %q; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if actual := exp.String(); actual != output {
+			t.Errorf("Case: %q; Actual: %#v; Expected: %#v", input, actual, output)
+		}
+		// what String writes reads back as the same expression
+		again, err := New(exp.String(), WhitespaceDelimited(), DecimalSeparator(','))
+		if err != nil {
+			t.Fatalf("Case: %q; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if actual := again.String(); actual != output {
+			t.Errorf("Case: %q; Actual: %#v; Expected: %#v", input, actual, output)
+		}
+	}
+
+	exp, err := New("2,5|foo|*", Delimiter('|'), DecimalSeparator(','), Precision(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := exp.Evaluate(map[string]interface{}{"foo": 2})
+	if err != nil || value != 5 {
+		t.Errorf("Actual: %#v, %#v; Expected: %#v", value, err, 5)
+	}
+	if actual, expected := exp.String(), "2,50|foo|*"; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+
+	// the period restores the default
+	exp, err = New("2.5,foo,*", DecimalSeparator(','), DecimalSeparator('.'))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual, expected := exp.String(), "2.5,foo,*"; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+}
+
+func TestExpressionDecimalSeparatorErrors(t *testing.T) {
+	list := map[string][]ExpressionConfigurator{
+		"syntax error : cannot use ',' as decimal separator with delimiter \",\"":                          {DecimalSeparator(',')},
+		"syntax error : cannot use ',' as decimal separator with delimiter \", \"":                         {DecimalSeparator(','), DelimiterString(", ")},
+		"syntax error : cannot use ';' as decimal separator":                                               {DecimalSeparator(';'), WhitespaceDelimited()},
+		"syntax error : cannot use number \"3.5\" written with a period when the decimal separator is ','": {WhitespaceDelimited(), DecimalSeparator(',')},
+	}
+	for expected, setters := range list {
+		_, err := New("3.5 foo *", setters...)
+		if err == nil || err.Error() != expected {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", expected, err, expected)
+		}
+	}
+}
+
+func TestExpressionTokenStrings(t *testing.T) {
+	exp, err := New("5,3,+,'foo,bar',*,0.1,+", Precision(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual, expected := exp.tokenStrings(), []string{"8.00", "'foo,bar'", "*", "0.10", "+"}
+	if fmt.Sprintf("%q", actual) != fmt.Sprintf("%q", expected) {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+}
+
+func TestExpressionTokens(t *testing.T) {
+	exp, err := New("'1e3',1e3,+,NOW,times,MAX", Aliases(map[string]string{"times": "*"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Token{
+		{Kind: TokenSymbol, Text: "1e3"},
+		{Kind: TokenNumber, Number: 1000},
+		{Kind: TokenOperator, Text: "+"},
+		{Kind: TokenOperator, Text: "NOW"},
+		{Kind: TokenOperator, Text: "*"},
+		{Kind: TokenOperator, Text: "MAX"},
+	}
+	actual := exp.Tokens()
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+
+	// the program belongs to the caller
+	actual[0].Text = "changed"
+	if s := exp.String(); s != "'1e3',1000,+,NOW,times,MAX" {
+		t.Errorf("Actual: %#v; Expected: %#v", s, "'1e3',1000,+,NOW,times,MAX")
+	}
+}
+
+func TestNewExpressionROLLLargeRotations(t *testing.T) {
+	list := map[string]string{
+		"a,b,c,3,4,ROLL":   "c,a,b", // same as 1
+		"a,b,c,3,-4,ROLL":  "b,c,a", // same as -1
+		"a,b,c,3,3,ROLL":   "a,b,c",
+		"a,1,b,3,1,ROLL":   "b,a,1",
+		"a,1,b,3,1,ROLL,+": "b,a,1,+",
+	}
+	for input, output := range list {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if actual, want := exp.String(), output; actual != want {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, actual, want)
+		}
+	}
+}
+
+func TestEvaluateStackManipulationDoesNotAllocate(t *testing.T) {
+	bindings := map[string]interface{}{"a": 3.0, "b": 1.0, "c": 2.0}
+	baseline, err := New("a,b,c,+,+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := testing.AllocsPerRun(100, func() { baseline.Evaluate(bindings) })
+
+	list := []string{
+		"a,b,c,3,1,ROLL,+,+",
+		"a,b,c,3,REV,+,+",
+		"a,b,c,3,SORT,+,+",
+	}
+	for _, input := range list {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if actual := testing.AllocsPerRun(100, func() { exp.Evaluate(bindings) }); actual > expected {
+			t.Errorf("Case: %s; Actual: %v; Expected: %v", input, actual, expected)
+		}
+	}
+}
+
+func TestEvaluateSORTWithNaN(t *testing.T) {
+	// NaN sorts first, so after reversing it is on top where UN consumes it
+	exp, err := New("a,b,c,3,SORT,3,REV,UN,+,+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := exp.Evaluate(map[string]interface{}{"a": 3, "b": math.NaN(), "c": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := float64(5); value != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", value, expected)
+	}
+}
+
+// hostile bindings
+
+func TestEvaluateBadBindingType(t *testing.T) {
+	exp, err := New("a,b,+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := map[string]interface{}{
+		"nil":         nil,
+		"string":      "13",
+		"map":         map[int]float64{1: 13}, // only maps with string keys are namespaces
+		"slice":       []string{"13"},
+		"int pointer": new(int),
+		"func":        func() int { return 13 },
+	}
+	for name, binding := range list {
+		_, err := exp.Evaluate(map[string]interface{}{"a": 1, "b": binding})
+		if _, ok := err.(ErrBadBindingType); !ok {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, err, ErrBadBindingType{})
+		}
+	}
+}
+
+func TestEvaluateUnsignedAndJSONBindings(t *testing.T) {
+	exp, err := New("a,b,+,c,+,d,+,e,+,f,+,g,+,h,+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bindings := map[string]interface{}{
+		"a": uint(1), "b": uint8(2), "c": uint16(3), "d": uint32(4), "e": uint64(5),
+		"f": int8(-6), "g": int16(7), "h": json.Number("1.5e1"),
+	}
+	if actual, err := exp.Evaluate(bindings); err != nil || actual != 31 {
+		t.Errorf("Actual: %#v, %#v; Expected: %#v", actual, err, 31.0)
+	}
+
+	// a payload decoded with UseNumber may be bound without walking it first
+	var payload map[string]interface{}
+	decoder := json.NewDecoder(strings.NewReader(`{"web1": {"qps": 12}, "web2": {"qps": 30.5}}`))
+	decoder.UseNumber()
+	if err = decoder.Decode(&payload); err != nil {
+		t.Fatal(err)
+	}
+	exp, err = New("web1.qps,web2.qps,+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual, err := exp.Evaluate(payload); err != nil || actual != 42.5 {
+		t.Errorf("Actual: %#v, %#v; Expected: %#v", actual, err, 42.5)
+	}
+
+	exp, err = New("qps,3,TREND")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, series := range map[string]interface{}{
+		"uint":   []uint{1, 2, 3},
+		"uint32": []uint32{1, 2, 3},
+		"uint64": []uint64{1, 2, 3},
+		"json":   []json.Number{"1", "2", "3"},
+	} {
+		if _, err := exp.Evaluate(map[string]interface{}{"qps": series, "TIME": 3}); err != nil {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, err, nil)
+		}
+	}
+
+	_, err = exp.Evaluate(map[string]interface{}{"qps": json.Number("twelve")})
+	if expected := "syntax error : cannot bind json.Number that is not a number: \"twelve\""; err == nil || err.Error() != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", err, expected)
+	}
+}
+
+func TestNumericStrings(t *testing.T) {
+	exp, err := New("used,total,/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bindings := map[string]interface{}{"used": "512", "total": "2048"}
+	if _, err = exp.Evaluate(bindings); err == nil || err.Error() != `bad binding type for "total": "string"` && err.Error() != `bad binding type for "used": "string"` {
+		t.Errorf("Actual: %#v; Expected: %#v", err, ErrBadBindingType{})
+	}
+
+	exp, err = New("used,total,/", NumericStrings())
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := map[string]struct {
+		used, total interface{}
+		expected    string
+	}{
+		"integers":   {"512", "2048", "0.25"},
+		"scientific": {"1e3", "4000", "0.25"},
+		"mixed":      {json.Number("1"), 4, "0.25"},
+		"infinity":   {"Inf", "1", "+Inf"},
+		"not number": {"lots", "1", "syntax error : cannot bind string that is not a number: \"lots\""},
+	}
+	for name, item := range list {
+		value, err := exp.Evaluate(map[string]interface{}{"used": item.used, "total": item.total})
+		var actual string
+		if err != nil {
+			actual = err.Error()
+		} else {
+			actual = strconv.FormatFloat(value, 'g', -1, 64)
+		}
+		if actual != item.expected {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, actual, item.expected)
+		}
+	}
+
+	exp, err = New("qps,3,TREND", NumericStrings())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = exp.Evaluate(map[string]interface{}{"qps": []string{"1", "2", "3"}, "TIME": 3}); err != nil {
+		t.Errorf("Actual: %#v; Expected: %#v", err, nil)
+	}
+}
+
+func TestEvaluateLiveBindings(t *testing.T) {
+	exp, err := New("connections,limit,/,load,+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var connections float64
+	var calls int
+	bindings := map[string]interface{}{
+		"connections": &connections,
+		"limit":       200,
+		"load":        func() float64 { calls++; return float64(calls) },
+	}
+	for i, expected := range []float64{1, 2.5, 4} {
+		connections = float64(i * 100)
+		actual, err := exp.Evaluate(bindings)
+		if err != nil {
+			t.Fatalf("Case: %d; Actual: %#v; Expected: %#v", i, err, nil)
+		}
+		if actual != expected {
+			t.Errorf("Case: %d; Actual: %#v; Expected: %#v", i, actual, expected)
+		}
+	}
+
+	// live values are never folded by Partial
+	partial, err := exp.Partial(bindings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual, expected := partial.String(), "connections,200,/,load,+"; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+	connections = 400
+	if actual, err := partial.Evaluate(bindings); err != nil || actual != 6 {
+		t.Errorf("Actual: %#v, %#v; Expected: %#v", actual, err, 6.0)
+	}
+
+	// nor remembered by EvaluateMemo
+	for _, expected := range []float64{7, 8} {
+		if actual, err := exp.EvaluateMemo(bindings, "render"); err != nil || actual != expected {
+			t.Errorf("Actual: %#v, %#v; Expected: %#v", actual, err, expected)
+		}
+	}
+
+	for name, binding := range map[string]interface{}{"pointer": (*float64)(nil), "func": (func() float64)(nil)} {
+		_, err := exp.Evaluate(map[string]interface{}{"connections": binding, "limit": 1, "load": 2})
+		if _, ok := err.(ErrSyntax); !ok {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, err, ErrSyntax{})
+		}
+	}
+}
+
+func TestEvaluateReportsCallbackPanics(t *testing.T) {
+	exp, err := New("load,2,*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = exp.Evaluate(map[string]interface{}{"load": func() float64 { panic("sensor offline") }})
+	if expected := (ErrCallbackPanic{Symbol: "load", Cause: "sensor offline"}); err != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", err, expected)
+	}
+
+	// New invokes the Trace function while simplifying
+	_, err = New("load,2,*", Trace(func(TraceEvent) { panic("trace failed") }))
+	if expected := (ErrCallbackPanic{Cause: "trace failed"}); err != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", err, expected)
+	}
+	if actual, expected := err.Error(), "panic in Trace function: trace failed"; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+}
+
+func TestEvaluateRecoversInternalError(t *testing.T) {
+	// work area deliberately too small for the program
+	exp := &Expression{config: newConfig(), tokens: []interface{}{13.0, 42.0, "+"}, scratch: make([]interface{}, 1), isFloat: make([]bool, 1)}
+
+	_, err := exp.Evaluate(nil)
+	ie, ok := err.(ErrInternal)
+	if !ok {
+		t.Fatalf("Actual: %#v; Expected: %#v", err, ErrInternal{})
+	}
+	if actual, expected := ie.Expression, "13,42,+"; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+	if actual, expected := ie.Position, 1; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+	if actual, expected := ie.Token, "42"; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+
+	if _, err = exp.Partial(nil); err == nil {
+		t.Errorf("Actual: %#v; Expected: %#v", err, ErrInternal{})
+	}
+}
+
+// open binding kinds
+
+func TestExpressionOpenBindingKinds(t *testing.T) {
+	list := map[string]map[string]BindingKind{
+		"13":                            nil,
+		"a,b,+":                         {"a": ScalarKind, "b": ScalarKind},
+		"qps,600,TREND,limit,MIN":       {"limit": ScalarKind, "qps": SeriesKind},
+		"qps,900,TRENDNAN,qps,POP":      {"qps": SeriesKind},
+		"qps,window,TREND":              {"qps": SeriesKind, "window": ScalarKind},
+		"qps,a,b,+,TREND":               {"a": ScalarKind, "b": ScalarKind, "qps": ScalarKind},
+		"cond,qps,600,TREND,other,IF,2": {"cond": ScalarKind, "other": ScalarKind, "qps": SeriesKind},
+		"qps,MEDIAN":                    {"qps": SeriesKind},
+		"qps,MAD,limit,MIN":             {"limit": ScalarKind, "qps": SeriesKind},
+		"95,qps,PERCENT":                {"qps": SeriesKind},
+		"a,b,n,MEDIAN":                  {"a": ScalarKind, "b": ScalarKind, "n": ScalarKind},
+		"x,qps,MEDIAN,+":                {"qps": ScalarKind, "x": ScalarKind}, // qps may be a count of values
+	}
+	for input, expected := range list {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		actual := exp.OpenBindingKinds()
+		if len(actual) != len(expected) {
+			t.Errorf("Case: %s; Actual: %v; Expected: %v", input, actual, expected)
+			continue
+		}
+		for k, v := range expected {
+			if actual[k] != v {
+				t.Errorf("Case: %s; Actual: %v; Expected: %v", input, actual, expected)
+				break
+			}
+		}
+	}
+}
+
+func TestEvaluateOpenBindingKinds(t *testing.T) {
+	exp, err := New("qps,600,TREND,limit,MIN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = exp.Evaluate(map[string]interface{}{"limit": 100})
+	if expected := (ErrOpenBindings{"qps": SeriesKind}); !reflect.DeepEqual(err, expected) {
+		t.Errorf("Actual: %#v; Expected: %#v", err, expected)
+	}
+	_, err = exp.Evaluate(nil)
+	if expected := (ErrOpenBindings{"limit": ScalarKind, "qps": SeriesKind}); !reflect.DeepEqual(err, expected) {
+		t.Errorf("Actual: %#v; Expected: %#v", err, expected)
+	}
+	if actual, expected := err.Error(), "open bindings: limit,qps"; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+}
+
+// Rename
+
+func TestExpressionRename(t *testing.T) {
+	exp, err := New("a,b,+,a,c,+,*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := map[string]struct {
+		renames map[string]string
+		output  string
+	}{
+		"none":      {nil, "a,b,+,a,c,+,*"},
+		"one":       {map[string]string{"a": "x"}, "x,b,+,x,c,+,*"},
+		"swap":      {map[string]string{"b": "c", "c": "b"}, "a,c,+,a,b,+,*"},
+		"merge":     {map[string]string{"c": "b"}, "a,b,+,DUP,*"},
+		"delimiter": {map[string]string{"a": "web,1.qps"}, "'web,1.qps',b,+,'web,1.qps',c,+,*"},
+		"number":    {map[string]string{"b": "13"}, "a,'13',+,a,c,+,*"},
+		"unknown":   {map[string]string{"z": "y"}, "a,b,+,a,c,+,*"},
+	}
+	for name, item := range list {
+		renamed, err := exp.Rename(item.renames)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", name, err, nil)
+		}
+		if actual := renamed.String(); actual != item.output {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, actual, item.output)
+		}
+	}
+	if actual, expected := exp.String(), "a,b,+,a,c,+,*"; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+}
+
+func TestExpressionRenameEvaluate(t *testing.T) {
+	exp, err := New("qps,1000,*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	renamed, err := exp.Rename(map[string]string{"qps": "web,1.qps"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := renamed.Evaluate(map[string]interface{}{"web,1.qps": 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := float64(2000); value != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", value, expected)
+	}
+}
+
+func TestExpressionRenameInvalidSymbol(t *testing.T) {
+	exp, err := New("a,b,+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	errors := map[string]string{
+		"":     "syntax error : cannot rename \"a\" to empty symbol",
+		"+":    "syntax error : cannot rename \"a\" to operator \"+\"",
+		"TIME": "syntax error : cannot rename \"a\" to operator \"TIME\"",
+	}
+	for to, e := range errors {
+		if _, err := exp.Rename(map[string]string{"a": to}); err == nil || err.Error() != e {
+			t.Errorf("Case: %s; Actual: %s; Expected: %#v", to, err, e)
+		}
+	}
+}
+
+// Trace
+
+func TestTrace(t *testing.T) {
+	var events []TraceEvent
+	exp, err := New("a,b,/,c,2,COPY,+,+,+", Trace(func(event TraceEvent) {
+		events = append(events, event)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual, expected := len(events), 5; actual != expected {
+		t.Fatalf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+	for _, event := range events {
+		if !event.Deferred {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", event.Operator, event.Deferred, true)
+		}
+	}
+
+	events = nil
+	value, err := exp.Evaluate(map[string]interface{}{"a": 0, "b": 0, "c": 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !math.IsNaN(value) {
+		t.Errorf("Actual: %#v; Expected: %#v", value, math.NaN())
+	}
+	if actual, expected := len(events), 5; actual != expected {
+		t.Fatalf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+
+	event := events[0]
+	if actual, expected := fmt.Sprintf("%d %s %v %v", event.Position, event.Operator, event.Inputs, event.Outputs), "2 / [0 0] [NaN]"; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+	event = events[1]
+	if actual, expected := fmt.Sprintf("%d %s %v %v %v", event.Position, event.Operator, event.Inputs, event.Outputs, event.Stack), "5 COPY [NaN 3 2] [NaN 3 NaN 3] [NaN 3 NaN 3]"; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+	event = events[2]
+	if actual, expected := fmt.Sprintf("%d %s %v %v %v", event.Position, event.Operator, event.Inputs, event.Outputs, event.Stack), "6 + [NaN 3] [NaN] [NaN 3 NaN]"; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+}
+
+func TestNewAutoDelimiter(t *testing.T) {
+	list := map[string]string{
+		"42,13,2,MEDIAN":     "27.5",
+		"42|13|2|MEDIAN":     "27.5",
+		"42;13;2;MEDIAN":     "27.5",
+		"42 13 2 MEDIAN":     "27.5",
+		"42  13\t2\nMEDIAN":  "27.5",
+		" 42, 13 , 2,MEDIAN": "27.5",
+		"42":                 "42",
+		"'a|b',13,+":         "15",
+		`a\;b|13|+`:          "16",
+	}
+	bindings := map[string]interface{}{"a|b": 2, "a;b": 3}
+	for input, output := range list {
+		exp, err := NewAutoDelimiter(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		value, err := exp.Evaluate(bindings)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if actual := formatNumber(value, -1); actual != output {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, actual, output)
+		}
+	}
+
+	errors := map[string]string{
+		"a,b|c":   "syntax error : cannot detect delimiter: expression contains ',' and '|'",
+		"a;b,c|d": "syntax error : cannot detect delimiter: expression contains ',' and '|' and ';'",
+	}
+	for input, e := range errors {
+		if _, err := NewAutoDelimiter(input); err == nil || err.Error() != e {
+			t.Errorf("Case: %s; Actual: %s; Expected: %#v", input, err, e)
+		}
+	}
+}
+
+func TestCheckedArithmetic(t *testing.T) {
+	bindings := map[string]interface{}{"big": 1e308, "huge": 1e200, "small": -1e308, "tiny": 1e-300, "a": 5}
+	list := map[string]string{
+		"big,big,+":     "overflow at token 2: 1e+308,1e+308,+",
+		"small,big,-":   "overflow at token 2: -1e+308,1e+308,-",
+		"huge,huge,*":   "overflow at token 2: 1e+200,1e+200,*",
+		"huge,2,POW":    "overflow at token 2: 1e+200,2,POW",
+		"a,big,*,a,MAX": "overflow at token 2: 5,1e+308,*",
+		"a,a,+":         "10",
+		"INF,a,+":       "INF",
+		"0,-1,a,*,POW":  "INF",
+		"tiny,tiny,*":   "underflow at token 2: 1e-300,1e-300,*",
+		"tiny,a,POW":    "underflow at token 2: 1e-300,5,POW",
+		"tiny,0.5,*":    "5e-301", // still normal
+		"tiny,0,*":      "0",
+		"tiny,tiny,-":   "0", // exact
+	}
+	for input, expected := range list {
+		exp, err := New(input, CheckedArithmetic())
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		value, err := exp.Evaluate(bindings)
+		var actual string
+		if err != nil {
+			_, isOverflow := err.(ErrOverflow)
+			if _, isUnderflow := err.(ErrUnderflow); !isOverflow && !isUnderflow {
+				t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, err, ErrOverflow{})
+			}
+			actual = err.Error()
+		} else {
+			actual = formatNumber(value, -1)
+		}
+		if actual != expected {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, actual, expected)
+		}
+	}
+
+	// constant operands are folded by New, so the error is reported there
+	if _, err := New("1,1e308,*,10,*", CheckedArithmetic()); err == nil || err.Error() != "overflow at token 4: 1e+308,10,*" {
+		t.Errorf("Actual: %#v; Expected: %#v", err, "overflow at token 4: 1e+308,10,*")
+	}
+
+	// without it, infinities propagate
+	exp, err := New("big,big,+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, err := exp.Evaluate(bindings); err != nil || !math.IsInf(value, 1) {
+		t.Errorf("Actual: %v, %#v; Expected: %v, %#v", value, err, math.Inf(1), nil)
+	}
+}
+
+func TestRejectNaNInputs(t *testing.T) {
+	double, err := New("b,2,*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := map[string]struct {
+		input    string
+		bindings map[string]interface{}
+		expected interface{}
+	}{
+		"none":       {"a,b,+", map[string]interface{}{"a": 1, "b": 2}, 3.0},
+		"one":        {"a,b,+", map[string]interface{}{"a": math.NaN(), "b": 2}, ErrNaNInput{"a"}},
+		"sorted":     {"b,a,+,b,*", map[string]interface{}{"a": math.NaN(), "b": math.NaN()}, ErrNaNInput{"a", "b"}},
+		"unused":     {"a,2,*", map[string]interface{}{"a": 1, "other": math.NaN()}, 2.0},
+		"series":     {"a,2,TREND", map[string]interface{}{"a": []float64{math.NaN(), 4}, "TIME": 2}, 4.0},
+		"live":       {"a,1,+", map[string]interface{}{"a": func() float64 { return math.NaN() }}, ErrNaNInput{"a"}},
+		"expression": {"a,1,+", map[string]interface{}{"a": double, "b": math.NaN()}, ErrNaNInput{"b"}},
+	}
+	for name, item := range list {
+		exp, err := New(item.input, RejectNaNInputs())
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", name, err, nil)
+		}
+		value, err := exp.Evaluate(item.bindings)
+		var actual interface{} = value
+		if err != nil {
+			actual = err
+		}
+		if !reflect.DeepEqual(actual, item.expected) {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, actual, item.expected)
+		}
+	}
+
+	// without the option, NaN propagates, and Partial never rejects it
+	exp, err := New("a,b,+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, err := exp.Evaluate(map[string]interface{}{"a": math.NaN(), "b": 2}); err != nil || !math.IsNaN(value) {
+		t.Errorf("Actual: %#v, %#v; Expected: %#v", value, err, math.NaN())
+	}
+	exp, err = New("a,b,+", RejectNaNInputs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = exp.Partial(map[string]interface{}{"a": math.NaN()}); err != nil {
+		t.Errorf("Actual: %#v; Expected: %#v", err, nil)
+	}
+	if actual, expected := ErrNaNInput([]string{"a", "b"}).Error(), "NaN bindings: a,b"; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+}
+
+func TestDivisionByZero(t *testing.T) {
+	bindings := map[string]interface{}{"a": 5, "z": 0}
+	list := map[string]struct {
+		policy DivisionByZeroPolicy
+		output string // result, or error
+	}{
+		"a,z,/ NaN":   {DivisionByZeroNaN, "UNKN"},
+		"a,z,/ Inf":   {DivisionByZeroInf, "INF"},
+		"a,z,/ Error": {DivisionByZeroError, "division by zero: 5,0,/"},
+		"z,z,/ Inf":   {DivisionByZeroInf, "UNKN"},
+		"a,0,/ NaN":   {DivisionByZeroNaN, "UNKN"},
+		"a,0,/ Inf":   {DivisionByZeroInf, "INF"},
+		"a,0,/ Error": {DivisionByZeroError, "division by zero: 5,0,/"},
+		"-5,0,/ Inf":  {DivisionByZeroInf, "NEGINF"},
+		"a,z,% NaN":   {DivisionByZeroNaN, "UNKN"},
+		"a,z,% Inf":   {DivisionByZeroInf, "UNKN"},
+		"a,0,% Error": {DivisionByZeroError, "division by zero: 5,0,%"},
+		"0,z,/ NaN":   {DivisionByZeroNaN, "UNKN"},
+	}
+	for input, item := range list {
+		someExpression := input[:strings.IndexByte(input, ' ')]
+		exp, err := New(someExpression, DivisionByZero(item.policy))
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		value, err := exp.Evaluate(bindings)
+		var actual string
+		if err != nil {
+			if _, ok := err.(ErrDivisionByZero); !ok {
+				t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, err, ErrDivisionByZero{})
+			}
+			actual = err.Error()
+		} else {
+			actual = formatNumber(value, -1)
+		}
+		if actual != item.output {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, actual, item.output)
+		}
+	}
+
+	// constant divisions are folded by New, so the error is reported there
+	if _, err := New("1,0,/", DivisionByZero(DivisionByZeroError)); err == nil || err.Error() != "division by zero: 1,0,/" {
+		t.Errorf("Actual: %#v; Expected: %#v", err, "division by zero: 1,0,/")
+	}
+	if _, err := New("1", DivisionByZero(DivisionByZeroPolicy(42))); err == nil {
+		t.Errorf("Actual: %#v; Expected: %#v", err, "unknown division by zero policy: 42")
+	}
+}
+
+func TestSentinelErrors(t *testing.T) {
+	list := map[string]struct {
+		input   string
+		setters []ExpressionConfigurator
+		target  error
+	}{
+		"underflow":        {"a,+", nil, ErrStackUnderflow},
+		"underflow count":  {"a,b,5,AVG", nil, ErrStackUnderflow},
+		"unknown alias":    {"a,b,plus", []ExpressionConfigurator{Aliases(map[string]string{"plus": "PLUS"})}, ErrUnknownOperator},
+		"unknown cost":     {"a,b,+", []ExpressionConfigurator{OperatorCosts(map[string]int{"PLUS": 2})}, ErrUnknownOperator},
+		"unknown rewrite":  {"a,b,+", []ExpressionConfigurator{RewriteRules(map[string]string{"x": "x"})}, ErrUnknownOperator},
+		"divide constants": {"5,0,/", []ExpressionConfigurator{DivisionByZero(DivisionByZeroError)}, ErrDivideByZero},
+	}
+	for name, item := range list {
+		_, err := New(item.input, item.setters...)
+		if !errors.Is(err, item.target) {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, err, item.target)
+		}
+		var syntaxError ErrSyntax
+		if item.target != ErrDivideByZero && !errors.As(err, &syntaxError) {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, err, ErrSyntax{})
+		}
+	}
+
+	exp, err := New("a,z,/", DivisionByZero(DivisionByZeroError))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = exp.Evaluate(map[string]interface{}{"a": 5, "z": 0})
+	var divisionError ErrDivisionByZero
+	if !errors.Is(err, ErrDivideByZero) || !errors.As(err, &divisionError) || divisionError.Operator != "/" {
+		t.Errorf("Actual: %#v; Expected: %#v", err, ErrDivisionByZero{Operator: "/", Dividend: 5})
+	}
+
+	// other syntax errors match no sentinel, and wrapping preserves the match
+	_, err = New("a,b,+,")
+	if errors.Is(err, ErrStackUnderflow) || errors.Is(err, ErrUnknownOperator) {
+		t.Errorf("Actual: %#v; Expected: %#v", err, ErrSyntax{})
+	}
+	_, err = New("a,+")
+	if wrapped := fmt.Errorf("cannot load rule: %w", err); !errors.Is(wrapped, ErrStackUnderflow) {
+		t.Errorf("Actual: %#v; Expected: %#v", wrapped, ErrStackUnderflow)
+	}
+}
+
+func TestComparisonsWithNaN(t *testing.T) {
+	bindings := map[string]interface{}{"a": 5, "u": math.NaN()}
+	list := map[string][3]string{ // results with ComparisonNaN, ComparisonFalse, and ComparisonUnknownAsFalse
+		"a,u,GT":          {"UNKN", "0", "1"},
+		"u,a,GT":          {"UNKN", "0", "0"},
+		"a,u,GE":          {"UNKN", "0", "1"},
+		"a,u,LT":          {"UNKN", "0", "0"},
+		"u,a,LE":          {"UNKN", "0", "1"},
+		"u,u,GE":          {"1", "0", "1"},
+		"u,u,LT":          {"0", "0", "0"},
+		"a,3,GT":          {"1", "1", "1"},
+		"u,0,GT,a,3,GT,+": {"UNKN", "1", "1"},
+		"UNKN,-1,GE":      {"UNKN", "0", "1"},
+		"a,u,EQ,a,u,NE,+": {"1", "1", "1"},
+	}
+	policies := []ComparisonPolicy{ComparisonNaN, ComparisonFalse, ComparisonUnknownAsFalse}
+	for input, outputs := range list {
+		for i, policy := range policies {
+			exp, err := New(input, ComparisonsWithNaN(policy))
+			if err != nil {
+				t.Fatalf("Case: %s %d; Actual: %#v; Expected: %#v", input, policy, err, nil)
+			}
+			value, err := exp.Evaluate(bindings)
+			if err != nil {
+				t.Fatalf("Case: %s %d; Actual: %#v; Expected: %#v", input, policy, err, nil)
+			}
+			if actual := formatNumber(value, -1); actual != outputs[i] {
+				t.Errorf("Case: %s %d; Actual: %#v; Expected: %#v", input, policy, actual, outputs[i])
+			}
+		}
+	}
+	if _, err := New("1", ComparisonsWithNaN(ComparisonPolicy(42))); err == nil {
+		t.Errorf("Actual: %#v; Expected: %#v", err, "unknown comparison policy: 42")
+	}
+}
+
+func TestThreeValuedLogic(t *testing.T) {
+	bindings := map[string]interface{}{"a": 5, "u": math.NaN()}
+	list := map[string][2]string{ // results without and with ThreeValuedLogic
+		"a,u,GT":           {"UNKN", "UNKN"},
+		"u,u,GE":           {"1", "UNKN"},
+		"u,u,LT":           {"0", "UNKN"},
+		"u,u,EQ":           {"1", "UNKN"},
+		"u,u,NE":           {"0", "UNKN"},
+		"a,u,EQ":           {"0", "UNKN"},
+		"a,u,NE":           {"1", "UNKN"},
+		"a,a,EQ":           {"1", "1"},
+		"a,3,GT":           {"1", "1"},
+		"u,1,2,IF":         {"2", "UNKN"},
+		"a,1,2,IF":         {"1", "1"},
+		"u,a,3,+,a,4,*,IF": {"20", "UNKN"},
+		"a,u,EQ,1,0,IF":    {"0", "UNKN"},
+		"u,UN,1,0,IF":      {"1", "1"},
+	}
+	for input, outputs := range list {
+		for i, setters := range [][]ExpressionConfigurator{nil, {ThreeValuedLogic()}} {
+			exp, err := New(input, setters...)
+			if err != nil {
+				t.Fatalf("Case: %s %d; Actual: %#v; Expected: %#v", input, i, err, nil)
+			}
+			value, err := exp.Evaluate(bindings)
+			if err != nil {
+				t.Fatalf("Case: %s %d; Actual: %#v; Expected: %#v", input, i, err, nil)
+			}
+			if actual := formatNumber(value, -1); actual != outputs[i] {
+				t.Errorf("Case: %s %d; Actual: %#v; Expected: %#v", input, i, actual, outputs[i])
+			}
+		}
+	}
+
+	// an IF whose condition is folded to UNKN is UNKN, even when its branches have open bindings
+	exp, err := New("UNKN,a,b,+,c,IF", ThreeValuedLogic())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual, expected := exp.String(), "UNKN"; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+	exp, err = New("u,a,b,+,c,IF", ThreeValuedLogic())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, err := exp.Evaluate(map[string]interface{}{"u": math.NaN()}); err != nil || !math.IsNaN(value) {
+		t.Errorf("Actual: %#v, %#v; Expected: %#v", value, err, math.NaN())
+	}
+}
+
+func TestIntegerOperators(t *testing.T) {
+	list := map[string]string{
+		"12,10,BITAND":          "8",
+		"12,10,BITOR":           "14",
+		"12.9,10.2,BITAND":      "8", // operands are truncated
+		"-1,255,BITAND":         "255",
+		"UNKN,1,BITAND":         "UNKN",
+		"INF,1,BITOR":           "UNKN",
+		"1e19,1,BITOR":          "UNKN", // too large for int64
+		"1,4,SHL":               "16",
+		"256,4,SHR":             "16",
+		"-256,4,SHR":            "-16",
+		"1,64,SHL":              "0",
+		"1,-1,SHL":              "UNKN",
+		"7,3,MODINT":            "1",
+		"-7,3,MODINT":           "-1",
+		"7.9,3.9,MODINT":        "1",
+		"7,0,MODINT":            "UNKN",
+		"flags,4,SHR,15,BITAND": "flags,4,SHR,15,BITAND",
+	}
+	for input, output := range list {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if actual := exp.String(); actual != output {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, actual, output)
+		}
+	}
+
+	exp, err := New("flags,4,SHR,15,BITAND")
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := exp.Evaluate(map[string]interface{}{"flags": 0x5a3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := float64(0xa); value != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", value, expected)
+	}
+
+	if _, err = New("7,0,MODINT", DivisionByZero(DivisionByZeroError)); err == nil || err.Error() != "division by zero: 7,0,MODINT" {
+		t.Errorf("Actual: %#v; Expected: %#v", err, "division by zero: 7,0,MODINT")
+	}
+}
+
+func TestNoSimplify(t *testing.T) {
+	list := map[string]struct {
+		input    string
+		bindings map[string]interface{}
+		expected float64
+	}{
+		"constants":   {"60,60,*,qps,*", map[string]interface{}{"qps": 2}, 7200},
+		"dead branch": {"0,a,b,IF", map[string]interface{}{"b": 3}, 3},
+		"repeated":    {"a,b,+,a,b,+,*", map[string]interface{}{"a": 1, "b": 2}, 9},
+		"time":        {"TIME,60,/", map[string]interface{}{"TIME": 120}, 2},
+	}
+	for name, item := range list {
+		exp, err := New(item.input, NoSimplify())
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", name, err, nil)
+		}
+		if actual := exp.String(); actual != item.input {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, actual, item.input)
+		}
+		simplified, err := New(item.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		openBindings, expected := exp.OpenBindings(), simplified.OpenBindings()
+		sort.Strings(openBindings)
+		sort.Strings(expected)
+		if !reflect.DeepEqual(openBindings, expected) {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, openBindings, expected)
+		}
+		actual, err := exp.Evaluate(item.bindings)
+		if err != nil || actual != item.expected {
+			t.Errorf("Case: %s; Actual: %#v, %#v; Expected: %#v", name, actual, err, item.expected)
+		}
+	}
+
+	exp, err := New("60,60,*,qps,*", NoSimplify())
+	if err != nil {
+		t.Fatal(err)
+	}
+	partial, err := exp.Partial(nil)
+	if err != nil || partial.String() != "3600,qps,*" {
+		t.Errorf("Actual: %#v, %#v; Expected: %#v", partial, err, "3600,qps,*")
+	}
+
+	for _, input := range []string{"a,+", "1,POP"} {
+		if _, err = New(input, NoSimplify()); err == nil {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, err, "error")
+		}
+	}
+}
+
+func TestRandomOperators(t *testing.T) {
+	list := map[string]string{
+		"RANDOM":             "RANDOM",
+		"RANDOM,2,*":         "RANDOM,2,*",
+		"100,5,GAUSSIAN":     "100,5,GAUSSIAN",
+		"qps,0,5,GAUSSIAN,+": "qps,0,5,GAUSSIAN,+",
+	}
+	for input, output := range list {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if actual := exp.String(); actual != output {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, actual, output)
+		}
+		if exp.IsConstant() {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, true, false)
+		}
+	}
+
+	exp, err := New("RANDOM")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		value, err := exp.Evaluate(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value < 0 || value >= 1 {
+			t.Errorf("Actual: %#v; Expected: value in [0, 1)", value)
+		}
+	}
+
+	// seeded expressions produce the same sequence of values
+	first, err := New("RANDOM,100,5,GAUSSIAN,+", RandomSeed(42))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := New("RANDOM,100,5,GAUSSIAN,+", RandomSeed(42))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		a, err := first.Evaluate(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := second.Evaluate(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a != b {
+			t.Errorf("Actual: %#v; Expected: %#v", a, b)
+		}
+	}
+
+	exp, err = New("UNKN,5,GAUSSIAN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, err := exp.Evaluate(nil); err != nil || !math.IsNaN(value) {
+		t.Errorf("Actual: %#v, %#v; Expected: %#v", value, err, math.NaN())
+	}
+	exp, err = New("100,0,GAUSSIAN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, err := exp.Evaluate(nil); err != nil || value != 100 {
+		t.Errorf("Actual: %#v, %#v; Expected: %#v", value, err, 100.0)
+	}
+}
@@ -0,0 +1,87 @@
+package gorpn
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+// fuzzSeeds are expressions that exercise each family of operators, from which the fuzzer mutates
+// malformed expressions.
+var fuzzSeeds = []string{
+	"13",
+	"a,b,+,c,*",
+	"1,2,3,4,5,5,AVG",
+	"a,b,c,3,COPY,3,REV,6,SORT,6,MEDIAN",
+	"a,b,c,d,4,1,ROLL,2,INDEX,DUP,EXC,POP",
+	"cond,a,b,IF,c,0,LT,+",
+	"qps,600,TREND,qps,900,TRENDNAN,+",
+	"a,b,c,95,3,PERCENT,DEPTH",
+	"TIME,LTIME,NOW,NEWDAY,NEWWEEK,NEWMONTH,NEWYEAR,STEPWIDTH,+,+,+,+,+,+,+",
+	"COUNT,a,ADDNAN,UNKN,INF,NEGINF,MAXNAN,MINNAN",
+	"'host,1.qps',1000,*",
+	"a,1,+,b,a,1,+,*",
+	"a,b,+,POP",
+	"a,b,c,3,10,HIST,SMAX",
+	"a,b,c,d,2,4,NLARGEST,1,2,NSMALLEST",
+	"a,b,c,ROT,OVER,TUCK,SWAP,NIP",
+}
+
+func FuzzNew(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, someExpression string) {
+		exp, err := New(someExpression)
+		if err != nil {
+			return
+		}
+		// whatever New accepts, String must write in a form New accepts again
+		if _, err = New(exp.String()); err != nil {
+			t.Errorf("Case: %q; Actual: %#v; Expected: %#v", exp.String(), err, nil)
+		}
+	})
+}
+
+func FuzzEvaluate(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed, 3.0, uint8(0))
+	}
+	f.Fuzz(func(t *testing.T, someExpression string, value float64, kind uint8) {
+		// limit the stack and the cost, so that inputs such as "DUP,DEPTH,COPY" repeated do not stall
+		exp, err := New(someExpression, StackLimit(1000), EvaluationBudget(100000))
+		if err != nil {
+			if errors.As(err, &ErrInternal{}) {
+				t.Fatalf("Case: %q; Actual: %#v; Expected: %#v", someExpression, err, nil)
+			}
+			return
+		}
+		// bind every symbol to the same hostile value, selected by kind
+		var binding interface{}
+		switch kind % 6 {
+		case 0:
+			binding = value
+		case 1:
+			binding = []float64{value, math.NaN(), value}
+		case 2:
+			binding = []float64{}
+		case 3:
+			binding = "not a number"
+		case 4:
+			binding = nil
+		case 5:
+			binding = exp
+		}
+		bindings := make(map[string]interface{})
+		for symbol := range exp.openBindings {
+			bindings[symbol] = binding
+		}
+		// hostile bindings may be rejected, but must never reach an internal error
+		if _, err = exp.Evaluate(bindings); errors.As(err, &ErrInternal{}) {
+			t.Fatalf("Case: %q; Actual: %#v; Expected: %#v", someExpression, err, nil)
+		}
+		if _, err = exp.Partial(bindings); errors.As(err, &ErrInternal{}) {
+			t.Fatalf("Case: %q; Actual: %#v; Expected: %#v", someExpression, err, nil)
+		}
+	})
+}
@@ -1 +1,3 @@
-module "github.com/karrick/gorpn"
+module github.com/karrick/gorpn
+
+go 1.27.1
@@ -0,0 +1,49 @@
+// Package gorpntest provides helpers for testing and benchmarking gorpn expressions.
+package gorpntest
+
+import (
+	"testing"
+
+	"github.com/karrick/gorpn"
+)
+
+// Benchmark reports how long it takes, and how many allocations are made, to evaluate an RPN
+// expression with the given bindings. Compiling the expression is not included in the results.
+//
+//	func BenchmarkMyExpression(b *testing.B) {
+//		bindings := map[string]interface{}{"qps": 42}
+//		gorpntest.Benchmark(b, "qps,1000,*", bindings)
+//	}
+func Benchmark(b *testing.B, someExpression string, bindings map[string]interface{}, setters ...gorpn.ExpressionConfigurator) {
+	b.Helper()
+	exp, err := gorpn.New(someExpression, setters...)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err = exp.Evaluate(bindings); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// AllocsPerEvaluate returns the average number of allocations made while evaluating exp with the
+// given bindings, so tests can guard against allocation regressions.
+//
+//	func TestMyExpressionAllocations(t *testing.T) {
+//		exp, err := gorpn.New("qps,1000,*")
+//		if err != nil {
+//			t.Fatal(err)
+//		}
+//		bindings := map[string]interface{}{"qps": 42}
+//		if allocs := gorpntest.AllocsPerEvaluate(exp, bindings, 100); allocs > 5 {
+//			t.Errorf("Actual: %v; Expected: <= %v", allocs, 5)
+//		}
+//	}
+func AllocsPerEvaluate(exp *gorpn.Expression, bindings map[string]interface{}, runs int) float64 {
+	return testing.AllocsPerRun(runs, func() {
+		_, _ = exp.Evaluate(bindings)
+	})
+}
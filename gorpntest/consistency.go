@@ -0,0 +1,97 @@
+package gorpntest
+
+import (
+	"math"
+	"sort"
+	"testing"
+
+	"github.com/karrick/gorpn"
+)
+
+// CheckRoundTrip reports an error on t when an RPN expression does not survive being written and
+// read back: the String of the compiled expression must compile, with the same configuration, to
+// an expression with the same String, and evaluating both with the given bindings must return the
+// same result, or both return an error. Expressions using RAND, or the time operators, are not
+// expected to evaluate to the same result twice and should not be checked.
+//
+//	func TestMyExpressionsRoundTrip(t *testing.T) {
+//		bindings := map[string]interface{}{"qps": 42, "limit": 100}
+//		for _, someExpression := range []string{"qps,1000,*", "qps,limit,GT"} {
+//			gorpntest.CheckRoundTrip(t, someExpression, bindings)
+//		}
+//	}
+func CheckRoundTrip(t testing.TB, someExpression string, bindings map[string]interface{}, setters ...gorpn.ExpressionConfigurator) {
+	t.Helper()
+	exp, err := gorpn.New(someExpression, setters...)
+	if err != nil {
+		t.Errorf("Case: %s; Actual: %#v; Expected: %#v", someExpression, err, nil)
+		return
+	}
+	again, err := gorpn.New(exp.String(), setters...)
+	if err != nil {
+		t.Errorf("Case: %s; String: %s; Actual: %#v; Expected: %#v", someExpression, exp.String(), err, nil)
+		return
+	}
+	if actual, expected := again.String(), exp.String(); actual != expected {
+		t.Errorf("Case: %s; Actual: %#v; Expected: %#v", someExpression, actual, expected)
+	}
+	expected, expectedErr := exp.Evaluate(bindings)
+	actual, actualErr := again.Evaluate(bindings)
+	if !sameResult(actual, actualErr, expected, expectedErr) {
+		t.Errorf("Case: %s; String: %s; Actual: %v, %#v; Expected: %v, %#v", someExpression, exp.String(), actual, actualErr, expected, expectedErr)
+	}
+}
+
+// CheckPartial reports an error on t when partially applying the bindings of an RPN expression
+// changes its result: for each symbol of bindings, and then for all of them at once, evaluating
+// the expression returned by Partial must return the same result as evaluating the expression with
+// all the bindings, or both return an error, whether Partial or Evaluate returns it. The same
+// expressions should not be checked as for CheckRoundTrip.
+//
+//	func TestMyExpressionsPartial(t *testing.T) {
+//		bindings := map[string]interface{}{"qps": 42, "limit": 100}
+//		for _, someExpression := range []string{"qps,1000,*", "qps,limit,GT"} {
+//			gorpntest.CheckPartial(t, someExpression, bindings)
+//		}
+//	}
+func CheckPartial(t testing.TB, someExpression string, bindings map[string]interface{}, setters ...gorpn.ExpressionConfigurator) {
+	t.Helper()
+	exp, err := gorpn.New(someExpression, setters...)
+	if err != nil {
+		t.Errorf("Case: %s; Actual: %#v; Expected: %#v", someExpression, err, nil)
+		return
+	}
+	expected, expectedErr := exp.Evaluate(bindings)
+
+	symbols := make([]string, 0, len(bindings))
+	for symbol := range bindings {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+
+	subsets := make([]map[string]interface{}, 0, len(symbols)+1)
+	for _, symbol := range symbols {
+		subsets = append(subsets, map[string]interface{}{symbol: bindings[symbol]})
+	}
+	subsets = append(subsets, bindings)
+
+	for _, subset := range subsets {
+		var actual float64
+		partial, actualErr := exp.Partial(subset)
+		if actualErr == nil {
+			actual, actualErr = partial.Evaluate(bindings)
+		}
+		if !sameResult(actual, actualErr, expected, expectedErr) {
+			t.Errorf("Case: %s; Partial: %v; Actual: %v, %#v; Expected: %v, %#v", someExpression, subset, actual, actualErr, expected, expectedErr)
+		}
+	}
+}
+
+// sameResult returns true when two evaluations both returned an error, or both returned the same
+// value, treating NaN as equal to itself.
+func sameResult(a float64, aErr error, b float64, bErr error) bool {
+	if aErr != nil || bErr != nil {
+		return aErr != nil && bErr != nil
+	}
+	return a == b || (math.IsNaN(a) && math.IsNaN(b))
+}
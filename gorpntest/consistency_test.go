@@ -0,0 +1,36 @@
+package gorpntest
+
+import (
+	"testing"
+
+	"github.com/karrick/gorpn"
+)
+
+var testExpressions = []string{
+	"qps,1000,*",
+	"qps,limit,GT",
+	"qps,limit,/,100,*,UNKN,MAX",
+	"qps,qps,*,limit,qps,*,+",
+	"qps,limit,LT,qps,limit,IF",
+	"qps,limit,0,3,SORT,+,+",
+	"qps,limit,2,AVG,limit,-",
+	"qps,'1e3',+",
+	"errors,qps,/",
+	"qps,0,/",
+}
+
+func TestCheckRoundTrip(t *testing.T) {
+	bindings := map[string]interface{}{"qps": 42, "limit": 100, "1e3": 7, "errors": []float64{1, 2}}
+	for _, someExpression := range testExpressions {
+		CheckRoundTrip(t, someExpression, bindings)
+		CheckRoundTrip(t, someExpression, bindings, gorpn.WhitespaceDelimited())
+	}
+}
+
+func TestCheckPartial(t *testing.T) {
+	bindings := map[string]interface{}{"qps": 42, "limit": 100, "1e3": 7, "errors": []float64{1, 2}}
+	for _, someExpression := range testExpressions {
+		CheckPartial(t, someExpression, bindings)
+		CheckPartial(t, someExpression, bindings, gorpn.DivisionByZero(gorpn.DivisionByZeroError))
+	}
+}
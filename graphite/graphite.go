@@ -0,0 +1,300 @@
+// Package graphite translates Graphite render targets into equivalent RPN expressions, so that
+// Graphite style dashboards may be evaluated by gorpn.
+//
+// Only the following functions are supported, and each series must be named by a metric path
+// without wildcards, which is bound by name when evaluating the expression.
+//
+//	scale(series, factor)               series,factor,*
+//	sumSeries(series, series...)        series,series,ADDNAN...
+//	movingAverage(path, points)         path,points,STEPWIDTH,*,TRENDNAN
+//	movingAverage(path, "interval")     path,seconds,TRENDNAN
+//	asPercent(series, total)            series,total,/,100,*
+//
+// The total given to asPercent may be a number or a series. Each metric path is quoted, so that a
+// path such as servers.MAX is bound by name even when one of its segments is an RPN operator or
+// reserved word. A path that is itself one, such as MAX, cannot be bound, and is rejected.
+package graphite
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/karrick/gorpn"
+)
+
+// ErrParse is returned when a Graphite target cannot be translated.
+type ErrParse struct {
+	Target  string
+	Offset  int // byte offset in Target where the problem was found
+	Message string
+}
+
+// Error returns the error string representation for ErrParse errors.
+func (e ErrParse) Error() string {
+	return fmt.Sprintf("cannot translate %q at offset %d: %s", e.Target, e.Offset, e.Message)
+}
+
+// New returns the compiled Expression equivalent to a Graphite target, configured by setters. The
+// points of movingAverage are converted to seconds using the SecondsPerInterval of the Expression.
+//
+//	func example() {
+//		exp, err := graphite.New("asPercent(sumSeries(web1.errors, web2.errors), web.requests)")
+//		if err != nil {
+//			panic(err)
+//		}
+//		value, err := exp.Evaluate(map[string]interface{}{"web1.errors": 3, "web2.errors": 1, "web.requests": 200})
+//		// value == 2
+//	}
+func New(target string, setters ...gorpn.ExpressionConfigurator) (*gorpn.Expression, error) {
+	someExpression, err := Translate(target)
+	if err != nil {
+		return nil, err
+	}
+	return gorpn.New(someExpression, setters...)
+}
+
+// Translate returns the RPN expression equivalent to a Graphite target.
+//
+//	s, err := graphite.Translate("scale(web1.qps, 60)") // "'web1.qps',60,*"
+func Translate(target string) (string, error) {
+	p := &parser{target: target}
+	tokens, err := p.expression()
+	if err != nil {
+		return "", err
+	}
+	if p.skipSpace(); p.offset < len(p.target) {
+		return "", p.fail("unexpected text after target")
+	}
+	return strings.Join(tokens, ","), nil
+}
+
+// argument is a parsed argument of a Graphite function.
+type argument struct {
+	tokens []string // RPN tokens that compute the argument
+	path   string   // metric path, when the argument is one
+	text   string   // contents, when the argument is a quoted string
+	number bool     // true when the argument is a number
+}
+
+type parser struct {
+	target string
+	offset int
+}
+
+func (p *parser) fail(format string, args ...interface{}) error {
+	return ErrParse{Target: p.target, Offset: p.offset, Message: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) skipSpace() {
+	for p.offset < len(p.target) && (p.target[p.offset] == ' ' || p.target[p.offset] == '\t') {
+		p.offset++
+	}
+}
+
+// expression parses an argument that must compute a series or number, and returns its RPN tokens.
+func (p *parser) expression() ([]string, error) {
+	start := p.offset
+	arg, err := p.argument()
+	if err != nil {
+		return nil, err
+	}
+	if arg.tokens == nil {
+		p.offset = start
+		return nil, p.fail("expected series or number")
+	}
+	return arg.tokens, nil
+}
+
+// argument parses a function call, metric path, number, or quoted string.
+func (p *parser) argument() (argument, error) {
+	p.skipSpace()
+	if p.offset == len(p.target) {
+		return argument{}, p.fail("unexpected end of target")
+	}
+	start := p.offset
+
+	if c := p.target[p.offset]; c == '"' || c == '\'' {
+		end := strings.IndexByte(p.target[p.offset+1:], c)
+		if end < 0 {
+			return argument{}, p.fail("unterminated string")
+		}
+		p.offset += end + 2
+		return argument{text: p.target[start+1 : start+1+end]}, nil
+	}
+
+	for p.offset < len(p.target) && !strings.ContainsRune("(), \t\"'", rune(p.target[p.offset])) {
+		p.offset++
+	}
+	name := p.target[start:p.offset]
+	if name == "" {
+		return argument{}, p.fail("expected series or number")
+	}
+	if value, err := strconv.ParseFloat(name, 64); err == nil {
+		return argument{tokens: []string{strconv.FormatFloat(value, 'g', -1, 64)}, number: true}, nil
+	}
+
+	if p.skipSpace(); p.offset < len(p.target) && p.target[p.offset] == '(' {
+		p.offset++
+		return p.call(name, start)
+	}
+
+	if strings.ContainsAny(name, "*?[]{}") {
+		p.offset = start
+		return argument{}, p.fail("wildcards are not supported: %s", name)
+	}
+	if _, err := gorpn.New(quote(name)); err != nil {
+		// gorpn never reads an operator or reserved word as a symbol, even when quoted
+		p.offset = start
+		return argument{}, p.fail("metric path is an RPN operator or reserved word: %s", name)
+	}
+	return argument{tokens: []string{quote(name)}, path: name}, nil
+}
+
+// call parses the arguments of the named function, after its opening parenthesis, and returns the
+// argument that computes the function.
+func (p *parser) call(name string, start int) (argument, error) {
+	var args []argument
+	var offsets []int
+	for {
+		if p.skipSpace(); p.offset < len(p.target) && p.target[p.offset] == ')' && len(args) == 0 {
+			p.offset++
+			break
+		}
+		offsets = append(offsets, p.offset)
+		arg, err := p.argument()
+		if err != nil {
+			return argument{}, err
+		}
+		args = append(args, arg)
+		if p.skipSpace(); p.offset == len(p.target) {
+			return argument{}, p.fail("expected ) to close %s", name)
+		}
+		if c := p.target[p.offset]; c == ')' {
+			p.offset++
+			break
+		} else if c != ',' {
+			return argument{}, p.fail("expected , or )")
+		}
+		p.offset++
+	}
+
+	// checks that argument i is a series or number, restoring the offset to it when not
+	series := func(i int) error {
+		if args[i].tokens == nil {
+			p.offset = offsets[i]
+			return p.fail("%s requires series or number", name)
+		}
+		return nil
+	}
+	arity := func(n int) error {
+		if len(args) != n {
+			p.offset = start
+			return p.fail("%s requires %d arguments, but %d given", name, n, len(args))
+		}
+		return nil
+	}
+
+	var tokens []string
+	switch name {
+	case "scale":
+		if err := arity(2); err != nil {
+			return argument{}, err
+		}
+		if err := series(0); err != nil {
+			return argument{}, err
+		}
+		if !args[1].number {
+			p.offset = offsets[1]
+			return argument{}, p.fail("%s requires number factor", name)
+		}
+		tokens = append(append(args[0].tokens, args[1].tokens...), "*")
+	case "sum", "sumSeries":
+		if len(args) == 0 {
+			p.offset = start
+			return argument{}, p.fail("%s requires at least 1 argument", name)
+		}
+		for i, arg := range args {
+			if err := series(i); err != nil {
+				return argument{}, err
+			}
+			tokens = append(tokens, arg.tokens...)
+			if i > 0 {
+				tokens = append(tokens, "ADDNAN") // like Graphite, ignore missing values
+			}
+		}
+	case "movingAverage":
+		if err := arity(2); err != nil {
+			return argument{}, err
+		}
+		if args[0].path == "" {
+			p.offset = offsets[0]
+			return argument{}, p.fail("%s requires metric path, because TRENDNAN only accepts series bindings", name)
+		}
+		tokens = args[0].tokens
+		switch {
+		case args[1].number:
+			tokens = append(append(tokens, args[1].tokens...), "STEPWIDTH", "*", "TRENDNAN")
+		case args[1].tokens == nil:
+			seconds, ok := parseInterval(args[1].text)
+			if !ok {
+				p.offset = offsets[1]
+				return argument{}, p.fail("invalid interval: %q", args[1].text)
+			}
+			tokens = append(tokens, strconv.FormatFloat(seconds, 'g', -1, 64), "TRENDNAN")
+		default:
+			p.offset = offsets[1]
+			return argument{}, p.fail("%s requires number of points or interval", name)
+		}
+	case "asPercent":
+		if err := arity(2); err != nil {
+			return argument{}, err
+		}
+		if err := series(0); err != nil {
+			return argument{}, err
+		}
+		if err := series(1); err != nil {
+			return argument{}, err
+		}
+		tokens = append(append(args[0].tokens, args[1].tokens...), "/", "100", "*")
+	default:
+		p.offset = start
+		return argument{}, p.fail("unsupported function: %s", name)
+	}
+	return argument{tokens: tokens}, nil
+}
+
+// intervalUnits are the units of Graphite intervals, in seconds.
+var intervalUnits = map[string]float64{
+	"s": 1, "sec": 1, "secs": 1, "second": 1, "seconds": 1,
+	"min": 60, "mins": 60, "minute": 60, "minutes": 60,
+	"h": 3600, "hour": 3600, "hours": 3600,
+	"d": 86400, "day": 86400, "days": 86400,
+	"w": 604800, "week": 604800, "weeks": 604800,
+	"mon": 2592000, "month": 2592000, "months": 2592000,
+	"y": 31536000, "year": 31536000, "years": 31536000,
+}
+
+// parseInterval returns the number of seconds in a Graphite interval such as "5min", and true, or
+// false when text is not a positive interval.
+func parseInterval(text string) (float64, bool) {
+	idx := strings.IndexFunc(text, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if idx <= 0 {
+		return 0, false
+	}
+	count, err := strconv.ParseFloat(text[:idx], 64)
+	if err != nil || count <= 0 {
+		return 0, false
+	}
+	unit, ok := intervalUnits[text[idx:]]
+	if !ok {
+		return 0, false
+	}
+	return count * unit, true
+}
+
+// quote returns a metric path as a quoted RPN symbol, so that paths that look like numbers, or
+// contain the delimiter, are read back as the same symbol.
+func quote(path string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(path) + "'"
+}
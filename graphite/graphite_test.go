@@ -0,0 +1,94 @@
+package graphite
+
+import (
+	"testing"
+
+	"github.com/karrick/gorpn"
+)
+
+func TestTranslate(t *testing.T) {
+	list := map[string]string{
+		"web1.qps":                                     "'web1.qps'",
+		"scale(web1.qps, 60)":                          "'web1.qps',60,*",
+		"sumSeries(web1.qps,web2.qps,web3.qps)":        "'web1.qps','web2.qps',ADDNAN,'web3.qps',ADDNAN",
+		"sum(scale(a.b, 2))":                           "'a.b',2,*",
+		"movingAverage(web1.qps, 5)":                   "'web1.qps',5,STEPWIDTH,*,TRENDNAN",
+		"movingAverage(web1.qps, '10min')":             "'web1.qps',600,TRENDNAN",
+		"asPercent(web.errors, web.requests)":          "'web.errors','web.requests',/,100,*",
+		"asPercent(sumSeries(a.x, b.x), 1e3)":          "'a.x','b.x',ADDNAN,1000,/,100,*",
+		"scale(movingAverage(web1.qps,\"1h\"), -0.5) ": "'web1.qps',3600,TRENDNAN,-0.5,*",
+		"sumSeries(servers.MAX, a.TIME)":               "'servers.MAX','a.TIME',ADDNAN",
+		"scale(COUNT.x, 2)":                            "'COUNT.x',2,*",
+	}
+	for input, expected := range list {
+		actual, err := Translate(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if actual != expected {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, actual, expected)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	exp, err := New("asPercent(sumSeries(web1.errors, web2.errors), web.requests)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := exp.Evaluate(map[string]interface{}{"web1.errors": 3, "web2.errors": 1, "web.requests": 200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := 2.0; value != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", value, expected)
+	}
+
+	// points are converted using the configured interval
+	exp, err = New("movingAverage(qps, 2)", gorpn.SecondsPerInterval(60))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual, expected := exp.String(), "qps,120,TRENDNAN"; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+}
+
+func TestReservedPathSegments(t *testing.T) {
+	exp, err := New("sumSeries(servers.MAX, a.TIME, NOW.x)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual, expected := exp.String(), "servers.MAX,a.TIME,ADDNAN,NOW.x,ADDNAN"; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+	value, err := exp.Evaluate(map[string]interface{}{"servers.MAX": 1, "a.TIME": 2, "NOW.x": 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := 6.0; value != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", value, expected)
+	}
+}
+
+func TestTranslateErrors(t *testing.T) {
+	errors := map[string]string{
+		"":                                  "cannot translate \"\" at offset 0: unexpected end of target",
+		"web*.qps":                          "cannot translate \"web*.qps\" at offset 0: wildcards are not supported: web*.qps",
+		"scale(a.b)":                        "cannot translate \"scale(a.b)\" at offset 0: scale requires 2 arguments, but 1 given",
+		"scale(a.b, c.d)":                   "cannot translate \"scale(a.b, c.d)\" at offset 11: scale requires number factor",
+		"movingAverage(scale(a.b,2),5)":     "cannot translate \"movingAverage(scale(a.b,2),5)\" at offset 14: movingAverage requires metric path, because TRENDNAN only accepts series bindings",
+		"movingAverage(a.b,'5 fortnights')": "cannot translate \"movingAverage(a.b,'5 fortnights')\" at offset 18: invalid interval: \"5 fortnights\"",
+		"derivative(a.b)":                   "cannot translate \"derivative(a.b)\" at offset 0: unsupported function: derivative",
+		"sumSeries(a.b":                     "cannot translate \"sumSeries(a.b\" at offset 13: expected ) to close sumSeries",
+		"sumSeries('a.b')":                  "cannot translate \"sumSeries('a.b')\" at offset 10: sumSeries requires series or number",
+		"scale(MAX, 2)":                     "cannot translate \"scale(MAX, 2)\" at offset 6: metric path is an RPN operator or reserved word: MAX",
+		"TIME":                              "cannot translate \"TIME\" at offset 0: metric path is an RPN operator or reserved word: TIME",
+		"a.b c.d":                           "cannot translate \"a.b c.d\" at offset 4: unexpected text after target",
+	}
+	for input, e := range errors {
+		if _, err := Translate(input); err == nil || err.Error() != e {
+			t.Errorf("Case: %s; Actual: %s; Expected: %#v", input, err, e)
+		}
+	}
+}
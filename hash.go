@@ -0,0 +1,150 @@
+package gorpn
+
+import (
+	"encoding/binary"
+	"hash"
+	"hash/fnv"
+	"math"
+	"sort"
+)
+
+// Hash returns a 64-bit hash of the program of the Expression and of the configuration that
+// affects what it computes, so that distributed caches and maps for removing duplicates may key on
+// expressions without their source strings. Expressions that are written differently, using other
+// delimiters, white space, aliases of operators, or letter cases of operators, or that simplify to
+// the same program, such as "1,2,+,a,*" and "3,a,*", have the same hash, because they compute the
+// same results. The configuration of how numbers are written by String, and the seed given to
+// RandomSeed, do not affect the hash.
+//
+// The hash is the same in every process and on every platform, and is only changed by new major
+// versions of this library. Being a hash, different expressions may rarely have the same hash.
+//
+//	func example() {
+//		a, err := gorpn.New("qps,latency,*")
+//		if err != nil {
+//			panic(err)
+//		}
+//		b, err := gorpn.New("qps latency *", gorpn.WhitespaceDelimited())
+//		if err != nil {
+//			panic(err)
+//		}
+//		same := a.Hash() == b.Hash() // true
+//	}
+func (e *Expression) Hash() uint64 {
+	h := fnv.New64a()
+	for _, token := range e.tokens {
+		switch v := token.(type) {
+		case float64:
+			if math.IsNaN(v) {
+				v = math.NaN() // every UNKN is the same
+			}
+			h.Write([]byte{'n'})
+			hashUint(h, math.Float64bits(v))
+		case string:
+			if _, ok := arity[v]; ok || reserved[v] {
+				h.Write([]byte{'o'})
+			} else {
+				h.Write([]byte{'s'})
+			}
+			hashString(h, v)
+		}
+	}
+
+	h.Write([]byte{';'})
+	for _, option := range []bool{e.lenientCounts, e.checkedArithmetic, e.numericStrings, e.rejectNaNInputs, e.threeValuedLogic, e.rejectUnknownBool} {
+		if option {
+			h.Write([]byte{1})
+		} else {
+			h.Write([]byte{0})
+		}
+	}
+	if e.strictAggregates {
+		h.Write([]byte{'a'}) // options added since only change the hashes of expressions using them
+	}
+	if e.stackLimit != DefaultStackLimit {
+		h.Write([]byte{'l'})
+		hashUint(h, uint64(e.stackLimit))
+	}
+	if e.wholeSeriesTrend {
+		h.Write([]byte{'w'})
+	}
+	if e.location != nil {
+		h.Write([]byte{'z'})
+		hashString(h, e.location.String())
+	}
+	hashUint(h, uint64(e.divisionByZero))
+	hashUint(h, uint64(e.comparisonsWithNaN))
+	hashUint(h, math.Float64bits(e.secondsPerInterval))
+	hashUint(h, uint64(e.budget))
+	if e.costs != nil {
+		operators := make([]string, 0, len(e.costs.weights))
+		for operator := range e.costs.weights {
+			operators = append(operators, operator)
+		}
+		sort.Strings(operators)
+		for _, operator := range operators {
+			hashString(h, operator)
+			hashUint(h, uint64(e.costs.weights[operator]))
+		}
+	}
+	return h.Sum64()
+}
+
+// hashUint writes value to h.
+func hashUint(h hash.Hash, value uint64) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], value)
+	h.Write(buf[:])
+}
+
+// hashString writes s to h, preceded by its length so that adjacent strings are not confused.
+func hashString(h hash.Hash, s string) {
+	hashUint(h, uint64(len(s)))
+	h.Write([]byte(s))
+}
+
+// Equal returns true when the Expression and other have the same simplified program and the same
+// configuration of what they compute, and therefore always compute the same results. Just as for
+// Hash, the delimiters, aliases, and letter cases of operators used to write the expressions, the
+// configuration of how numbers are written by String, and the seed given to RandomSeed do not
+// matter. Use Canonical to also disregard the order of the operands of commutative operators.
+//
+//	func example() {
+//		a, err := gorpn.New("1,2,+,a,*")
+//		if err != nil {
+//			panic(err)
+//		}
+//		b, err := gorpn.New("3 a *", gorpn.WhitespaceDelimited())
+//		if err != nil {
+//			panic(err)
+//		}
+//		same := a.Equal(b) // true
+//	}
+func (e *Expression) Equal(other *Expression) bool {
+	if len(e.tokens) != len(other.tokens) || e.config.computation() != other.config.computation() {
+		return false
+	}
+	for i, token := range e.tokens {
+		switch v := token.(type) {
+		case float64:
+			w, ok := other.tokens[i].(float64)
+			if !ok || (v != w && !(math.IsNaN(v) && math.IsNaN(w))) || math.Signbit(v) != math.Signbit(w) {
+				return false
+			}
+		default:
+			if token != other.tokens[i] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// computation returns the configuration with only the options that affect what an Expression
+// computes, which are the options included in its Hash.
+func (c config) computation() config {
+	c.delimiter, c.whitespace, c.precision, c.decimalSeparator = "", false, 0, 0
+	c.random, c.seed, c.aliases, c.rewrites = nil, 0, nil, nil
+	c.canonicalOperators, c.caseInsensitiveOperators, c.noSimplify = false, false, false
+	return c
+}
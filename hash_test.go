@@ -0,0 +1,96 @@
+package gorpn
+
+import (
+	"testing"
+)
+
+func TestHashSame(t *testing.T) {
+	expected, err := New("qps,latency,*,3,+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := map[string]struct {
+		input   string
+		setters []ExpressionConfigurator
+	}{
+		"whitespace": {"qps latency * 3 +", []ExpressionConfigurator{WhitespaceDelimited()}},
+		"delimiter":  {"qps;latency;*;3;+", []ExpressionConfigurator{Delimiter(';')}},
+		"folded":     {"qps,latency,*,1,2,+,+", nil},
+		"alias":      {"qps,latency,times,3,+", []ExpressionConfigurator{Aliases(map[string]string{"times": "*"})}},
+		"case":       {"qps,latency,*,3,+", []ExpressionConfigurator{CaseInsensitiveOperators()}},
+		"precision":  {"qps,latency,*,3,+", []ExpressionConfigurator{Precision(2), RandomSeed(42)}},
+		"quoted":     {"'qps',latency,*,3,+", nil},
+	}
+	for name, item := range list {
+		exp, err := New(item.input, item.setters...)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", name, err, nil)
+		}
+		if actual := exp.Hash(); actual != expected.Hash() {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, actual, expected.Hash())
+		}
+		if !exp.Equal(expected) {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, false, true)
+		}
+	}
+}
+
+func TestHashDifferent(t *testing.T) {
+	list := map[string]struct {
+		input   string
+		setters []ExpressionConfigurator
+	}{
+		"base":           {"a,b,/", nil},
+		"operator":       {"a,b,*", nil},
+		"order":          {"b,a,/", nil},
+		"symbol":         {"a,c,/", nil},
+		"joined":         {"ab,c,/", nil},
+		"split":          {"a,bc,/", nil},
+		"number":         {"a,2,/", nil},
+		"negative zero":  {"a,-0,b,IF", nil},
+		"zero":           {"a,0,b,IF", nil},
+		"division":       {"a,b,/", []ExpressionConfigurator{DivisionByZero(DivisionByZeroError)}},
+		"comparisons":    {"a,b,/", []ExpressionConfigurator{ComparisonsWithNaN(ComparisonFalse)}},
+		"interval":       {"a,b,/", []ExpressionConfigurator{SecondsPerInterval(60)}},
+		"budget":         {"a,b,/", []ExpressionConfigurator{EvaluationBudget(100)}},
+		"costs":          {"a,b,/", []ExpressionConfigurator{OperatorCosts(map[string]int{"/": 2})}},
+		"checked":        {"a,b,/", []ExpressionConfigurator{CheckedArithmetic()}},
+		"three valued":   {"a,b,/", []ExpressionConfigurator{ThreeValuedLogic()}},
+		"reject nan":     {"a,b,/", []ExpressionConfigurator{RejectNaNInputs()}},
+		"reject unknown": {"a,b,/", []ExpressionConfigurator{RejectUnknownBool()}},
+		"strict":         {"a,b,/", []ExpressionConfigurator{StrictAggregates()}},
+		"stack limit":    {"a,b,/", []ExpressionConfigurator{StackLimit(100)}},
+		"time zone":      {"a,b,/", []ExpressionConfigurator{TimeZone("UTC")}},
+		"whole series":   {"a,b,/", []ExpressionConfigurator{WholeSeriesTrend()}},
+	}
+	seen := make(map[uint64]string)
+	compiled := make(map[string]*Expression)
+	for name, item := range list {
+		exp, err := New(item.input, item.setters...)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", name, err, nil)
+		}
+		hash := exp.Hash()
+		if other, ok := seen[hash]; ok {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, other, "distinct hash")
+		}
+		seen[hash] = name
+		for otherName, other := range compiled {
+			if exp.Equal(other) {
+				t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, otherName, "not equal")
+			}
+		}
+		compiled[name] = exp
+	}
+}
+
+func TestHashStable(t *testing.T) {
+	exp, err := New("qps,latency,*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// changing this value changes the hash of every expression, which requires a new major version
+	if actual, expected := exp.Hash(), uint64(0x7b444bb0f7ae9688); actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+}
@@ -0,0 +1,130 @@
+package gorpn
+
+import (
+	"math"
+	"sort"
+)
+
+// maxHistogramBuckets is the most buckets the HIST operator pushes on the stack, so that a few
+// values far apart from one another cannot exhaust memory.
+const maxHistogramBuckets = 1 << 16
+
+// Histogram counts values in buckets of equal width, where each bucket holds the values no smaller
+// than its lower bound and smaller than its upper bound, and the bounds of every bucket are
+// multiples of the width. Only the count of each bucket is retained, so that the distribution of
+// very many values may be summarized in little memory, which complements the PERCENT operator for
+// series too large to push every value on the stack.
+//
+//	func example(latencies []float64) {
+//		h, err := gorpn.NewHistogram(10)
+//		if err != nil {
+//			panic(err)
+//		}
+//		for _, latency := range latencies {
+//			h.Add(latency)
+//		}
+//		p99 := h.Percentile(99)
+//	}
+type Histogram struct {
+	width  float64
+	counts map[float64]uint64 // count of values in each bucket, keyed by lower bound divided by width
+	total  uint64
+}
+
+// Bucket is one bucket of a Histogram, along with the count of values it holds.
+type Bucket struct {
+	Lower, Upper float64
+	Count        uint64
+}
+
+// NewHistogram returns an empty Histogram with buckets of the specified width, or an error when the
+// width is not a positive finite number.
+func NewHistogram(width float64) (*Histogram, error) {
+	if math.IsNaN(width) || math.IsInf(width, 0) || width <= 0 {
+		return nil, newErrSyntax("cannot use %v as bucket width", width)
+	}
+	return &Histogram{width: width, counts: make(map[float64]uint64)}, nil
+}
+
+// Add counts each value in the bucket that holds it. Just as with AVG, UNKN values are ignored,
+// along with infinite values, which no bucket holds.
+func (h *Histogram) Add(values ...float64) {
+	for _, value := range values {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			continue
+		}
+		h.counts[math.Floor(value/h.width)]++
+		h.total++
+	}
+}
+
+// Width returns the width of each bucket of the Histogram.
+func (h *Histogram) Width() float64 {
+	return h.width
+}
+
+// Count returns the number of values counted by the Histogram.
+func (h *Histogram) Count() uint64 {
+	return h.total
+}
+
+// Buckets returns the buckets of the Histogram that hold at least one value, ordered from smallest
+// to largest lower bound.
+func (h *Histogram) Buckets() []Bucket {
+	indexes := h.indexes()
+	buckets := make([]Bucket, len(indexes))
+	for i, index := range indexes {
+		buckets[i] = Bucket{Lower: index * h.width, Upper: (index + 1) * h.width, Count: h.counts[index]}
+	}
+	return buckets
+}
+
+// Percentile returns an estimate of the specified percentile of the values counted by the
+// Histogram, using the nearest rank method just like the PERCENT operator does. Because the
+// individual values are not retained, the estimate is the upper bound of the bucket that holds the
+// value of that rank, and so never understates the percentile by more than the width of a bucket.
+// It returns NaN when the Histogram is empty, or when the percentile is not greater than 0 and no
+// greater than 100.
+func (h *Histogram) Percentile(percent float64) float64 {
+	if h.total == 0 || !(percent > 0 && percent <= 100) {
+		return math.NaN()
+	}
+	rank := uint64(math.Ceil(percent / 100 * float64(h.total)))
+	var seen uint64
+	for _, index := range h.indexes() {
+		if seen += h.counts[index]; seen >= rank {
+			return (index + 1) * h.width
+		}
+	}
+	return math.NaN() // not reached
+}
+
+// span returns the count of every bucket from the smallest through the largest bucket that holds a
+// value, including the empty buckets between them, and true, or false when there are more than
+// maxHistogramBuckets of them.
+func (h *Histogram) span() ([]uint64, bool) {
+	indexes := h.indexes()
+	if len(indexes) == 0 {
+		return nil, true
+	}
+	first, last := indexes[0], indexes[len(indexes)-1]
+	if last-first >= maxHistogramBuckets {
+		return nil, false
+	}
+	counts := make([]uint64, int(last-first)+1)
+	for _, index := range indexes {
+		counts[int(index-first)] = h.counts[index]
+	}
+	return counts, true
+}
+
+// indexes returns the lower bound divided by the width of each bucket that holds a value, in
+// ascending order.
+func (h *Histogram) indexes() []float64 {
+	indexes := make([]float64, 0, len(h.counts))
+	for index := range h.counts {
+		indexes = append(indexes, index)
+	}
+	sort.Float64s(indexes)
+	return indexes
+}
@@ -0,0 +1,106 @@
+package gorpn
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestHistogram(t *testing.T) {
+	for _, width := range []float64{0, -1, math.NaN(), math.Inf(1)} {
+		if _, err := NewHistogram(width); err == nil {
+			t.Errorf("Case: %v; Actual: %#v; Expected: error", width, err)
+		}
+	}
+
+	h, err := NewHistogram(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual := h.Percentile(50); !math.IsNaN(actual) {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, math.NaN())
+	}
+	h.Add(3, 12, 15, 19, 20, -4, 47, math.NaN(), math.Inf(1))
+	if actual, expected := h.Count(), uint64(7); actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+	expected := []Bucket{
+		{Lower: -10, Upper: 0, Count: 1},
+		{Lower: 0, Upper: 10, Count: 1},
+		{Lower: 10, Upper: 20, Count: 3},
+		{Lower: 20, Upper: 30, Count: 1},
+		{Lower: 40, Upper: 50, Count: 1},
+	}
+	if actual := h.Buckets(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+	percentiles := map[float64]float64{1: 0, 50: 20, 71: 20, 72: 30, 100: 50}
+	for percent, expected := range percentiles {
+		if actual := h.Percentile(percent); actual != expected {
+			t.Errorf("Case: %v; Actual: %#v; Expected: %#v", percent, actual, expected)
+		}
+	}
+	if actual := h.Percentile(101); !math.IsNaN(actual) {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, math.NaN())
+	}
+}
+
+func TestNewExpressionHIST(t *testing.T) {
+	errors := map[string]string{
+		"1,2,3,0,10,HIST":    "syntax error : HIST operator requires positive finite integer: 0",
+		"1,2,3,4,10,HIST":    "syntax error : HIST operand requires 4 items, but only 3 on stack",
+		"1,2,3,3,0,HIST":     "syntax error : HIST operator requires positive finite bucket width: 0",
+		"1,2,3,3,UNKN,HIST":  "syntax error : HIST operator requires positive finite bucket width: NaN",
+		"0,1e9,2,1,HIST":     "syntax error : HIST operator requires more than 65536 buckets of width 1",
+		"series,NEGINF,HIST": "syntax error : HIST operator requires positive finite bucket width: -Inf",
+	}
+	for i, e := range errors {
+		if _, err := New(i); err == nil || err.Error() != e {
+			t.Errorf("Case: %s; Actual: %s; Expected: %#v", i, err, e)
+		}
+	}
+	list := map[string]string{
+		"3,12,15,19,47,5,10,HIST":      "1,3,0,0,1,5",
+		"3,12,UNKN,3,10,HIST":          "1,1,2",
+		"UNKN,1,10,HIST":               "0",
+		"3,12,15,19,47,5,10,HIST,SMAX": "3",
+		"a,12,15,3,10,HIST":            "a,12,15,3,10,HIST", // cannot bin variables
+		"series,10,HIST":               "series,10,HIST",
+		"7,series,10,HIST,POP,POP":     "7,series,10,HIST,POP,POP",
+		"1,2,a,+,3,2,HIST":             "1,2,a,+,3,2,HIST",
+		"42,43,44,3,1,HIST":            "1,1,1,3",
+	}
+	for input, output := range list {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if exp.String() != output {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, exp.String(), output)
+		}
+	}
+}
+
+func TestEvaluateHISTSeries(t *testing.T) {
+	exp, err := New("latency,100,HIST,SMAX")
+	if err != nil {
+		t.Fatal(err)
+	}
+	series := make([]float64, 1000)
+	for i := range series {
+		series[i] = float64(i % 250) // 100 values in [200, 250), 400 in [0, 100) and [100, 200)
+	}
+	value, err := exp.Evaluate(map[string]interface{}{"latency": series})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := 400.0; value != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", value, expected)
+	}
+
+	// a symbol bound to a number is a count of values rather than a series
+	_, err = exp.Evaluate(map[string]interface{}{"latency": 42})
+	if expected := "syntax error : HIST operand requires 42 items, but only 0 on stack"; err == nil || err.Error() != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", err, expected)
+	}
+}
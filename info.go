@@ -0,0 +1,56 @@
+package gorpn
+
+import "math"
+
+// Info describes what went into the result of evaluating an Expression.
+type Info struct {
+	// Unknown is true when a NaN value, such as UNKN or a symbol bound to NaN, was an operand of an
+	// operator while evaluating, or is the result itself.
+	Unknown bool
+
+	// NaNBindings lists the symbols of the Expression that were bound to NaN, in sorted order.
+	NaNBindings []string
+}
+
+// EvaluateWithInfo evaluates the Expression just like Evaluate, and also returns Info describing
+// whether any unknown values participated in computing the result, and which symbols were bound to
+// NaN. Alert engines may use it to distinguish a threshold that was not breached from insufficient
+// data, even when an operator such as AVG or UN hides the unknown value from the result. Unknown
+// values in a series, and numbers folded when the Expression was created, are not reported.
+//
+//	func example() {
+//		exp, err := gorpn.New("a,b,c,3,AVG,100,GT")
+//		if err != nil {
+//			panic(err)
+//		}
+//		value, info, err := exp.EvaluateWithInfo(map[string]interface{}{"a": 120, "b": math.NaN(), "c": 90})
+//		// value is 1, info.Unknown is true, and info.NaNBindings is []string{"b"}
+//	}
+func (e *Expression) EvaluateWithInfo(bindings map[string]interface{}) (float64, Info, error) {
+	var info Info
+	trace := e.trace
+	e.info = &info
+	e.trace = func(event TraceEvent) {
+		if !event.Deferred {
+			for _, input := range event.Inputs {
+				if v, ok := input.(float64); ok && math.IsNaN(v) {
+					info.Unknown = true
+				}
+			}
+		}
+		if trace != nil {
+			trace(event)
+		}
+	}
+	defer func() { e.trace, e.info = trace, nil }()
+
+	value, err := e.Evaluate(bindings)
+	if err != nil {
+		return 0, Info{}, err
+	}
+	if math.IsNaN(value) {
+		info.Unknown = true
+	}
+	info.NaNBindings = uniqueSorted(info.NaNBindings)
+	return value, info, nil
+}
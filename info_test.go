@@ -0,0 +1,90 @@
+package gorpn
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestEvaluateWithInfo(t *testing.T) {
+	nan := math.NaN()
+	list := map[string]struct {
+		input    string
+		bindings map[string]interface{}
+		value    float64
+		info     Info
+	}{
+		"known":        {"a,b,+", map[string]interface{}{"a": 1, "b": 2}, 3, Info{}},
+		"nan binding":  {"a,b,+", map[string]interface{}{"a": nan, "b": 2}, nan, Info{Unknown: true, NaNBindings: []string{"a"}}},
+		"hidden":       {"a,b,c,3,AVG,100,GT", map[string]interface{}{"a": 120, "b": nan, "c": 90}, 1, Info{Unknown: true, NaNBindings: []string{"b"}}},
+		"tested":       {"a,UN,0,a,IF", map[string]interface{}{"a": nan}, 0, Info{Unknown: true, NaNBindings: []string{"a"}}},
+		"alone":        {"a", map[string]interface{}{"a": nan}, nan, Info{Unknown: true, NaNBindings: []string{"a"}}},
+		"twice sorted": {"b,a,+,b,*", map[string]interface{}{"a": nan, "b": nan}, nan, Info{Unknown: true, NaNBindings: []string{"a", "b"}}},
+		"unused":       {"a,2,*", map[string]interface{}{"a": 1, "other": nan}, 2, Info{}},
+		"computed":     {"a,b,/", map[string]interface{}{"a": 0, "b": 0}, nan, Info{Unknown: true}},
+		"expression":   {"x,1,+", map[string]interface{}{"x": mustParse(t, "y,2,*"), "y": nan}, nan, Info{Unknown: true, NaNBindings: []string{"y"}}},
+	}
+	for name, item := range list {
+		exp, err := New(item.input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", name, err, nil)
+		}
+		value, info, err := exp.EvaluateWithInfo(item.bindings)
+		if err != nil {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, err, nil)
+			continue
+		}
+		if value != item.value && !(math.IsNaN(value) && math.IsNaN(item.value)) {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, value, item.value)
+		}
+		if !reflect.DeepEqual(info, item.info) {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, info, item.info)
+		}
+
+		// the Expression is left as it was found
+		if exp.trace != nil || exp.info != nil {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, "trace or info", nil)
+		}
+	}
+}
+
+func TestEvaluateWithInfoTrace(t *testing.T) {
+	var events int
+	exp, err := New("a,b,+", Trace(func(TraceEvent) { events++ }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	events = 0
+	if _, info, err := exp.EvaluateWithInfo(map[string]interface{}{"a": math.NaN(), "b": 1}); err != nil || !info.Unknown {
+		t.Errorf("Actual: %#v, %#v; Expected: %#v", info, err, Info{Unknown: true})
+	}
+	if events != 1 {
+		t.Errorf("Actual: %#v; Expected: %#v", events, 1)
+	}
+	if exp.trace == nil {
+		t.Errorf("Actual: %#v; Expected: %#v", nil, "trace")
+	}
+}
+
+func TestEvaluateWithInfoError(t *testing.T) {
+	exp, err := New("a,b,+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, info, err := exp.EvaluateWithInfo(map[string]interface{}{"a": math.NaN()})
+	if _, ok := err.(ErrOpenBindings); !ok {
+		t.Errorf("Actual: %#v; Expected: %#v", err, ErrOpenBindings{"b": ScalarKind})
+	}
+	if !reflect.DeepEqual(info, Info{}) {
+		t.Errorf("Actual: %#v; Expected: %#v", info, Info{})
+	}
+}
+
+func mustParse(t *testing.T, input string) *Expression {
+	t.Helper()
+	exp, err := New(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return exp
+}
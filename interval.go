@@ -0,0 +1,279 @@
+package gorpn
+
+import (
+	"fmt"
+	"math"
+)
+
+// Interval is the closed range of real numbers from Min to Max, inclusive. An Interval whose Min
+// and Max are equal holds a single number.
+type Interval struct {
+	Min, Max float64
+}
+
+// String returns the interval in the customary notation, such as "[1, 2]".
+func (i Interval) String() string {
+	return fmt.Sprintf("[%v, %v]", i.Min, i.Max)
+}
+
+// hull returns the smallest interval that holds each of values.
+func hull(values ...float64) Interval {
+	result := Interval{Min: math.Inf(1), Max: math.Inf(-1)}
+	for _, value := range values {
+		if math.IsNaN(value) {
+			return Interval{Min: math.NaN(), Max: math.NaN()}
+		}
+		result.Min = math.Min(result.Min, value)
+		result.Max = math.Max(result.Max, value)
+	}
+	return result
+}
+
+// isNaN returns true when the interval is unknown, which results from operations that are not
+// defined over the entire interval, such as the logarithm of an interval including negative
+// numbers.
+func (i Interval) isNaN() bool {
+	return math.IsNaN(i.Min) || math.IsNaN(i.Max)
+}
+
+func (i Interval) contains(value float64) bool {
+	return i.Min <= value && value <= i.Max
+}
+
+// EvaluateInterval evaluates the Expression using interval arithmetic, returning the interval that
+// holds every result the Expression may compute when each of its symbols is bound to any number
+// within its respective interval. This permits finding the possible range of a derived metric when
+// its inputs have known error bars, without evaluating the Expression for many sample inputs. The
+// interval is exact when each symbol appears once in the Expression, and otherwise may be wider
+// than necessary. Rounding errors of floating point arithmetic are not accounted for.
+//
+// The parts of the Expression that depend on a symbol may only use the +, -, *, /, ABS, ATAN, CEIL,
+// COS, DEG2RAD, EXP, FLOOR, GE, GT, IF, LE, LOG, LT, MAX, MIN, POW, RAD2DEG, SIN, and SQRT
+// operators. Comparisons result in [0, 1] when the intervals of their operands overlap, and an IF
+// whose condition may be either true or false results in the interval holding both of its
+// branches. Dividing by an interval that includes zero results in [-Inf, +Inf], and an operation
+// that is not defined over the entire interval of an operand, such as the logarithm of an interval
+// including negative numbers, results in an interval whose bounds are NaN.
+//
+//	func example() {
+//		exp, err := gorpn.New("qps,latency,*")
+//		if err != nil {
+//			panic(err)
+//		}
+//		concurrency, err := exp.EvaluateInterval(map[string]gorpn.Interval{
+//			"qps":     {Min: 900, Max: 1100},
+//			"latency": {Min: 0.05, Max: 0.2},
+//		})
+//		// concurrency is [45, 220]
+//	}
+func (e *Expression) EvaluateInterval(bindings map[string]Interval) (Interval, error) {
+	root, err := e.intervalTree(bindings, "evaluate interval of")
+	if err != nil {
+		return Interval{}, err
+	}
+	return evaluateInterval(root, bindings)
+}
+
+// intervalTree returns the expression tree of the Expression after ensuring bindings holds a valid
+// interval for each of its open bindings. Errors describe the analysis that cannot be performed
+// using verb, just like expressionTree.
+func (e *Expression) intervalTree(bindings map[string]Interval, verb string) (*node, error) {
+	for symbol, interval := range bindings {
+		if interval.isNaN() || interval.Min > interval.Max {
+			return nil, newErrSyntax("cannot bind %q to invalid interval: %v", symbol, interval)
+		}
+	}
+	root, err := expressionTree(e.tokens, verb)
+	if err != nil {
+		return nil, err
+	}
+	var openBindings []string
+	for symbol, count := range e.openBindings {
+		if _, ok := bindings[symbol]; count > 0 && !ok {
+			openBindings = append(openBindings, symbol)
+		}
+	}
+	if len(openBindings) > 0 {
+		return nil, e.errOpenBindings(openBindings, e.tokens)
+	}
+	return root, nil
+}
+
+// evaluateInterval returns the interval of the results computed by the tree n.
+func evaluateInterval(n *node, bindings map[string]Interval) (Interval, error) {
+	if !n.isOperator() {
+		if value, ok := n.token.(float64); ok {
+			return hull(value), nil
+		}
+		return bindings[n.token.(string)], nil
+	}
+
+	operands := make([]Interval, len(n.children))
+	for i, child := range n.children {
+		operand, err := evaluateInterval(child, bindings)
+		if err != nil {
+			return Interval{}, err
+		}
+		operands[i] = operand
+	}
+	return applyInterval(n, operands)
+}
+
+// applyInterval returns the interval of the results computed by the operator of n, given the
+// intervals of its operands.
+func applyInterval(n *node, operands []Interval) (Interval, error) {
+	a := operands[0]
+	for _, operand := range operands {
+		if operand.isNaN() && n.token != "IF" { // IF ignores the branch it does not take
+			return hull(math.NaN()), nil
+		}
+	}
+
+	switch n.token {
+	case "+":
+		return Interval{a.Min + operands[1].Min, a.Max + operands[1].Max}, nil
+	case "-":
+		return Interval{a.Min - operands[1].Max, a.Max - operands[1].Min}, nil
+	case "*":
+		return multiplyIntervals(a, operands[1]), nil
+	case "/":
+		return divideIntervals(a, operands[1]), nil
+	case "ABS":
+		if a.Min >= 0 {
+			return a, nil
+		}
+		if a.Max <= 0 {
+			return Interval{-a.Max, -a.Min}, nil
+		}
+		return Interval{0, math.Max(-a.Min, a.Max)}, nil
+	case "ATAN":
+		return Interval{math.Atan(a.Min), math.Atan(a.Max)}, nil
+	case "CEIL":
+		return Interval{math.Ceil(a.Min), math.Ceil(a.Max)}, nil
+	case "COS":
+		return sineInterval(Interval{a.Min + math.Pi/2, a.Max + math.Pi/2}), nil
+	case "DEG2RAD":
+		return Interval{a.Min * math.Pi / 180, a.Max * math.Pi / 180}, nil
+	case "EXP":
+		return Interval{math.Exp(a.Min), math.Exp(a.Max)}, nil
+	case "FLOOR":
+		return Interval{math.Floor(a.Min), math.Floor(a.Max)}, nil
+	case "GE", "GT", "LE", "LT":
+		return compareIntervals(n.token.(string), a, operands[1]), nil
+	case "IF":
+		if a.isNaN() {
+			return hull(math.NaN()), nil
+		}
+		if !a.contains(0) {
+			return operands[1], nil
+		}
+		if a.Min == 0 && a.Max == 0 {
+			return operands[2], nil
+		}
+		if operands[1].isNaN() || operands[2].isNaN() {
+			return hull(math.NaN()), nil
+		}
+		return Interval{math.Min(operands[1].Min, operands[2].Min), math.Max(operands[1].Max, operands[2].Max)}, nil
+	case "LOG":
+		if a.Min < 0 {
+			return hull(math.NaN()), nil
+		}
+		return Interval{math.Log(a.Min), math.Log(a.Max)}, nil
+	case "MAX":
+		return Interval{math.Max(a.Min, operands[1].Min), math.Max(a.Max, operands[1].Max)}, nil
+	case "MIN":
+		return Interval{math.Min(a.Min, operands[1].Min), math.Min(a.Max, operands[1].Max)}, nil
+	case "POW":
+		return powerInterval(a, operands[1]), nil
+	case "RAD2DEG":
+		return Interval{a.Min * 180 / math.Pi, a.Max * 180 / math.Pi}, nil
+	case "SIN":
+		return sineInterval(a), nil
+	case "SQRT":
+		if a.Min < 0 {
+			return hull(math.NaN()), nil
+		}
+		return Interval{math.Sqrt(a.Min), math.Sqrt(a.Max)}, nil
+	}
+	return Interval{}, newErrSyntax("cannot evaluate interval of %s operator", n.token)
+}
+
+// multiplyIntervals returns the interval of the products of a and b, taking zero times an infinite
+// bound to be zero.
+func multiplyIntervals(a, b Interval) Interval {
+	product := func(x, y float64) float64 {
+		if x == 0 || y == 0 {
+			return 0
+		}
+		return x * y
+	}
+	return hull(product(a.Min, b.Min), product(a.Min, b.Max), product(a.Max, b.Min), product(a.Max, b.Max))
+}
+
+// divideIntervals returns the interval of the quotients of a and b, which is the entire real line
+// when b includes zero.
+func divideIntervals(a, b Interval) Interval {
+	if b.contains(0) {
+		return Interval{math.Inf(-1), math.Inf(1)}
+	}
+	return multiplyIntervals(a, Interval{1 / b.Max, 1 / b.Min})
+}
+
+// compareIntervals returns [1, 1] when the comparison holds for every pair of numbers from a and b,
+// [0, 0] when it holds for none, and [0, 1] otherwise.
+func compareIntervals(operator string, a, b Interval) Interval {
+	var always, never bool
+	switch operator {
+	case "GE":
+		always, never = a.Min >= b.Max, a.Max < b.Min
+	case "GT":
+		always, never = a.Min > b.Max, a.Max <= b.Min
+	case "LE":
+		always, never = a.Max <= b.Min, a.Min > b.Max
+	case "LT":
+		always, never = a.Max < b.Min, a.Min >= b.Max
+	}
+	switch {
+	case always:
+		return Interval{1, 1}
+	case never:
+		return Interval{0, 0}
+	}
+	return Interval{0, 1}
+}
+
+// powerInterval returns the interval of a raised to the powers in b. A negative base may only be
+// raised to a single integer power.
+func powerInterval(a, b Interval) Interval {
+	if b.Min == b.Max && b.Min == math.Trunc(b.Min) && !math.IsInf(b.Min, 0) {
+		n := b.Min
+		if n < 0 {
+			return divideIntervals(hull(1), powerInterval(a, hull(-n)))
+		}
+		if math.Mod(n, 2) == 0 && a.contains(0) { // even powers are least at zero
+			return Interval{math.Pow(0, n), math.Max(math.Pow(a.Min, n), math.Pow(a.Max, n))}
+		}
+		return hull(math.Pow(a.Min, n), math.Pow(a.Max, n))
+	}
+	if a.Min < 0 {
+		return hull(math.NaN())
+	}
+	// with a non-negative base, the power is monotonic in each operand, so its extremes are corners
+	return hull(math.Pow(a.Min, b.Min), math.Pow(a.Min, b.Max), math.Pow(a.Max, b.Min), math.Pow(a.Max, b.Max))
+}
+
+// sineInterval returns the interval of the sines of a.
+func sineInterval(a Interval) Interval {
+	if a.Max-a.Min >= 2*math.Pi || math.IsInf(a.Min, 0) || math.IsInf(a.Max, 0) {
+		return Interval{-1, 1}
+	}
+	result := hull(math.Sin(a.Min), math.Sin(a.Max))
+	// sine is greatest at pi/2 + 2k pi, and least at 3pi/2 + 2k pi
+	if k := math.Ceil((a.Min - math.Pi/2) / (2 * math.Pi)); a.contains(math.Pi/2 + 2*k*math.Pi) {
+		result.Max = 1
+	}
+	if k := math.Ceil((a.Min - 3*math.Pi/2) / (2 * math.Pi)); a.contains(3*math.Pi/2 + 2*k*math.Pi) {
+		result.Min = -1
+	}
+	return result
+}
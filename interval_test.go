@@ -0,0 +1,135 @@
+package gorpn
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestEvaluateInterval(t *testing.T) {
+	bindings := map[string]Interval{
+		"a": {Min: 1, Max: 2},
+		"b": {Min: -3, Max: 4},
+		"c": {Min: 0, Max: 0},
+		"d": {Min: -2, Max: -1},
+	}
+	list := map[string]Interval{
+		"a":              {1, 2},
+		"42":             {42, 42},
+		"a,b,+":          {-2, 6},
+		"a,b,-":          {-3, 5},
+		"a,b,*":          {-6, 8},
+		"b,b,*":          {-12, 16}, // wider than necessary, because b appears twice
+		"b,2,POW":        {0, 16},
+		"b,3,POW":        {-27, 64},
+		"a,-1,POW":       {0.5, 1},
+		"a,b,POW":        {0.125, 16},
+		"b,0.5,POW":      {math.NaN(), math.NaN()},
+		"1,a,/":          {0.5, 1},
+		"1,b,/":          {math.Inf(-1), math.Inf(1)},
+		"1,d,/":          {-1, -0.5},
+		"b,ABS":          {0, 4},
+		"d,ABS":          {1, 2},
+		"a,b,MAX":        {1, 4},
+		"a,b,MIN":        {-3, 2},
+		"a,LOG":          {0, math.Log(2)},
+		"b,SQRT":         {math.NaN(), math.NaN()},
+		"b,SIN":          {-1, 1},
+		"a,SIN":          {math.Sin(1), 1},
+		"c,COS":          {1, 1},
+		"a,b,GT":         {0, 1},
+		"a,d,GT":         {1, 1},
+		"d,a,GE":         {0, 0},
+		"a,d,GT,a,b,IF":  {1, 2},
+		"c,a,b,IF":       {-3, 4},
+		"b,a,d,IF":       {-2, 2},
+		"d,0,LT,a,-1,IF": {1, 2},
+		"c,a,b,SQRT,IF":  {math.NaN(), math.NaN()},
+		"c,b,SQRT,a,IF":  {1, 2}, // untaken branch is ignored
+	}
+	for input, expected := range list {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		actual, err := exp.EvaluateInterval(bindings)
+		if err != nil {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+			continue
+		}
+		if expected.isNaN() {
+			if !actual.isNaN() {
+				t.Errorf("Case: %s; Actual: %v; Expected: %v", input, actual, expected)
+			}
+		} else if math.Abs(actual.Min-expected.Min) > 1e-12 || math.Abs(actual.Max-expected.Max) > 1e-12 {
+			t.Errorf("Case: %s; Actual: %v; Expected: %v", input, actual, expected)
+		}
+	}
+}
+
+func TestEvaluateIntervalErrors(t *testing.T) {
+	errors := map[string]string{
+		"a,b,+":        "open bindings: b",
+		"a,2,TREND":    "syntax error : cannot evaluate interval of TREND operator",
+		"a,a,2,SORT,+": "syntax error : cannot evaluate interval of SORT operator",
+		"a,1,+,1,SHL":  "syntax error : cannot evaluate interval of SHL operator",
+		"a,1":          "syntax error : cannot evaluate interval of expression that leaves 2 items on stack",
+	}
+	for input, expected := range errors {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if _, err = exp.EvaluateInterval(map[string]Interval{"a": {1, 2}}); err == nil || err.Error() != expected {
+			t.Errorf("Case: %s; Actual: %v; Expected: %#v", input, err, expected)
+		}
+	}
+
+	exp, err := New("a,1,+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	invalid := map[string]Interval{
+		"syntax error : cannot bind \"a\" to invalid interval: [2, 1]":     {2, 1},
+		"syntax error : cannot bind \"a\" to invalid interval: [NaN, NaN]": {math.NaN(), math.NaN()},
+	}
+	for expected, interval := range invalid {
+		if _, err = exp.EvaluateInterval(map[string]Interval{"a": interval}); err == nil || err.Error() != expected {
+			t.Errorf("Case: %v; Actual: %v; Expected: %#v", interval, err, expected)
+		}
+	}
+}
+
+func TestEvaluateIntervalHoldsResults(t *testing.T) {
+	bindings := map[string]Interval{"x": {Min: 0.5, Max: 3}, "y": {Min: -2, Max: 1.5}}
+	list := []string{
+		"x,y,*,x,/,y,-",
+		"x,y,POW,y,EXP,+",
+		"x,LOG,y,COS,*",
+		"y,ABS,SQRT,x,MAX,y,MIN",
+		"y,0,GT,x,y,IF,3,*",
+		"x,4,POW,y,3,POW,-,x,ATAN,+",
+	}
+	r := rand.New(rand.NewSource(42))
+	for _, input := range list {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		interval, err := exp.EvaluateInterval(bindings)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		for i := 0; i < 1000; i++ {
+			x := 0.5 + 2.5*r.Float64()
+			y := -2 + 3.5*r.Float64()
+			value, err := exp.Evaluate(map[string]interface{}{"x": x, "y": y})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !interval.contains(value) {
+				t.Fatalf("Case: %s; x: %v; y: %v; Actual: %v; Expected: within %v", input, x, y, value, interval)
+			}
+		}
+	}
+}
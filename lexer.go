@@ -0,0 +1,282 @@
+package gorpn
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// quote is the character used to surround a symbol that would otherwise not survive tokenizing,
+// such as a label that contains the delimiter.
+const quote = '\''
+
+// escape is the character used to include the following character in a token verbatim, both
+// inside and outside of quotes.
+const escape = '\\'
+
+// reserved lists the tokens besides operators that have a special meaning in an RPN expression.
+var reserved = map[string]bool{
+	"DAY": true, "HOUR": true, "INF": true, "LTIME": true, "MINUTE": true, "NEGINF": true,
+	"NEWDAY": true, "NEWMONTH": true, "NEWWEEK": true, "NEWYEAR": true, "NOW": true,
+	"STEPWIDTH": true, "TIME": true, "UNKN": true, "WEEK": true,
+}
+
+// rrdtoolBindings lists the words of rrdtool RPN that are not reserved, because the program
+// evaluating an expression binds them like any other symbol.
+var rrdtoolBindings = map[string]bool{"COUNT": true, "PREV": true}
+
+// IsReserved returns true when symbol is a word of rrdtool RPN rather than a name of the caller's
+// choosing: an operator, a reserved word such as TIME or NEWDAY, or one of COUNT, PREV, and
+// PREV(vname), which must be bound when evaluating like any other symbol.
+//
+//	func example(exp *gorpn.Expression) {
+//		for _, symbol := range exp.OpenBindings() {
+//			if !gorpn.IsReserved(symbol) {
+//				fmt.Println("data source:", symbol)
+//			}
+//		}
+//	}
+func IsReserved(symbol string) bool {
+	if isOperatorName(symbol) || rrdtoolBindings[symbol] {
+		return true
+	}
+	return len(symbol) > len("PREV()") && strings.HasPrefix(symbol, "PREV(") && strings.HasSuffix(symbol, ")")
+}
+
+// lexeme is a single token read from an RPN expression.
+type lexeme struct {
+	text   string
+	quoted bool // true iff text was quoted or escaped, and therefore must be a symbol
+	offset int  // byte offset of the start of the token in the expression
+	end    int  // byte offset just past the end of the token in the expression
+}
+
+// tokenize splits an RPN expression into its tokens. Whitespace surrounding each token is ignored,
+// unless the whitespace is part of the delimiter. A token surrounded by single quotes, or one that
+// includes characters escaped by a backslash, may contain the delimiter or whitespace, and is
+// always treated as a symbol. When delimiter is empty, tokens are instead separated by runs of
+// whitespace.
+//
+//	'host,1.qps',1000,*   ==>   ["host,1.qps", "1000", "*"]
+//	host\,1.qps, 1000, *   ==>   ["host,1.qps", "1000", "*"]
+//	'host 1.qps'  1000 *   ==>   ["host 1.qps", "1000", "*"]   (empty delimiter)
+func tokenize(someExpression, delimiter string) ([]lexeme, error) {
+	var lexemes []lexeme
+	var current, pending strings.Builder // pending holds whitespace that may turn out to be trailing
+	var quoted, inQuotes, afterQuotes, escaped bool
+	var started bool // true once the first non-whitespace character of the token has been read
+	offset, last := 0, 0
+
+	emit := func(end int) error {
+		if !started {
+			offset, last = end, end
+		}
+		if current.Len() == 0 && !quoted {
+			return newErrSyntax("empty token at offset %d", offset)
+		}
+		lexemes = append(lexemes, lexeme{current.String(), quoted, offset, last})
+		current.Reset()
+		pending.Reset()
+		quoted, afterQuotes, started = false, false, false
+		return nil
+	}
+
+	for i := 0; i < len(someExpression); {
+		r, width := utf8.DecodeRuneInString(someExpression[i:])
+		switch {
+		case escaped:
+			current.WriteString(pending.String())
+			pending.Reset()
+			current.WriteRune(r)
+			escaped = false
+		case inQuotes:
+			if r == escape {
+				escaped = true
+			} else if r == quote {
+				inQuotes, afterQuotes = false, true
+			} else {
+				current.WriteRune(r)
+			}
+		case delimiter == "" && unicode.IsSpace(r):
+			if started {
+				if err := emit(i); err != nil {
+					return nil, err
+				}
+			}
+		case delimiter != "" && strings.HasPrefix(someExpression[i:], delimiter):
+			if err := emit(i); err != nil {
+				return nil, err
+			}
+			i += len(delimiter)
+			continue
+		case unicode.IsSpace(r):
+			if started && !afterQuotes {
+				pending.WriteRune(r)
+			}
+			i += width
+			continue // trailing whitespace is not part of the token
+		case afterQuotes:
+			return nil, newErrSyntax("unexpected character after closing quote at offset %d: %c", i, r)
+		case r == escape:
+			if !started {
+				started, offset = true, i
+			}
+			escaped, quoted = true, true
+		case r == quote && !started:
+			started, offset = true, i
+			inQuotes, quoted = true, true
+		default:
+			if !started {
+				started, offset = true, i
+			}
+			current.WriteString(pending.String())
+			pending.Reset()
+			current.WriteRune(r)
+		}
+		i += width
+		last = i
+	}
+	if inQuotes {
+		return nil, newErrSyntax("unterminated quote at offset %d", offset)
+	}
+	if escaped {
+		return nil, newErrSyntax("escape character at end of expression")
+	}
+	if started || delimiter != "" {
+		if err := emit(len(someExpression)); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, l := range lexemes {
+		if l.quoted {
+			if l.text == "" {
+				return nil, newErrSyntax("empty quoted token at offset %d", l.offset)
+			}
+			if _, ok := arity[l.text]; ok || reserved[l.text] {
+				return nil, newErrSyntax("cannot quote operator at offset %d: %s", l.offset, l.text)
+			}
+		}
+	}
+	return lexemes, nil
+}
+
+// detectableDelimiters are the delimiters NewAutoDelimiter looks for, in the order they are
+// reported when an expression contains more than one.
+var detectableDelimiters = []rune{',', '|', ';'}
+
+// detectDelimiter returns the delimiter used by an RPN expression: whichever detectable delimiter
+// appears outside quoted and escaped symbols, or when none does, the empty string when tokens are
+// separated by whitespace, or the default delimiter when there is only one token.
+func detectDelimiter(someExpression string) (string, error) {
+	var found []rune
+	var inQuotes, escaped, whitespace, started bool
+	pending := false // whitespace seen since the last character of a token
+	for _, r := range someExpression {
+		switch {
+		case escaped:
+			escaped = false
+		case r == escape:
+			escaped = true
+		case inQuotes:
+			inQuotes = r != quote
+		case r == quote:
+			inQuotes = true
+		case unicode.IsSpace(r):
+			pending = started
+			continue
+		case strings.ContainsRune(string(detectableDelimiters), r):
+			if !strings.ContainsRune(string(found), r) {
+				found = append(found, r)
+			}
+		}
+		whitespace = whitespace || pending
+		pending, started = false, true
+	}
+
+	switch len(found) {
+	case 0:
+		if whitespace {
+			return "", nil
+		}
+		return newConfig().delimiter, nil
+	case 1:
+		return string(found[0]), nil
+	}
+	var candidates []string
+	for _, r := range detectableDelimiters {
+		if strings.ContainsRune(string(found), r) {
+			candidates = append(candidates, fmt.Sprintf("%q", r))
+		}
+	}
+	return "", newErrSyntax("cannot detect delimiter: expression contains %s", strings.Join(candidates, " and "))
+}
+
+// quoteSymbol returns symbol as it must be written in an RPN expression using delimiter, so that
+// reading it back yields the same symbol.
+func quoteSymbol(symbol, delimiter string) string {
+	needsQuotes := symbol == "" || strings.Contains(symbol, delimiter) ||
+		(strings.TrimSpace(delimiter) == "" && strings.IndexFunc(symbol, unicode.IsSpace) >= 0) ||
+		strings.ContainsRune(symbol, quote) || strings.ContainsRune(symbol, escape) ||
+		strings.TrimSpace(symbol) != symbol
+	if !needsQuotes {
+		if _, ok := parseNumber(symbol); !ok {
+			return symbol
+		}
+		// would otherwise be read back as a number
+	}
+	return quoteAlways(symbol)
+}
+
+// quoteAlways returns symbol surrounded by quotes, escaping the quote and escape characters within
+// it.
+func quoteAlways(symbol string) string {
+	var quoted strings.Builder
+	quoted.WriteRune(quote)
+	for _, r := range symbol {
+		if r == quote || r == escape {
+			quoted.WriteRune(escape)
+		}
+		quoted.WriteRune(r)
+	}
+	quoted.WriteRune(quote)
+	return quoted.String()
+}
+
+// parseNumber returns the numerical value of a literal token, and true, when the token is a
+// number. Accepted forms include integers and decimals with an optional sign ("42", "-1.5", "+.5",
+// "1_000"), scientific notation ("1.5e3", "1E-6"), hexadecimal floating point ("0x1p-2"), and the
+// case insensitive special values "NaN", "Inf", "+Inf", "-Inf", and "Infinity". Literals too large
+// to represent are taken to be ±Inf, and those too small to represent are taken to be zero.
+func parseNumber(token string) (float64, bool) {
+	value, err := strconv.ParseFloat(token, 64)
+	if err != nil {
+		if ne, ok := err.(*strconv.NumError); !ok || ne.Err != strconv.ErrRange {
+			return 0, false
+		}
+		// ParseFloat returns ±Inf or zero as appropriate for values out of range
+	}
+	return value, true
+}
+
+// formatNumber returns the literal token for value with prec digits after the decimal point, or
+// when prec is negative, the shortest literal token that parseNumber reads back as value. NaN,
+// +Inf, and -Inf are written as UNKN, INF, and NEGINF, respectively.
+func formatNumber(value float64, prec int) string {
+	switch {
+	case math.IsNaN(value):
+		// return "NaN" // would prefer this
+		return "UNKN" // don't like this
+	case math.IsInf(value, 1):
+		return "INF"
+	case math.IsInf(value, -1):
+		return "NEGINF"
+	case prec >= 0:
+		return strconv.FormatFloat(value, 'f', prec, 64)
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
@@ -0,0 +1,339 @@
+package gorpn
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNewExpressionQuotedSymbols(t *testing.T) {
+	list := map[string]string{
+		"'host,1.qps',1000,*":     "'host,1.qps',1000,*",
+		`host\,1.qps,1000,*`:      "'host,1.qps',1000,*",
+		"'plain',2,*":             "plain,2,*",
+		"'5',2,*":                 "'5',2,*", // quoted numbers are symbols
+		`'it\'s',2,*`:             `'it\'s',2,*`,
+		`'back\\slash',2,*`:       `'back\\slash',2,*`,
+		"'a,b','a,b',+":           "'a,b','a,b',+",
+		"'a,b','c,d',GT,1,2,IF":   "'a,b','c,d',GT,1,2,IF",
+		"'sp ace',1,+":            "sp ace,1,+",
+		"'not''a',1,+":            "", // errors expected when output is empty
+		"'unterminated,1,+":       "",
+		`trailing\`:               "",
+		"'',1,+":                  "",
+		"'+',1,+":                 "",
+		"'TIME',1,+":              "",
+		"'a'b,1,+":                "",
+		"1,2,+,'x',*":             "3,x,*",
+		"'x',DUP,'x',+":           "x,x,x,+",
+		"'1e3','1e3',EQ":          "1",
+		"'host|1'|2|*":            "",
+		"'INFINITY',1,+":          "'INFINITY',1,+",
+		"'UNKN_count',1,+":        "UNKN_count,1,+",
+		"'a,b',2,*,'a,b',2,*,+":   "'a,b',2,*,DUP,+",
+		"'nested \\' quote',1,+":  "'nested \\' quote',1,+",
+		"'comma, then space',1,+": "'comma, then space',1,+",
+		"'üñíçødé,label',1,+":     "'üñíçødé,label',1,+",
+		"'trailing,',1,+":         "'trailing,',1,+",
+		",'leading',1,+":          "",
+		"'x',1,+,":                "",
+	}
+	for input, output := range list {
+		exp, err := New(input)
+		if output == "" {
+			if _, ok := err.(ErrSyntax); !ok {
+				t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, err, ErrSyntax{})
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if exp.String() != output {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, exp.String(), output)
+		}
+	}
+}
+
+func TestQuotedSymbolsRoundTrip(t *testing.T) {
+	bindings := map[string]interface{}{
+		"host,1.qps": 3,
+		"it's":       5,
+		`a\b`:        7,
+		"42":         11,
+	}
+	for _, delimiter := range []rune{',', '|', ' '} {
+		for symbol, value := range bindings {
+			exp, err := New(quoteSymbol(symbol, string(delimiter))+string(delimiter)+"2"+string(delimiter)+"*", Delimiter(delimiter))
+			if err != nil {
+				t.Fatalf("Case: %q; Actual: %#v; Expected: %#v", symbol, err, nil)
+			}
+			exp2, err := New(exp.String(), Delimiter(delimiter))
+			if err != nil {
+				t.Fatalf("Case: %q; Actual: %#v; Expected: %#v", symbol, err, nil)
+			}
+			actual, err := exp2.Evaluate(bindings)
+			if err != nil {
+				t.Fatalf("Case: %q; Actual: %#v; Expected: %#v", symbol, err, nil)
+			}
+			if expected := float64(2 * value.(int)); actual != expected {
+				t.Errorf("Case: %q; Actual: %#v; Expected: %#v", symbol, actual, expected)
+			}
+		}
+	}
+}
+
+func TestDelimiterRejectsQuotingCharacters(t *testing.T) {
+	for _, delimiter := range []rune{'\'', '\\'} {
+		if _, err := New("13", Delimiter(delimiter)); err == nil {
+			t.Errorf("Case: %c; Actual: %#v; Expected: %#v", delimiter, err, ErrSyntax{})
+		}
+	}
+}
+
+func TestNewExpressionToleratesWhitespace(t *testing.T) {
+	list := map[string]string{
+		" 5 , 3 , + ":              "8",
+		"5,\t3,\n+":                "8",
+		"foo bar , 2 , *":          "foo bar,2,*",
+		"' padded ' , 2 , *":       "' padded ',2,*",
+		`foo\ , 2, *`:              "'foo ',2,*",
+		" 5　,3,+":                  "8", // ideographic space
+		"ünïcödé , 2 , *":          "ünïcödé,2,*",
+		"12 , âge , *":             "12,âge,*",
+		"5 , 3 , + , foo , *":      "8,foo,*",
+		"INF , NEGINF , MAX , 1,+": "INF",
+	}
+	for input, output := range list {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %q; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if exp.String() != output {
+			t.Errorf("Case: %q; Actual: %#v; Expected: %#v", input, exp.String(), output)
+		}
+	}
+}
+
+func TestNewExpressionMultiRuneDelimiter(t *testing.T) {
+	exp, err := New("42 :: 13 :: 2 :: MEDIAN :: foo :: +", DelimiterString("::"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "27.5::foo::+"; exp.String() != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", exp.String(), expected)
+	}
+
+	exp, err = New("a→b→+", DelimiterString("→"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "a→b→+"; exp.String() != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", exp.String(), expected)
+	}
+
+	for _, delimiter := range []string{"", "+", "a'b", `\`} {
+		if _, err := New("13", DelimiterString(delimiter)); err == nil {
+			t.Errorf("Case: %q; Actual: %#v; Expected: %#v", delimiter, err, ErrSyntax{})
+		}
+	}
+}
+
+func TestTokenizeOffsets(t *testing.T) {
+	lexemes, err := tokenize("5, 'a,b' ,  foo,été,+", ",")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []lexeme{
+		{"5", false, 0, 1},
+		{"a,b", true, 3, 8},
+		{"foo", false, 12, 15},
+		{"été", false, 16, 21},
+		{"+", false, 22, 23},
+	}
+	if len(lexemes) != len(expected) {
+		t.Fatalf("Actual: %#v; Expected: %#v", lexemes, expected)
+	}
+	for i := range expected {
+		if lexemes[i] != expected[i] {
+			t.Errorf("Case: %d; Actual: %#v; Expected: %#v", i, lexemes[i], expected[i])
+		}
+	}
+}
+
+func TestTokenizeWhitespace(t *testing.T) {
+	lexemes, err := tokenize("  5\t'a b'  foo\n\t+ ", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []lexeme{
+		{"5", false, 2, 3},
+		{"a b", true, 4, 9},
+		{"foo", false, 11, 14},
+		{"+", false, 16, 17},
+	}
+	if len(lexemes) != len(expected) {
+		t.Fatalf("Actual: %#v; Expected: %#v", lexemes, expected)
+	}
+	for i := range expected {
+		if lexemes[i] != expected[i] {
+			t.Errorf("Case: %d; Actual: %#v; Expected: %#v", i, lexemes[i], expected[i])
+		}
+	}
+}
+
+func TestWhitespaceDelimited(t *testing.T) {
+	list := map[string]string{
+		"5 3 + foo *":        "8 foo *",
+		"5\t3  +\n\tfoo *\n": "8 foo *",
+		"'foo bar'  'a,b' +": "'foo bar' a,b +",
+		"'foo\tbar' 2 *":     "'foo\tbar' 2 *",
+		"  a  ":              "a",
+	}
+	for input, output := range list {
+		exp, err := New(input, WhitespaceDelimited())
+		if err != nil {
+			t.Fatalf("Case: %q; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if actual := exp.String(); actual != output {
+			t.Errorf("Case: %q; Actual: %#v; Expected: %#v", input, actual, output)
+		}
+		// what String writes reads back as the same expression
+		again, err := New(exp.String(), WhitespaceDelimited())
+		if err != nil {
+			t.Fatalf("Case: %q; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if actual := again.String(); actual != output {
+			t.Errorf("Case: %q; Actual: %#v; Expected: %#v", input, actual, output)
+		}
+	}
+
+	// the last delimiter configured wins
+	exp, err := New("a,b,+", WhitespaceDelimited(), Delimiter(','))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "a,b,+"; exp.String() != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", exp.String(), expected)
+	}
+}
+
+func TestTokenizeErrorsReportOffsets(t *testing.T) {
+	list := map[string]string{
+		"5,,+":           "syntax error : empty token at offset 2",
+		"5, ,+":          "syntax error : empty token at offset 3",
+		"5,3,":           "syntax error : empty token at offset 4",
+		"5,'abc":         "syntax error : unterminated quote at offset 2",
+		"5,'abc'd,+":     "syntax error : unexpected character after closing quote at offset 7: d",
+		"5,'',+":         "syntax error : empty quoted token at offset 2",
+		"5,  'MAX',+":    "syntax error : cannot quote operator at offset 4: MAX",
+		`5,3,+\`:         "syntax error : escape character at end of expression",
+		"ünï,'abc'd":     "syntax error : unexpected character after closing quote at offset 11: d",
+		"'x',  \t'y'z,+": "syntax error : unexpected character after closing quote at offset 10: z",
+	}
+	for input, expected := range list {
+		_, err := New(input)
+		if err == nil || err.Error() != expected {
+			t.Errorf("Case: %q; Actual: %v; Expected: %#v", input, err, expected)
+		}
+	}
+}
+
+func TestNewExpressionNumericLiterals(t *testing.T) {
+	list := map[string]string{
+		"1.5e3":          "1500",
+		"1E-6":           "1e-06",
+		"+.5":            "0.5",
+		"-1.5":           "-1.5",
+		"0x1p-2":         "0.25",
+		"1000000":        "1e+06",
+		"NaN":            "UNKN",
+		"nan":            "UNKN",
+		"Inf":            "INF",
+		"+Inf":           "INF",
+		"-Inf":           "NEGINF",
+		"infinity":       "INF",
+		"-INFINITY":      "NEGINF",
+		"1e400":          "INF",
+		"-1e400":         "NEGINF",
+		"1e-400":         "0",
+		"0.1,0.2,+":      "0.30000000000000004",
+		"1_000":          "1000",   // digit separators as in Go syntax
+		"1__000":         "1__000", // not a number, so a symbol
+		"0x10":           "0x10",   // hexadecimal requires an exponent
+		"1.5e3,x,*":      "1500,x,*",
+		"'1.5e3',x,*":    "'1.5e3',x,*",
+		"'NaN',x,*":      "'NaN',x,*",
+		"'infinity',2,*": "'infinity',2,*",
+	}
+	for input, output := range list {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if exp.String() != output {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, exp.String(), output)
+		}
+	}
+}
+
+func TestNewExpressionStringRoundTrip(t *testing.T) {
+	bindings := map[string]interface{}{
+		"a":        1.0 / 3,
+		"b":        1e-300,
+		"1.5e3":    7,
+		"c,d":      11,
+		"infinity": 13,
+		"series":   []float64{1, 2, 3, 4},
+	}
+	list := []string{
+		"a,3,*",
+		"a,b,/",
+		"0.1,0.2,+,a,*",
+		"1e21,a,*",
+		"5e-324,b,+",
+		"1.7976931348623157e308,a,*",
+		"'1.5e3',2,/",
+		"'c,d',a,*",
+		"'infinity',UNKN,ADDNAN",
+		"a,INF,MIN,NEGINF,MAX",
+		"series,600,TREND,a,+",
+		"a,b,GT,a,b,IF",
+		"a,0.1,+,a,0.1,+,*",
+	}
+	for _, input := range list {
+		exp1, err := New(input, SecondsPerInterval(300))
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		exp2, err := New(exp1.String(), SecondsPerInterval(300))
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if exp1.String() != exp2.String() {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, exp2.String(), exp1.String())
+		}
+		value1, err := exp1.Evaluate(bindings)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		value2, err := exp2.Evaluate(bindings)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if value1 != value2 && !(math.IsNaN(value1) && math.IsNaN(value2)) {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, value2, value1)
+		}
+	}
+}
+
+func TestIsReserved(t *testing.T) {
+	list := map[string]bool{
+		"+": true, "MAX": true, "TIME": true, "NEWDAY": true, "COUNT": true, "PREV": true,
+		"PREV(a)": true, "PREV()": false, "PREVa": false, "a": false, "time": false, "servers.MAX": false,
+	}
+	for symbol, expected := range list {
+		if actual := IsReserved(symbol); actual != expected {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", symbol, actual, expected)
+		}
+	}
+}
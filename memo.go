@@ -0,0 +1,175 @@
+package gorpn
+
+import (
+	"container/list"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// memoSize specifies the maximum number of results each Expression retains for EvaluateMemo.
+const memoSize = 64
+
+// memoKey identifies a memoized result by the key given by the caller and the encoding of the
+// bindings, which is compared in full, so that bindings that merely hash alike never share a
+// result.
+type memoKey struct {
+	key      string
+	bindings string
+}
+
+type memoEntry struct {
+	key    memoKey
+	result float64
+	bound  []*Expression // keeps the Expressions whose addresses are encoded in key from being reused
+}
+
+// memoTable is a fixed size least recently used cache of the results of evaluating an Expression.
+// Its lock also serializes the evaluations themselves, which share the work area of the Expression.
+type memoTable struct {
+	lock    sync.Mutex
+	entries map[memoKey]*list.Element
+	order   *list.List // front is most recently used
+}
+
+// memoTablesLock guards the lazy creation of the memoTable of each Expression.
+var memoTablesLock sync.Mutex
+
+// EvaluateMemo evaluates the Expression just like Evaluate, but remembers the result, so that
+// evaluating the Expression again with an identical set of bindings and the same key returns the
+// remembered result without evaluating the Expression again. This is useful when several panels of
+// a dashboard request the same expression with the same bindings during a single render. The key
+// scopes the remembered results, for instance to a single render, so that a result remembered
+// under one key is never returned for another. Bindings are compared by value, except that symbols
+// bound to an *Expression must be bound to the very same *Expression. Errors are never remembered,
+// nor are results of expressions that use the NOW, RANDOM, or GAUSSIAN operators, or that have a
+// symbol bound to a *float64 or a func() float64. Only the most recently used results are retained.
+//
+// Unlike Evaluate, EvaluateMemo is safe for concurrent use by multiple goroutines.
+//
+//	func example(exp *gorpn.Expression, renderID string, bindings map[string]interface{}) {
+//		for _, panel := range panels {
+//			value, err := exp.EvaluateMemo(bindings, renderID) // evaluated once per render
+//		}
+//	}
+func (e *Expression) EvaluateMemo(bindings map[string]interface{}, key string) (float64, error) {
+	coerced, err := e.coerceMapValuesToFloat64(bindings)
+	if err != nil {
+		return 0, err
+	}
+	memo := e.memoTable()
+	memo.lock.Lock()
+	defer memo.lock.Unlock()
+
+	if !isDeterministic(e.tokens, coerced) {
+		return e.Evaluate(bindings)
+	}
+	mk := memoKey{key: key, bindings: encodeBindings(coerced)}
+	if element, ok := memo.entries[mk]; ok {
+		memo.order.MoveToFront(element)
+		return element.Value.(*memoEntry).result, nil
+	}
+	result, err := e.Evaluate(bindings)
+	if err != nil {
+		return 0, err
+	}
+	var bound []*Expression
+	for _, value := range coerced {
+		if exp, ok := value.(*Expression); ok {
+			bound = append(bound, exp)
+		}
+	}
+	memo.entries[mk] = memo.order.PushFront(&memoEntry{mk, result, bound})
+	for memo.order.Len() > memoSize {
+		element := memo.order.Back()
+		memo.order.Remove(element)
+		delete(memo.entries, element.Value.(*memoEntry).key)
+	}
+	return result, nil
+}
+
+// memoTable returns the memoTable of the Expression, creating it when first needed.
+func (e *Expression) memoTable() *memoTable {
+	memoTablesLock.Lock()
+	defer memoTablesLock.Unlock()
+	if e.memo == nil {
+		e.memo = &memoTable{entries: make(map[memoKey]*list.Element), order: list.New()}
+	}
+	return e.memo
+}
+
+// isDeterministic returns true unless tokens, or one of the expressions bound in bindings, uses an
+// operator whose result differs from one evaluation to the next, or bindings has a live value.
+func isDeterministic(tokens []interface{}, bindings map[string]interface{}) bool {
+	for _, tok := range tokens {
+		switch tok {
+		case "NOW", "RANDOM", "GAUSSIAN":
+			return false
+		}
+	}
+	for _, value := range bindings {
+		switch v := value.(type) {
+		case *Expression:
+			if !isDeterministic(v.tokens, nil) {
+				return false
+			}
+		case *float64, func() float64:
+			return false // live values may change between evaluations
+		}
+	}
+	return true
+}
+
+// encodeBindings returns an encoding of the coerced bindings that does not depend on the order in
+// which the map is traversed, and that differs for bindings that differ. An Expression bound to a
+// symbol is encoded by its address.
+func encodeBindings(bindings map[string]interface{}) string {
+	keys := make([]string, 0, len(bindings))
+	for key := range bindings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var h strings.Builder
+	var buf [8]byte
+	writeFloat := func(value float64) {
+		binary.LittleEndian.PutUint64(buf[:], math.Float64bits(value))
+		h.Write(buf[:])
+	}
+	for _, key := range keys {
+		binary.LittleEndian.PutUint64(buf[:], uint64(len(key)))
+		h.Write(buf[:])
+		h.WriteString(key)
+		switch value := bindings[key].(type) {
+		case float64:
+			h.Write([]byte{'f'})
+			writeFloat(value)
+		case []float64:
+			h.Write([]byte{'s'})
+			binary.LittleEndian.PutUint64(buf[:], uint64(len(value)))
+			h.Write(buf[:])
+			for _, item := range value {
+				writeFloat(item)
+			}
+		case SeriesBinding:
+			h.Write([]byte{'S'})
+			binary.LittleEndian.PutUint64(buf[:], uint64(value.Step))
+			h.Write(buf[:])
+			binary.LittleEndian.PutUint64(buf[:], uint64(value.Start.UnixNano()))
+			h.Write(buf[:])
+			binary.LittleEndian.PutUint64(buf[:], uint64(len(value.Values)))
+			h.Write(buf[:])
+			for _, item := range value.Values {
+				writeFloat(item)
+			}
+		case *Expression:
+			h.WriteByte('e')
+			binary.LittleEndian.PutUint64(buf[:], uint64(reflect.ValueOf(value).Pointer()))
+			h.Write(buf[:])
+		}
+	}
+	return h.String()
+}
@@ -0,0 +1,164 @@
+package gorpn
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEvaluateMemo(t *testing.T) {
+	var evaluations int
+	exp, err := New("a,b,+", Trace(func(TraceEvent) { evaluations++ }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	evaluations = 0
+	list := []struct {
+		bindings    map[string]interface{}
+		key         string
+		result      float64
+		evaluations int
+	}{
+		{map[string]interface{}{"a": 1, "b": 2}, "render1", 3, 1},
+		{map[string]interface{}{"a": 1.0, "b": int64(2)}, "render1", 3, 1}, // same values, other types
+		{map[string]interface{}{"a": 2, "b": 1}, "render1", 3, 2},
+		{map[string]interface{}{"a": 1, "b": 2}, "render2", 3, 3},
+		{map[string]interface{}{"a": 1, "b": 2, "c": 3}, "render1", 3, 4},
+		{map[string]interface{}{"a": 1, "b": 2}, "render1", 3, 4},
+	}
+	for i, item := range list {
+		value, err := exp.EvaluateMemo(item.bindings, item.key)
+		if err != nil {
+			t.Fatalf("Case: %d; Actual: %#v; Expected: %#v", i, err, nil)
+		}
+		if value != item.result {
+			t.Errorf("Case: %d; Actual: %#v; Expected: %#v", i, value, item.result)
+		}
+		if evaluations != item.evaluations {
+			t.Errorf("Case: %d; Actual: %#v; Expected: %#v", i, evaluations, item.evaluations)
+		}
+	}
+
+	// errors are not remembered
+	if _, err = exp.EvaluateMemo(map[string]interface{}{"a": 1}, "render1"); err == nil {
+		t.Errorf("Actual: %#v; Expected: error", err)
+	}
+	if _, err = exp.EvaluateMemo(map[string]interface{}{"a": "1", "b": 2}, "render1"); err == nil {
+		t.Errorf("Actual: %#v; Expected: error", err)
+	}
+}
+
+func TestEvaluateMemoSeries(t *testing.T) {
+	exp, err := New("series,1,HIST,SMAX")
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := map[float64][]float64{2: {1, 1, 3}, 3: {1, 3, 3, 3}, 1: {1}}
+	for expected, series := range list {
+		value, err := exp.EvaluateMemo(map[string]interface{}{"series": series}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value != expected {
+			t.Errorf("Case: %v; Actual: %#v; Expected: %#v", series, value, expected)
+		}
+	}
+}
+
+func TestEvaluateMemoNondeterministic(t *testing.T) {
+	exp, err := New("x,RANDOM,+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := exp.EvaluateMemo(map[string]interface{}{"x": 1}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := exp.EvaluateMemo(map[string]interface{}{"x": 1}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second {
+		t.Errorf("Actual: %#v; Expected: different values", second)
+	}
+
+	// neither is an expression bound to a symbol that uses RANDOM
+	exp, err = New("x,1,+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	random, err := New("RANDOM")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err = exp.EvaluateMemo(map[string]interface{}{"x": random}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err = exp.EvaluateMemo(map[string]interface{}{"x": random}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second {
+		t.Errorf("Actual: %#v; Expected: different values", second)
+	}
+}
+
+func TestEvaluateMemoConcurrent(t *testing.T) {
+	exp, err := New("a,b,*,c,+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			bindings := map[string]interface{}{"a": i % 4, "b": 3, "c": 1}
+			value, err := exp.EvaluateMemo(bindings, "render")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if expected := float64(i%4*3 + 1); value != expected {
+				t.Errorf("Case: %d; Actual: %#v; Expected: %#v", i, value, expected)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestEncodeBindingsDistinguishesBindings(t *testing.T) {
+	exp, err := New("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := New("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := []map[string]interface{}{
+		{},
+		{"a": 1.0},
+		{"a": 2.0},
+		{"b": 1.0},
+		{"a": 1.0, "b": 1.0},
+		{"a": []float64{1}},
+		{"a": []float64{1, 1}},
+		{"a": SeriesBinding{Values: []float64{1}, Step: time.Second}},
+		{"a": exp},
+		{"a": other},
+		{"a\x00": 1.0},
+	}
+	seen := make(map[string]int)
+	for i, bindings := range list {
+		encoding := encodeBindings(bindings)
+		if j, ok := seen[encoding]; ok {
+			t.Errorf("Case: %v; Actual: same encoding as %v; Expected: different encoding", bindings, list[j])
+		}
+		seen[encoding] = i
+		if again := encodeBindings(bindings); again != encoding {
+			t.Errorf("Case: %v; Actual: %q; Expected: %q", bindings, again, encoding)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package gorpn
+
+import (
+	"errors"
+	"time"
+)
+
+// Metrics receives measurements of the health of the RPN Expressions configured with it, so that
+// services embedding this library may export them to a monitoring system such as Prometheus
+// without wrapping every call site. Each method corresponds to a metric: Evaluated to a counter of
+// evaluations, a counter of errors labeled by their kind, and a histogram of evaluation durations,
+// and Compiled to a histogram of fold ratios. Because expressions may be evaluated by several
+// goroutines at once, implementations must be safe for concurrent use.
+type Metrics interface {
+	// Evaluated is invoked after each evaluation with how long it took, and with the kind of error
+	// it returned, such as "syntax" or "open_bindings", or the empty string when it succeeded. The
+	// kinds are short, fixed strings that are suitable as the values of metric labels.
+	Evaluated(duration time.Duration, errorKind string)
+
+	// Compiled is invoked by New with the fraction of the tokens of the expression that were
+	// removed by simplifying it, such as 0.4 when "60,60,*,qps,*" becomes "3600,qps,*".
+	Compiled(foldRatio float64)
+}
+
+// WithMetrics allows registering a Metrics implementation that receives a measurement each time an
+// RPN Expression is compiled by New, and each time it is evaluated by Evaluate, or by a method
+// built upon it, such as EvaluateBool, EvaluateMemo, or EvaluateResolver. Expressions returned by
+// NewCached from its cache are not compiled again, so they do not invoke Compiled.
+//
+//	type promMetrics struct {
+//		evaluations prometheus.Counter
+//		errors      *prometheus.CounterVec
+//		durations   prometheus.Histogram
+//		foldRatios  prometheus.Histogram
+//	}
+//
+//	func (m promMetrics) Evaluated(duration time.Duration, errorKind string) {
+//		m.evaluations.Inc()
+//		if errorKind != "" {
+//			m.errors.WithLabelValues(errorKind).Inc()
+//		}
+//		m.durations.Observe(duration.Seconds())
+//	}
+//
+//	func (m promMetrics) Compiled(foldRatio float64) {
+//		m.foldRatios.Observe(foldRatio)
+//	}
+//
+//	func example(m promMetrics) {
+//		exp, err := gorpn.New("60,60,*,qps,*", gorpn.WithMetrics(m))
+//		if err != nil {
+//			panic(err)
+//		}
+//	}
+func WithMetrics(metrics Metrics) ExpressionConfigurator {
+	return func(e *Expression) error {
+		e.metrics = metrics
+		return nil
+	}
+}
+
+// foldRatio returns the fraction of count tokens that are not in the program of the Expression.
+func (e *Expression) foldRatio(count int) float64 {
+	if count == 0 || len(e.tokens) >= count {
+		return 0 // rewrite rules may lengthen a program
+	}
+	return 1 - float64(len(e.tokens))/float64(count)
+}
+
+// errorKind returns the kind of err reported to Metrics, or the empty string when err is nil.
+func errorKind(err error) string {
+	if err == nil {
+		return ""
+	}
+	switch {
+	case errors.As(err, &ErrInternal{}):
+		return "internal"
+	case errors.As(err, &ErrCallbackPanic{}):
+		return "callback_panic"
+	case errors.As(err, &ErrOpenBindings{}):
+		return "open_bindings"
+	case errors.As(err, &ErrBadBindingType{}):
+		return "bad_binding_type"
+	case errors.As(err, &ErrNaNInput{}):
+		return "nan_input"
+	case errors.As(err, &ErrDivisionByZero{}):
+		return "division_by_zero"
+	case errors.As(err, &ErrOverflow{}):
+		return "overflow"
+	case errors.As(err, &ErrUnderflow{}):
+		return "underflow"
+	case errors.As(err, &ErrLimitExceeded{}):
+		return "stack_limit"
+	case errors.As(err, &ErrBudgetExceeded{}):
+		return "budget"
+	case errors.As(err, &ErrSyntax{}):
+		return "syntax"
+	}
+	return "other"
+}
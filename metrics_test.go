@@ -0,0 +1,142 @@
+package gorpn
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingMetrics records the measurements it receives.
+type recordingMetrics struct {
+	lock       sync.Mutex
+	errorKinds []string
+	durations  []time.Duration
+	foldRatios []float64
+}
+
+func (m *recordingMetrics) Evaluated(duration time.Duration, errorKind string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.durations = append(m.durations, duration)
+	m.errorKinds = append(m.errorKinds, errorKind)
+}
+
+func (m *recordingMetrics) Compiled(foldRatio float64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.foldRatios = append(m.foldRatios, foldRatio)
+}
+
+func TestMetricsCompiled(t *testing.T) {
+	list := map[string]struct {
+		input    string
+		setters  []ExpressionConfigurator
+		expected float64
+	}{
+		"folded":      {"60,60,*,qps,*", nil, 0.4},
+		"unchanged":   {"qps,60,*", nil, 0},
+		"no simplify": {"60,60,*,qps,*", []ExpressionConfigurator{NoSimplify()}, 0},
+		"constant":    {"1,2,+,3,*", nil, 0.8},
+	}
+	for name, item := range list {
+		metrics := new(recordingMetrics)
+		if _, err := New(item.input, append(item.setters, WithMetrics(metrics))...); err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", name, err, nil)
+		}
+		if len(metrics.foldRatios) != 1 || metrics.foldRatios[0] != item.expected {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, metrics.foldRatios, []float64{item.expected})
+		}
+	}
+}
+
+func TestMetricsEvaluated(t *testing.T) {
+	list := map[string]struct {
+		input    string
+		bindings map[string]interface{}
+		expected string
+	}{
+		"success":          {"a,b,+", map[string]interface{}{"a": 1, "b": 2}, ""},
+		"open bindings":    {"a,b,+", map[string]interface{}{"a": 1}, "open_bindings"},
+		"untaken branch":   {"a,b,c,IF", map[string]interface{}{"a": 1, "b": 2}, ""},
+		"bad binding type": {"a,b,+", map[string]interface{}{"a": 1, "b": "two"}, "bad_binding_type"},
+		"division":         {"a,b,/", map[string]interface{}{"a": 1, "b": 0}, "division_by_zero"},
+		"time":             {"TIME,60,+", map[string]interface{}{"TIME": 60}, ""},
+	}
+	for name, item := range list {
+		metrics := new(recordingMetrics)
+		exp, err := New(item.input, DivisionByZero(DivisionByZeroError), WithMetrics(metrics))
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", name, err, nil)
+		}
+		_, _ = exp.Evaluate(item.bindings)
+		if len(metrics.errorKinds) != 1 || metrics.errorKinds[0] != item.expected {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, metrics.errorKinds, []string{item.expected})
+		}
+		if len(metrics.durations) != 1 || metrics.durations[0] < 0 {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, metrics.durations, "one duration")
+		}
+	}
+}
+
+func TestMetricsCopies(t *testing.T) {
+	metrics := new(recordingMetrics)
+	exp, err := New("a,b,GT", WithMetrics(metrics))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = exp.EvaluateBool(map[string]interface{}{"a": 2, "b": 1}); err != nil {
+		t.Fatal(err)
+	}
+	partial, err := exp.Partial(map[string]interface{}{"a": 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = partial.Clone().Evaluate(map[string]interface{}{"b": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if actual, expected := len(metrics.errorKinds), 2; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+
+	PurgeCache()
+	first := new(recordingMetrics)
+	if _, err = NewCached("a,b,LT", WithMetrics(first)); err != nil {
+		t.Fatal(err)
+	}
+	second := new(recordingMetrics)
+	cached, err := NewCached("a,b,LT", WithMetrics(second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cached.Evaluate(map[string]interface{}{"a": 2, "b": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if len(first.errorKinds) != 0 || len(second.errorKinds) != 1 {
+		t.Errorf("Actual: %#v, %#v; Expected: %#v, %#v", len(first.errorKinds), len(second.errorKinds), 0, 1)
+	}
+}
+
+func TestErrorKind(t *testing.T) {
+	list := map[string]struct {
+		err      error
+		expected string
+	}{
+		"nil":       {nil, ""},
+		"syntax":    {newErrSyntax("bad"), "syntax"},
+		"budget":    {ErrBudgetExceeded{}, "budget"},
+		"overflow":  {ErrOverflow{}, "overflow"},
+		"underflow": {ErrUnderflow{}, "underflow"},
+		"limit":     {ErrLimitExceeded{}, "stack_limit"},
+		"nan":       {ErrNaNInput{"a"}, "nan_input"},
+		"internal":  {ErrInternal{}, "internal"},
+		"callback":  {ErrCallbackPanic{}, "callback_panic"},
+		"wrapped":   {ErrExpression{Name: "a", Err: ErrOpenBindings{"a": ScalarKind}}, "open_bindings"},
+		"other":     {errors.New("other"), "other"},
+	}
+	for name, item := range list {
+		if actual := errorKind(item.err); actual != item.expected {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, actual, item.expected)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package gorpn
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// treeOperators are the operators that pop a fixed number of operands and push a single result
+// that depends only on those operands. Programs composed solely of these operators and leaf
+// values can be represented as a forest of expression trees, which the optimization passes below
+// rely upon.
+var treeOperators = map[string]bool{
+	"%": true, "*": true, "+": true, "-": true, "/": true, "ABS": true, "ADDNAN": true, "ATAN": true,
+	"ATAN2": true, "BITAND": true, "BITOR": true, "CEIL": true, "COS": true, "DEG2RAD": true,
+	"EQ": true, "EXP": true, "FLOOR": true, "GE": true, "GT": true, "IF": true, "ISINF": true,
+	"LE": true, "LIMIT": true, "LOG": true, "LT": true, "MAX": true, "MAXNAN": true, "MIN": true,
+	"MINNAN": true, "MODINT": true, "NE": true, "POW": true, "RAD2DEG": true, "SHL": true,
+	"SHR": true, "SIN": true, "SQRT": true, "TREND": true, "TRENDNAN": true, "UN": true,
+}
+
+// node is an element of an expression tree: either a leaf value (a number or a symbol), or an
+// operator along with the subtrees that compute its operands.
+type node struct {
+	token    interface{}
+	children []*node
+	key      string      // canonical representation, equal for structurally identical subtrees
+	size     int         // number of tokens required to compute this subtree
+	source   SourceRange // range of the source from which this token was derived, when known
+}
+
+func newNode(token interface{}, children []*node) *node {
+	n := &node{token: token, children: children, size: 1}
+	keys := make([]string, 0, len(children)+1)
+	for _, child := range children {
+		keys = append(keys, child.key)
+		n.size += child.size
+	}
+	switch v := token.(type) {
+	case float64:
+		keys = append(keys, strconv.FormatFloat(v, 'g', -1, 64))
+	case string:
+		keys = append(keys, v)
+	}
+	n.key = "(" + strings.Join(keys, " ") + ")"
+	return n
+}
+
+func (n *node) isOperator() bool {
+	return len(n.children) > 0
+}
+
+// buildForest converts a stored program into the forest of expression trees it computes, with one
+// root per item the program leaves on the stack. It returns false when the program contains
+// operators whose stack effect depends on run time values, such as COPY or SORT.
+func buildForest(tokens []interface{}) ([]*node, bool) {
+	var stack []*node
+	for _, tok := range tokens {
+		token, ok := tok.(string)
+		if !ok {
+			stack = append(stack, newNode(tok, nil))
+			continue
+		}
+		opArity, isOperator := arity[token]
+		if !isOperator {
+			stack = append(stack, newNode(token, nil))
+			continue
+		}
+		if !treeOperators[token] || len(stack) < opArity.popCount {
+			return nil, false
+		}
+		children := make([]*node, opArity.popCount)
+		copy(children, stack[len(stack)-opArity.popCount:])
+		stack = append(stack[:len(stack)-opArity.popCount], newNode(token, children))
+	}
+	return stack, true
+}
+
+// emitForest converts a forest of expression trees back into a stored program.
+func emitForest(roots []*node) []interface{} {
+	var tokens []interface{}
+	var emit func(*node)
+	emit = func(n *node) {
+		for _, child := range n.children {
+			emit(child)
+		}
+		tokens = append(tokens, n.token)
+	}
+	for _, root := range roots {
+		emit(root)
+	}
+	return tokens
+}
+
+// eliminateCommonSubexpressions rewrites a stored program so that an operator subtree computed
+// more than once is only computed the first time, provided its value is still on the stack when
+// it is needed again. Later occurrences are replaced by DUP, when the value is on top of the stack,
+// or by n,INDEX otherwise, each derived from the source of the occurrence it replaces. It also
+// returns the source range of each token when given those of tokens.
+//
+//	a,b,+,a,b,+,*   ==>   a,b,+,DUP,*
+//	a,b,+,c,a,b,+,*,+   ==>   a,b,+,c,2,INDEX,*,+
+func eliminateCommonSubexpressions(tokens []interface{}, sources []SourceRange) ([]interface{}, []SourceRange) {
+	roots, ok := buildForest(tokens)
+	if !ok {
+		return tokens, sources
+	}
+	if sources != nil {
+		annotateSources(roots, sources)
+	}
+
+	var optimized []interface{}
+	var optimizedSources []SourceRange
+	var stack []string // keys of values on the stack while the optimized program runs
+	var emit func(*node)
+	emit = func(n *node) {
+		if n.isOperator() {
+			for depth := 1; depth <= len(stack); depth++ {
+				if stack[len(stack)-depth] != n.key {
+					continue
+				}
+				extent := n.extent()
+				if depth == 1 {
+					optimized = append(optimized, "DUP")
+					optimizedSources = append(optimizedSources, extent)
+				} else if n.size > 2 {
+					optimized = append(optimized, float64(depth), "INDEX")
+					optimizedSources = append(optimizedSources, extent, extent)
+				} else {
+					break // not worth replacing
+				}
+				stack = append(stack, n.key)
+				return
+			}
+		}
+		for _, child := range n.children {
+			emit(child)
+		}
+		optimized = append(optimized, n.token)
+		optimizedSources = append(optimizedSources, n.source)
+		stack = append(stack[:len(stack)-len(n.children)], n.key)
+	}
+	for _, root := range roots {
+		emit(root)
+	}
+
+	if len(optimized) < len(tokens) {
+		if sources == nil {
+			return optimized, nil
+		}
+		return optimized, optimizedSources
+	}
+	return tokens, sources
+}
+
+// associativeOperators are the operators whose operands may be regrouped and reordered without
+// changing the result, along with how to combine two constant operands. Although + and * are
+// associative for real numbers, they are not for floating point numbers, where regrouping changes
+// how results are rounded, or whether they overflow: x,1e308,+,1e308,+ is not x,INF,+ when x is
+// -1e308, and x,1,+,1,+ is not x,2,+ when x is 2^53.
+var associativeOperators = map[string]func(a, b float64) float64{
+	"MAX": math.Max,
+	"MIN": math.Min,
+}
+
+// reassociateConstants rewrites chains of associative operators so that all constant operands in
+// the chain are combined into a single constant, which is applied last, and derived from the
+// sources of all the constants it combines. It returns false when no chain could be shortened. It
+// also returns the source range of each token when given those of tokens.
+//
+//	x,2,MAX,3,MAX   ==>   x,3,MAX
+//	1,x,MIN,y,MIN,5,MIN   ==>   x,y,MIN,1,MIN
+func reassociateConstants(tokens []interface{}, sources []SourceRange) ([]interface{}, []SourceRange, bool) {
+	roots, ok := buildForest(tokens)
+	if !ok {
+		return tokens, sources, false
+	}
+	if sources != nil {
+		annotateSources(roots, sources)
+	}
+
+	var changed bool
+	var rewrite func(*node) *node
+	rewrite = func(n *node) *node {
+		if !n.isOperator() {
+			return n
+		}
+		children := make([]*node, len(n.children))
+		for i, child := range n.children {
+			children[i] = rewrite(child)
+		}
+		source := n.source
+		n = newNode(n.token, children)
+		n.source = source
+
+		op := n.token.(string)
+		combine, ok := associativeOperators[op]
+		if !ok {
+			return n
+		}
+
+		var operands []*node
+		var constant float64
+		var constantSource SourceRange
+		var constantCount int
+		var flatten func(*node)
+		flatten = func(n *node) {
+			if token, ok := n.token.(string); ok && token == op {
+				for _, child := range n.children {
+					flatten(child)
+				}
+				return
+			}
+			if value, ok := n.token.(float64); ok {
+				if constantCount == 0 {
+					constant, constantSource = value, n.source
+				} else {
+					constant, constantSource = combine(constant, value), constantSource.union(n.source)
+				}
+				constantCount++
+				return
+			}
+			operands = append(operands, n)
+		}
+		flatten(n)
+
+		if constantCount < 2 || len(operands) == 0 {
+			return n // nothing to gather, or simplify already folds it
+		}
+		changed = true
+		chain := operands[0]
+		for _, operand := range operands[1:] {
+			chain = newNode(op, []*node{chain, operand})
+			chain.source = source
+		}
+		combined := newNode(constant, nil)
+		combined.source = constantSource
+		n = newNode(op, []*node{chain, combined})
+		n.source = source
+		return n
+	}
+
+	for i, root := range roots {
+		roots[i] = rewrite(root)
+	}
+	if !changed {
+		return tokens, sources, false
+	}
+	if sources == nil {
+		return emitForest(roots), nil, true
+	}
+	return emitForest(roots), emitSources(roots), true
+}
+
+// eliminateDeadBranches rewrites a stored program so that IF operators whose condition is a
+// constant are replaced by the branch they select, discarding the other branch entirely, even
+// when either branch contains open bindings. It returns false when no IF could be eliminated. It
+// also returns the source range of each token when given those of tokens. With ThreeValuedLogic,
+// an IF whose condition is UNKN is replaced by UNKN.
+//
+//	1,a,3,+,b,c,TREND,IF   ==>   a,3,+
+func (c config) eliminateDeadBranches(tokens []interface{}, sources []SourceRange) ([]interface{}, []SourceRange, bool) {
+	roots, ok := buildForest(tokens)
+	if !ok {
+		return tokens, sources, false
+	}
+	if sources != nil {
+		annotateSources(roots, sources)
+	}
+
+	var changed bool
+	var rewrite func(*node) *node
+	rewrite = func(n *node) *node {
+		if !n.isOperator() {
+			return n
+		}
+		if token, ok := n.token.(string); ok && token == "IF" {
+			if condition, ok := n.children[0].token.(float64); ok {
+				changed = true
+				if c.threeValuedLogic && math.IsNaN(condition) {
+					unknown := newNode(condition, nil)
+					unknown.source = n.extent()
+					return unknown
+				}
+				// A,B,C,IF ==> A ? B : C
+				if condition < 0 || condition > 0 {
+					return rewrite(n.children[1])
+				}
+				return rewrite(n.children[2])
+			}
+		}
+		children := make([]*node, len(n.children))
+		for i, child := range n.children {
+			children[i] = rewrite(child)
+		}
+		rewritten := newNode(n.token, children)
+		rewritten.source = n.source
+		return rewritten
+	}
+
+	for i, root := range roots {
+		roots[i] = rewrite(root)
+	}
+	if !changed {
+		return tokens, sources, false
+	}
+	if sources == nil {
+		return emitForest(roots), nil, true
+	}
+	return emitForest(roots), emitSources(roots), true
+}
@@ -0,0 +1,190 @@
+package gorpn
+
+import "testing"
+
+func TestPartialEliminatesCommonSubexpressions(t *testing.T) {
+	list := map[string]string{
+		"a,b,+,a,b,+,*":             "a,b,+,DUP,*",
+		"a,b,+,c,a,b,+,*,+":         "a,b,+,c,2,INDEX,*,+",
+		"a,b,+,a,b,+,a,b,+,+,+":     "a,b,+,DUP,DUP,+,+",
+		"a,b,+,b,a,+,*":             "a,b,+,b,a,+,*", // operand order matters
+		"a,a,*":                     "a,a,*",         // leaves are not replaced
+		"a,2,+,b,a,2,+,*":           "a,2,+,b,2,INDEX,*",
+		"x,SIN,x,SIN,*":             "x,SIN,DUP,*",
+		"x,SIN,y,x,SIN,*":           "x,SIN,y,x,SIN,*", // INDEX no shorter than recomputing
+		"a,b,+,a,b,+,2,COPY":        "a,b,+,a,b,+,2,COPY",
+		"a,b,+,a,b,+,*,a,b,+,a,b,+": "a,b,+,DUP,*,a,b,+,DUP",
+	}
+	for input, output := range list {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if exp.String() != output {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, exp.String(), output)
+		}
+	}
+}
+
+func TestEliminateCommonSubexpressionsPreservesValue(t *testing.T) {
+	bindings := map[string]interface{}{"a": 3, "b": 5, "c": 7}
+	list := map[string]float64{
+		"a,b,+,a,b,+,*":         64,
+		"a,b,+,c,a,b,+,*,+":     64,
+		"a,b,+,a,b,+,a,b,+,+,+": 24,
+		"a,b,-,c,a,b,-,c,*,+,+": -9,
+	}
+	for input, expected := range list {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		// partially binding must not break the rewritten program
+		exp, err = exp.Partial(map[string]interface{}{"a": 3})
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		value, err := exp.Evaluate(bindings)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if value != expected {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, value, expected)
+		}
+	}
+}
+
+func TestPartialReassociatesConstants(t *testing.T) {
+	list := map[string]string{
+		"x,2,MAX,3,MAX":                 "x,3,MAX",
+		"2,x,MAX,3,MAX":                 "x,3,MAX",
+		"1,x,MIN,y,MIN,5,MIN":           "x,y,MIN,1,MIN",
+		"x,2,MAX,y,3,MAX,MAX":           "x,y,MAX,3,MAX",
+		"x,UNKN,MAX,2,MAX":              "UNKN",
+		"x,2,MAX,3,MIN":                 "x,2,MAX,3,MIN", // mixed operators are not regrouped
+		"x,2,MAX,3,MAX,x,2,MAX,3,MAX,*": "x,3,MAX,DUP,*",
+		"x,2,+,3,+":                     "x,2,+,3,+", // rounding depends on grouping
+		"2,x,*,y,*,3,*":                 "2,x,*,y,*,3,*",
+		"x,2,+,-2,+":                    "x,2,+,-2,+",
+		"x,2,*,0.5,*":                   "x,2,*,0.5,*",
+		"x,2,-,3,-":                     "x,2,-,3,-",
+	}
+	for input, output := range list {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if exp.String() != output {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, exp.String(), output)
+		}
+	}
+}
+
+func TestPartialReassociationKeepsResults(t *testing.T) {
+	list := map[string]struct {
+		x        float64
+		expected float64
+	}{
+		"x,1e308,+,1e308,+":      {-1e308, 1e308},
+		"x,1e200,*,1e200,*":      {1e-300, 1e100},
+		"x,1,+,1,+":              {1 << 53, 1 << 53},
+		"x,1e308,MAX,INF,MIN":    {-1e308, 1e308},
+		"x,-1e308,MIN,1e308,MIN": {2, -1e308},
+	}
+	for input, item := range list {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		actual, err := exp.Evaluate(map[string]interface{}{"x": item.x})
+		if err != nil {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+			continue
+		}
+		if actual != item.expected {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, actual, item.expected)
+		}
+	}
+}
+
+func TestPartialEliminatesDeadBranches(t *testing.T) {
+	list := map[string]string{
+		"1,a,3,+,b,IF":                "a,3,+",
+		"0,a,3,+,b,IF":                "b",
+		"UNKN,a,b,IF":                 "b",
+		"cond,a,b,IF":                 "cond,a,b,IF",
+		"1,2,GT,a,b,600,TREND,IF":     "b,600,TREND",
+		"1,2,LT,a,b,600,TREND,IF":     "a",
+		"x,1,a,2,*,b,IF,+":            "x,a,2,*,+",
+		"0,1,a,b,IF,c,d,IF":           "0,a,c,d,IF",
+		"0,a,b,+,1,c,d,IF,IF":         "c",
+		"1,a,b,+,c,IF,1,a,b,+,d,IF,*": "a,b,+,DUP,*",
+		"1,2,3,2,COPY,a,b,IF":         "1,2,3,2,a",
+	}
+	for input, output := range list {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if exp.String() != output {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, exp.String(), output)
+		}
+	}
+}
+
+func TestPartialEliminatesDeadBranchesWithBindings(t *testing.T) {
+	exp, err := New("cond,qps,600,TREND,qps,IF", SecondsPerInterval(300))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp, err = exp.Partial(map[string]interface{}{"cond": 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "qps"; exp.String() != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", exp.String(), expected)
+	}
+}
+
+func TestEvaluateShortCircuitsIF(t *testing.T) {
+	exp, err := New("cond,qps,600,TREND,other,IF", SecondsPerInterval(300))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// series needed only by the untaken branch is not required
+	value, err := exp.Evaluate(map[string]interface{}{"cond": 0, "other": 42})
+	if err != nil {
+		t.Fatalf("Actual: %#v; Expected: %#v", err, nil)
+	}
+	if expected := float64(42); value != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", value, expected)
+	}
+
+	value, err = exp.Evaluate(map[string]interface{}{"cond": 1, "qps": []float64{1, 2, 3}})
+	if err != nil {
+		t.Fatalf("Actual: %#v; Expected: %#v", err, nil)
+	}
+	if expected := float64(2.5); value != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", value, expected)
+	}
+
+	_, err = exp.Evaluate(map[string]interface{}{"cond": 1, "other": 42})
+	if _, ok := err.(ErrOpenBindings); !ok {
+		t.Errorf("Actual: %#v; Expected: %#v", err, ErrOpenBindings{"qps": ScalarKind})
+	}
+}
+
+func TestEvaluateIFIgnoresUntakenSymbol(t *testing.T) {
+	exp, err := New("cond,a,b,IF")
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := exp.Evaluate(map[string]interface{}{"cond": 1, "a": 13})
+	if err != nil {
+		t.Fatalf("Actual: %#v; Expected: %#v", err, nil)
+	}
+	if expected := float64(13); value != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", value, expected)
+	}
+}
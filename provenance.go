@@ -0,0 +1,189 @@
+package gorpn
+
+// SourceRange is the range of bytes of the source of an Expression from which one of its tokens
+// was derived, such that source[r.Start:r.End] is the text of the tokens involved.
+type SourceRange struct {
+	Start, End int
+}
+
+// union returns the smallest range that includes both r and other.
+func (r SourceRange) union(other SourceRange) SourceRange {
+	if other.Start < r.Start {
+		r.Start = other.Start
+	}
+	if other.End > r.End {
+		r.End = other.End
+	}
+	return r
+}
+
+// Source returns the string from which the Expression was originally created by New, before it was
+// simplified or specialized by Partial.
+func (e *Expression) Source() string {
+	return e.source
+}
+
+// SourceRanges returns, for each token of the simplified program returned by Tokens, the range of
+// bytes of Source from which that token was derived. A number folded from several tokens refers to
+// all of them, so that operators debugging a folded expression may correlate its tokens with the
+// configuration it came from. A token derived from a symbol bound to another Expression by Partial
+// refers to that symbol. It returns nil when the tokens are no longer derived from the source, as
+// happens for the result of Derivative.
+//
+//	func example() {
+//		source := "5,3,+,foo,*"
+//		exp, err := gorpn.New(source)
+//		if err != nil {
+//			panic(err)
+//		}
+//		tokens := exp.Tokens()       // number 8, symbol foo, and operator *
+//		ranges := exp.SourceRanges() // []gorpn.SourceRange{{0, 5}, {6, 9}, {10, 11}}
+//		s := source[ranges[0].Start:ranges[0].End] // "5,3,+"
+//	}
+func (e *Expression) SourceRanges() []SourceRange {
+	if e.sources == nil {
+		return nil
+	}
+	ranges := make([]SourceRange, len(e.sources))
+	copy(ranges, e.sources)
+	return ranges
+}
+
+// provenance follows the trace events of simplifying a program to learn the source range of each
+// item left in the work area, given the source range of each token of the program.
+type provenance struct {
+	sources []SourceRange // one for each token of the program being simplified
+	stack   []SourceRange // one for each item in the work area
+	next    int           // index of the next token whose range has not been pushed
+}
+
+// leaves pushes the range of each token before position, all of which are operands, because the
+// trace function is only invoked for operators.
+func (p *provenance) leaves(position int) {
+	for ; p.next < position; p.next++ {
+		p.stack = append(p.stack, p.sources[p.next])
+	}
+}
+
+func (p *provenance) event(event TraceEvent) {
+	p.leaves(event.Position)
+	p.next = event.Position + 1
+	own := p.sources[event.Position]
+
+	if event.Deferred {
+		p.stack = append(p.stack, own) // operator remains in the program, after its operands
+		return
+	}
+
+	consumed := len(event.Inputs)
+	if consumed > len(p.stack) {
+		consumed = len(p.stack)
+	}
+	inputs := append([]SourceRange(nil), p.stack[len(p.stack)-consumed:]...)
+	p.stack = p.stack[:len(p.stack)-consumed]
+
+	derived := own
+	for _, input := range inputs {
+		derived = derived.union(input)
+	}
+
+	// an item that was merely rearranged by a stack operator keeps the range of the operand it was,
+	// preferring operands not yet matched; operands are indexed by value so that copying many items
+	// takes linear time
+	counts, isStackOperator := stackOperatorCounts[event.Operator]
+	var candidates map[interface{}][]int // indexes of the operands equal to each value, ascending
+	if isStackOperator {
+		candidates = make(map[interface{}][]int)
+		for i := 0; i < len(inputs)-counts && i < len(event.Inputs); i++ {
+			candidates[event.Inputs[i]] = append(candidates[event.Inputs[i]], i)
+		}
+	}
+	matched := make(map[interface{}]int) // how many of the candidates of each value were matched
+	for _, output := range event.Outputs {
+		indexes := candidates[output]
+		if len(indexes) == 0 {
+			p.stack = append(p.stack, derived)
+			continue
+		}
+		match := indexes[0] // every equal operand was matched, so reuse the first
+		if k := matched[output]; k < len(indexes) {
+			match = indexes[k]
+			matched[output] = k + 1
+		}
+		p.stack = append(p.stack, inputs[match])
+	}
+}
+
+// ranges returns the source range of each item in the work area once the program of count tokens
+// has been simplified, or nil when they cannot be accounted for.
+func (p *provenance) ranges(count, items int) []SourceRange {
+	p.leaves(count)
+	if len(p.stack) != items {
+		return nil
+	}
+	return p.stack
+}
+
+// inlineSources returns the source range of each token of the program inlineExpressionBindings
+// returns for tokens, where every token inlined in place of a symbol has the range of that symbol.
+func inlineSources(tokens []interface{}, sources []SourceRange, bindings map[string]interface{}) ([]SourceRange, error) {
+	inlined := make([]SourceRange, 0, len(sources))
+	for idx, tok := range tokens {
+		count := 1
+		if symbol, ok := tok.(string); ok {
+			if _, ok = bindings[symbol].(*Expression); ok {
+				nested, err := inlineExpressionBindings([]interface{}{tok}, bindings, make(map[*Expression]bool))
+				if err != nil {
+					return nil, err
+				}
+				count = len(nested)
+			}
+		}
+		for ; count > 0; count-- {
+			inlined = append(inlined, sources[idx])
+		}
+	}
+	return inlined, nil
+}
+
+// extent returns the source range of all tokens required to compute the subtree rooted at n.
+func (n *node) extent() SourceRange {
+	r := n.source
+	for _, child := range n.children {
+		r = r.union(child.extent())
+	}
+	return r
+}
+
+// annotateSources records the source range of each token of the program from which roots were
+// built by buildForest in the node of that token.
+func annotateSources(roots []*node, sources []SourceRange) {
+	var next int
+	var annotate func(*node)
+	annotate = func(n *node) {
+		for _, child := range n.children {
+			annotate(child)
+		}
+		n.source = sources[next]
+		next++
+	}
+	for _, root := range roots {
+		annotate(root)
+	}
+}
+
+// emitSources returns the source range of each token emitForest returns for roots.
+func emitSources(roots []*node) []SourceRange {
+	var sources []SourceRange
+	var emit func(*node)
+	emit = func(n *node) {
+		for _, child := range n.children {
+			emit(child)
+		}
+		sources = append(sources, n.source)
+	}
+	for _, root := range roots {
+		emit(root)
+	}
+	return sources
+}
@@ -0,0 +1,90 @@
+package gorpn
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSourceRanges(t *testing.T) {
+	list := map[string][]string{
+		"5,3,+,foo,*":          {"5,3,+", "foo", "*"},
+		"5, 3 ,+ , foo,*":      {"5, 3 ,+", "foo", "*"},
+		"'a,b',1,+":            {"'a,b'", "1", "+"},
+		"a,0,+":                {"a,0,+"},
+		"60,24,*,a,+,DAY,/":    {"60,24,*", "a", "+", "DAY", "/"},
+		"a,b,EXC,-":            {"b", "a", "-"},
+		"a,b,+,a,b,+,*":        {"a", "b", "+", "a,b,+", "*"},
+		"a,b,+,c,a,b,+,*,+":    {"a", "b", "+", "c", "a,b,+", "a,b,+", "*", "+"},
+		"x,2,MAX,3,MAX":        {"x", "2,MAX,3", "MAX"},
+		"1,a,3,+,b,c,TREND,IF": {"a", "3", "+"},
+	}
+	for input, expected := range list {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if actual := exp.Source(); actual != input {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, actual, input)
+		}
+		var actual []string
+		for _, r := range exp.SourceRanges() {
+			actual = append(actual, input[r.Start:r.End])
+		}
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, actual, expected)
+		}
+	}
+}
+
+func TestSourceRangesPartial(t *testing.T) {
+	source := "foo,1000,*,bar,3,+,/"
+	exp, err := New(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner, err := New("x,y,+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := []struct {
+		bindings map[string]interface{}
+		expected []string
+	}{
+		{map[string]interface{}{"foo": 2, "bar": 13}, []string{source}},
+		{map[string]interface{}{"foo": 2}, []string{"foo,1000,*", "bar", "3", "+", "/"}},
+		{map[string]interface{}{"foo": 2, "bar": inner}, []string{"foo,1000,*", "bar", "bar", "bar", "3", "+", "/"}},
+	}
+	for _, item := range list {
+		partial, err := exp.Partial(item.bindings)
+		if err != nil {
+			t.Fatalf("Case: %v; Actual: %#v; Expected: %#v", item.bindings, err, nil)
+		}
+		if actual := partial.Source(); actual != source {
+			t.Errorf("Case: %v; Actual: %#v; Expected: %#v", item.bindings, actual, source)
+		}
+		var actual []string
+		for _, r := range partial.SourceRanges() {
+			actual = append(actual, source[r.Start:r.End])
+		}
+		if !reflect.DeepEqual(actual, item.expected) {
+			t.Errorf("Case: %v; Actual: %#v; Expected: %#v", item.bindings, actual, item.expected)
+		}
+	}
+}
+
+func TestSourceRangesDerivative(t *testing.T) {
+	exp, err := New("x,x,*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	derivative, err := exp.Derivative("x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual := derivative.Source(); actual != "x,x,*" {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, "x,x,*")
+	}
+	if actual := derivative.SourceRanges(); actual != nil {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, nil)
+	}
+}
@@ -0,0 +1,245 @@
+// Package repl provides an interactive evaluator for RPN expressions, which shows the stack after
+// each token of an expression, so that authors of long formulas can see where they go wrong.
+//
+// Each line given to a REPL is either an expression to evaluate, or one of the following commands:
+//
+//	:bind name value...   bind name to a number, or to a series when given several numbers
+//	:unbind name          remove the binding of name
+//	:bindings             list the current bindings
+//	:load pathname        execute each line of a file
+//	:help                 list the commands
+//
+// Empty lines and lines that start with # are ignored. Expressions are not simplified before they
+// are evaluated, so the stack is shown after each token as written. When an untaken branch of IF
+// uses a symbol that is not bound, the branch is discarded first, and the stack is shown after
+// each operator instead.
+package repl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/karrick/gorpn"
+)
+
+// REPL evaluates lines of input, writing the results to its output.
+//
+//	func example() {
+//		r := repl.New(os.Stdout)
+//		r.Prompt = "> "
+//		if err := r.Run(os.Stdin); err != nil {
+//			panic(err)
+//		}
+//	}
+type REPL struct {
+	Bindings map[string]interface{} // values bound to symbols while evaluating expressions
+	Prompt   string                 // written before reading each line, when not empty
+
+	w       io.Writer
+	setters []gorpn.ExpressionConfigurator
+}
+
+// New returns a REPL that writes to w, and compiles expressions with the given configuration.
+func New(w io.Writer, setters ...gorpn.ExpressionConfigurator) *REPL {
+	return &REPL{Bindings: make(map[string]interface{}), w: w, setters: setters}
+}
+
+// Run executes each line read from rd until its end. Errors from executing a line are written to
+// the output of the REPL rather than ending the session; only errors reading rd are returned.
+func (r *REPL) Run(rd io.Reader) error {
+	scanner := bufio.NewScanner(rd)
+	for {
+		if r.Prompt != "" {
+			io.WriteString(r.w, r.Prompt)
+		}
+		if !scanner.Scan() {
+			break
+		}
+		if err := r.Execute(scanner.Text()); err != nil {
+			fmt.Fprintln(r.w, "error:", err)
+		}
+	}
+	return scanner.Err()
+}
+
+// Load executes each line of the named file, just as Run does.
+func (r *REPL) Load(pathname string) error {
+	fh, err := os.Open(pathname)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	prompt := r.Prompt
+	r.Prompt = ""
+	err = r.Run(fh)
+	r.Prompt = prompt
+	return err
+}
+
+// Execute executes a single line of input, which is either a command or an expression.
+func (r *REPL) Execute(line string) error {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+	if !strings.HasPrefix(line, ":") {
+		return r.evaluate(line)
+	}
+
+	fields := strings.Fields(line)
+	switch command, args := fields[0], fields[1:]; command {
+	case ":bind":
+		if len(args) < 2 {
+			return fmt.Errorf("%s requires name and value", command)
+		}
+		values := make([]float64, 0, len(args)-1)
+		for _, arg := range args[1:] {
+			for _, field := range strings.Split(arg, ",") {
+				if field == "" {
+					continue
+				}
+				value, err := strconv.ParseFloat(field, 64)
+				if err != nil {
+					return fmt.Errorf("cannot parse value of %q: %w", args[0], err)
+				}
+				values = append(values, value)
+			}
+		}
+		if len(values) == 1 {
+			r.Bindings[args[0]] = values[0]
+		} else {
+			r.Bindings[args[0]] = values
+		}
+	case ":unbind":
+		if len(args) != 1 {
+			return fmt.Errorf("%s requires name", command)
+		}
+		delete(r.Bindings, args[0])
+	case ":bindings":
+		names := make([]string, 0, len(r.Bindings))
+		for name := range r.Bindings {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(r.w, "%s = %s\n", name, format(r.Bindings[name]))
+		}
+	case ":load":
+		if len(args) != 1 {
+			return fmt.Errorf("%s requires pathname", command)
+		}
+		return r.Load(args[0])
+	case ":help":
+		io.WriteString(r.w, help)
+	default:
+		return fmt.Errorf("unknown command: %s", command)
+	}
+	return nil
+}
+
+const help = `:bind name value...   bind name to a number, or to a series when given several numbers
+:unbind name          remove the binding of name
+:bindings             list the current bindings
+:load pathname        execute each line of a file
+:help                 list the commands
+`
+
+// evaluate evaluates an expression, writing the stack after each token as written, followed by the
+// result.
+func (r *REPL) evaluate(someExpression string) error {
+	var evaluating, deferred bool
+	var events []gorpn.TraceEvent
+	trace := gorpn.Trace(func(event gorpn.TraceEvent) {
+		if evaluating {
+			events = append(events, event)
+			deferred = deferred || event.Deferred
+		}
+	})
+	// keep the tokens as written, so that the stack is shown after each of them
+	setters := append(append([]gorpn.ExpressionConfigurator(nil), r.setters...), trace, gorpn.NoSimplify())
+	exp, err := gorpn.New(someExpression, setters...)
+	if err != nil {
+		return err
+	}
+	evaluating = true
+	result, err := exp.Evaluate(r.Bindings)
+	if err != nil {
+		return err
+	}
+
+	// When the program needed to be rewritten to discard untaken branches, positions in the trace
+	// no longer refer to its tokens, so only the stack after each operator is written.
+	if deferred {
+		width := 0
+		for _, event := range events {
+			if len(event.Operator) > width {
+				width = len(event.Operator)
+			}
+		}
+		for _, event := range events {
+			fmt.Fprintf(r.w, "  %-*s  %s\n", width, event.Operator, format(event.Stack))
+		}
+	} else {
+		program := exp.Tokens()
+		tokens := make([]string, len(program))
+		for i, token := range program {
+			tokens[i] = token.Text
+			if token.Kind == gorpn.TokenNumber {
+				tokens[i] = format(token.Number)
+			}
+		}
+		width := 0
+		for _, token := range tokens {
+			if len(token) > width {
+				width = len(token)
+			}
+		}
+		line := func(token string, stack []interface{}) {
+			fmt.Fprintf(r.w, "  %-*s  %s\n", width, token, format(stack))
+		}
+
+		next := 0 // index of the next token to be written
+		for _, event := range events {
+			// the stack before the operator, from which the stack after each operand follows
+			before := append(append([]interface{}(nil), event.Stack[:len(event.Stack)-len(event.Outputs)]...), event.Inputs...)
+			for ; next < event.Position; next++ {
+				line(tokens[next], before[:len(before)-event.Position+next+1])
+			}
+			line(tokens[next], event.Stack)
+			next++
+		}
+		for ; next < len(tokens); next++ {
+			line(tokens[next], []interface{}{result}) // a program without operators
+		}
+	}
+	fmt.Fprintln(r.w, "=", format(result))
+	return nil
+}
+
+// format returns the text representation of a value, a series, or a stack.
+func format(value interface{}) string {
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case []float64:
+		strs := make([]string, len(v))
+		for i, f := range v {
+			strs[i] = format(f)
+		}
+		return "[" + strings.Join(strs, " ") + "]"
+	case []interface{}:
+		strs := make([]string, len(v))
+		for i, item := range v {
+			strs[i] = format(item)
+		}
+		return "[" + strings.Join(strs, " ") + "]"
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,66 @@
+package repl
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExecute(t *testing.T) {
+	list := map[string]string{
+		"a,b,+,2,*": "  a  [3]\n  b  [3 5]\n  +  [8]\n  2  [8 2]\n  *  [16]\n= 16\n",
+		"a":         "  a  [3]\n= 3\n",
+		"qps,1200,TREND,a,*": "  qps    [qps]\n  1200   [qps 1200]\n  TREND  [2.5]\n  a      [2.5 3]\n" +
+			"  *      [7.5]\n= 7.5\n",
+		"60,24,*,a,+":      "  60  [60]\n  24  [60 24]\n  *   [1440]\n  a   [1440 3]\n  +   [1443]\n= 1443\n",
+		"1,2,+,a,*":        "  1  [1]\n  2  [1 2]\n  +  [3]\n  a  [3 3]\n  *  [9]\n= 9\n", // not folded
+		"0,d,1,+,c,IF,2,*": "  +   [0 d 1 +]\n  IF  [0 d 1 + 0 IF]\n  *   [0 d 1 + 0 IF 2 *]\n  *   [0]\n= 0\n",
+		"a,b,c,3,SORT,+,+": "  a     [3]\n  b     [3 5]\n  c     [3 5 0]\n  3     [3 5 0 3]\n  SORT  [0 3 5]\n" +
+			"  +     [0 8]\n  +     [8]\n= 8\n",
+		"# comment": "",
+	}
+	for input, expected := range list {
+		var b strings.Builder
+		r := New(&b)
+		r.Bindings = map[string]interface{}{"a": 3.0, "b": 5.0, "c": 0.0, "qps": []float64{1, 2, 3, 4}}
+		if err := r.Execute(input); err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if actual := b.String(); actual != expected {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, actual, expected)
+		}
+	}
+}
+
+func TestCommands(t *testing.T) {
+	var b strings.Builder
+	r := New(&b)
+	input := ":bind a 3\n:bind qps 1,2 3\n:bind b 5\n:unbind b\n:bindings\nb\n:bogus\n"
+	if err := r.Run(strings.NewReader(input)); err != nil {
+		t.Fatal(err)
+	}
+	expected := "a = 3\nqps = [1 2 3]\nerror: open bindings: b\nerror: unknown command: :bogus\n"
+	if actual := b.String(); actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	pathname := filepath.Join(t.TempDir(), "formulas.rpn")
+	if err := os.WriteFile(pathname, []byte("# hit ratio\n:bind hits 3\n:bind misses 1\nhits,hits,misses,+,/\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	r := New(&b)
+	r.Prompt = "> "
+	if err := r.Run(strings.NewReader(":load " + pathname + "\n")); err != nil {
+		t.Fatal(err)
+	}
+	expected := "> " +
+		"  hits    [3]\n  hits    [3 3]\n  misses  [3 3 1]\n  +       [3 4]\n  /       [0.75]\n= 0.75\n" +
+		"> "
+	if actual := b.String(); actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+}
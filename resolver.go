@@ -0,0 +1,79 @@
+package gorpn
+
+// BindingResolver provides the values of the symbols of an Expression on demand, as an alternative
+// to a map of bindings. Resolve returns the value bound to name, which may be anything a map of
+// bindings may hold, and true, or false when name is not bound.
+type BindingResolver interface {
+	Resolve(name string) (interface{}, bool)
+}
+
+// BindingResolverFunc adapts an ordinary function to the BindingResolver interface.
+type BindingResolverFunc func(name string) (interface{}, bool)
+
+// Resolve returns f(name).
+func (f BindingResolverFunc) Resolve(name string) (interface{}, bool) {
+	return f(name)
+}
+
+// EvaluateResolver evaluates the Expression just like Evaluate, but obtains the value of each
+// symbol from resolver, only when the Expression needs it. Symbols are resolved in the order they
+// appear in the Expression, and once the condition of an IF is known, the symbols of the branch it
+// does not take are never resolved. This permits fetching values, or entire series, from a store
+// only when they are actually used. Each symbol is resolved at most once.
+//
+//	func example(store *MetricStore) {
+//		exp, err := gorpn.New("maintenance,0,primary.qps,IF")
+//		if err != nil {
+//			panic(err)
+//		}
+//		value, err := exp.EvaluateResolver(gorpn.BindingResolverFunc(func(name string) (interface{}, bool) {
+//			return store.Fetch(name) // primary.qps is not fetched during maintenance
+//		}))
+//	}
+func (e *Expression) EvaluateResolver(resolver BindingResolver) (float64, error) {
+	exp, err := e.Partial(nil)
+	if err != nil {
+		return 0, err
+	}
+	bindings := make(map[string]interface{})
+	attempted := map[string]bool{"NOW": true} // Evaluate binds NOW itself
+	for {
+		symbol, ok := exp.nextOpenBinding(attempted)
+		if !ok {
+			break
+		}
+		attempted[symbol] = true
+		value, ok := resolver.Resolve(symbol)
+		if !ok {
+			continue // reported as an open binding by Evaluate, if still needed
+		}
+		bindings[symbol] = value
+
+		// the newly bound value may decide the condition of an IF, discarding a branch
+		if exp, err = e.Partial(bindings); err != nil {
+			return 0, err
+		}
+	}
+	return e.Evaluate(bindings)
+}
+
+// nextOpenBinding returns the first open binding of the stored program, in the order the program
+// uses them, that is not in attempted, and true, or false when there is no such open binding.
+func (e *Expression) nextOpenBinding(attempted map[string]bool) (string, bool) {
+	for _, tok := range e.tokens {
+		symbol, ok := tok.(string)
+		if !ok || attempted[symbol] {
+			continue
+		}
+		if symbol == "LTIME" || symbol == "NEWDAY" || symbol == "NEWWEEK" || symbol == "NEWMONTH" || symbol == "NEWYEAR" {
+			symbol = "TIME" // NOTE: actually requires TIME to be bound
+			if attempted[symbol] {
+				continue
+			}
+		}
+		if e.openBindings[symbol] > 0 {
+			return symbol, true
+		}
+	}
+	return "", false
+}
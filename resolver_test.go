@@ -0,0 +1,96 @@
+package gorpn
+
+import (
+	"reflect"
+	"testing"
+)
+
+// recordingResolver resolves names from a map, recording each name it is asked to resolve.
+type recordingResolver struct {
+	values   map[string]interface{}
+	resolved []string
+}
+
+func (r *recordingResolver) Resolve(name string) (interface{}, bool) {
+	r.resolved = append(r.resolved, name)
+	value, ok := r.values[name]
+	return value, ok
+}
+
+func TestEvaluateResolver(t *testing.T) {
+	list := map[string]struct {
+		values   map[string]interface{}
+		result   float64
+		resolved []string
+	}{
+		"a,b,+":                    {map[string]interface{}{"a": 1, "b": 2}, 3, []string{"a", "b"}},
+		"maintenance,0,primary,IF": {map[string]interface{}{"maintenance": 1, "primary": 42}, 0, []string{"maintenance"}},
+		"maintenance,0,primary,IF,backup,+": {
+			map[string]interface{}{"maintenance": 0, "primary": 42, "backup": 8}, 50, []string{"maintenance", "primary", "backup"},
+		},
+		"a,a,*,a,+":         {map[string]interface{}{"a": 3}, 12, []string{"a"}},
+		"qps,600,TREND,2,*": {map[string]interface{}{"qps": []float64{1, 2, 3, 4}}, 7, []string{"qps"}},
+		"cond,lag,1,+,0,IF": {map[string]interface{}{"cond": 0, "lag": 5}, 0, []string{"cond"}},
+	}
+	for input, item := range list {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		resolver := &recordingResolver{values: item.values}
+		value, err := exp.EvaluateResolver(resolver)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if value != item.result {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, value, item.result)
+		}
+		if !reflect.DeepEqual(resolver.resolved, item.resolved) {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, resolver.resolved, item.resolved)
+		}
+	}
+}
+
+func TestEvaluateResolverExpressionBinding(t *testing.T) {
+	month, err := New("days,DAY,*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp, err := New("month,HOUR,/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]interface{}{"month": month, "days": 30}
+	value, err := exp.EvaluateResolver(BindingResolverFunc(func(name string) (interface{}, bool) {
+		v, ok := values[name]
+		return v, ok
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := float64(720); value != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", value, expected)
+	}
+}
+
+func TestEvaluateResolverOpenBindings(t *testing.T) {
+	exp, err := New("a,b,+,NOW,-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver := &recordingResolver{values: map[string]interface{}{"a": 1}}
+	_, err = exp.EvaluateResolver(resolver)
+	if actual, expected := err, (ErrOpenBindings{"b": ScalarKind}); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+	if actual, expected := resolver.resolved, []string{"a", "b"}; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+
+	resolver = &recordingResolver{values: map[string]interface{}{"a": 1, "b": "13"}}
+	if _, err = exp.EvaluateResolver(resolver); err == nil {
+		t.Errorf("Actual: %#v; Expected: %#v", err, ErrBadBindingType{})
+	} else if _, ok := err.(ErrBadBindingType); !ok {
+		t.Errorf("Actual: %#v; Expected: %#v", err, ErrBadBindingType{})
+	}
+}
@@ -0,0 +1,287 @@
+package gorpn
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// rewriteRule replaces each subtree matching pattern by replacement, in which each symbol of
+// pattern stands for the subtree it matched.
+type rewriteRule struct {
+	pattern, replacement *node
+}
+
+// rewriteTable holds the rewrite rules applied by Partial, sorted by the text of their patterns.
+type rewriteTable struct {
+	texts map[string]string // replacement of each pattern, as given to RewriteRules
+	rules []rewriteRule
+}
+
+// rewriteTables interns each rewriteTable by its contents, so that expressions configured with the
+// same rules share a configuration, and NewCached finds the expressions compiled with them.
+var rewriteTables sync.Map
+
+// RewriteRules allows Partial, and therefore New, to rewrite the program of an RPN Expression using
+// rules that are known to hold for the values it is given, such as redundancies that generated
+// expressions contain but that the built-in simplifications do not remove. Each key of rules is a
+// pattern, and its value the replacement for each subtree of the program that the pattern matches.
+// Both are RPN expressions using the default delimiter. Each symbol of a pattern matches any
+// subtree, and must match the same subtree each time the symbol is used, while numbers, operators,
+// and reserved words only match themselves. Each symbol of a replacement stands for the subtree the
+// symbol matched in the pattern.
+//
+// The rules are tried in the order of their patterns, and applied until none of them matches, or
+// the program is one it has already been, so that rules such as commutativity do not apply
+// forever. Rewriting only applies to programs whose operators consume a fixed number of operands,
+// such as those that do not use COPY or SORT. It returns an error when a pattern is not an
+// operator, when a replacement uses a symbol that is not in its pattern, or when a replacement is
+// longer than its pattern. When RewriteRules is given more than once, the rules accumulate.
+//
+//	func example() {
+//		exp, err := gorpn.New("a,ABS,ABS,b,*,c,*", gorpn.RewriteRules(map[string]string{
+//			"x,ABS,ABS": "x,ABS",
+//			"x,y,*,z,*": "x,y,z,*,*",
+//		}))
+//		if err != nil {
+//			panic(err)
+//		}
+//		s := exp.String() // "a,ABS,b,c,*,*"
+//	}
+func RewriteRules(rules map[string]string) ExpressionConfigurator {
+	return func(e *Expression) error {
+		texts := make(map[string]string, len(rules))
+		if e.rewrites != nil {
+			for pattern, replacement := range e.rewrites.texts {
+				texts[pattern] = replacement
+			}
+		}
+		for pattern, replacement := range rules {
+			texts[pattern] = replacement
+		}
+		table, err := internRewriteTable(texts)
+		if err != nil {
+			return err
+		}
+		e.rewrites = table
+		return nil
+	}
+}
+
+// parseRewriteRule returns the rule that rewrites subtrees matching pattern to replacement.
+func parseRewriteRule(pattern, replacement string) (rewriteRule, error) {
+	p, err := parseRewriteTree(pattern)
+	if err != nil {
+		return rewriteRule{}, err
+	}
+	if !p.isOperator() {
+		return rewriteRule{}, newErrUnknownOperator("cannot use rewrite pattern %q, which is not an operator", pattern)
+	}
+	r, err := parseRewriteTree(replacement)
+	if err != nil {
+		return rewriteRule{}, err
+	}
+	if r.size > p.size {
+		return rewriteRule{}, newErrSyntax("cannot use rewrite replacement %q, which is longer than its pattern %q", replacement, pattern)
+	}
+	variables := make(map[string]bool)
+	collectVariables(p, variables)
+	used := make(map[string]bool)
+	collectVariables(r, used)
+	for symbol := range used {
+		if !variables[symbol] {
+			return rewriteRule{}, newErrSyntax("cannot use rewrite replacement %q, which uses symbol %q not in its pattern %q", replacement, symbol, pattern)
+		}
+	}
+	return rewriteRule{pattern: p, replacement: r}, nil
+}
+
+// parseRewriteTree returns the expression tree of text, which is a pattern or replacement of a
+// rewrite rule.
+func parseRewriteTree(text string) (*node, error) {
+	exp, err := New(text, NoSimplify())
+	if err != nil {
+		return nil, rewriteRuleError(text, err)
+	}
+	n, err := expressionTree(exp.tokens, "rewrite")
+	if err != nil {
+		return nil, rewriteRuleError(text, err)
+	}
+	return n, nil
+}
+
+// rewriteRuleError returns err, which was returned while parsing text, which is a pattern or
+// replacement of a rewrite rule, amended to name text.
+func rewriteRuleError(text string, err error) error {
+	se, ok := err.(ErrSyntax)
+	if !ok {
+		return err
+	}
+	message := se.Message
+	if !strings.HasPrefix(message, ":") {
+		message = ": " + message // such as "empty expression"
+	}
+	return ErrSyntax{Message: fmt.Sprintf(": cannot use rewrite rule %q%s", text, message), Err: se.Err, kind: se.kind}
+}
+
+// collectVariables adds each symbol of the tree n to symbols.
+func collectVariables(n *node, symbols map[string]bool) {
+	if symbol, ok := n.token.(string); ok && !n.isOperator() && !reserved[symbol] {
+		symbols[symbol] = true
+	}
+	for _, child := range n.children {
+		collectVariables(child, symbols)
+	}
+}
+
+// internRewriteTable returns the rewriteTable for rules, creating it the first time these rules are
+// seen.
+func internRewriteTable(rules map[string]string) (*rewriteTable, error) {
+	patterns := make([]string, 0, len(rules))
+	for pattern := range rules {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+
+	var key strings.Builder
+	for _, pattern := range patterns {
+		key.WriteString(pattern)
+		key.WriteByte(0)
+		key.WriteString(rules[pattern])
+		key.WriteByte(0)
+	}
+	if table, ok := rewriteTables.Load(key.String()); ok {
+		return table.(*rewriteTable), nil
+	}
+
+	table := &rewriteTable{texts: rules, rules: make([]rewriteRule, 0, len(patterns))}
+	for _, pattern := range patterns {
+		rule, err := parseRewriteRule(pattern, rules[pattern])
+		if err != nil {
+			return nil, err
+		}
+		table.rules = append(table.rules, rule)
+	}
+	actual, _ := rewriteTables.LoadOrStore(key.String(), table)
+	return actual.(*rewriteTable), nil
+}
+
+// applyRewriteRules rewrites the program using the rules given to RewriteRules, folding it after
+// each pass, until no rule matches, or the program is one it has already been.
+func (e *Expression) applyRewriteRules() error {
+	if e.rewrites == nil {
+		return nil
+	}
+	seen := map[string]bool{fmt.Sprintf("%#v", e.tokens): true}
+	for {
+		tokens, sources, ok := e.rewrites.rewrite(e.tokens, e.sources)
+		if !ok {
+			return nil
+		}
+		e.tokens, e.sources = tokens, sources
+		if err := e.fold(nil); err != nil {
+			return err
+		}
+		key := fmt.Sprintf("%#v", e.tokens)
+		if seen[key] {
+			return nil
+		}
+		seen[key] = true
+	}
+}
+
+// rewrite replaces each subtree of a stored program matching the pattern of a rule by the
+// replacement of that rule, each derived from the source of the subtree it replaces. It returns
+// false when no rule matched. It also returns the source range of each token when given those of
+// tokens.
+//
+//	a,ABS,ABS,b,*   ==>   a,ABS,b,*   given   x,ABS,ABS   ==>   x,ABS
+func (t *rewriteTable) rewrite(tokens []interface{}, sources []SourceRange) ([]interface{}, []SourceRange, bool) {
+	roots, ok := buildForest(tokens)
+	if !ok {
+		return tokens, sources, false
+	}
+	if sources != nil {
+		annotateSources(roots, sources)
+	}
+
+	var changed bool
+	var rewrite func(*node) *node
+	rewrite = func(n *node) *node {
+		if !n.isOperator() {
+			return n
+		}
+		children := make([]*node, len(n.children))
+		for i, child := range n.children {
+			children[i] = rewrite(child)
+		}
+		source := n.source
+		n = newNode(n.token, children)
+		n.source = source
+
+		for _, rule := range t.rules {
+			matched := make(map[string]*node)
+			if matchRewrite(rule.pattern, n, matched) {
+				changed = true
+				return instantiateRewrite(rule.replacement, matched, n.extent())
+			}
+		}
+		return n
+	}
+
+	for i, root := range roots {
+		roots[i] = rewrite(root)
+	}
+	if !changed {
+		return tokens, sources, false
+	}
+	if sources == nil {
+		return emitForest(roots), nil, true
+	}
+	return emitForest(roots), emitSources(roots), true
+}
+
+// matchRewrite returns true when the tree n matches pattern, recording the subtree matched by each
+// symbol of pattern in matched.
+func matchRewrite(pattern, n *node, matched map[string]*node) bool {
+	if !pattern.isOperator() {
+		if symbol, ok := pattern.token.(string); ok && !reserved[symbol] {
+			if previous, ok := matched[symbol]; ok {
+				return previous.key == n.key
+			}
+			matched[symbol] = n
+			return true
+		}
+		return pattern.key == n.key
+	}
+	if n.token != pattern.token || len(n.children) != len(pattern.children) {
+		return false
+	}
+	for i, child := range pattern.children {
+		if !matchRewrite(child, n.children[i], matched) {
+			return false
+		}
+	}
+	return true
+}
+
+// instantiateRewrite returns the tree of replacement, with each of its symbols replaced by the
+// subtree it matched, and other nodes derived from source.
+func instantiateRewrite(replacement *node, matched map[string]*node, source SourceRange) *node {
+	if !replacement.isOperator() {
+		if symbol, ok := replacement.token.(string); ok && !reserved[symbol] {
+			return matched[symbol]
+		}
+		n := newNode(replacement.token, nil)
+		n.source = source
+		return n
+	}
+	children := make([]*node, len(replacement.children))
+	for i, child := range replacement.children {
+		children[i] = instantiateRewrite(child, matched, source)
+	}
+	n := newNode(replacement.token, children)
+	n.source = source
+	return n
+}
@@ -0,0 +1,117 @@
+package gorpn
+
+import "testing"
+
+var testRewriteRules = map[string]string{
+	"x,x,MAX":       "x",
+	"x,ABS,ABS":     "x,ABS",
+	"x,y,MAX,y,MAX": "x,y,MAX",
+	"x,y,MAX,x,MIN": "x",
+	"x,y,*,z,*":     "x,y,z,*,*",
+}
+
+func TestRewriteRules(t *testing.T) {
+	list := map[string]string{
+		"a,ABS,ABS":                 "a,ABS",
+		"a,ABS,ABS,ABS":             "a,ABS", // applied until none matches
+		"a,b,+,a,b,+,MAX":           "a,b,+",
+		"a,b,*,c,*":                 "a,b,c,*,*",
+		"a,b,*,c,*,d,*":             "a,b,c,d,*,*,*",
+		"a,b,MAX,a,MIN":             "a",
+		"a,b,MAX,b,MAX,a,MIN":       "a",
+		"a,b,MAX,b,a,MAX,MAX":       "a,b,MAX,b,a,MAX,MAX", // only matches identical subtrees
+		"a,b,+,c,/":                 "a,b,+,c,/",
+		"a,b,c,n,COPY,+,+,+,+":      "a,b,c,n,COPY,+,+,+,+",
+		"a,b,+,ABS,ABS,a,b,+,ABS,*": "a,b,+,ABS,DUP,*", // then repeated subexpressions are eliminated
+	}
+	for input, expected := range list {
+		exp, err := New(input, RewriteRules(testRewriteRules))
+		if err != nil {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+			continue
+		}
+		if actual := exp.String(); actual != expected {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, actual, expected)
+		}
+	}
+}
+
+func TestRewriteRulesPartial(t *testing.T) {
+	exp, err := New("a,b,MAX,1,MIN", RewriteRules(testRewriteRules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual, expected := exp.String(), "a,b,MAX,1,MIN"; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+	partial, err := exp.Partial(map[string]interface{}{"a": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual, expected := partial.String(), "1"; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+}
+
+func TestRewriteRulesCycle(t *testing.T) {
+	exp, err := New("a,b,+", RewriteRules(map[string]string{"x,y,+": "y,x,+"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual, expected := exp.String(), "a,b,+"; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+}
+
+func TestRewriteRulesAccumulate(t *testing.T) {
+	exp, err := New("a,ABS,ABS,b,MAX,b,MAX", RewriteRules(map[string]string{"x,ABS,ABS": "x,ABS"}), RewriteRules(map[string]string{"x,y,MAX,y,MAX": "x,y,MAX"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual, expected := exp.String(), "a,ABS,b,MAX"; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+}
+
+func TestRewriteRulesSources(t *testing.T) {
+	exp, err := New("a,ABS,ABS,b,+", RewriteRules(testRewriteRules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []SourceRange{{0, 1}, {0, 9}, {10, 11}, {12, 13}}
+	actual := exp.SourceRanges()
+	if len(actual) != len(expected) {
+		t.Fatalf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+			break
+		}
+	}
+}
+
+func TestRewriteRulesErrors(t *testing.T) {
+	list := map[string]string{
+		"x":        "syntax error : cannot use rewrite pattern \"x\", which is not an operator",
+		"x,y,+,":   "syntax error : cannot use rewrite rule \"x,y,+,\": empty token at offset 6",
+		"x,n,COPY": "syntax error : cannot use rewrite rule \"x,n,COPY\": cannot rewrite COPY operator",
+		"x,y,MAX":  "syntax error : cannot use rewrite replacement \"x,z,MAX\", which uses symbol \"z\" not in its pattern \"x,y,MAX\"",
+		"x,SQRT":   "syntax error : cannot use rewrite replacement \"x,x,*\", which is longer than its pattern \"x,SQRT\"",
+		"x,y,z,IF": "syntax error : cannot use rewrite rule \"\": empty expression",
+	}
+	replacements := map[string]string{
+		"x":        "x",
+		"x,y,+,":   "x",
+		"x,n,COPY": "x",
+		"x,y,MAX":  "x,z,MAX",
+		"x,SQRT":   "x,x,*",
+		"x,y,z,IF": "",
+	}
+	for pattern, expected := range list {
+		_, err := New("a", RewriteRules(map[string]string{pattern: replacements[pattern]}))
+		if err == nil || err.Error() != expected {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", pattern, err, expected)
+		}
+	}
+}
@@ -0,0 +1,328 @@
+// Package rrdgraph reads the data definitions of rrdtool graph command files, so that existing RRD
+// graph definitions may be evaluated by gorpn.
+//
+// Only DEF, CDEF, and VDEF arguments are read; every other argument of the command, such as options
+// and graph elements like LINE1 or GPRINT, is ignored. Arguments are separated by white space, may
+// be quoted with single or double quotes, and lines may be continued with a trailing backslash, just
+// as in the shell scripts these commands are usually kept in.
+//
+//	rrdtool graph load.png --start -1d \
+//		DEF:busy=host.rrd:busy:AVERAGE \
+//		DEF:idle=host.rrd:idle:AVERAGE \
+//		CDEF:load=busy,busy,idle,+,/,100,* \
+//		VDEF:peak=load,MAXIMUM \
+//		LINE1:load#ff0000:"load"
+package rrdgraph
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/karrick/gorpn"
+)
+
+// Def is a DEF argument, which names the values of a data source of an RRD file.
+//
+//	DEF:<vname>=<rrdfile>:<ds-name>:<CF>[:step=<step>][:start=<time>][:end=<time>][:reduce=<CF>]
+type Def struct {
+	Name                  string
+	Filename              string
+	DataSource            string
+	ConsolidationFunction string
+	Options               map[string]string // optional step, start, end, reduce, and daemon, by name
+}
+
+// CDef is a CDEF argument, which names the values computed at each step by an RPN expression of
+// other DEF, CDEF, or VDEF names.
+//
+//	CDEF:<vname>=<RPN expression>
+type CDef struct {
+	Name       string
+	Expression *gorpn.Expression
+	References []string // names of the other definitions the expression uses, sorted
+}
+
+// VDef is a VDEF argument, which names a single value computed from all the values of a DEF or
+// CDEF, such as their maximum.
+//
+//	VDEF:<vname>=<vname>,<function>
+//	VDEF:<vname>=<vname>,<percentile>,<function>
+type VDef struct {
+	Name     string
+	Source   string  // name of the DEF or CDEF whose values are consumed
+	Function string  // such as MAXIMUM, AVERAGE, or PERCENT
+	Argument float64 // percentile for PERCENT and PERCENTNAN; otherwise zero
+}
+
+// vdefFunctions are the VDEF functions, along with whether each requires an argument.
+var vdefFunctions = map[string]bool{
+	"AVERAGE": false, "FIRST": false, "LAST": false, "LSLCORREL": false, "LSLINT": false,
+	"LSLSLOPE": false, "MAXIMUM": false, "MINIMUM": false, "PERCENT": true, "PERCENTNAN": true,
+	"STDEV": false, "TOTAL": false,
+}
+
+// Graph is the set of data definitions of an rrdtool graph command, in the order they were given.
+type Graph struct {
+	Defs  []*Def
+	CDefs []*CDef
+	VDefs []*VDef
+
+	kinds map[string]string // kind of definition, DEF, CDEF, or VDEF, of each name
+}
+
+// ErrParse is returned when an argument of an rrdtool graph command cannot be read.
+type ErrParse struct {
+	Line     int    // line on which the argument starts
+	Argument string // the argument
+	Message  string
+}
+
+// Error returns the error string representation for ErrParse errors.
+func (e ErrParse) Error() string {
+	return fmt.Sprintf("line %d: %s: %s", e.Line, e.Argument, e.Message)
+}
+
+// Parse reads the data definitions of an rrdtool graph command. It returns an error when a
+// definition is malformed, reuses a name, or refers to a name not defined before it, which rrdtool
+// does not allow either. Each CDEF expression is compiled with the given configuration.
+func Parse(r io.Reader, setters ...gorpn.ExpressionConfigurator) (*Graph, error) {
+	g := &Graph{kinds: make(map[string]string)}
+	err := split(r, func(line int, arg string) error {
+		idx := strings.IndexByte(arg, ':')
+		if idx < 0 {
+			return nil
+		}
+		kind, rest := arg[:idx], arg[idx+1:]
+		if kind != "DEF" && kind != "CDEF" && kind != "VDEF" {
+			return nil // not a data definition
+		}
+		fail := func(format string, args ...interface{}) error {
+			return ErrParse{Line: line, Argument: arg, Message: fmt.Sprintf(format, args...)}
+		}
+
+		idx = strings.IndexByte(rest, '=')
+		if idx < 0 {
+			return fail("expected %s:<vname>=...", kind)
+		}
+		name, definition := rest[:idx], rest[idx+1:]
+		if !isVname(name) {
+			return fail("invalid name: %q", name)
+		}
+		if previous, ok := g.kinds[name]; ok {
+			return fail("name already defined by %s: %q", previous, name)
+		}
+
+		switch kind {
+		case "DEF":
+			fields := splitEscaped(definition)
+			if len(fields) < 3 || fields[0] == "" || fields[1] == "" || fields[2] == "" {
+				return fail("expected DEF:<vname>=<rrdfile>:<ds-name>:<CF>")
+			}
+			def := &Def{Name: name, Filename: fields[0], DataSource: fields[1], ConsolidationFunction: fields[2]}
+			for _, option := range fields[3:] {
+				idx = strings.IndexByte(option, '=')
+				if idx <= 0 {
+					return fail("expected option name=value: %q", option)
+				}
+				if def.Options == nil {
+					def.Options = make(map[string]string)
+				}
+				def.Options[option[:idx]] = option[idx+1:]
+			}
+			g.Defs = append(g.Defs, def)
+		case "CDEF":
+			exp, err := gorpn.New(definition, setters...)
+			if err != nil {
+				return fail("%s", err)
+			}
+			references := exp.OpenBindings()
+			for _, reference := range references {
+				if strings.HasPrefix(reference, "PREV(") && gorpn.IsReserved(reference) {
+					reference = reference[len("PREV(") : len(reference)-1]
+				} else if gorpn.IsReserved(reference) {
+					continue // bound when evaluating rather than defined by the graph
+				}
+				if _, ok := g.kinds[reference]; !ok {
+					return fail("undefined name: %q", reference)
+				}
+			}
+			sort.Strings(references)
+			g.CDefs = append(g.CDefs, &CDef{Name: name, Expression: exp, References: references})
+		case "VDEF":
+			fields := strings.Split(definition, ",")
+			if len(fields) < 2 {
+				return fail("expected VDEF:<vname>=<vname>,[<argument>,]<function>")
+			}
+			vdef := &VDef{Name: name, Source: fields[0]}
+			if kind := g.kinds[vdef.Source]; kind != "DEF" && kind != "CDEF" {
+				return fail("undefined DEF or CDEF name: %q", vdef.Source)
+			}
+			needsArgument, ok := vdefFunctions[fields[len(fields)-1]]
+			if !ok || (needsArgument && len(fields) != 3) || (!needsArgument && len(fields) != 2) {
+				return fail("expected VDEF:<vname>=<vname>,[<argument>,]<function>")
+			}
+			vdef.Function = fields[len(fields)-1]
+			if needsArgument {
+				value, err := strconv.ParseFloat(fields[1], 64)
+				if err != nil || value < 0 || value > 100 {
+					return fail("%s requires percentile between 0 and 100: %q", vdef.Function, fields[1])
+				}
+				vdef.Argument = value
+			}
+			g.VDefs = append(g.VDefs, vdef)
+		}
+		g.kinds[name] = kind
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// Bindings returns bindings for evaluating any CDEF of the Graph: values, along with each CDEF name
+// bound to its Expression, so that a CDEF using other CDEFs evaluates them in turn. The values of
+// the DEF and VDEF names, and of TIME, COUNT, and PREV when used, must be given in values, which is
+// not modified.
+//
+//	func example(g *rrdgraph.Graph) {
+//		bindings := g.Bindings(map[string]interface{}{"busy": 30, "idle": 70})
+//		load, err := g.CDefs[0].Expression.Evaluate(bindings)
+//	}
+func (g *Graph) Bindings(values map[string]interface{}) map[string]interface{} {
+	bindings := make(map[string]interface{}, len(values)+len(g.CDefs))
+	for name, value := range values {
+		bindings[name] = value
+	}
+	for _, cdef := range g.CDefs {
+		bindings[cdef.Name] = cdef.Expression
+	}
+	return bindings
+}
+
+// isVname returns true when name is a valid rrdtool name: from 1 to 255 letters, digits, hyphens,
+// and underscores.
+func isVname(name string) bool {
+	if name == "" || len(name) > 255 {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// splitEscaped splits a DEF on colons not escaped by a backslash, as rrdtool does so that file
+// names may contain colons.
+func splitEscaped(definition string) []string {
+	var fields []string
+	var field strings.Builder
+	for i := 0; i < len(definition); i++ {
+		switch c := definition[i]; {
+		case c == '\\' && i+1 < len(definition) && definition[i+1] == ':':
+			field.WriteByte(':')
+			i++
+		case c == ':':
+			fields = append(fields, field.String())
+			field.Reset()
+		default:
+			field.WriteByte(c)
+		}
+	}
+	return append(fields, field.String())
+}
+
+// split invokes callback with each argument of a shell command read from r, along with the line on
+// which the argument starts, stopping at the first error. Arguments are separated by white space,
+// and may be quoted with single or double quotes. Comments start with # and end with the line. A
+// backslash escapes the following character, except within single quotes, and a backslash before a
+// newline continues the line.
+func split(r io.Reader, callback func(line int, arg string) error) error {
+	br := bufio.NewReader(r)
+	var arg strings.Builder
+	var quote rune // quote character of pending quoted text, or zero
+	var inArg bool
+	line, start := 1, 1
+
+	for {
+		c, _, err := br.ReadRune()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case c == '\\' && quote != '\'':
+			next, _, err := br.ReadRune()
+			if err == io.EOF {
+				if !inArg {
+					start = line
+				}
+				return ErrParse{Line: start, Argument: arg.String(), Message: "trailing backslash"}
+			}
+			if err != nil {
+				return err
+			}
+			if next == '\n' {
+				line++ // continued line
+				continue
+			}
+			if quote == 0 || next == '"' || next == '\\' {
+				arg.WriteRune(next)
+			} else {
+				arg.WriteRune(c)
+				arg.WriteRune(next) // within double quotes, other backslashes are kept
+			}
+			if !inArg {
+				inArg, start = true, line
+			}
+		case quote != 0:
+			arg.WriteRune(c)
+			if c == '\n' {
+				line++
+			}
+		case c == '#' && !inArg:
+			if _, err = br.ReadString('\n'); err != nil && err != io.EOF {
+				return err
+			}
+			line++ // comment through the end of the line
+		case c == '\'' || c == '"':
+			quote = c
+			if !inArg {
+				inArg, start = true, line
+			}
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			if inArg {
+				if err = callback(start, arg.String()); err != nil {
+					return err
+				}
+				arg.Reset()
+				inArg = false
+			}
+			if c == '\n' {
+				line++
+			}
+		default:
+			arg.WriteRune(c)
+			if !inArg {
+				inArg, start = true, line
+			}
+		}
+	}
+	if quote != 0 {
+		return ErrParse{Line: start, Argument: arg.String(), Message: "unterminated quote"}
+	}
+	if inArg {
+		return callback(start, arg.String())
+	}
+	return nil
+}
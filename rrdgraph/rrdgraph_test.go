@@ -0,0 +1,102 @@
+package rrdgraph
+
+import (
+	"strings"
+	"testing"
+)
+
+const script = `#!/bin/sh
+# load of a host
+rrdtool graph load.png --start -1d \
+	DEF:busy=host.rrd:busy:AVERAGE \
+	'DEF:idle=/var/lib/rrd/host\:80.rrd:idle:AVERAGE:step=300:reduce=MAX' \
+	CDEF:total=busy,idle,+ \
+	"CDEF:load=busy,total,/,100,*" \
+	VDEF:peak=load,MAXIMUM \
+	VDEF:p95=load,95,PERCENT \
+	CDEF:overloaded=load,peak,GE \
+	LINE1:load#ff0000:"load of host"
+`
+
+func TestParse(t *testing.T) {
+	g, err := Parse(strings.NewReader(script))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual, expected := len(g.Defs), 2; actual != expected {
+		t.Fatalf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+	idle := g.Defs[1]
+	if idle.Name != "idle" || idle.Filename != "/var/lib/rrd/host:80.rrd" || idle.DataSource != "idle" || idle.ConsolidationFunction != "AVERAGE" {
+		t.Errorf("Actual: %#v; Expected: %#v", idle, "idle DEF")
+	}
+	if actual, expected := idle.Options["step"]+","+idle.Options["reduce"], "300,MAX"; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+
+	if actual, expected := len(g.CDefs), 3; actual != expected {
+		t.Fatalf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+	if actual, expected := strings.Join(g.CDefs[1].References, ","), "busy,total"; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+
+	if actual, expected := len(g.VDefs), 2; actual != expected {
+		t.Fatalf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+	if p95 := g.VDefs[1]; p95.Source != "load" || p95.Function != "PERCENT" || p95.Argument != 95 {
+		t.Errorf("Actual: %#v; Expected: %#v", p95, "p95 VDEF")
+	}
+}
+
+func TestGraphBindings(t *testing.T) {
+	g, err := Parse(strings.NewReader(script))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bindings := g.Bindings(map[string]interface{}{"busy": 30, "idle": 90, "peak": 25})
+	list := map[string]float64{"total": 120, "load": 25, "overloaded": 1}
+	for _, cdef := range g.CDefs {
+		value, err := cdef.Expression.Evaluate(bindings)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", cdef.Name, err, nil)
+		}
+		if expected := list[cdef.Name]; value != expected {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", cdef.Name, value, expected)
+		}
+	}
+}
+
+func TestParseReservedWords(t *testing.T) {
+	input := "DEF:a=x.rrd:a:MAX\nCDEF:b=a,PREV(a),-,COUNT,/,PREV,+,LTIME,NEWDAY,+,+,NOW,STEPWIDTH,+,+"
+	g, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual, expected := strings.Join(g.CDefs[0].References, ","), "COUNT,NOW,PREV,PREV(a),TIME,a"; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	errors := map[string]string{
+		"DEF:busy=host.rrd:busy":                             "line 1: DEF:busy=host.rrd:busy: expected DEF:<vname>=<rrdfile>:<ds-name>:<CF>",
+		"DEF:a.b=host.rrd:busy:AVERAGE":                      "line 1: DEF:a.b=host.rrd:busy:AVERAGE: invalid name: \"a.b\"",
+		"CDEF:load=busy,2,*":                                 "line 1: CDEF:load=busy,2,*: undefined name: \"busy\"",
+		"DEF:a=x.rrd:a:MAX\nDEF:a=x.rrd:b:MAX":               "line 2: DEF:a=x.rrd:b:MAX: name already defined by DEF: \"a\"",
+		"DEF:a=x.rrd:a:MAX\nVDEF:b=a,FASTEST":                "line 2: VDEF:b=a,FASTEST: expected VDEF:<vname>=<vname>,[<argument>,]<function>",
+		"DEF:a=x.rrd:a:MAX\nVDEF:b=a":                        "line 2: VDEF:b=a: expected VDEF:<vname>=<vname>,[<argument>,]<function>",
+		"DEF:a=x.rrd:a:MAX\nCDEF:b=a,PREV(c),+":              "line 2: CDEF:b=a,PREV(c),+: undefined name: \"c\"",
+		"DEF:a=x.rrd:a:MAX\nVDEF:b=a,101,PERCENT":            "line 2: VDEF:b=a,101,PERCENT: PERCENT requires percentile between 0 and 100: \"101\"",
+		"DEF:a=x.rrd:a:MAX\nVDEF:b=a,MAXIMUM\nVDEF:c=b,LAST": "line 3: VDEF:c=b,LAST: undefined DEF or CDEF name: \"b\"",
+		"DEF:a=x.rrd:a:MAX\nCDEF:b=a,+":                      "line 2: CDEF:b=a,+: syntax error : not enough parameters: operator + requires 2 operands",
+		"'DEF:a=x.rrd:a:MAX":                                 "line 1: DEF:a=x.rrd:a:MAX: unterminated quote",
+		"DEF:a=x.rrd:a:MAX\\":                                "line 1: DEF:a=x.rrd:a:MAX: trailing backslash",
+		"DEF:a=x.rrd:a:MAX\n\\":                              "line 2: : trailing backslash",
+	}
+	for input, e := range errors {
+		if _, err := Parse(strings.NewReader(input)); err == nil || err.Error() != e {
+			t.Errorf("Case: %s; Actual: %s; Expected: %#v", input, err, e)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package gorpn
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// SeriesBinding is a series of numbers measured at regular intervals, which may be bound to the
+// label operand of TREND or TRENDNAN in place of a []float64, so that the number of values they
+// average is computed from the Step of the series rather than from SecondsPerInterval, which might
+// not match the data. When Start is not the zero time and TIME is bound, the values averaged are
+// those up to the one measured at TIME, rather than up to the last one. Anywhere else a series may
+// be bound, a SeriesBinding is the same as its Values.
+//
+//	func example() {
+//		exp, err := gorpn.New("qps,600,TREND")
+//		if err != nil {
+//			panic(err)
+//		}
+//		value, err := exp.Evaluate(map[string]interface{}{
+//			"qps": gorpn.SeriesBinding{Values: []float64{1, 2, 3, 4}, Step: time.Minute * 5},
+//		})
+//		// value is 3.5, the average of the last 2 values
+//	}
+type SeriesBinding struct {
+	Values []float64     // numbers of the series, oldest first
+	Step   time.Duration // time between consecutive values, which must be positive
+	Start  time.Time     // time of the first value, or the zero time when not known
+}
+
+// seriesValues returns the numbers of a coerced binding to a series, and false for any other
+// binding.
+func seriesValues(value interface{}) ([]float64, bool) {
+	switch v := value.(type) {
+	case []float64:
+		return v, true
+	case SeriesBinding:
+		return v.Values, true
+	}
+	return nil, false
+}
+
+// trendWindow returns the numbers of the series bound to label, the operand of the operator token,
+// that are within the window of seconds ending with the last of them. The numbers of a []float64
+// are SecondsPerInterval apart, while those of a SeriesBinding are Step apart, and end with the one
+// measured at TIME when the SeriesBinding has a Start and TIME is bound.
+func (e *Expression) trendWindow(token, label string, series interface{}, seconds float64, bindings map[string]interface{}) ([]float64, error) {
+	values, ok := seriesValues(series)
+	if !ok {
+		return nil, newErrSyntax("%s operand specifies %q label, which is not a series of numbers: %T", token, label, series)
+	}
+	step, end := e.secondsPerInterval, len(values)
+	if s, ok := series.(SeriesBinding); ok {
+		step = s.Step.Seconds()
+		if when, ok := bindings["TIME"].(float64); ok && !s.Start.IsZero() {
+			index := math.Floor((when - float64(s.Start.UnixNano())/1e9) / step)
+			if index < 0 || index >= float64(len(values)) {
+				return nil, newErrSyntax("%s operand specifies %q label, which has no value at TIME %v", token, label, when)
+			}
+			end = int(index) + 1
+		}
+	}
+	intervals := saturatingInt(math.Ceil(seconds / step))
+	if intervals > end {
+		return nil, newErrSyntax("%s operand specifies %d values, but only %d available", token, intervals, end)
+	}
+	return values[end-intervals : end], nil
+}
+
+// EvaluateSeriesResult evaluates the Expression elementwise over the series bound to its symbols,
+// returning a series of results, so that an Expression such as "qps,1000,/" may be evaluated with
+// qps bound to a series of numbers, which Evaluate rejects. Each result is what Evaluate returns
+// when every symbol bound to a series is instead bound to the number at the same position in that
+// series, while symbols bound to numbers keep their values for every result. Symbols used as the
+// label operand of TREND or TRENDNAN remain bound to series, which slide along with the elements,
+// so that each result averages the window ending at its own step, unless WholeSeriesTrend is used.
+// Symbols bound to a series and used as the label operand of MEDIAN, MAD, or PERCENT remain bound
+// to their whole series. It returns an error when the series
+// used elementwise have different lengths. When no series is used elementwise, the result holds
+// the single number Evaluate returns.
+//
+//	func example() {
+//		exp, err := gorpn.New("qps,1000,/,limit,GT")
+//		if err != nil {
+//			panic(err)
+//		}
+//		results, err := exp.EvaluateSeriesResult(map[string]interface{}{
+//			"qps":   []float64{500, 2500, 4000},
+//			"limit": 2,
+//		})
+//		// results is []float64{0, 1, 1}
+//	}
+func (e *Expression) EvaluateSeriesResult(bindings map[string]interface{}) ([]float64, error) {
+	coerced, err := e.coerceMapValuesToFloat64(bindings)
+	if err != nil {
+		return nil, err
+	}
+
+	// series bound to symbols of the program that are not labels are used elementwise
+	labels := e.seriesLabels(e.tokens)
+	for idx := 1; idx < len(e.tokens); idx++ {
+		switch e.tokens[idx] {
+		case "MEDIAN", "MAD", "PERCENT":
+			// a count of values is a number, so a symbol bound to a series is the label
+			if symbol, ok := e.tokens[idx-1].(string); ok {
+				if _, ok = seriesValues(coerced[symbol]); ok {
+					labels[symbol] = true
+				}
+			}
+		}
+	}
+	elementwise := make(map[string]bool)
+	var symbols []string
+	for _, tok := range e.tokens {
+		if symbol, ok := tok.(string); ok && !labels[symbol] && !elementwise[symbol] {
+			if _, ok = seriesValues(coerced[symbol]); ok {
+				elementwise[symbol] = true
+				symbols = append(symbols, symbol)
+			}
+		}
+	}
+	if len(symbols) == 0 {
+		value, err := e.Evaluate(coerced)
+		if err != nil {
+			return nil, err
+		}
+		return []float64{value}, nil
+	}
+	sort.Strings(symbols)
+
+	series := make([][]float64, len(symbols))
+	for i, symbol := range symbols {
+		series[i], _ = seriesValues(coerced[symbol])
+		if len(series[i]) != len(series[0]) {
+			return nil, newErrSyntax("cannot evaluate series of different lengths elementwise: %q has %d items, but %q has %d", symbols[0], len(series[0]), symbol, len(series[i]))
+		}
+	}
+
+	// labels of TREND and TRENDNAN slide along with the elements, their last values aligned
+	trends := make(map[string]bool)
+	if !e.wholeSeriesTrend {
+		for idx := 2; idx < len(e.tokens); idx++ {
+			if tok := e.tokens[idx]; tok == "TREND" || tok == "TRENDNAN" {
+				if symbol, ok := e.tokens[idx-2].(string); ok && labels[symbol] {
+					trends[symbol] = true
+				}
+			}
+		}
+	}
+
+	results := make([]float64, len(series[0]))
+	for idx := range results {
+		element := make(map[string]interface{}, len(coerced))
+		for symbol, value := range coerced {
+			element[symbol] = value
+		}
+		for i, symbol := range symbols {
+			element[symbol] = series[i][idx]
+		}
+		for symbol := range trends {
+			if value, ok := coerced[symbol]; ok {
+				element[symbol] = seriesBefore(value, len(results)-1-idx)
+			}
+		}
+		if results[idx], err = e.Evaluate(element); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// seriesBefore returns the series bound to a label as it was offset steps before its last value:
+// the values after that step are dropped, and as many UNKN values precede its first value, so that
+// TREND averages the window ending at that step, and is UNKN when the window begins before the
+// series does.
+func seriesBefore(series interface{}, offset int) interface{} {
+	values, ok := seriesValues(series)
+	if !ok || offset == 0 {
+		return series
+	}
+	shifted := make([]float64, len(values))
+	kept := len(values) - offset
+	if kept < 0 {
+		kept = 0
+	}
+	for i := range shifted[:len(values)-kept] {
+		shifted[i] = math.NaN()
+	}
+	copy(shifted[len(values)-kept:], values[:kept])
+	if s, ok := series.(SeriesBinding); ok {
+		s.Values = shifted
+		if !s.Start.IsZero() {
+			s.Start = s.Start.Add(-time.Duration(offset) * s.Step)
+		}
+		return s
+	}
+	return shifted
+}
+
+// WholeSeriesTrend causes EvaluateSeriesResult to bind the label operands of TREND and TRENDNAN to
+// their whole series for every element of its result, so that every element averages the same
+// window at the end of the series, just as Evaluate does. By default, each element averages the
+// window that ends with its own step, the last values of the label and of the series evaluated
+// elementwise being aligned, just like the sliding window of RRDtool.
+//
+//	func example() {
+//		exp, err := gorpn.New("qps,history,600,TREND,-", gorpn.WholeSeriesTrend())
+//		if err != nil {
+//			panic(err)
+//		}
+//	}
+func WholeSeriesTrend() ExpressionConfigurator {
+	return func(e *Expression) error {
+		e.wholeSeriesTrend = true
+		return nil
+	}
+}
@@ -0,0 +1,106 @@
+package gorpn
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestEvaluateSeriesResult(t *testing.T) {
+	bindings := map[string]interface{}{
+		"qps":     []float64{500, 2500, 4000},
+		"errors":  []int{5, 0, 40},
+		"limit":   2,
+		"history": []float64{1, 2, 3, 4},
+		"short":   []float64{1, 2},
+		"stepped": SeriesBinding{Values: []float64{1, 2, 3, 4}, Step: 2 * time.Second},
+	}
+	list := map[string][]float64{
+		"qps,1000,/":               {0.5, 2.5, 4},
+		"qps,1000,/,limit,GT":      {0, 1, 1},
+		"errors,qps,/,100,*":       {1, 0, 1},
+		"qps,qps,*":                {250000, 6250000, 16000000},
+		"qps,errors,MAX,limit,+":   {502, 2502, 4002},
+		"history,3,TREND,qps,+":    {math.NaN(), 2502, 4003}, // window slides along with qps
+		"history,3,TRENDNAN,qps,+": {501.5, 2502, 4003},
+		"limit,1,+":                {3},
+		"history,2,TREND":          {3.5},
+		"errors,0,EQ,UNKN,qps,IF":  {500, math.NaN(), 4000},
+		"stepped,4,TREND":          {3.5}, // 2 values 2 seconds apart
+		"history,4,TREND":          {2.5}, // 4 values 1 second apart
+		"stepped,10,*":             {10, 20, 30, 40},
+		"qps,MEDIAN":               {2500}, // label remains a series
+		"qps,MAD":                  {1500},
+		"50,qps,PERCENT":           {2500},
+		"history,MEDIAN,qps,+":     {502.5, 2502.5, 4002.5},
+		"limit,history,MEDIAN,+":   {4.5},
+		"qps,qps,limit,MEDIAN":     {500, 2500, 4000}, // limit is a count of values
+	}
+	for input, expected := range list {
+		exp, err := New(input, SecondsPerInterval(1))
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		actual, err := exp.EvaluateSeriesResult(bindings)
+		if err != nil {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+			continue
+		}
+		if len(actual) != len(expected) {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, actual, expected)
+			continue
+		}
+		for i := range expected {
+			if actual[i] != expected[i] && !(math.IsNaN(actual[i]) && math.IsNaN(expected[i])) {
+				t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, actual, expected)
+				break
+			}
+		}
+	}
+}
+
+func TestEvaluateSeriesResultWholeSeriesTrend(t *testing.T) {
+	bindings := map[string]interface{}{
+		"qps":     []float64{500, 2500, 4000},
+		"history": []float64{1, 2, 3, 4},
+	}
+	exp, err := New("history,3,TREND,qps,+", SecondsPerInterval(1), WholeSeriesTrend())
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual, err := exp.EvaluateSeriesResult(bindings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []float64{503, 2503, 4003} // label remains the whole series
+	if len(actual) != len(expected) {
+		t.Fatalf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+			break
+		}
+	}
+}
+
+func TestEvaluateSeriesResultErrors(t *testing.T) {
+	bindings := map[string]interface{}{
+		"qps":   []float64{500, 2500, 4000},
+		"short": []float64{1, 2},
+	}
+	list := map[string]string{
+		"qps,short,+": "syntax error : cannot evaluate series of different lengths elementwise: \"qps\" has 3 items, but \"short\" has 2",
+		"qps,other,+": "open bindings: other",
+	}
+	for input, expected := range list {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		_, err = exp.EvaluateSeriesResult(bindings)
+		if err == nil || err.Error() != expected {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, err, expected)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package gorpn
+
+import "math"
+
+// solveIterations limits the number of bisections Solve performs, which is more than enough to
+// narrow any range of float64 values down to adjacent values.
+const solveIterations = 2100
+
+// Solve returns the value of the symbol unknown, between min and max, for which the Expression
+// evaluates to target, given bindings for its other symbols, which answers questions such as what
+// rate of requests makes an alert fire. It bisects the range, so the Expression need only be
+// monotonic between min and max, rather than differentiable, and when the Expression changes
+// abruptly, as comparisons do, Solve returns the boundary where it first reaches target.
+//
+// It returns an error when the Expression does not reach target between min and max, or evaluates
+// to NaN along the way.
+//
+//	func example() {
+//		exp, err := gorpn.New("qps,latency,*,concurrency,GT")
+//		if err != nil {
+//			panic(err)
+//		}
+//		qps, err := exp.Solve(1, "qps", map[string]interface{}{"latency": 0.25, "concurrency": 100}, 0, 1e6)
+//		// qps is the least rate of requests that exceeds the concurrency, just over 400
+//	}
+func (e *Expression) Solve(target float64, unknown string, bindings map[string]interface{}, min, max float64) (float64, error) {
+	if math.IsNaN(target) {
+		return 0, newErrSyntax("cannot solve for %q to reach NaN", unknown)
+	}
+	if !(min < max) || math.IsInf(min, 0) || math.IsInf(max, 0) {
+		return 0, newErrSyntax("cannot solve for %q in range: [%v, %v]", unknown, min, max)
+	}
+	if _, ok := bindings[unknown]; ok {
+		return 0, newErrSyntax("cannot solve for %q, which is already bound", unknown)
+	}
+
+	var x float64
+	withUnknown := make(map[string]interface{}, len(bindings)+1)
+	for symbol, value := range bindings {
+		withUnknown[symbol] = value
+	}
+	withUnknown[unknown] = &x
+	evaluate, err := e.Bind(withUnknown)
+	if err != nil {
+		return 0, err
+	}
+
+	// f returns how far the Expression is from target when unknown is value
+	f := func(value float64) (float64, error) {
+		x = value
+		result, err := evaluate()
+		if err != nil {
+			return 0, err
+		}
+		if math.IsNaN(result) {
+			return 0, newErrSyntax("cannot solve for %q, because expression is NaN when %q is %v", unknown, unknown, value)
+		}
+		return result - target, nil
+	}
+
+	low, err := f(min)
+	if err != nil {
+		return 0, err
+	}
+	if low == 0 {
+		return min, nil
+	}
+	high, err := f(max)
+	if err != nil {
+		return 0, err
+	}
+	if high != 0 && math.Signbit(high) == math.Signbit(low) {
+		return 0, newErrSyntax("cannot solve for %q, because expression does not reach %v between %v and %v", unknown, target, min, max)
+	}
+
+	// invariant: the Expression has not reached target at min, but has at max
+	for i := 0; i < solveIterations; i++ {
+		middle := min + (max-min)/2
+		if middle <= min || middle >= max {
+			break // min and max are adjacent
+		}
+		value, err := f(middle)
+		if err != nil {
+			return 0, err
+		}
+		if value == 0 || math.Signbit(value) != math.Signbit(low) {
+			max = middle
+		} else {
+			min = middle
+		}
+	}
+	return max, nil
+}
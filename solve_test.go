@@ -0,0 +1,87 @@
+package gorpn
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSolve(t *testing.T) {
+	list := map[string]struct {
+		input    string
+		target   float64
+		bindings map[string]interface{}
+		min, max float64
+		expected float64
+	}{
+		"linear":     {"qps,latency,*", 100, map[string]interface{}{"latency": 0.25}, 0, 1e6, 400},
+		"decreasing": {"1000,qps,-", 250, nil, 0, 1e6, 750},
+		"square":     {"qps,qps,*", 2, nil, 0, 10, math.Sqrt2},
+		"at minimum": {"qps,2,*", 0, nil, 0, 10, 0},
+		"folded":     {"qps,a,b,+,*", 30, map[string]interface{}{"a": 1, "b": 2}, -100, 100, 10},
+		"expression": {"qps,x,+", 15, map[string]interface{}{"x": mustParse(t, "qps,2,*")}, 0, 100, 5},
+	}
+	for name, item := range list {
+		exp, err := New(item.input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", name, err, nil)
+		}
+		actual, err := exp.Solve(item.target, "qps", item.bindings, item.min, item.max)
+		if err != nil {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, err, nil)
+			continue
+		}
+		if math.Abs(actual-item.expected) > 1e-9*math.Max(1, math.Abs(item.expected)) {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, actual, item.expected)
+		}
+	}
+}
+
+func TestSolveThreshold(t *testing.T) {
+	exp, err := New("qps,latency,*,concurrency,GT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bindings := map[string]interface{}{"latency": 0.25, "concurrency": 100}
+	qps, err := exp.Solve(1, "qps", bindings, 0, 1e6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the least value that fires, whose predecessor does not
+	if qps <= 400 || qps > math.Nextafter(400, 1e6) {
+		t.Errorf("Actual: %#v; Expected: %#v", qps, math.Nextafter(400, 1e6))
+	}
+	for value, expected := range map[float64]float64{qps: 1, math.Nextafter(qps, 0): 0} {
+		actual, err := exp.Evaluate(map[string]interface{}{"qps": value, "latency": 0.25, "concurrency": 100})
+		if err != nil || actual != expected {
+			t.Errorf("Case: %v; Actual: %#v, %#v; Expected: %#v", value, actual, err, expected)
+		}
+	}
+}
+
+func TestSolveErrors(t *testing.T) {
+	list := map[string]struct {
+		input    string
+		target   float64
+		bindings map[string]interface{}
+		min, max float64
+		expected string
+	}{
+		"not reached":    {"qps,2,*", 100, nil, 0, 10, "syntax error : cannot solve for \"qps\", because expression does not reach 100 between 0 and 10"},
+		"empty range":    {"qps,2,*", 1, nil, 10, 10, "syntax error : cannot solve for \"qps\" in range: [10, 10]"},
+		"infinite range": {"qps,2,*", 1, nil, 0, math.Inf(1), "syntax error : cannot solve for \"qps\" in range: [0, +Inf]"},
+		"nan target":     {"qps,2,*", math.NaN(), nil, 0, 10, "syntax error : cannot solve for \"qps\" to reach NaN"},
+		"already bound":  {"qps,2,*", 1, map[string]interface{}{"qps": 3}, 0, 10, "syntax error : cannot solve for \"qps\", which is already bound"},
+		"open binding":   {"qps,other,*", 1, nil, 0, 10, "open bindings: other"},
+		"nan":            {"qps,SQRT", 1, nil, -10, 10, "syntax error : cannot solve for \"qps\", because expression is NaN when \"qps\" is -10"},
+	}
+	for name, item := range list {
+		exp, err := New(item.input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", name, err, nil)
+		}
+		_, err = exp.Solve(item.target, "qps", item.bindings, item.min, item.max)
+		if err == nil || err.Error() != item.expected {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", name, err, item.expected)
+		}
+	}
+}
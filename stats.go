@@ -0,0 +1,137 @@
+package gorpn
+
+// Stats describes the size and complexity of an Expression, as returned by its Stats method.
+type Stats struct {
+	Tokens           int            // tokens in the simplified program
+	Operators        map[string]int // uses of each operator and reserved word, such as NOW
+	MaxStackDepth    int            // most items on the stack at once while evaluating, or -1 when not known until evaluation
+	SeriesReferences int            // symbols used as the series of TREND or TRENDNAN
+	Cost             int            // estimated cost of evaluating, as accounted by EvaluationBudget
+}
+
+// statsReducers are the operators whose top operand is a count of the items they reduce to a
+// single value.
+var statsReducers = map[string]bool{
+	"AVG": true, "AVGNAN": true, "MAD": true, "MEDIAN": true, "SMAX": true, "SMIN": true,
+	"SSTDEV": true, "STDEV": true, "STDEVNAN": true, "SVAR": true, "VAR": true,
+}
+
+// Stats returns the size and complexity of the Expression after simplification, which is useful
+// for auditing the complexity of many expressions, such as the rules of an alerting system, without
+// parsing the result of String again.
+//
+// The estimated cost is the number of items each token pushes onto the stack or consumes from it,
+// multiplied by the weight of each operator given to OperatorCosts, so an operator that takes a
+// count of items, such as SORT or AVG, costs as much as the items it examines. This is the cost
+// that EvaluationBudget limits. The maximum stack depth is -1 when a count of items is not known until the Expression
+// is evaluated, and the cost then only includes the other operands of such operators.
+//
+//	func example() {
+//		exp, err := gorpn.New("a,b,c,3,AVG,limit,MIN")
+//		if err != nil {
+//			panic(err)
+//		}
+//		stats := exp.Stats()
+//		// stats.Tokens == 7, stats.Operators == map[AVG:1 MIN:1], stats.MaxStackDepth == 4
+//	}
+func (e *Expression) Stats() Stats {
+	stats := Stats{Tokens: len(e.tokens), Operators: make(map[string]int)}
+	depth, known := 0, true
+
+	for position, tok := range e.tokens {
+		token, ok := tok.(string)
+		if reserved[token] {
+			stats.Operators[token]++
+		}
+		if _, isOperator := arity[token]; ok && isOperator {
+			stats.Operators[token]++
+		}
+		if token == "TREND" || token == "TRENDNAN" {
+			if position >= 2 {
+				if label, ok := e.tokens[position-2].(string); ok && !isOperatorName(label) {
+					if _, ok = e.tokens[position-1].(float64); ok {
+						stats.SeriesReferences++
+					}
+				}
+			}
+		}
+
+		pops, pushes, ok := e.stackEffect(position, depth)
+		known = known && ok
+		stats.Cost += e.costs.weight(token) * (pops + pushes)
+		depth += pushes - pops
+		if depth > stats.MaxStackDepth {
+			stats.MaxStackDepth = depth
+		}
+	}
+	if !known {
+		stats.MaxStackDepth = -1
+	}
+	return stats
+}
+
+// stackEffect returns how many items the token at position of the program consumes from the stack
+// and pushes onto it, given the depth of the stack before it, and false when a count of items it
+// depends upon is not known until evaluation, in which case only its other operands are accounted
+// for. Numbers and symbols push a single item.
+func (e *Expression) stackEffect(position, depth int) (pops, pushes int, known bool) {
+	token, ok := e.tokens[position].(string)
+	opArity, isOperator := arity[token]
+	if !ok || !isOperator {
+		return 0, 1, true
+	}
+
+	// count returns the constant count offset tokens before position, and true, or false when that
+	// count is not known until evaluation
+	count := func(offset int) (int, bool) {
+		if position < offset {
+			return 0, false
+		}
+		value, ok := e.tokens[position-offset].(float64)
+		if !ok || !e.isCount(value) {
+			return 0, false
+		}
+		return saturatingInt(value), true
+	}
+
+	pops, pushes, known = opArity.popCount, 1, true
+	switch {
+	case statsReducers[token]:
+		n, ok := count(1)
+		pops += n
+		known = ok
+	case token == "COPY" || token == "REV" || token == "SORT":
+		n, ok := count(1)
+		pops, pushes = pops+n, n
+		if token == "COPY" {
+			pushes = 2 * n // the items copied remain
+		}
+		known = ok
+	case token == "NLARGEST" || token == "NSMALLEST":
+		k, okK := count(2)
+		n, okN := count(1)
+		pops, pushes = pops+n, k
+		known = okK && okN
+	case token == "PERCENT":
+		n, ok := count(1)
+		pops += n
+		known = ok
+	case token == "ROLL":
+		n, ok := count(2)
+		pops, pushes = pops+n, n
+		known = ok
+	case wholeStackOperators[token]:
+		pops = depth
+	case token == "HIST":
+		known = false // pushes a count for each bucket
+	case token == "DUP" || token == "OVER" || token == "TUCK":
+		pushes = pops + 1
+	case token == "EXC" || token == "SWAP" || token == "ROT":
+		pushes = pops
+	case token == "NIP":
+		pushes = 1
+	case token == "POP":
+		pushes = 0
+	}
+	return pops, pushes, known
+}
@@ -0,0 +1,32 @@
+package gorpn
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	list := map[string]Stats{
+		"42":                     {Tokens: 1, Operators: map[string]int{}, MaxStackDepth: 1, Cost: 1},
+		"60,24,*,a,+":            {Tokens: 3, Operators: map[string]int{"+": 1}, MaxStackDepth: 2, Cost: 5},
+		"a,b,c,3,AVG,limit,MIN":  {Tokens: 7, Operators: map[string]int{"AVG": 1, "MIN": 1}, MaxStackDepth: 4, Cost: 13},
+		"a,b,+,a,b,+,*":          {Tokens: 5, Operators: map[string]int{"+": 1, "DUP": 1, "*": 1}, MaxStackDepth: 2, Cost: 11},
+		"a,b,c,2,COPY,5,SORT,+":  {Tokens: 8, Operators: map[string]int{"SORT": 1, "+": 1}, MaxStackDepth: 6, Cost: 20},
+		"a,b,+,c,2,COPY,*,*":     {Tokens: 8, Operators: map[string]int{"+": 1, "COPY": 1, "*": 2}, MaxStackDepth: 4, Cost: 20},
+		"a,b,c,d,1,3,NLARGEST":   {Tokens: 7, Operators: map[string]int{"NLARGEST": 1}, MaxStackDepth: 6, Cost: 12},
+		"a,b,+,c,d,3,1,ROLL,-,*": {Tokens: 10, Operators: map[string]int{"+": 1, "ROLL": 1, "-": 1, "*": 1}, MaxStackDepth: 5, Cost: 23},
+		"a,b,c,n,AVG":            {Tokens: 5, Operators: map[string]int{"AVG": 1}, MaxStackDepth: -1, Cost: 6},
+		"qps,600,TREND,NOW,-":    {Tokens: 5, Operators: map[string]int{"TREND": 1, "NOW": 1, "-": 1}, MaxStackDepth: 2, Cost: 9, SeriesReferences: 1},
+		"a,b,c,3,10,HIST":        {Tokens: 6, Operators: map[string]int{"HIST": 1}, MaxStackDepth: -1, Cost: 8},
+		"a,b,+,c,ALLMAX":         {Tokens: 5, Operators: map[string]int{"+": 1, "ALLMAX": 1}, MaxStackDepth: 2, Cost: 9},
+	}
+	for input, expected := range list {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if actual := exp.Stats(); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, actual, expected)
+		}
+	}
+}
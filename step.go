@@ -0,0 +1,68 @@
+package gorpn
+
+import (
+	"math"
+	"strconv"
+	"time"
+)
+
+// stepUnits are the units a step may be written in by ParseStep.
+var stepUnits = map[byte]time.Duration{
+	's': time.Second,
+	'm': time.Minute,
+	'h': time.Hour,
+	'd': 24 * time.Hour,
+	'w': 7 * 24 * time.Hour,
+}
+
+// ParseStep returns the duration of a step written as a number of seconds, such as "300", as a
+// number followed by one of the units s, m, h, d, or w, such as "5m" or "1.5h", or in any form
+// time.ParseDuration accepts, such as "1h30m". It returns an error when the step is not positive.
+//
+//	func example() {
+//		step, err := gorpn.ParseStep("1w")
+//		if err != nil {
+//			panic(err)
+//		}
+//		exp, err := gorpn.New("qps,STEPWIDTH,*", gorpn.SecondsPerIntervalFromDuration(step))
+//	}
+func ParseStep(text string) (time.Duration, error) {
+	count, unit := text, time.Second
+	if n := len(text); n > 1 {
+		if u, ok := stepUnits[text[n-1]]; ok {
+			count, unit = text[:n-1], u
+		}
+	}
+	value, err := strconv.ParseFloat(count, 64)
+	if err != nil {
+		step, err := time.ParseDuration(text)
+		if err != nil || step <= 0 {
+			return 0, newErrSyntax("cannot parse step: %q", text)
+		}
+		return step, nil
+	}
+	step := value * float64(unit)
+	if !(step >= 1 && step < math.MaxInt64) { // also rejects NaN
+		return 0, newErrSyntax("cannot parse step: %q", text)
+	}
+	return time.Duration(step), nil
+}
+
+// SecondsPerIntervalFromDuration is just like SecondsPerInterval, but takes the duration of an
+// interval, such as one returned by ParseStep, rather than its number of seconds.
+//
+//	func example() {
+//		exp, err := gorpn.New("42,13,2,MEDIAN", gorpn.SecondsPerIntervalFromDuration(time.Minute))
+//		if err != nil {
+//			panic(err)
+//		}
+//	}
+func SecondsPerIntervalFromDuration(interval time.Duration) ExpressionConfigurator {
+	return func(e *Expression) error {
+		if interval <= 0 {
+			return newErrSyntax("cannot use %s as interval", interval)
+		}
+		e.secondsPerInterval = interval.Seconds()
+		return nil
+	}
+}
@@ -0,0 +1,58 @@
+package gorpn
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseStep(t *testing.T) {
+	list := map[string]time.Duration{
+		"300":    5 * time.Minute,
+		"30s":    30 * time.Second,
+		"5m":     5 * time.Minute,
+		"1h":     time.Hour,
+		"1.5h":   90 * time.Minute,
+		"1d":     24 * time.Hour,
+		"1w":     7 * 24 * time.Hour,
+		"1h30m":  90 * time.Minute,
+		"500ms":  500 * time.Millisecond,
+		"2m30s":  150 * time.Second,
+		"1e3":    1000 * time.Second,
+		"0.001s": time.Millisecond,
+	}
+	for input, expected := range list {
+		actual, err := ParseStep(input)
+		if err != nil {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+			continue
+		}
+		if actual != expected {
+			t.Errorf("Case: %s; Actual: %s; Expected: %s", input, actual, expected)
+		}
+	}
+}
+
+func TestParseStepErrors(t *testing.T) {
+	for _, input := range []string{"", "m", "0", "-5m", "0s", "5x", "NaN", "Infh", "1e20w", "5 m", "-1h30m"} {
+		_, err := ParseStep(input)
+		if expected := "syntax error : cannot parse step: \"" + input + "\""; err == nil || err.Error() != expected {
+			t.Errorf("Case: %q; Actual: %#v; Expected: %#v", input, err, expected)
+		}
+	}
+}
+
+func TestSecondsPerIntervalFromDuration(t *testing.T) {
+	exp, err := New("STEPWIDTH", SecondsPerIntervalFromDuration(5*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := exp.Evaluate(nil)
+	if err != nil || value != 300 {
+		t.Errorf("Actual: %#v, %#v; Expected: %#v", value, err, 300.0)
+	}
+
+	_, err = New("STEPWIDTH", SecondsPerIntervalFromDuration(0))
+	if expected := "syntax error : cannot use 0s as interval"; err == nil || err.Error() != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", err, expected)
+	}
+}
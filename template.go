@@ -0,0 +1,224 @@
+package gorpn
+
+import (
+	"strconv"
+	"strings"
+)
+
+// placeholder is one piece of a symbol in a Template: either literal text, or a positional or
+// named placeholder to be replaced by an argument when the Template is instantiated.
+type placeholder struct {
+	literal  string
+	position int    // 1 for $1, 2 for $2, and so on, or 0 when not positional
+	name     string // name for {name}, or empty when not named
+}
+
+// Template is an RPN expression whose symbols contain placeholders, which is compiled once, then
+// instantiated any number of times with different arguments to produce concrete Expressions.
+//
+// A positional placeholder is written as a dollar sign followed by a number, `$1` through `$n`, and
+// is replaced by the respective argument given to Instantiate. A named placeholder is written as a
+// name surrounded by braces, `{name}`, and is replaced by the respective argument given to
+// InstantiateNamed. Placeholders may only be used in symbols, and may be combined with other text
+// in the same symbol.
+//
+//	func example(hosts []string) {
+//		template, err := gorpn.NewTemplate("{host}.hits,{host}.misses,+,{host}.hits,/")
+//		if err != nil {
+//			panic(err)
+//		}
+//		for _, host := range hosts {
+//			exp, err := template.InstantiateNamed(map[string]string{"host": host})
+//			if err != nil {
+//				panic(err)
+//			}
+//			// exp.Evaluate(...)
+//		}
+//	}
+type Template struct {
+	exp     *Expression
+	symbols map[string][]placeholder // symbols of exp that contain placeholders
+	indexes []int                    // indexes of tokens of exp that contain placeholders
+}
+
+// NewTemplate returns a new Template based on some expression, accepting the same configuration as
+// New.
+func NewTemplate(someExpression string, setters ...ExpressionConfigurator) (*Template, error) {
+	exp, err := New(someExpression, setters...)
+	if err != nil {
+		return nil, err
+	}
+	t := &Template{exp: exp, symbols: make(map[string][]placeholder)}
+	for idx, tok := range exp.tokens {
+		symbol, ok := tok.(string)
+		if !ok {
+			continue
+		}
+		if _, ok = arity[symbol]; ok || reserved[symbol] {
+			continue
+		}
+		parts, ok := t.symbols[symbol]
+		if !ok {
+			if parts, err = parsePlaceholders(symbol); err != nil {
+				return nil, err
+			}
+			if parts == nil {
+				continue
+			}
+			t.symbols[symbol] = parts
+		}
+		t.indexes = append(t.indexes, idx)
+	}
+	return t, nil
+}
+
+// parsePlaceholders splits symbol into literal text and placeholders, or returns nil when symbol
+// has no placeholders.
+func parsePlaceholders(symbol string) ([]placeholder, error) {
+	var parts []placeholder
+	var found bool
+	start := 0 // start of pending literal text
+	flush := func(end int) {
+		if end > start {
+			parts = append(parts, placeholder{literal: symbol[start:end]})
+		}
+	}
+	for i := 0; i < len(symbol); {
+		switch symbol[i] {
+		case '$':
+			j := i + 1
+			for j < len(symbol) && symbol[j] >= '0' && symbol[j] <= '9' {
+				j++
+			}
+			if j == i+1 {
+				i++ // lone dollar sign is literal text
+				continue
+			}
+			position, err := strconv.Atoi(symbol[i+1 : j])
+			if err != nil || position == 0 {
+				return nil, newErrSyntax("invalid placeholder in %q: %s", symbol, symbol[i:j])
+			}
+			flush(i)
+			parts = append(parts, placeholder{position: position})
+			found = true
+			i, start = j, j
+		case '{':
+			j := strings.IndexByte(symbol[i:], '}')
+			if j < 0 {
+				return nil, newErrSyntax("unterminated placeholder in %q", symbol)
+			}
+			if j == 1 {
+				return nil, newErrSyntax("empty placeholder in %q", symbol)
+			}
+			flush(i)
+			parts = append(parts, placeholder{name: symbol[i+1 : i+j]})
+			found = true
+			i += j + 1
+			start = i
+		default:
+			i++
+		}
+	}
+	if !found {
+		return nil, nil
+	}
+	flush(len(symbol))
+	return parts, nil
+}
+
+// Instantiate returns a new Expression with each positional placeholder, `$1` through `$n`, replaced
+// by the respective argument. It returns an error when the Template uses a placeholder for which no
+// argument is given, or uses named placeholders.
+//
+//	func example() {
+//		template, err := gorpn.NewTemplate("$1.qps,$2.qps,+")
+//		if err != nil {
+//			panic(err)
+//		}
+//		exp, err := template.Instantiate("web1", "web2")
+//		if err != nil {
+//			panic(err)
+//		}
+//		s := exp.String() // "web1.qps,web2.qps,+"
+//	}
+func (t *Template) Instantiate(args ...string) (*Expression, error) {
+	return t.instantiate(func(p placeholder) (string, error) {
+		if p.position == 0 {
+			return "", newErrSyntax("cannot instantiate named placeholder {%s} with positional arguments", p.name)
+		}
+		if p.position > len(args) {
+			return "", newErrSyntax("placeholder $%d requires %d arguments, but only %d given", p.position, p.position, len(args))
+		}
+		return args[p.position-1], nil
+	})
+}
+
+// InstantiateNamed returns a new Expression with each named placeholder, `{name}`, replaced by the
+// respective argument. It returns an error when the Template uses a placeholder for which no
+// argument is given, or uses positional placeholders.
+func (t *Template) InstantiateNamed(args map[string]string) (*Expression, error) {
+	return t.instantiate(func(p placeholder) (string, error) {
+		if p.name == "" {
+			return "", newErrSyntax("cannot instantiate positional placeholder $%d with named arguments", p.position)
+		}
+		arg, ok := args[p.name]
+		if !ok {
+			return "", newErrSyntax("placeholder {%s} requires argument", p.name)
+		}
+		return arg, nil
+	})
+}
+
+// instantiate returns a new Expression sharing the compiled program of the Template, with each
+// symbol that contains placeholders replaced by the symbol formed using the given arguments.
+// Nothing is tokenized or simplified again.
+func (t *Template) instantiate(argument func(placeholder) (string, error)) (*Expression, error) {
+	renames := make(map[string]string, len(t.symbols))
+	for _, idx := range t.indexes {
+		// in token order, so the same error is reported every time
+		symbol := t.exp.tokens[idx].(string)
+		if _, ok := renames[symbol]; ok {
+			continue
+		}
+		parts := t.symbols[symbol]
+		var b strings.Builder
+		for _, p := range parts {
+			if p.position == 0 && p.name == "" {
+				b.WriteString(p.literal)
+				continue
+			}
+			arg, err := argument(p)
+			if err != nil {
+				return nil, err
+			}
+			b.WriteString(arg)
+		}
+		to := b.String()
+		if to == "" {
+			return nil, newErrSyntax("cannot instantiate %q as empty symbol", symbol)
+		}
+		if _, ok := arity[to]; ok || reserved[to] {
+			return nil, newErrSyntax("cannot instantiate %q as operator %q", symbol, to)
+		}
+		renames[symbol] = to
+	}
+
+	exp := t.exp.clone()
+	for _, idx := range t.indexes {
+		exp.tokens[idx] = renames[exp.tokens[idx].(string)]
+	}
+	openBindings := make(map[string]int, len(exp.openBindings))
+	for symbol, count := range exp.openBindings {
+		if to, ok := renames[symbol]; ok {
+			symbol = to
+		}
+		openBindings[symbol] += count
+	}
+	exp.openBindings = openBindings
+	return exp, nil
+}
+
+// String returns the string representation of a Template.
+func (t *Template) String() string {
+	return t.exp.String()
+}
@@ -0,0 +1,119 @@
+package gorpn
+
+import "testing"
+
+func TestTemplateInstantiate(t *testing.T) {
+	list := map[string]struct {
+		args   []string
+		output string
+	}{
+		"$1.qps,1000,*":             {[]string{"web1"}, "web1.qps,1000,*"},
+		"$1.qps,$2.qps,+":           {[]string{"web1", "web2"}, "web1.qps,web2.qps,+"},
+		"$2.qps,$1.qps,-":           {[]string{"web1", "web2"}, "web2.qps,web1.qps,-"},
+		"$1.hits,$1.misses,+":       {[]string{"web,1"}, "'web,1.hits','web,1.misses',+"},
+		"cost$,$1,*":                {[]string{"qps"}, "cost$,qps,*"},
+		"$1,600,TREND,$1,900,TREND": {[]string{"qps"}, "qps,600,TREND,qps,900,TREND"},
+	}
+	for input, item := range list {
+		template, err := NewTemplate(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		exp, err := template.Instantiate(item.args...)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if actual := exp.String(); actual != item.output {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, actual, item.output)
+		}
+	}
+}
+
+func TestTemplateInstantiateNamed(t *testing.T) {
+	template, err := NewTemplate("{host}.hits,{host}.misses,+,{host}.hits,/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, host := range []string{"web1", "web2"} {
+		exp, err := template.InstantiateNamed(map[string]string{"host": host})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual, expected := exp.OpenBindings(), 2; len(actual) != expected {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", host, actual, expected)
+		}
+		value, err := exp.Evaluate(map[string]interface{}{host + ".hits": 3, host + ".misses": 1})
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", host, err, nil)
+		}
+		if expected := 4.0 / 3.0; value != expected {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", host, value, expected)
+		}
+	}
+	if actual, expected := template.String(), "{host}.hits,{host}.misses,+,{host}.hits,/"; actual != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", actual, expected)
+	}
+}
+
+func TestTemplateInstancesAreIndependent(t *testing.T) {
+	template, err := NewTemplate("$1,2,*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp1, err := template.Instantiate("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp2, err := template.Instantiate("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	value1, err := exp1.Evaluate(map[string]interface{}{"a": 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	value2, err := exp2.Evaluate(map[string]interface{}{"b": 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := float64(6); value1 != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", value1, expected)
+	}
+	if expected := float64(10); value2 != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", value2, expected)
+	}
+}
+
+func TestTemplateErrors(t *testing.T) {
+	errors := map[string]string{
+		"{host.qps": "syntax error : unterminated placeholder in \"{host.qps\"",
+		"{}.qps":    "syntax error : empty placeholder in \"{}.qps\"",
+		"$0.qps":    "syntax error : invalid placeholder in \"$0.qps\": $0",
+	}
+	for input, e := range errors {
+		if _, err := NewTemplate(input); err == nil || err.Error() != e {
+			t.Errorf("Case: %s; Actual: %s; Expected: %#v", input, err, e)
+		}
+	}
+
+	template, err := NewTemplate("$1,$2,+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	instantiations := map[string]func() (*Expression, error){
+		"syntax error : placeholder $2 requires 2 arguments, but only 1 given": func() (*Expression, error) {
+			return template.Instantiate("a")
+		},
+		"syntax error : cannot instantiate positional placeholder $1 with named arguments": func() (*Expression, error) {
+			return template.InstantiateNamed(map[string]string{"1": "a"})
+		},
+		"syntax error : cannot instantiate \"$1\" as operator \"+\"": func() (*Expression, error) {
+			return template.Instantiate("+", "b")
+		},
+	}
+	for e, instantiate := range instantiations {
+		if _, err := instantiate(); err == nil || err.Error() != e {
+			t.Errorf("Actual: %s; Expected: %#v", err, e)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package gorpn
+
+import "fmt"
+
+// stackType is the type of an item on the abstract stack of checkStackTypes: a symbol, which may
+// be bound to either a number or a series of numbers, or a number computed by an operator, or given
+// in the program, along with how the symbols consumed to compute that number were used.
+type stackType struct {
+	symbol   string               // name of the symbol, or empty for a number
+	operator string               // operator that computed the number, or empty for a number in the program
+	uses     map[string]symbolUse // how the symbols consumed to compute the number were used
+}
+
+// symbolUse records the index of the first operator using a symbol as a series label, and the
+// index of the first operator using it as a number, each -1 when the symbol is not used that way.
+type symbolUse struct {
+	label, operand int
+}
+
+// checkStackTypes returns an error when the program tokens cannot be evaluated regardless of the
+// values bound to its symbols, because a symbol is used both as the series label of TREND,
+// TRENDNAN, MEDIAN, MAD, or PERCENT, and as the operand of another operator, or because the label
+// operand of TREND or TRENDNAN is a number computed by another operator rather than a symbol. A
+// symbol before MEDIAN, MAD, or PERCENT is only known to be a label when no values are below it on
+// the stack, since it may otherwise be the count of values they consume. A symbol may be used both
+// ways by the two branches of IF, which are never both evaluated. It describes where in the source
+// each operator was found when given sources. Checking stops at the first operator whose stack
+// effect depends on the values of its operands, such as COPY or SORT.
+func checkStackTypes(tokens []interface{}, sources []SourceRange) error {
+	at := func(idx int) string {
+		if sources == nil {
+			return ""
+		}
+		return fmt.Sprintf(" at offset %d", sources[idx].Start)
+	}
+
+	// merge returns the uses of both a and b, checking that they agree when check is true
+	merge := func(a, b map[string]symbolUse, check bool) (map[string]symbolUse, error) {
+		if len(a) == 0 {
+			return b, nil
+		}
+		merged := make(map[string]symbolUse, len(a)+len(b))
+		for symbol, use := range a {
+			merged[symbol] = use
+		}
+		for symbol, use := range b {
+			other, ok := merged[symbol]
+			if !ok {
+				merged[symbol] = use
+				continue
+			}
+			if check {
+				label, operand := other.label, use.operand
+				if label < 0 || operand < 0 {
+					label, operand = use.label, other.operand
+				}
+				if label >= 0 && operand >= 0 {
+					return nil, newErrSyntax("cannot use %q as operand of %s operator%s and as series label of %s operator%s", symbol, tokens[operand], at(operand), tokens[label], at(label))
+				}
+			}
+			merged[symbol] = symbolUse{label: firstIndex(other.label, use.label), operand: firstIndex(other.operand, use.operand)}
+		}
+		return merged, nil
+	}
+
+	// operand returns the uses of item once it is consumed as a number by the operator at idx
+	operand := func(item stackType, idx int) map[string]symbolUse {
+		if item.symbol == "" {
+			return item.uses
+		}
+		return map[string]symbolUse{item.symbol: {label: -1, operand: idx}}
+	}
+
+	var stack []stackType
+	for idx, tok := range tokens {
+		token, ok := tok.(string)
+		if !ok {
+			stack = append(stack, stackType{})
+			continue
+		}
+		opArity, isOperator := arity[token]
+		if !isOperator {
+			if reserved[token] {
+				stack = append(stack, stackType{operator: token})
+			} else {
+				stack = append(stack, stackType{symbol: token})
+			}
+			continue
+		}
+		var err error
+		switch {
+		case token == "DUP" && len(stack) > 0:
+			stack = append(stack, stack[len(stack)-1])
+		case token == "EXC" && len(stack) > 1:
+			stack[len(stack)-1], stack[len(stack)-2] = stack[len(stack)-2], stack[len(stack)-1]
+		case token == "POP" && len(stack) > 0:
+			stack = stack[:len(stack)-1]
+		case token == "INDEX" && idx > 0 && len(stack) > 0 && stack[len(stack)-1].operator == "" && stack[len(stack)-1].symbol == "":
+			n, ok := tokens[idx-1].(float64)
+			if !ok || n < 1 || int(n) > len(stack)-1 || n != float64(int(n)) {
+				return nil
+			}
+			stack[len(stack)-1] = stack[len(stack)-1-int(n)]
+		case (token == "TREND" || token == "TRENDNAN") && len(stack) > 1: // label,count,TREND
+			label, count := stack[len(stack)-2], stack[len(stack)-1]
+			if label.symbol == "" {
+				if label.operator != "" {
+					return newErrSyntax("cannot use result of %s operator as series label of %s operator%s", label.operator, token, at(idx))
+				}
+				return nil // simplify reports numbers given as labels
+			}
+			result := stackType{operator: token}
+			result.uses, err = merge(map[string]symbolUse{label.symbol: {label: idx, operand: -1}}, operand(count, idx), true)
+			if err != nil {
+				return err
+			}
+			stack = append(stack[:len(stack)-2], result)
+		case (token == "MEDIAN" || token == "MAD") && len(stack) == 1 && stack[0].symbol != "": // label,MEDIAN
+			// with no values below it, the symbol cannot be a count of values
+			result := stackType{operator: token, uses: map[string]symbolUse{stack[0].symbol: {label: idx, operand: -1}}}
+			stack = append(stack[:0], result)
+		case token == "PERCENT" && len(stack) == 2 && stack[1].symbol != "": // n,label,PERCENT
+			result := stackType{operator: token}
+			result.uses, err = merge(map[string]symbolUse{stack[1].symbol: {label: idx, operand: -1}}, operand(stack[0], idx), true)
+			if err != nil {
+				return err
+			}
+			stack = append(stack[:0], result)
+		case token == "IF" && len(stack) > 2: // A,B,C,IF ==> A ? B : C
+			condition := operand(stack[len(stack)-3], idx)
+			then, err := merge(condition, operand(stack[len(stack)-2], idx), true)
+			if err != nil {
+				return err
+			}
+			otherwise, err := merge(condition, operand(stack[len(stack)-1], idx), true)
+			if err != nil {
+				return err
+			}
+			result := stackType{operator: token}
+			result.uses, _ = merge(then, otherwise, false) // never both evaluated
+			stack = append(stack[:len(stack)-3], result)
+		case treeOperators[token] && len(stack) >= opArity.popCount:
+			result := stackType{operator: token}
+			for _, item := range stack[len(stack)-opArity.popCount:] {
+				if result.uses, err = merge(result.uses, operand(item, idx), true); err != nil {
+					return err
+				}
+			}
+			stack = append(stack[:len(stack)-opArity.popCount], result)
+		default:
+			return nil // stack effect depends on the values of operands
+		}
+	}
+	return nil
+}
+
+// firstIndex returns the lesser of indexes a and b that is not -1, or -1 when both are.
+func firstIndex(a, b int) int {
+	if a < 0 || (b >= 0 && b < a) {
+		return b
+	}
+	return a
+}
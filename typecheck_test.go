@@ -0,0 +1,52 @@
+package gorpn
+
+import "testing"
+
+func TestCheckStackTypes(t *testing.T) {
+	list := []string{
+		"qps,600,TREND",
+		"qps,600,TREND,limit,MIN",
+		"qps,600,TREND,qps,600,TREND,+",
+		"cond,qps,600,TREND,qps,IF", // branches of IF are never both evaluated
+		"qps,600,TREND,errors,600,TRENDNAN,/",
+		"qps,n,COPY,+,qps,600,TREND",  // not checked beyond COPY
+		"qps,600,TREND,a,2,INDEX,+,*", // copies the result of TREND
+		"qps,MEDIAN,qps,MAD,/",
+		"a,b,n,MEDIAN,n,/", // n is a count of values
+		"95,qps,PERCENT,limit,GT",
+	}
+	for _, input := range list {
+		if _, err := New(input, SecondsPerInterval(300)); err != nil {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+	}
+}
+
+func TestCheckStackTypesErrors(t *testing.T) {
+	list := map[string]string{
+		"qps,600,TREND,qps,+":             "syntax error : cannot use \"qps\" as operand of + operator at offset 18 and as series label of TREND operator at offset 8",
+		"qps,1,+,qps,600,TREND,*":         "syntax error : cannot use \"qps\" as operand of + operator at offset 6 and as series label of TREND operator at offset 16",
+		"qps,qps,TREND":                   "syntax error : cannot use \"qps\" as operand of TREND operator at offset 8 and as series label of TREND operator at offset 8",
+		"cond,qps,600,TREND,qps,IF,qps,-": "syntax error : cannot use \"qps\" as operand of - operator at offset 30 and as series label of TREND operator at offset 13",
+		"qps,qps,600,TREND,1,IF":          "syntax error : cannot use \"qps\" as operand of IF operator at offset 20 and as series label of TREND operator at offset 12",
+		"qps,600,TREND,DUP,qps,*":         "syntax error : cannot use \"qps\" as operand of * operator at offset 22 and as series label of TREND operator at offset 8",
+		"a,b,+,600,TREND":                 "syntax error : cannot use result of + operator as series label of TREND operator at offset 10",
+		"NOW,600,TRENDNAN":                "syntax error : cannot use result of NOW operator as series label of TRENDNAN operator at offset 8",
+		"qps,MEDIAN,qps,+":                "syntax error : cannot use \"qps\" as operand of + operator at offset 15 and as series label of MEDIAN operator at offset 4",
+		"qps,MAD,qps,*":                   "syntax error : cannot use \"qps\" as operand of * operator at offset 12 and as series label of MAD operator at offset 4",
+		"95,qps,PERCENT,qps,*":            "syntax error : cannot use \"qps\" as operand of * operator at offset 19 and as series label of PERCENT operator at offset 7",
+	}
+	for input, expected := range list {
+		_, err := New(input, SecondsPerInterval(300))
+		if err == nil || err.Error() != expected {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, err, expected)
+		}
+	}
+}
+
+func TestCheckStackTypesNoSimplify(t *testing.T) {
+	_, err := New("qps,600,TREND,qps,+", SecondsPerInterval(300), NoSimplify())
+	if expected := "syntax error : cannot use \"qps\" as operand of + operator at offset 18 and as series label of TREND operator at offset 8"; err == nil || err.Error() != expected {
+		t.Errorf("Actual: %#v; Expected: %#v", err, expected)
+	}
+}
@@ -0,0 +1,285 @@
+package gorpn
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Quantity is a number along with its unit, such as 1500 bytes/seconds. A unit is written as the
+// product of named units, each optionally raised to an integer power, divided by other named
+// units, such as "bytes", "bytes/seconds", "requests*seconds^-1", or "1/seconds". The empty unit
+// denotes a dimensionless number. Named units are never converted into one another, so bits and
+// bytes are different units.
+type Quantity struct {
+	Value float64
+	Unit  string
+}
+
+// ErrUnits error is returned by EvaluateUnits when the units of the operands of an operator are not
+// compatible, such as when adding bytes to bits.
+type ErrUnits struct {
+	Operator string   // the operator whose operands have incompatible units
+	Units    []string // the units of its operands
+}
+
+// Error returns the error string representation for ErrUnits errors.
+func (e ErrUnits) Error() string {
+	units := make([]string, len(e.Units))
+	for i, unit := range e.Units {
+		units[i] = strconv.Quote(unit)
+	}
+	return fmt.Sprintf("incompatible units for %s operator: %s", e.Operator, strings.Join(units, ", "))
+}
+
+// unit is the unit of a value, as the power of each named unit it is composed of. Numbers written
+// in an Expression are free, adopting whatever unit the operation that uses them requires, so
+// that bytes,8,* is in bytes, and rate,0,MAX has the unit of rate.
+type unit struct {
+	powers map[string]int
+	free   bool
+}
+
+var dimensionless = unit{}
+
+// EvaluateUnits evaluates the Expression just like Evaluate, and also derives the unit of its
+// result from the units of the quantities bound to its symbols, returning an ErrUnits error when
+// the Expression combines quantities whose units are not compatible. This catches mistakes such as
+// adding bytes to bits, which would otherwise silently produce a meaningless number.
+//
+// Operands of +, -, %, MIN, MAX, comparisons, and the branches of IF must have the same unit, while
+// * and / multiply and divide their units. Operands of EXP, LOG, trigonometric functions, and
+// other operators that only make sense for plain numbers must be dimensionless. A number may only
+// be raised to a power written as a number in the Expression, and only the square root of a unit
+// whose powers are all even may be taken. Numbers written in the Expression adopt whatever unit is
+// required of them. Converting between units is done by binding a conversion factor, such as 8
+// bits/bytes. Only the operators that compute a single value from a fixed number of operands are
+// supported.
+//
+//	func example() {
+//		exp, err := gorpn.New("transferred,elapsed,/,bits_per_byte,*")
+//		if err != nil {
+//			panic(err)
+//		}
+//		rate, err := exp.EvaluateUnits(map[string]gorpn.Quantity{
+//			"transferred":   {Value: 1500, Unit: "bytes"},
+//			"elapsed":       {Value: 3, Unit: "seconds"},
+//			"bits_per_byte": {Value: 8, Unit: "bits/bytes"},
+//		})
+//		// rate is {Value: 4000, Unit: "bits/seconds"}
+//	}
+func (e *Expression) EvaluateUnits(bindings map[string]Quantity) (Quantity, error) {
+	units := make(map[string]unit, len(bindings))
+	values := make(map[string]interface{}, len(bindings))
+	for symbol, quantity := range bindings {
+		u, err := parseUnit(quantity.Unit)
+		if err != nil {
+			return Quantity{}, err
+		}
+		units[symbol] = u
+		values[symbol] = quantity.Value
+	}
+	value, err := e.Evaluate(values)
+	if err != nil {
+		return Quantity{}, err
+	}
+	root, err := expressionTree(e.tokens, "track units of")
+	if err != nil {
+		return Quantity{}, err
+	}
+	u, err := deriveUnit(root, units)
+	if err != nil {
+		return Quantity{}, err
+	}
+	return Quantity{Value: value, Unit: u.String()}, nil
+}
+
+// parseUnit returns the unit written as s.
+func parseUnit(s string) (unit, error) {
+	u := unit{powers: make(map[string]int)}
+	if s == "" {
+		return u, nil
+	}
+	for i, factor := range strings.Split(s, "/") {
+		sign := 1
+		if i > 0 {
+			sign = -1 // every factor after the first is a divisor
+		}
+		for _, term := range strings.Split(factor, "*") {
+			name, power := strings.TrimSpace(term), 1
+			if caret := strings.IndexByte(name, '^'); caret >= 0 {
+				var err error
+				if power, err = strconv.Atoi(name[caret+1:]); err != nil {
+					return unit{}, newErrSyntax("invalid power in unit %q: %q", s, term)
+				}
+				name = strings.TrimSpace(name[:caret])
+			}
+			if name == "1" && power == 1 {
+				continue // as in 1/seconds
+			}
+			if name == "" {
+				return unit{}, newErrSyntax("invalid unit %q", s)
+			}
+			if _, ok := parseNumber(name); ok {
+				return unit{}, newErrSyntax("cannot use number as unit in %q: %q", s, name)
+			}
+			u.powers[name] += sign * power
+			if u.powers[name] == 0 {
+				delete(u.powers, name)
+			}
+		}
+	}
+	return u, nil
+}
+
+// String returns the canonical representation of the unit, which names the units that are
+// multiplied in lexicographical order, followed by those that are divided, such as
+// "bytes*requests/seconds^2".
+func (u unit) String() string {
+	names := make([]string, 0, len(u.powers))
+	for name := range u.powers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var numerator, denominator []string
+	for _, name := range names {
+		power := u.powers[name]
+		term := name
+		if power > 1 || power < -1 {
+			term += "^" + strconv.Itoa(int(math.Abs(float64(power))))
+		}
+		if power > 0 {
+			numerator = append(numerator, term)
+		} else {
+			denominator = append(denominator, term)
+		}
+	}
+	s := strings.Join(numerator, "*")
+	if len(denominator) > 0 {
+		if s == "" {
+			s = "1"
+		}
+		s += "/" + strings.Join(denominator, "/")
+	}
+	return s
+}
+
+func (u unit) equal(other unit) bool {
+	if len(u.powers) != len(other.powers) {
+		return false
+	}
+	for name, power := range u.powers {
+		if other.powers[name] != power {
+			return false
+		}
+	}
+	return true
+}
+
+func (u unit) isDimensionless() bool {
+	return u.free || len(u.powers) == 0
+}
+
+// product returns the unit of the product of values with units u and other raised to power.
+func (u unit) product(other unit, power int) unit {
+	result := unit{powers: make(map[string]int, len(u.powers)+len(other.powers)), free: u.free && other.free}
+	for name, p := range u.powers {
+		result.powers[name] = p
+	}
+	for name, p := range other.powers {
+		result.powers[name] += p * power
+		if result.powers[name] == 0 {
+			delete(result.powers, name)
+		}
+	}
+	return result
+}
+
+// deriveUnit returns the unit of the values computed by the tree n.
+func deriveUnit(n *node, units map[string]unit) (unit, error) {
+	if !n.isOperator() {
+		if _, ok := n.token.(float64); ok {
+			return unit{free: true}, nil
+		}
+		return units[n.token.(string)], nil
+	}
+
+	operands := make([]unit, len(n.children))
+	for i, child := range n.children {
+		operand, err := deriveUnit(child, units)
+		if err != nil {
+			return unit{}, err
+		}
+		operands[i] = operand
+	}
+	operator := n.token.(string)
+	mismatch := func(operands ...unit) error {
+		err := ErrUnits{Operator: operator}
+		for _, operand := range operands {
+			err.Units = append(err.Units, operand.String())
+		}
+		return err
+	}
+	// same returns the unit shared by operands, a free unit adopting the unit of the others
+	same := func(operands ...unit) (unit, error) {
+		result := unit{free: true}
+		for _, operand := range operands {
+			if result.free {
+				result = operand
+			} else if !operand.free && !operand.equal(result) {
+				return unit{}, mismatch(operands...)
+			}
+		}
+		return result, nil
+	}
+
+	switch operator {
+	case "+", "-", "%", "ADDNAN", "LIMIT", "MAX", "MAXNAN", "MIN", "MINNAN":
+		return same(operands...)
+	case "ABS", "CEIL", "FLOOR", "TREND", "TRENDNAN":
+		return operands[0], nil
+	case "*":
+		return operands[0].product(operands[1], 1), nil
+	case "/":
+		return operands[0].product(operands[1], -1), nil
+	case "ATAN2", "EQ", "GE", "GT", "LE", "LT", "NE":
+		if _, err := same(operands...); err != nil {
+			return unit{}, err
+		}
+		return dimensionless, nil
+	case "IF":
+		return same(operands[1:]...)
+	case "ISINF", "UN":
+		return dimensionless, nil
+	case "POW":
+		if !operands[1].isDimensionless() {
+			return unit{}, mismatch(operands...)
+		}
+		if operands[0].isDimensionless() {
+			return operands[0], nil
+		}
+		power, ok := n.children[1].token.(float64)
+		if !ok || n.children[1].isOperator() || power != math.Trunc(power) || math.Abs(power) > math.MaxInt32 {
+			return unit{}, mismatch(operands...)
+		}
+		return dimensionless.product(operands[0], int(power)), nil
+	case "SQRT":
+		result := unit{powers: make(map[string]int, len(operands[0].powers)), free: operands[0].free}
+		for name, power := range operands[0].powers {
+			if power%2 != 0 {
+				return unit{}, mismatch(operands...)
+			}
+			result.powers[name] = power / 2
+		}
+		return result, nil
+	}
+	// remaining operators only make sense for plain numbers
+	for _, operand := range operands {
+		if !operand.isDimensionless() {
+			return unit{}, mismatch(operands...)
+		}
+	}
+	return dimensionless, nil
+}
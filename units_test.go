@@ -0,0 +1,97 @@
+package gorpn
+
+import "testing"
+
+func TestEvaluateUnits(t *testing.T) {
+	bindings := map[string]Quantity{
+		"transferred":   {Value: 1500, Unit: "bytes"},
+		"received":      {Value: 500, Unit: "bytes"},
+		"capacity":      {Value: 8000, Unit: "bits"},
+		"elapsed":       {Value: 3, Unit: "seconds"},
+		"bits_per_byte": {Value: 8, Unit: "bits / bytes"},
+		"requests":      {Value: 300, Unit: "requests"},
+		"area":          {Value: 16, Unit: "meters^2"},
+		"ratio":         {Value: 0.5, Unit: ""},
+		"hertz":         {Value: 2, Unit: "1/seconds"},
+	}
+	list := map[string]Quantity{
+		"transferred":                                  {1500, "bytes"},
+		"transferred,received,+":                       {2000, "bytes"},
+		"transferred,8,*":                              {12000, "bytes"},
+		"transferred,elapsed,/":                        {500, "bytes/seconds"},
+		"transferred,elapsed,/,bits_per_byte,*":        {4000, "bits/seconds"},
+		"transferred,bits_per_byte,*,capacity,/":       {1.5, ""},
+		"requests,elapsed,/,elapsed,/":                 {100.0 / 3, "requests/seconds^2"},
+		"transferred,requests,*,elapsed,/":             {150000, "bytes*requests/seconds"},
+		"1,elapsed,/":                                  {1.0 / 3, "1/seconds"},
+		"hertz,elapsed,*":                              {6, ""},
+		"area,SQRT":                                    {4, "meters"},
+		"elapsed,2,POW":                                {9, "seconds^2"},
+		"elapsed,-1,POW":                               {1.0 / 3, "1/seconds"},
+		"transferred,received,GT,transferred,0,IF":     {1500, "bytes"},
+		"transferred,0,MAX,received,MIN":               {500, "bytes"},
+		"ratio,EXP,LOG":                                {0.5, ""},
+		"transferred,received,-,ABS":                   {1000, "bytes"},
+		"transferred,received,EQ,capacity,capacity,IF": {8000, "bits"},
+		"60,24,*": {1440, ""},
+	}
+	for input, expected := range list {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		actual, err := exp.EvaluateUnits(bindings)
+		if err != nil {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+			continue
+		}
+		if actual != expected {
+			t.Errorf("Case: %s; Actual: %#v; Expected: %#v", input, actual, expected)
+		}
+	}
+}
+
+func TestEvaluateUnitsErrors(t *testing.T) {
+	bindings := map[string]Quantity{
+		"transferred": {Value: 1500, Unit: "bytes"},
+		"capacity":    {Value: 8000, Unit: "bits"},
+		"elapsed":     {Value: 3, Unit: "seconds"},
+		"ratio":       {Value: 0.5, Unit: ""},
+	}
+	errors := map[string]string{
+		"transferred,capacity,+":             "incompatible units for + operator: \"bytes\", \"bits\"",
+		"transferred,capacity,GT":            "incompatible units for GT operator: \"bytes\", \"bits\"",
+		"ratio,transferred,capacity,IF":      "incompatible units for IF operator: \"bytes\", \"bits\"",
+		"transferred,EXP":                    "incompatible units for EXP operator: \"bytes\"",
+		"transferred,SQRT":                   "incompatible units for SQRT operator: \"bytes\"",
+		"transferred,ratio,POW":              "incompatible units for POW operator: \"bytes\", \"\"",
+		"2,elapsed,POW":                      "incompatible units for POW operator: \"\", \"seconds\"",
+		"transferred,elapsed,/,capacity,MAX": "incompatible units for MAX operator: \"bytes/seconds\", \"bits\"",
+		"transferred,missing,+":              "open bindings: missing",
+		"transferred,2,2,SORT,+":             "syntax error : cannot track units of SORT operator",
+	}
+	for input, expected := range errors {
+		exp, err := New(input)
+		if err != nil {
+			t.Fatalf("Case: %s; Actual: %#v; Expected: %#v", input, err, nil)
+		}
+		if _, err = exp.EvaluateUnits(bindings); err == nil || err.Error() != expected {
+			t.Errorf("Case: %s; Actual: %v; Expected: %#v", input, err, expected)
+		}
+	}
+
+	units := map[string]string{
+		"bytes/":    "syntax error : invalid unit \"bytes/\"",
+		"bytes^two": "syntax error : invalid power in unit \"bytes^two\": \"bytes^two\"",
+		"8*bits":    "syntax error : cannot use number as unit in \"8*bits\": \"8\"",
+	}
+	exp, err := New("x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for unit, expected := range units {
+		if _, err = exp.EvaluateUnits(map[string]Quantity{"x": {Value: 1, Unit: unit}}); err == nil || err.Error() != expected {
+			t.Errorf("Case: %s; Actual: %v; Expected: %#v", unit, err, expected)
+		}
+	}
+}